@@ -0,0 +1,119 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// adminSocketPrefix marks an admin_listen address naming a Unix socket, as
+// in unix:/run/caddy/search.sock
+const adminSocketPrefix = "unix:"
+
+// adminSocketMode is the permissions of the admin listener's Unix socket:
+// only its owner and group may connect
+const adminSocketMode = 0660
+
+// parseAdminListen checks an admin_listen address and returns the network
+// and address to listen on
+func parseAdminListen(addr string) (network, address string, err error) {
+	if strings.HasPrefix(addr, adminSocketPrefix) {
+		if address = strings.TrimPrefix(addr, adminSocketPrefix); address == "" {
+			return "", "", fmt.Errorf("missing socket path")
+		}
+		return "unix", address, nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", err
+	}
+	return "tcp", addr, nil
+}
+
+// listenAdmin opens the admin listener. A socket left behind by a process
+// that did not shut down cleanly is replaced.
+func listenAdmin(addr string) (net.Listener, error) {
+	network, address, err := parseAdminListen(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if err := os.Chmod(address, adminSocketMode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// ServeAdmin serves the administrative endpoints on the admin listener
+// until the returned func closes it
+func (s *Search) ServeAdmin(ln net.Listener) (close func() error) {
+	server := &http.Server{Handler: s.AdminHandler()}
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("[search] admin listener: %v", err)
+		}
+	}()
+
+	var once sync.Once
+	return func() (err error) {
+		once.Do(func() { err = server.Close() })
+		return err
+	}
+}
+
+// AdminHandler answers the administrative endpoints (push, push_bulk,
+// export, inspect, crawl_state and analytics) and nothing else, as on the
+// admin listener. Like Caddy, it writes the status text of the errors the
+// endpoints return.
+func (s *Search) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, err := http.StatusNotFound, error(nil)
+		if endpoint := s.adminEndpoint(r); endpoint != nil {
+			status, err = endpoint(w, r)
+		}
+		if err != nil {
+			log.Printf("[search] %s %s: %v", r.Method, r.URL.Path, err)
+		}
+		if status >= 400 {
+			http.Error(w, http.StatusText(status), status)
+		}
+	})
+}
+
+// adminEndpoint returns the handler of the administrative endpoint the
+// request is for, or nil
+func (s *Search) adminEndpoint(r *http.Request) func(http.ResponseWriter, *http.Request) (int, error) {
+	path := httpserver.Path(r.URL.Path)
+	switch {
+	case s.Config.PushBulkEndpoint != "" && path.Matches(s.Config.PushBulkEndpoint):
+		return s.PushBulk
+	case s.Config.PushEndpoint != "" && path.Matches(s.Config.PushEndpoint):
+		return s.Push
+	case s.Config.ExportEndpoint != "" && path.Matches(s.Config.ExportEndpoint):
+		return s.IndexArchive
+	case s.Config.InspectEndpoint != "" && path.Matches(s.Config.InspectEndpoint):
+		return s.Inspect
+	case s.Crawler != nil && s.Config.CrawlStateEndpoint != "" && path.Matches(s.Config.CrawlStateEndpoint):
+		return s.CrawlStateReport
+	case s.Config.AnalyticsEndpoint != "" && path.Matches(s.Config.AnalyticsEndpoint):
+		return s.AnalyticsReport
+	}
+	return nil
+}
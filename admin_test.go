@@ -0,0 +1,90 @@
+package search_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAdminListener(t *testing.T) {
+	Convey("Given a search middleware with an admin listener", t, func() {
+		config := &search.Config{
+			Endpoint:     "/search",
+			PushEndpoint: "/search/push",
+			PushMaxSize:  256,
+			Token:        "secret",
+			AdminListen:  "unix:/run/search.sock",
+		}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		s := search.NewSearch(config, capture, pipeline)
+
+		push := func() *http.Request {
+			req := httptest.NewRequest("POST", "/search/push", strings.NewReader(`{"path": "/a", "body": "text", "content_type": "text/plain"}`))
+			req.Header.Set("Authorization", "Bearer secret")
+			return req
+		}
+
+		Convey("Should leave the administrative endpoints off the site's listener", func() {
+			status, _ := s.ServeHTTP(httptest.NewRecorder(), push())
+			So(status, ShouldNotEqual, http.StatusAccepted)
+			So(capture.next(), ShouldBeNil)
+		})
+
+		Convey("Should serve them on the admin listener, still behind the token", func() {
+			w := httptest.NewRecorder()
+			s.AdminHandler().ServeHTTP(w, push())
+			So(w.Code, ShouldEqual, http.StatusAccepted)
+			So(capture.next(), ShouldNotBeNil)
+
+			w = httptest.NewRecorder()
+			s.AdminHandler().ServeHTTP(w, httptest.NewRequest("POST", "/search/push", strings.NewReader("{}")))
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			So(w.Body.String(), ShouldContainSubstring, "Unauthorized")
+		})
+
+		Convey("Should serve nothing else on the admin listener", func() {
+			w := httptest.NewRecorder()
+			s.AdminHandler().ServeHTTP(w, httptest.NewRequest("GET", "/search?q=text", nil))
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("Should answer over a Unix socket", func() {
+			dir, err := ioutil.TempDir("", "caddySearchAdmin")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			socket := filepath.Join(dir, "search.sock")
+			ln, err := net.Listen("unix", socket)
+			So(err, ShouldBeNil)
+			closeAdmin := s.ServeAdmin(ln)
+			defer closeAdmin()
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			}}
+			req, _ := http.NewRequest("POST", "http://search/search/push", strings.NewReader(`{"path": "/a", "body": "text", "content_type": "text/plain"}`))
+			req.Header.Set("Authorization", "Bearer secret")
+			resp, err := client.Do(req)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusAccepted)
+
+			So(closeAdmin(), ShouldBeNil)
+			_, err = client.Do(req)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,209 @@
+package search
+
+import (
+	"container/heap"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAnalyticsQueries bounds the number of distinct queries counted; the
+	// least searched one makes room for a new one
+	maxAnalyticsQueries = 10000
+	// analyticsSummarySize is the default length of the summary's lists
+	analyticsSummarySize = 20
+)
+
+// Analytics counts what users search for and which searches find nothing.
+// Each search can also be logged as a line of JSON.
+type Analytics struct {
+	mutex   sync.Mutex
+	since   time.Time
+	queries map[string]*queryEntry
+	// least orders the queries by their searches, to evict the least searched
+	least queryHeap
+	log   io.Writer
+}
+
+// QueryCount is the number of times a query was searched and found nothing
+type QueryCount struct {
+	Query       string `json:"query"`
+	Searches    int    `json:"searches"`
+	ZeroResults int    `json:"zero_results"`
+}
+
+// queryEntry is a counted query and its position in the heap
+type queryEntry struct {
+	QueryCount
+	index int
+}
+
+// AnalyticsSummary lists the most searched queries and the most searched of
+// those that found nothing
+type AnalyticsSummary struct {
+	Since       time.Time    `json:"since"`
+	Queries     int          `json:"queries"`
+	Top         []QueryCount `json:"top"`
+	ZeroResults []QueryCount `json:"zero_results"`
+}
+
+// analyticsEvent is the line logged for a search
+type analyticsEvent struct {
+	Time    time.Time `json:"time"`
+	Query   string    `json:"query"`
+	Scope   string    `json:"scope,omitempty"`
+	Results int       `json:"results"`
+}
+
+// NewAnalytics creates an Analytics logging each search to log, if not nil
+func NewAnalytics(log io.Writer) *Analytics {
+	return &Analytics{
+		since:   time.Now(),
+		queries: make(map[string]*queryEntry),
+		log:     log,
+	}
+}
+
+// analyticsTerms normalizes a query for counting, so searches differing only
+// in case or spacing count as the same
+func analyticsTerms(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// Record counts a search for text in scope that found the given number of
+// results
+func (a *Analytics) Record(text, scope string, results int, at time.Time) {
+	terms := analyticsTerms(text)
+	if terms == "" {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	count, ok := a.queries[terms]
+	if !ok {
+		if len(a.queries) >= maxAnalyticsQueries {
+			a.evict()
+		}
+		count = &queryEntry{QueryCount: QueryCount{Query: terms}}
+		a.queries[terms] = count
+		heap.Push(&a.least, count)
+	}
+	count.Searches++
+	heap.Fix(&a.least, count.index)
+	if results == 0 {
+		count.ZeroResults++
+	}
+
+	if a.log != nil {
+		line, err := json.Marshal(analyticsEvent{at, terms, scope, results})
+		if err == nil {
+			a.log.Write(append(line, '\n'))
+		}
+	}
+}
+
+// evict forgets the least searched query
+func (a *Analytics) evict() {
+	least := heap.Pop(&a.least).(*queryEntry)
+	delete(a.queries, least.Query)
+}
+
+// queryHeap is a min-heap of counted queries by searches
+type queryHeap []*queryEntry
+
+func (h queryHeap) Len() int           { return len(h) }
+func (h queryHeap) Less(i, j int) bool { return h[i].Searches < h[j].Searches }
+
+func (h queryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *queryHeap) Push(x interface{}) {
+	count := x.(*queryEntry)
+	count.index = len(*h)
+	*h = append(*h, count)
+}
+
+func (h *queryHeap) Pop() interface{} {
+	old := *h
+	count := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return count
+}
+
+// Summary returns up to limit of the most searched queries and of the most
+// searched queries that found nothing
+func (a *Analytics) Summary(limit int) AnalyticsSummary {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	top := make([]QueryCount, 0, len(a.queries))
+	zero := []QueryCount{}
+	for _, count := range a.queries {
+		top = append(top, count.QueryCount)
+		if count.ZeroResults > 0 {
+			zero = append(zero, count.QueryCount)
+		}
+	}
+
+	sortCounts(top, func(c QueryCount) int { return c.Searches })
+	sortCounts(zero, func(c QueryCount) int { return c.ZeroResults })
+
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	if len(zero) > limit {
+		zero = zero[:limit]
+	}
+
+	return AnalyticsSummary{
+		Since:       a.since,
+		Queries:     len(a.queries),
+		Top:         top,
+		ZeroResults: zero,
+	}
+}
+
+// sortCounts orders counts by decreasing key, then alphabetically
+func sortCounts(counts []QueryCount, key func(QueryCount) int) {
+	sort.Slice(counts, func(i, j int) bool {
+		if key(counts[i]) != key(counts[j]) {
+			return key(counts[i]) > key(counts[j])
+		}
+		return counts[i].Query < counts[j].Query
+	})
+}
+
+// AnalyticsReport renders the analytics summary in JSON format to an
+// authenticated client. The limit parameter sets the length of its lists.
+func (s *Search) AnalyticsReport(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !s.authorized(r) {
+		return http.StatusUnauthorized, nil
+	}
+
+	limit := analyticsSummarySize
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+
+	jresp, err := json.Marshal(s.Analytics.Summary(limit))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(jresp)
+	return http.StatusOK, nil
+}
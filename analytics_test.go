@@ -0,0 +1,84 @@
+package search_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAnalytics(t *testing.T) {
+	Convey("Given a search collecting analytics", t, func() {
+		s, cleanup := newTestSearch(&search.Config{AnalyticsEndpoint: "/search/analytics", Token: "secret"})
+		defer cleanup()
+		indexFixture(s, "install.html")
+
+		var log bytes.Buffer
+		s.Analytics = search.NewAnalytics(&log)
+
+		searchJSON(s, "install")
+		searchJSON(s, "  Install ")
+		searchJSON(s, "uninstallable")
+		searchJSONParams(s, url.Values{"q": {"nothing here"}, "scope": {"/docs/"}})
+
+		report := func(token string) (int, search.AnalyticsSummary) {
+			req := httptest.NewRequest("GET", "/search/analytics?limit=1", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+
+			var summary search.AnalyticsSummary
+			if status == 200 {
+				So(json.Unmarshal(w.Body.Bytes(), &summary), ShouldBeNil)
+			}
+			return status, summary
+		}
+
+		Convey("Should summarize the top and zero-result queries", func() {
+			status, summary := report("secret")
+			So(status, ShouldEqual, 200)
+			So(summary.Queries, ShouldEqual, 3)
+			So(summary.Top, ShouldResemble, []search.QueryCount{{Query: "install", Searches: 2}})
+			So(summary.ZeroResults, ShouldResemble, []search.QueryCount{{Query: "nothing here", Searches: 1, ZeroResults: 1}})
+		})
+
+		Convey("Should require the token", func() {
+			status, _ := report("wrong")
+			So(status, ShouldEqual, 401)
+		})
+
+		Convey("Should log each search as a line of JSON", func() {
+			lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+			So(lines, ShouldHaveLength, 4)
+
+			var event struct {
+				Time    time.Time
+				Query   string
+				Scope   string
+				Results int
+			}
+			So(json.Unmarshal([]byte(lines[3]), &event), ShouldBeNil)
+			So(event.Query, ShouldEqual, "nothing here")
+			So(event.Scope, ShouldEqual, "/docs/")
+			So(event.Results, ShouldEqual, 0)
+			So(event.Time.IsZero(), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a search without analytics", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+
+		Convey("Should not collect any", func() {
+			searchJSON(s, "install")
+			So(s.Analytics, ShouldBeNil)
+		})
+	})
+}
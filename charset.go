@@ -0,0 +1,41 @@
+package search
+
+import (
+	"bytes"
+	"mime"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+var (
+	utf8BOM     = []byte("\xef\xbb\xbf")
+	replacement = []byte("�")
+)
+
+// decodeBody returns a page's body transcoded to UTF-8 and without a byte
+// order mark. The encoding is taken from the BOM, the charset of the
+// Content-Type or a <meta charset> tag, in that order; undeclared bodies that
+// are valid UTF-8 are kept as they are, others are sniffed. A charset that is
+// declared but unknown is read as UTF-8, replacing invalid sequences.
+func decodeBody(body []byte, contentType string) []byte {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err == nil && params["charset"] != "" {
+		if enc, _ := charset.Lookup(params["charset"]); enc == nil {
+			return bytes.ToValidUTF8(bytes.TrimPrefix(body, utf8BOM), replacement)
+		}
+	} else if utf8.Valid(body) {
+		return bytes.TrimPrefix(body, utf8BOM)
+	}
+
+	enc, name, _ := charset.DetermineEncoding(body, contentType)
+	if name == "utf-8" {
+		return bytes.ToValidUTF8(bytes.TrimPrefix(body, utf8BOM), replacement)
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return bytes.ToValidUTF8(body, replacement)
+	}
+	return bytes.TrimPrefix(decoded, utf8BOM)
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxClickCounts bounds the number of (term, page) pairs whose clicks are
+// counted; the least clicked one makes room for a new one
+const maxClickCounts = 10000
+
+// ClickCounts counts, for each query term, the clicks on each result page.
+// Counts decay with every half-life, so rankings follow changing interests.
+type ClickCounts struct {
+	mutex  sync.Mutex
+	counts *decayingCounts
+}
+
+// clickKey is a query term and a page clicked for it
+type clickKey struct {
+	term, path string
+}
+
+// NewClickCounts creates ClickCounts whose counts halve every halfLife
+func NewClickCounts(halfLife time.Duration) *ClickCounts {
+	return &ClickCounts{counts: newDecayingCounts(halfLife, maxClickCounts)}
+}
+
+// Record counts a click on the page at path among the results of query
+func (c *ClickCounts) Record(query, path string, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, term := range strings.Fields(analyticsTerms(query)) {
+		c.counts.add(clickKey{term, path}, now)
+	}
+}
+
+// Clicks returns the decayed clicks on the page at path for the terms of
+// query, averaged over the terms, so queries sharing terms share clicks
+func (c *ClickCounts) Clicks(query, path string, now time.Time) float64 {
+	terms := strings.Fields(analyticsTerms(query))
+	if len(terms) == 0 {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	total := 0.0
+	for _, term := range terms {
+		total += c.counts.get(clickKey{term, path}, now)
+	}
+	return total / float64(len(terms))
+}
+
+// clickBoost returns the score multiplier of a result clicked the given
+// number of times: 1 without clicks, growing logarithmically with them
+func clickBoost(clicks, weight float64) float64 {
+	return 1 + weight*math.Log1p(clicks)
+}
+
+// Click records that a user picked the result at the path parameter among
+// those of the query in q. Pages send it with navigator.sendBeacon or a
+// regular POST when a result is followed.
+func (s *Search) Click(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	if s.limited(w, r) {
+		return http.StatusTooManyRequests, nil
+	}
+
+	query, path := r.FormValue("q"), r.FormValue("path")
+	if analyticsTerms(query) == "" || !strings.HasPrefix(path, "/") || !s.Pipeline.ValidatePath(path) {
+		return http.StatusBadRequest, nil
+	}
+
+	s.Clicks.Record(normalizeText(query), path, time.Now())
+
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, nil
+}
@@ -0,0 +1,65 @@
+package search_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClickBoost(t *testing.T) {
+	Convey("Given a search learning from clicks", t, func() {
+		s, cleanup := newTestSearch(&search.Config{
+			ClickEndpoint: "/search/click",
+			ClickHalfLife: time.Hour,
+			ClickWeight:   10,
+		})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		click := func(q, path string) int {
+			form := url.Values{"q": {q}, "path": {path}}
+			req := httptest.NewRequest("POST", "/search/click", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			status, err := s.ServeHTTP(httptest.NewRecorder(), req)
+			So(err, ShouldBeNil)
+			return status
+		}
+
+		results := searchJSON(s, "install")
+		So(results, ShouldHaveLength, 2)
+		clicked := results[1].Path
+
+		Convey("Should rank often clicked results higher for queries sharing terms", func() {
+			So(click("install", clicked), ShouldEqual, 204)
+			So(click("Install guide", clicked), ShouldEqual, 204)
+
+			results := searchJSONParams(s, url.Values{"q": {"install"}, "debug": {"1"}})
+			So(results[0].Path, ShouldEqual, clicked)
+			So(results[0].Debug.ClickBoost, ShouldBeGreaterThan, 1)
+		})
+
+		Convey("Should reject clicks on pages outside the site", func() {
+			So(click("install", "https://elsewhere.example.com/"), ShouldEqual, 400)
+			So(click("", clicked), ShouldEqual, 400)
+		})
+	})
+
+	Convey("Given clicks recorded a while ago", t, func() {
+		clicks := search.NewClickCounts(time.Hour)
+		now := time.Now()
+		clicks.Record("install", "/install.html", now.Add(-2*time.Hour))
+		clicks.Record("install", "/install.html", now.Add(-2*time.Hour))
+
+		Convey("Should decay their count with every half-life", func() {
+			So(clicks.Clicks("install", "/install.html", now), ShouldAlmostEqual, 0.5)
+			So(clicks.Clicks("install guide", "/install.html", now), ShouldAlmostEqual, 0.25)
+			So(clicks.Clicks("install", "/other.html", now), ShouldEqual, 0)
+		})
+	})
+}
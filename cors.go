@@ -0,0 +1,63 @@
+package search
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// corsMethods are the methods cross-origin clients may use on the search API
+	corsMethods = "GET, OPTIONS"
+	// corsHeaders are the request headers cross-origin clients may send
+	corsHeaders = "Accept, Authorization"
+	// corsMaxAge is how long, in seconds, browsers may cache a preflight
+	corsMaxAge = "600"
+)
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request's
+// origin, or "" when the origin is not allowed
+func (s *Search) allowedOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+
+	for _, allowed := range s.Config.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+// cors sets the CORS headers on a search API response when the request comes
+// from an allowed origin. It reports whether the request is a preflight, in
+// which case the response is complete.
+func (s *Search) cors(w http.ResponseWriter, r *http.Request) bool {
+	if len(s.Config.AllowedOrigins) == 0 {
+		return false
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+
+	origin := s.allowedOrigin(r.Header.Get("Origin"))
+	if origin != "" {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+
+	if origin != "" {
+		header.Set("Access-Control-Allow-Methods", corsMethods)
+		header.Set("Access-Control-Allow-Headers", corsHeaders)
+		header.Set("Access-Control-Max-Age", corsMaxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
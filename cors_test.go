@@ -0,0 +1,70 @@
+package search_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCORS(t *testing.T) {
+	Convey("Given a search API", t, func() {
+		request := func(s *search.Search, method, origin string) (int, *httptest.ResponseRecorder) {
+			req := httptest.NewRequest(method, "/search?q=install", nil)
+			req.Header.Set("Accept", "application/json")
+			req.Header.Set("Origin", origin)
+			if method == "OPTIONS" {
+				req.Header.Set("Access-Control-Request-Method", "GET")
+			}
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			return status, w
+		}
+
+		Convey("Should not send CORS headers by default", func() {
+			s, cleanup := newTestSearch(&search.Config{})
+			defer cleanup()
+
+			_, w := request(s, "GET", "https://app.example.com")
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldBeEmpty)
+		})
+
+		Convey("Given allowed origins", func() {
+			s, cleanup := newTestSearch(&search.Config{AllowedOrigins: []string{"https://app.example.com"}})
+			defer cleanup()
+
+			Convey("Should allow requests from an allowed origin", func() {
+				status, w := request(s, "GET", "https://app.example.com")
+				So(status, ShouldEqual, 200)
+				So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://app.example.com")
+				So(w.Header().Get("Vary"), ShouldEqual, "Origin")
+			})
+
+			Convey("Should answer preflight requests", func() {
+				status, w := request(s, "OPTIONS", "https://app.example.com")
+				So(status, ShouldEqual, 204)
+				So(w.Code, ShouldEqual, 204)
+				So(w.Header().Get("Access-Control-Allow-Methods"), ShouldEqual, "GET, OPTIONS")
+				So(w.Header().Get("Access-Control-Allow-Headers"), ShouldContainSubstring, "Authorization")
+			})
+
+			Convey("Should not allow other origins", func() {
+				_, w := request(s, "GET", "https://evil.example.com")
+				So(w.Header().Get("Access-Control-Allow-Origin"), ShouldBeEmpty)
+
+				_, w = request(s, "OPTIONS", "https://evil.example.com")
+				So(w.Header().Get("Access-Control-Allow-Methods"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("Should allow any origin with a wildcard", func() {
+			s, cleanup := newTestSearch(&search.Config{AllowedOrigins: []string{"*"}})
+			defer cleanup()
+
+			_, w := request(s, "GET", "https://app.example.com")
+			So(w.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "*")
+		})
+	})
+}
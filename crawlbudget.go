@@ -0,0 +1,121 @@
+package search
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// CrawlBudget reports the progress of the current crawl cycle against
+// max_crawl_pages and max_crawl_duration. A cycle starts with the crawler and
+// with every poll of the change feed, or every change feed interval without
+// a feed.
+type CrawlBudget struct {
+	Pages       int     `json:"pages"`
+	MaxPages    int     `json:"max_pages,omitempty"`
+	Elapsed     float64 `json:"elapsed_seconds"`
+	MaxDuration float64 `json:"max_duration_seconds,omitempty"`
+	Reached     bool    `json:"reached"`
+}
+
+// budgeted reports whether the crawl cycles are bounded
+func (c *Config) budgeted() bool {
+	return c.MaxCrawlPages > 0 || c.MaxCrawlDuration > 0
+}
+
+// StartCycle starts a crawl cycle with its whole budget, queuing first the
+// pages the previous cycles had no budget left for, oldest first
+func (c *Crawler) StartCycle() {
+	c.mutex.Lock()
+	c.cycleStart = time.Now()
+	c.cyclePages = 0
+	c.budgetReached = false
+	c.discovered = make(map[string]bool)
+	deferred := c.deferred
+	c.deferred = make(map[string]time.Time)
+	c.mutex.Unlock()
+
+	paths := make([]string, 0, len(deferred))
+	for path := range deferred {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return deferred[paths[i]].Before(deferred[paths[j]])
+	})
+	for _, path := range paths {
+		if !c.enqueue(path, deferred[path]) {
+			// the queue is full; the page waits for the cycle after
+			c.mutex.Lock()
+			c.deferCrawl(path, deferred[path])
+			c.mutex.Unlock()
+		}
+	}
+}
+
+// CycleEvery starts a crawl cycle at every interval, for crawls without a
+// change feed to start them
+func (c *Crawler) CycleEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		c.StartCycle()
+	}
+}
+
+// deferCrawl keeps a page queued at the given time for the next cycle, once
+// the current one has used up its budget. The caller holds c.mutex.
+func (c *Crawler) deferCrawl(path string, queued time.Time) {
+	if earlier, ok := c.deferred[path]; !ok || queued.Before(earlier) {
+		c.deferred[path] = queued
+	}
+}
+
+// exhausted reports whether the current cycle has used up its budget,
+// logging it the first time. The caller holds c.mutex.
+func (c *Crawler) exhausted() bool {
+	if c.budgetReached {
+		return true
+	}
+
+	pages, elapsed := c.config.MaxCrawlPages > 0 && c.cyclePages >= c.config.MaxCrawlPages,
+		c.config.MaxCrawlDuration > 0 && time.Since(c.cycleStart) >= c.config.MaxCrawlDuration
+	if !pages && !elapsed {
+		return false
+	}
+
+	c.budgetReached = true
+	log.Printf("[search] crawl budget reached after %d pages in %s; the remaining pages wait for the next cycle",
+		c.cyclePages, time.Since(c.cycleStart).Round(time.Second))
+	return true
+}
+
+// spend counts a page about to be fetched against the cycle's budget. It
+// returns false once the budget is used up, deferring the page to the next
+// cycle.
+func (c *Crawler) spend(path string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.config.budgeted() {
+		return true
+	}
+	if c.exhausted() {
+		c.deferCrawl(path, c.pending[path])
+		return false
+	}
+	c.cyclePages++
+	return true
+}
+
+// budget returns the progress of the current cycle against its budget, or
+// nil when crawls are unbounded. The caller holds c.mutex.
+func (c *Crawler) budget() *CrawlBudget {
+	if !c.config.budgeted() {
+		return nil
+	}
+	return &CrawlBudget{
+		Pages:       c.cyclePages,
+		MaxPages:    c.config.MaxCrawlPages,
+		Elapsed:     time.Since(c.cycleStart).Seconds(),
+		MaxDuration: c.config.MaxCrawlDuration.Seconds(),
+		Reached:     c.budgetReached,
+	}
+}
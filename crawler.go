@@ -0,0 +1,443 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+const (
+	// crawlHeader marks the crawler's own requests so the middleware does not
+	// index the responses a second time
+	crawlHeader = "X-Search-Crawl"
+	// crawlUserAgent identifies the crawler to the site
+	crawlUserAgent = "caddy-search"
+	// crawlWorkers is the number of pages fetched concurrently
+	crawlWorkers = 4
+	// crawlQueueSize bounds the number of pages waiting to be fetched
+	crawlQueueSize = 4096
+	// maxCrawlBodySize bounds how much of a page is read
+	maxCrawlBodySize = 10 << 20
+	// maxCrawlRedirects bounds the redirects followed for a single page
+	maxCrawlRedirects = 10
+	// crawlSaveInterval is the number of fetches after which the crawl state
+	// is saved, when the queue does not drain before
+	crawlSaveInterval = 100
+)
+
+// Crawler fetches the site's pages over HTTP and pipes them to the pipeline
+type Crawler struct {
+	config   *Config
+	index    indexer.Handler
+	pipeline *Pipeline
+	client   *http.Client
+	queue    chan string
+	mutex    sync.Mutex
+	pending  map[string]time.Time
+	visited  map[string]crawlVisit
+	fetched  int
+	// unchanged counts the feed entries skipped as not changed since their
+	// last fetch
+	unchanged int
+	// priorities are the sitemap priorities of the pages that declare one
+	priorities map[string]float64
+
+	// cycleStart, cyclePages and budgetReached track the current crawl
+	// cycle against its budget
+	cycleStart    time.Time
+	cyclePages    int
+	budgetReached bool
+	// deferred are the pages the budget kept from being fetched, with the
+	// time they were queued, waiting for the next cycle
+	deferred map[string]time.Time
+	// discovered are the pages reached by following links from crawl_only
+	// pages during the current cycle
+	discovered map[string]bool
+	// listed is set once the first crawl cycle has queued its pages, those
+	// of the change feed's first poll or of the seed URLs
+	listed bool
+
+	// stateFile is where the crawl state is saved, if anywhere
+	stateFile string
+	saveMutex sync.Mutex
+}
+
+// NewCrawler creates a new Crawler and starts its workers
+func NewCrawler(config *Config, index indexer.Handler, ppl *Pipeline) *Crawler {
+	c := &Crawler{
+		config:   config,
+		index:    index,
+		pipeline: ppl,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				// the configured headers are meant for the site only
+				if req.URL.Host != via[0].URL.Host {
+					for name := range config.CrawlHeaders {
+						req.Header.Del(name)
+					}
+				}
+				return checkRedirect(req, via)
+			},
+		},
+		queue:   make(chan string, crawlQueueSize),
+		pending: make(map[string]time.Time),
+		visited: make(map[string]crawlVisit),
+
+		deferred:   make(map[string]time.Time),
+		discovered: make(map[string]bool),
+
+		priorities: make(map[string]float64),
+	}
+
+	if len(config.CrawlHeaders) > 0 {
+		log.Printf("[search] crawling with headers %s", redactHeaders(config.CrawlHeaders))
+	}
+
+	c.StartCycle()
+	for i := 0; i < crawlWorkers; i++ {
+		go c.work()
+	}
+
+	return c
+}
+
+// Enqueue schedules a site path (with its query, if any) to be fetched,
+// unless it is already waiting or a skipped variant of another page. Once the
+// crawl cycle's budget is used up, the page waits for the next cycle. It
+// returns false when the queue is full.
+func (c *Crawler) Enqueue(path string) bool {
+	path = c.config.slashPath(c.config.stripParams(path))
+	if c.pipeline.IsVariant(path) {
+		return true
+	}
+	return c.enqueue(path, time.Now())
+}
+
+// Seed schedules the pages at the given URLs to be fetched ahead of those the
+// change feed announces, whether or not they were fetched before. URLs of
+// other sites are skipped. It returns the number of pages scheduled.
+func (c *Crawler) Seed(urls []string) int {
+	seeded := 0
+	for _, raw := range urls {
+		path, ok := c.SitePath(raw)
+		if !ok {
+			log.Printf("[search] skipping seed URL %s outside the site", raw)
+			continue
+		}
+		if !c.Enqueue(path) {
+			log.Printf("[search] crawl queue full, skipping seed URL %s", raw)
+			continue
+		}
+		seeded++
+	}
+	return seeded
+}
+
+// enqueue schedules a path as queued at the given time
+func (c *Crawler) enqueue(path string, queued time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.pending[path]; ok {
+		return true
+	}
+	if c.config.budgeted() && c.exhausted() {
+		c.deferCrawl(path, queued)
+		return true
+	}
+
+	select {
+	case c.queue <- path:
+		c.pending[path] = queued
+		return true
+	default:
+		return false
+	}
+}
+
+// markListed records that the first crawl cycle has queued its pages
+func (c *Crawler) markListed() {
+	c.mutex.Lock()
+	c.listed = true
+	c.mutex.Unlock()
+}
+
+// FirstCycleDone reports whether every page the first crawl cycle queued,
+// and those they led to, has been fetched
+func (c *Crawler) FirstCycleDone() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.listed && len(c.pending) == 0
+}
+
+// changed reports whether a page the change feed lists with the given change
+// time must be fetched: it was never visited, it changed since or the feed
+// gives no change time. The page is recorded as visited at that change time.
+func (c *Crawler) changed(path, updated string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	visit, ok := c.visited[path]
+	c.visited[path] = crawlVisit{Updated: updated, At: time.Now()}
+
+	if ok && visit.Updated == updated && updated != "" {
+		c.unchanged++
+		return false
+	}
+	return true
+}
+
+// forget drops the visit changed recorded for a page that could not be
+// queued, so the next poll fetches it
+func (c *Crawler) forget(path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.visited, path)
+}
+
+// setPriority records the sitemap priority of a page, a number from 0 to 1.
+// Pages without a valid priority get the default one.
+func (c *Crawler) setPriority(path, raw string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	priority, err := strconv.ParseFloat(raw, 64)
+	if err != nil || priority < 0 || priority > 1 {
+		delete(c.priorities, path)
+		return
+	}
+	c.priorities[path] = priority
+}
+
+// priority returns the sitemap priority of a page
+func (c *Crawler) priority(path string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if priority, ok := c.priorities[path]; ok {
+		return priority
+	}
+	return indexer.DefaultPriority
+}
+
+// SitePath returns the path, relative to the site root, of a URL that
+// belongs to the crawled site. Relative URLs are resolved against the root.
+func (c *Crawler) SitePath(raw string) (string, bool) {
+	path, ok := c.config.sitePath(raw)
+	if !ok {
+		return "", false
+	}
+	return c.config.slashPath(c.config.stripParams(path)), true
+}
+
+// sitePath returns the path, relative to the site root, of a URL that belongs
+// to the site at siteURL. Relative URLs are resolved against the root.
+func sitePath(siteURL, raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	if u.Host != "" {
+		site, err := url.Parse(siteURL)
+		if err != nil || u.Host != site.Host {
+			return "", false
+		}
+	}
+
+	if u.Path == "" || u.Path[0] != '/' {
+		u = (&url.URL{Path: "/"}).ResolveReference(u)
+	}
+
+	return u.RequestURI(), true
+}
+
+// sitePath returns the path, relative to the site root, of a URL that belongs
+// to the site, under its public address or the crawl_upstream it is fetched
+// from
+func (c *Config) sitePath(raw string) (string, bool) {
+	if path, ok := sitePath(c.SiteURL, raw); ok {
+		return path, true
+	}
+	if c.CrawlUpstream != "" {
+		return sitePath(c.CrawlUpstream, raw)
+	}
+	return "", false
+}
+
+// crawlBase returns the URL the crawler fetches the site's pages from: the
+// crawl_upstream when set, the site's own address otherwise
+func (c *Config) crawlBase() string {
+	if c.CrawlUpstream != "" {
+		return c.CrawlUpstream
+	}
+	return c.SiteURL
+}
+
+// newCrawlRequest creates a GET request for a crawled URL marked as the
+// crawler's own. Requests to the site carry the configured headers.
+func newCrawlRequest(config *Config, url string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", crawlUserAgent)
+	if _, ok := config.sitePath(url); ok {
+		for name, values := range config.CrawlHeaders {
+			req.Header[name] = values
+		}
+	}
+	req.Header.Set(crawlHeader, "1")
+
+	return req, nil
+}
+
+// redactHeaders formats headers for logging, hiding the values of those
+// that carry credentials
+func redactHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		value := strings.Join(header[name], ", ")
+		if sensitiveHeader(name) {
+			value = "[redacted]"
+		}
+		parts[i] = name + ": " + value
+	}
+	return strings.Join(parts, "; ")
+}
+
+// sensitiveHeader reports whether a header's value is a credential
+func sensitiveHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization", "Proxy-Authorization", "Cookie":
+		return true
+	}
+
+	name = strings.ToLower(name)
+	for _, word := range []string{"token", "secret", "key", "password", "session", "auth"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect stops following a page's redirects once they loop or exceed
+// maxCrawlRedirects
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxCrawlRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxCrawlRedirects)
+	}
+	for _, prev := range via {
+		if prev.URL.String() == req.URL.String() {
+			return fmt.Errorf("redirect loop at %s", req.URL)
+		}
+	}
+	return nil
+}
+
+// work fetches queued pages until the queue is closed
+func (c *Crawler) work() {
+	for path := range c.queue {
+		fetch := c.spend(path)
+		if fetch {
+			c.fetch(path)
+		}
+
+		c.mutex.Lock()
+		delete(c.pending, path)
+		if fetch {
+			c.fetched++
+		}
+		save := len(c.pending) == 0 || c.fetched%crawlSaveInterval == 0
+		c.mutex.Unlock()
+
+		if save {
+			c.persist()
+		}
+	}
+}
+
+// fetch requests a page from the site and pipes it to the pipeline
+func (c *Crawler) fetch(path string) {
+	if !c.pipeline.ValidatePath(path) {
+		return
+	}
+
+	req, err := newCrawlRequest(c.config, c.config.crawlBase()+path)
+	if err != nil {
+		return
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Printf("[search] crawling %s: %v", path, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	priority := c.priority(path)
+
+	// content is indexed under the URL it was finally served from; the path
+	// that redirected there is dropped from the index
+	final, ok := c.SitePath(resp.Request.URL.String())
+	if !ok || final != path {
+		c.index.Delete(path)
+		if !ok {
+			return
+		}
+		c.pipeline.Redirect(path, final)
+		if !c.pipeline.ValidatePath(final) {
+			return
+		}
+		path = final
+	}
+	c.pipeline.RemoveRedirect(path)
+
+	if c.config.crawlOnly(path) {
+		c.index.Delete(path)
+		c.followLinks(path, resp.Header, io.LimitReader(resp.Body, maxCrawlBodySize))
+		return
+	}
+
+	if headerNoindex(resp.Header) {
+		c.index.Delete(path)
+		return
+	}
+
+	record := c.index.Record(path)
+	record.SetContentType(resp.Header.Get("Content-Type"))
+	record.SetPriority(priority)
+	record.SetFields(headerFields(resp.Header, c.config.IndexHeaders))
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		record.SetModified(modified)
+	}
+
+	if _, err := io.Copy(record, io.LimitReader(resp.Body, maxCrawlBodySize)); err != nil {
+		c.index.Kill(record)
+		return
+	}
+
+	c.pipeline.PipeCrawled(record)
+}
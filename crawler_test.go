@@ -0,0 +1,446 @@
+package search_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCrawlerRedirects(t *testing.T) {
+	Convey("Given a site where pages have moved", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/old":
+				http.Redirect(w, r, "/older", http.StatusMovedPermanently)
+			case "/older":
+				http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			case "/loop-a":
+				http.Redirect(w, r, "/loop-b", http.StatusFound)
+			case "/loop-b":
+				http.Redirect(w, r, "/loop-a", http.StatusFound)
+			default:
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprintf(w, "<html><head><title>%s</title></head><body>page</body></html>", r.URL.Path)
+			}
+		}))
+		defer server.Close()
+
+		config := &search.Config{SiteURL: server.URL}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+
+		Convey("Should index the content under the final URL", func() {
+			So(crawler.Enqueue("/old"), ShouldBeTrue)
+
+			rec := capture.next()
+			So(rec, ShouldNotBeNil)
+			So(rec.Path(), ShouldEqual, "/new")
+
+			to, ok := pipeline.Redirected("/old")
+			So(ok, ShouldBeTrue)
+			So(to, ShouldEqual, "/new")
+		})
+
+		Convey("Should give up on redirect loops", func() {
+			So(crawler.Enqueue("/loop-a"), ShouldBeTrue)
+			So(capture.next(), ShouldBeNil)
+		})
+	})
+}
+
+func TestCrawlHeaders(t *testing.T) {
+	Convey("Given a site whose pages require a session cookie", t, func() {
+		received := make(chan string, 1)
+		elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- r.Header.Get("X-Section")
+		}))
+		defer elsewhere.Close()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Cookie") != "session=abc" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			if r.URL.Path == "/away" {
+				http.Redirect(w, r, elsewhere.URL+"/away", http.StatusFound)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><head><title>Members</title></head><body>page</body></html>")
+		}))
+		defer server.Close()
+
+		var logs bytes.Buffer
+		log.SetOutput(&logs)
+		defer log.SetOutput(os.Stderr)
+
+		config := &search.Config{
+			SiteURL:      server.URL,
+			CrawlHeaders: http.Header{"Cookie": {"session=abc"}, "X-Section": {"members"}},
+		}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+
+		Convey("Should send the headers with every crawl request", func() {
+			So(crawler.Enqueue("/members"), ShouldBeTrue)
+
+			rec := capture.next()
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "Members")
+		})
+
+		Convey("Should not send the headers to other hosts", func() {
+			So(crawler.Enqueue("/away"), ShouldBeTrue)
+
+			select {
+			case section := <-received:
+				So(section, ShouldBeEmpty)
+			case <-time.After(time.Second):
+				So("no request", ShouldEqual, "a request to the other host")
+			}
+		})
+
+		Convey("Should redact credentials in the logs", func() {
+			So(logs.String(), ShouldContainSubstring, "Cookie: [redacted]")
+			So(logs.String(), ShouldContainSubstring, "X-Section: members")
+			So(logs.String(), ShouldNotContainSubstring, "session=abc")
+		})
+	})
+}
+
+func TestCrawlIgnoreParams(t *testing.T) {
+	Convey("Given a faceted listing reachable through many query strings", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/changes.json" {
+				fmt.Fprint(w, `["/list?sort=asc&page=2", "/list?page=3&sort=desc", "/list?utm_source=mail",
+					"/list?q=shoes&sort=asc", "/list?sort=desc&q=shoes"]`)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><head><title>Listing</title></head><body>page</body></html>")
+		}))
+		defer server.Close()
+
+		config := &search.Config{SiteURL: server.URL, CrawlIgnoreParams: []string{"sort", "page", "utm_*"}}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+
+		Convey("Should strip the ignored parameters and fetch each page once", func() {
+			So(search.NewChangeFeed("/changes.json", crawler).Poll(), ShouldBeNil)
+
+			paths := []string{}
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				paths = append(paths, rec.Path())
+			}
+			sort.Strings(paths)
+			So(paths, ShouldResemble, []string{"/list", "/list?q=shoes"})
+		})
+	})
+}
+
+func TestCrawlerSeed(t *testing.T) {
+	Convey("Given section indexes no other page links to", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><head><title>%s</title></head><body>section</body></html>", r.URL.Path)
+		}))
+		defer server.Close()
+
+		config := &search.Config{SiteURL: server.URL}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+
+		Convey("Should fetch the seed URLs of the site and skip the others", func() {
+			seeded := crawler.Seed([]string{server.URL + "/docs/", "/blog/", "https://elsewhere.example/"})
+			So(seeded, ShouldEqual, 2)
+
+			paths := []string{}
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				paths = append(paths, rec.Path())
+			}
+			sort.Strings(paths)
+			So(paths, ShouldResemble, []string{"/blog/", "/docs/"})
+		})
+	})
+}
+
+func TestCrawlerRobotsHeader(t *testing.T) {
+	Convey("Given a site marking pages noindex in their headers", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/private":
+				w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+			case "/elsewhere":
+				w.Header().Set("X-Robots-Tag", "otherbot: noindex")
+			case "/none":
+				w.Header().Add("X-Robots-Tag", "max-snippet: 20")
+				w.Header().Add("X-Robots-Tag", "caddy-search: none")
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><head><title>%s</title></head><body>page</body></html>", r.URL.Path)
+		}))
+		defer server.Close()
+
+		config := &search.Config{SiteURL: server.URL}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+
+		Convey("Should skip the pages and remove them from the index", func() {
+			indexed := capture.Record("/private")
+			indexed.Write([]byte("page"))
+			capture.Handler.Pipe(indexed)
+			for i := 0; i < 100 && !capture.Record("/private").Load(); i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(capture.Record("/private").Load(), ShouldBeTrue)
+
+			So(crawler.Enqueue("/private"), ShouldBeTrue)
+			So(crawler.Enqueue("/none"), ShouldBeTrue)
+			So(capture.next(), ShouldBeNil)
+			So(capture.Record("/private").Load(), ShouldBeFalse)
+		})
+
+		Convey("Should index pages marked noindex for another crawler", func() {
+			So(crawler.Enqueue("/elsewhere"), ShouldBeTrue)
+			rec := capture.next()
+			So(rec, ShouldNotBeNil)
+			So(rec.Path(), ShouldEqual, "/elsewhere")
+		})
+	})
+}
+
+func TestCrawlerTrailingSlash(t *testing.T) {
+	Convey("Given a site serving pages with and without a trailing slash", t, func() {
+		requested := make(chan string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested <- r.URL.Path
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><head><title>Guide</title></head><body>page</body></html>")
+		}))
+		defer server.Close()
+
+		crawl := func(policy, path string) (string, string) {
+			config := &search.Config{SiteURL: server.URL, TrailingSlash: policy}
+			capture, pipeline, cleanup := newCapturePipeline(config)
+			defer cleanup()
+
+			crawler := search.NewCrawler(config, capture, pipeline)
+			So(crawler.Enqueue(path), ShouldBeTrue)
+			rec := capture.next()
+			So(rec, ShouldNotBeNil)
+			return <-requested, rec.Path()
+		}
+
+		Convey("Should fetch and index the paths without it", func() {
+			requestedPath, indexed := crawl("strip", "/guide/?page=2")
+			So(requestedPath, ShouldEqual, "/guide")
+			So(indexed, ShouldEqual, "/guide?page=2")
+		})
+
+		Convey("Should fetch and index the paths with it", func() {
+			requestedPath, indexed := crawl("add", "/guide")
+			So(requestedPath, ShouldEqual, "/guide/")
+			So(indexed, ShouldEqual, "/guide/")
+		})
+
+		Convey("Should leave the paths of files alone", func() {
+			_, indexed := crawl("add", "/guide.html")
+			So(indexed, ShouldEqual, "/guide.html")
+		})
+	})
+}
+
+func TestRedirectedResults(t *testing.T) {
+	Convey("Given an indexed page that has moved", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "install.html")
+
+		s.Pipeline.Redirect("/install.html", "/setup.html")
+
+		Convey("Should list the result under the page's new path", func() {
+			results := searchJSON(s, "install")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/setup.html")
+		})
+
+		Convey("Should resolve chains of redirects", func() {
+			s.Pipeline.Redirect("/setup.html", "/docs/setup.html")
+
+			results := searchJSON(s, "install")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/docs/setup.html")
+		})
+	})
+}
+
+func TestCrawlerIndexHeaders(t *testing.T) {
+	Convey("Given a site describing pages in response headers", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Add("X-Product", "cli")
+			w.Header().Add("X-Product", "server")
+			w.Header().Set("X-Team", "docs")
+			w.Header().Set("X-Secret", "hidden")
+			fmt.Fprint(w, `<html><head><title>Page</title></head><body data-search-x-team="writers">page</body></html>`)
+		}))
+		defer server.Close()
+
+		config := &search.Config{SiteURL: server.URL, IndexHeaders: []string{"X-Product", "X-Team", "X-Missing"}}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+
+		Convey("Should store only the listed headers as fields", func() {
+			So(crawler.Enqueue("/page"), ShouldBeTrue)
+			rec := capture.next()
+			So(rec, ShouldNotBeNil)
+			So(rec.Fields()["x-product"], ShouldEqual, "cli, server")
+			So(rec.Fields(), ShouldNotContainKey, "x-secret")
+			So(rec.Fields(), ShouldNotContainKey, "x-missing")
+		})
+
+		Convey("Should prefer the fields the page declares", func() {
+			So(crawler.Enqueue("/page"), ShouldBeTrue)
+			rec := capture.next()
+			So(rec, ShouldNotBeNil)
+			So(rec.Fields()["x-team"], ShouldEqual, "writers")
+		})
+	})
+}
+
+func TestCrawlerUpstream(t *testing.T) {
+	Convey("Given a site crawled from an upstream distinct from its public host", t, func() {
+		var upstream *httptest.Server
+		upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/old":
+				http.Redirect(w, r, upstream.URL+"/new", http.StatusMovedPermanently)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><head><title>%s</title></head><body>%s</body></html>", r.URL.Path, r.Header.Get("Authorization"))
+		}))
+		defer upstream.Close()
+
+		config := &search.Config{
+			SiteURL:       "https://public.example",
+			CrawlUpstream: upstream.URL,
+			CrawlHeaders:  http.Header{"Authorization": {"Bearer secret"}},
+		}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+
+		Convey("Should fetch pages from the upstream with the crawl headers", func() {
+			So(crawler.Seed([]string{"https://public.example/docs"}), ShouldEqual, 1)
+			rec := capture.next()
+			So(rec, ShouldNotBeNil)
+			So(rec.Path(), ShouldEqual, "/docs")
+			So(string(rec.Body()), ShouldContainSubstring, "Bearer secret")
+		})
+
+		Convey("Should index pages redirected within the upstream under their path", func() {
+			So(crawler.Enqueue("/old"), ShouldBeTrue)
+			rec := capture.next()
+			So(rec, ShouldNotBeNil)
+			So(rec.Path(), ShouldEqual, "/new")
+		})
+	})
+}
+
+func TestCrawlerCrawlOnly(t *testing.T) {
+	Convey("Given a blog whose paginated listings link to its posts", t, func() {
+		site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			switch r.URL.Path {
+			case "/blog/page/2":
+				fmt.Fprint(w, `<html><head><title>Page 2</title><base href="/blog/"><link rel="next" href="page/3"></head>`+
+					`<body><a href="first-post.html">First</a> <a href="#top">Top</a></body></html>`)
+			case "/blog/page/3":
+				fmt.Fprint(w, `<html><head><title>Page 3</title></head>`+
+					`<body><a href="/blog/page/2">Previous</a> <a href="/blog/second-post.html">Second</a></body></html>`)
+			case "/blog/page/4":
+				fmt.Fprint(w, `<html><head><meta name="robots" content="noindex,nofollow"></head>`+
+					`<body><a href="/blog/draft.html">Draft</a></body></html>`)
+			case "/blog/page/5":
+				w.Header().Set("X-Robots-Tag", "nofollow")
+				fmt.Fprint(w, `<html><body><a href="/blog/draft.html">Draft</a></body></html>`)
+			default:
+				fmt.Fprintf(w, "<html><head><title>%s</title></head><body>A post.</body></html>", r.URL.Path)
+			}
+		}))
+		defer site.Close()
+
+		config := &search.Config{
+			SiteURL:        site.URL,
+			CrawlOnlyPaths: search.ConvertToRegExp([]string{"^/blog/page/"}),
+		}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+
+		Convey("Should index the posts the listings link to but not the listings", func() {
+			So(crawler.Enqueue("/blog/page/2"), ShouldBeTrue)
+
+			indexed := []string{}
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				indexed = append(indexed, rec.Path())
+			}
+			sort.Strings(indexed)
+			So(indexed, ShouldResemble, []string{"/blog/first-post.html", "/blog/second-post.html"})
+
+			Convey("Should follow the listings again in the next cycle", func() {
+				crawler.StartCycle()
+				So(crawler.Enqueue("/blog/page/2"), ShouldBeTrue)
+
+				indexed := []string{}
+				for rec := capture.next(); rec != nil; rec = capture.next() {
+					indexed = append(indexed, rec.Path())
+				}
+				sort.Strings(indexed)
+				So(indexed, ShouldResemble, []string{"/blog/first-post.html", "/blog/second-post.html"})
+			})
+		})
+
+		Convey("Should not follow the links of a listing marked noindex,nofollow", func() {
+			So(crawler.Enqueue("/blog/page/4"), ShouldBeTrue)
+			So(capture.next(), ShouldBeNil)
+		})
+
+		Convey("Should not follow the links of a listing whose headers say nofollow", func() {
+			So(crawler.Enqueue("/blog/page/5"), ShouldBeTrue)
+			So(capture.next(), ShouldBeNil)
+		})
+
+		Convey("Should not index a listing served to a visitor", func() {
+			So(pipeline.ValidatePath("/blog/page/2"), ShouldBeTrue)
+			rec := capture.Record("/blog/page/2")
+			rec.Write([]byte("<html><head><title>Page 2</title></head><body>Posts</body></html>"))
+			pipeline.Pipe(rec)
+			So(capture.next(), ShouldBeNil)
+		})
+	})
+}
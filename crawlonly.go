@@ -0,0 +1,79 @@
+package search
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// crawlOnly reports whether the page at path is only crawled for its links,
+// as crawl_only sets for listing pages, and never indexed
+func (c *Config) crawlOnly(path string) bool {
+	for _, pattern := range c.CrawlOnlyPaths {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlLinks returns the targets of a page's <a> elements and of its
+// <link rel="next">, which paginated listings point to their next page with
+func htmlLinks(doc *html.Node) []string {
+	var links []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && attr(n, "href") != "" &&
+			(n.DataAtom == atom.A || n.DataAtom == atom.Link && hasToken(attr(n, "rel"), "next")) {
+			links = append(links, attr(n, "href"))
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return links
+}
+
+// followLinks schedules the pages of the site a crawl_only page links to,
+// resolved against its base href, unless its robots directives say nofollow.
+// Pages already reached from such a page during the current cycle are
+// skipped, so listings linking to one another are not crawled in circles.
+func (c *Crawler) followLinks(path string, header http.Header, body io.Reader) {
+	if headerNofollow(header) {
+		return
+	}
+	doc, err := html.Parse(body)
+	if err != nil || htmlNofollow(doc) {
+		return
+	}
+
+	c.discover(path)
+	base := htmlBase(path, doc)
+	for _, href := range htmlLinks(doc) {
+		if strings.HasPrefix(strings.TrimSpace(href), "#") {
+			continue
+		}
+		link, ok := c.SitePath(resolveURL(base, href))
+		if !ok || !c.pipeline.ValidatePath(link) || !c.discover(link) {
+			continue
+		}
+		c.Enqueue(link)
+	}
+}
+
+// discover records that a page was reached by following links and reports
+// whether it was not reached before in the current crawl cycle
+func (c *Crawler) discover(path string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.discovered[path] {
+		return false
+	}
+	c.discovered[path] = true
+	return true
+}
@@ -0,0 +1,197 @@
+package search
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// crawlState is the crawler's progress as saved to disk: the pages waiting
+// to be fetched, in this cycle or a later one, with the time they were
+// queued, and the pages the change feed listed, with the change time they
+// were last fetched for
+type crawlState struct {
+	Pending  map[string]time.Time  `json:"pending"`
+	Deferred map[string]time.Time  `json:"deferred,omitempty"`
+	Visited  map[string]crawlVisit `json:"visited"`
+}
+
+// crawlVisit is the change time a page was fetched for and when
+type crawlVisit struct {
+	Updated string    `json:"updated"`
+	At      time.Time `json:"at"`
+}
+
+// crawlStateFile returns where the crawl state of the site is saved, next to
+// its index
+func crawlStateFile(config *Config) string {
+	return filepath.Join(config.IndexDirectory, config.HostName+".crawl")
+}
+
+// Resume restores the crawl state saved in file, so a restarted server goes
+// on with the pages still waiting instead of fetching every page again, and
+// saves the state there from then on. Entries older than the configured
+// expiration are dropped. A missing file starts an empty crawl.
+func (c *Crawler) Resume(file string) error {
+	c.saveMutex.Lock()
+	c.stateFile = file
+	c.saveMutex.Unlock()
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state crawlState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("[search] ignoring crawl state %s: %v", file, err)
+		return nil
+	}
+
+	stale := func(t time.Time) bool {
+		return c.config.Expire > 0 && time.Since(t) > c.config.Expire
+	}
+
+	c.mutex.Lock()
+	for path, visit := range state.Visited {
+		if !stale(visit.At) {
+			c.visited[path] = visit
+		}
+	}
+	c.mutex.Unlock()
+
+	// pages deferred by the budget start the next cycle along with the others
+	waiting := make(map[string]time.Time, len(state.Pending)+len(state.Deferred))
+	for path, queued := range state.Deferred {
+		waiting[path] = queued
+	}
+	for path, queued := range state.Pending {
+		waiting[path] = queued
+	}
+
+	paths := make([]string, 0, len(waiting))
+	for path, queued := range waiting {
+		if stale(queued) {
+			// forgotten as well, so the change feed lists it again
+			c.mutex.Lock()
+			delete(c.visited, path)
+			c.mutex.Unlock()
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return waiting[paths[i]].Before(waiting[paths[j]])
+	})
+
+	for _, path := range paths {
+		c.enqueue(path, waiting[path])
+	}
+
+	return nil
+}
+
+// persist saves the crawl state, if the crawler has a state file, logging
+// failures
+func (c *Crawler) persist() {
+	if err := c.saveState(); err != nil {
+		log.Printf("[search] saving crawl state: %v", err)
+	}
+}
+
+// saveState writes the crawl state to the state file, replacing the previous
+// one only once it is complete
+func (c *Crawler) saveState() error {
+	c.saveMutex.Lock()
+	defer c.saveMutex.Unlock()
+
+	if c.stateFile == "" {
+		return nil
+	}
+
+	c.mutex.Lock()
+	data, err := json.Marshal(crawlState{Pending: c.pending, Deferred: c.deferred, Visited: c.visited})
+	c.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := c.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.stateFile)
+}
+
+// CrawlStats describe the crawl state: the pages waiting to be fetched, those
+// waiting for the next cycle, the pages the change feed listed that are
+// remembered with their change time,
+// and, since the server started, the pages fetched and the feed entries
+// skipped because they had not changed since their last fetch. Budget is
+// set when the crawl cycles are bounded.
+type CrawlStats struct {
+	Pending   int          `json:"pending"`
+	Deferred  int          `json:"deferred"`
+	Visited   int          `json:"visited"`
+	Fetched   int          `json:"fetched"`
+	Unchanged int          `json:"unchanged"`
+	Budget    *CrawlBudget `json:"budget,omitempty"`
+}
+
+// Stats returns the current crawl statistics
+func (c *Crawler) Stats() CrawlStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return CrawlStats{
+		Pending:   len(c.pending),
+		Deferred:  len(c.deferred),
+		Visited:   len(c.visited),
+		Fetched:   c.fetched,
+		Unchanged: c.unchanged,
+		Budget:    c.budget(),
+	}
+}
+
+// Reset forgets the change times of the pages the change feed listed, so its
+// next poll fetches every page again, and saves the emptied state
+func (c *Crawler) Reset() {
+	c.mutex.Lock()
+	c.visited = make(map[string]crawlVisit)
+	c.mutex.Unlock()
+	c.persist()
+}
+
+// CrawlStateReport serves the crawl statistics to authorized clients. A
+// DELETE request resets the crawl state first.
+func (s *Search) CrawlStateReport(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !s.authorized(r) {
+		return http.StatusUnauthorized, nil
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodDelete:
+		s.Crawler.Reset()
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	jresp, err := json.Marshal(s.Crawler.Stats())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(jresp)
+	return http.StatusOK, nil
+}
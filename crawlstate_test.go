@@ -0,0 +1,158 @@
+package search_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCrawlerResume(t *testing.T) {
+	Convey("Given a crawl interrupted by a restart", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/changes.json":
+				fmt.Fprint(w, `[{"url": "/fetched", "updated": "2006-01-02"}, {"url": "/stale", "updated": "2006-01-02"}]`)
+			default:
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprintf(w, "<html><head><title>%s</title></head><body>page</body></html>", r.URL.Path)
+			}
+		}))
+		defer server.Close()
+
+		dir, err := ioutil.TempDir("", "caddyCrawlTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "site.crawl")
+
+		now, old := time.Now(), time.Now().Add(-2*time.Hour)
+		state, _ := json.Marshal(map[string]interface{}{
+			"pending": map[string]time.Time{"/waiting": now, "/stale": old},
+			"visited": map[string]interface{}{
+				"/fetched": map[string]interface{}{"updated": "2006-01-02", "at": now},
+				"/stale":   map[string]interface{}{"updated": "2006-01-02", "at": now},
+			},
+		})
+		So(ioutil.WriteFile(file, state, 0644), ShouldBeNil)
+
+		config := &search.Config{SiteURL: server.URL, Expire: time.Hour}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+		So(crawler.Resume(file), ShouldBeNil)
+
+		crawled := func() []string {
+			paths := []string{}
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				paths = append(paths, rec.Path())
+			}
+			sort.Strings(paths)
+			return paths
+		}
+
+		Convey("Should fetch the pages still waiting, except stale ones", func() {
+			So(crawled(), ShouldResemble, []string{"/waiting"})
+
+			Convey("Should not fetch the pages already visited again", func() {
+				So(search.NewChangeFeed("/changes.json", crawler).Poll(), ShouldBeNil)
+				So(crawled(), ShouldResemble, []string{"/stale"})
+			})
+
+			Convey("Should save the state for the next restart", func() {
+				So(search.NewChangeFeed("/changes.json", crawler).Poll(), ShouldBeNil)
+				crawled()
+
+				data, err := ioutil.ReadFile(file)
+				So(err, ShouldBeNil)
+				So(string(data), ShouldContainSubstring, `"/stale":{"updated":"2006-01-02"`)
+			})
+		})
+	})
+}
+
+func TestCrawlStateEndpoint(t *testing.T) {
+	Convey("Given a crawler fed by a change feed", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/changes.json":
+				fmt.Fprint(w, `[{"url": "/a", "updated": "2006-01-02"}, {"url": "/b", "updated": "2006-01-02"}]`)
+			default:
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprintf(w, "<html><head><title>%s</title></head><body>page</body></html>", r.URL.Path)
+			}
+		}))
+		defer server.Close()
+
+		config := &search.Config{
+			SiteURL:            server.URL,
+			Endpoint:           "/search",
+			Token:              "secret",
+			CrawlStateEndpoint: "/search/crawl",
+		}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+		feed := search.NewChangeFeed("/changes.json", crawler)
+		s := search.NewSearch(config, capture, pipeline)
+		s.Crawler = crawler
+
+		crawled := func() int {
+			n := 0
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				n++
+			}
+			return n
+		}
+
+		request := func(method, token string) (int, search.CrawlStats) {
+			req := httptest.NewRequest(method, "/search/crawl", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+
+			var stats search.CrawlStats
+			if status == http.StatusOK {
+				So(json.Unmarshal(w.Body.Bytes(), &stats), ShouldBeNil)
+			}
+			return status, stats
+		}
+
+		So(feed.Poll(), ShouldBeNil)
+		So(crawled(), ShouldEqual, 2)
+		So(feed.Poll(), ShouldBeNil)
+		So(crawled(), ShouldEqual, 0)
+
+		Convey("Should report the pages skipped as unchanged", func() {
+			status, stats := request("GET", "secret")
+			So(status, ShouldEqual, http.StatusOK)
+			So(stats, ShouldResemble, search.CrawlStats{Visited: 2, Fetched: 2, Unchanged: 2})
+		})
+
+		Convey("Should fetch every page again after a reset", func() {
+			status, stats := request("DELETE", "secret")
+			So(status, ShouldEqual, http.StatusOK)
+			So(stats.Visited, ShouldEqual, 0)
+
+			So(feed.Poll(), ShouldBeNil)
+			So(crawled(), ShouldEqual, 2)
+		})
+
+		Convey("Should require the token", func() {
+			status, _ := request("DELETE", "wrong")
+			So(status, ShouldEqual, http.StatusUnauthorized)
+			So(crawler.Stats().Visited, ShouldEqual, 2)
+		})
+	})
+}
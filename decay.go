@@ -0,0 +1,104 @@
+package search
+
+import (
+	"container/heap"
+	"math"
+	"time"
+)
+
+// decayingCounts holds up to max counts that halve every half-life. Counts
+// all decay at the same rate, so their order never changes with time: they
+// are kept in a heap by their value as of a fixed epoch, and the lowest is
+// evicted to make room without scanning them all.
+type decayingCounts struct {
+	halfLife time.Duration
+	max      int
+	epoch    time.Time
+	counts   map[interface{}]*decayingCount
+	lowest   countHeap
+}
+
+// decayingCount is a count as of a time
+type decayingCount struct {
+	key   interface{}
+	value float64
+	at    time.Time
+	rank  float64 // log2 of the value as of the epoch, which orders counts
+	index int     // position in the heap
+}
+
+// newDecayingCounts creates decayingCounts holding up to max counts, which
+// halve every halfLife
+func newDecayingCounts(halfLife time.Duration, max int) *decayingCounts {
+	return &decayingCounts{
+		halfLife: halfLife,
+		max:      max,
+		epoch:    time.Now(),
+		counts:   make(map[interface{}]*decayingCount),
+	}
+}
+
+// decayed returns the count's value as of now
+func (d *decayingCounts) decayed(count *decayingCount, now time.Time) float64 {
+	age := now.Sub(count.at)
+	if age < 0 {
+		age = 0
+	}
+	return count.value * math.Exp2(-age.Seconds()/d.halfLife.Seconds())
+}
+
+// add adds one to the count of key as of now. A new key makes room by
+// evicting the lowest count when full, whose key add returns.
+func (d *decayingCounts) add(key interface{}, now time.Time) (evicted interface{}, ok bool) {
+	count, found := d.counts[key]
+	if !found {
+		if len(d.counts) >= d.max {
+			lowest := heap.Pop(&d.lowest).(*decayingCount)
+			delete(d.counts, lowest.key)
+			evicted, ok = lowest.key, true
+		}
+		count = &decayingCount{key: key, at: now}
+		d.counts[key] = count
+		heap.Push(&d.lowest, count)
+	}
+
+	count.value = d.decayed(count, now) + 1
+	count.at = now
+	count.rank = math.Log2(count.value) + now.Sub(d.epoch).Seconds()/d.halfLife.Seconds()
+	heap.Fix(&d.lowest, count.index)
+	return evicted, ok
+}
+
+// get returns the count of key as of now, 0 if it is not counted
+func (d *decayingCounts) get(key interface{}, now time.Time) float64 {
+	if count, ok := d.counts[key]; ok {
+		return d.decayed(count, now)
+	}
+	return 0
+}
+
+// countHeap is a min-heap of counts by rank
+type countHeap []*decayingCount
+
+func (h countHeap) Len() int           { return len(h) }
+func (h countHeap) Less(i, j int) bool { return h[i].rank < h[j].rank }
+
+func (h countHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *countHeap) Push(x interface{}) {
+	count := x.(*decayingCount)
+	count.index = len(*h)
+	*h = append(*h, count)
+}
+
+func (h *countHeap) Pop() interface{} {
+	old := *h
+	count := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return count
+}
@@ -0,0 +1,113 @@
+package search
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Markers of the start of a section in a stripped body, around the number of
+// the section. They are private use characters, which pages do not hold and
+// normalization leaves alone.
+const (
+	sectionOpen  = "\uE000"
+	sectionClose = "\uE001"
+)
+
+// headingElements are the elements starting a section
+var headingElements = map[atom.Atom]bool{
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// markSections marks the start of the text of every heading of n's subtree
+// that has an id, or holds an anchor with one, and returns the ids in
+// document order
+func markSections(n *html.Node) []string {
+	var ids []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && headingElements[n.DataAtom] {
+			if id := headingID(n); id != "" {
+				marker := sectionOpen + strconv.Itoa(len(ids)) + sectionClose
+				n.InsertBefore(&html.Node{Type: html.TextNode, Data: marker}, n.FirstChild)
+				ids = append(ids, id)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return ids
+}
+
+// headingID returns the id of a heading, or else that of the first anchor
+// it holds, as in <h2><a id="setup"></a>Setup</h2> or <a name="setup">
+func headingID(heading *html.Node) string {
+	if id := strings.TrimSpace(attr(heading, "id")); id != "" {
+		return id
+	}
+	anchor := findElement(heading, func(n *html.Node) bool {
+		return n.DataAtom == atom.A && (attr(n, "id") != "" || attr(n, "name") != "")
+	})
+	if anchor == nil {
+		return ""
+	}
+	if id := strings.TrimSpace(attr(anchor, "id")); id != "" {
+		return id
+	}
+	return strings.TrimSpace(attr(anchor, "name"))
+}
+
+// splitSections removes the section markers from a body and returns the
+// sections they start, with the ids markSections returned
+func splitSections(body string, ids []string) (string, []indexer.Section) {
+	if !strings.Contains(body, sectionOpen) {
+		return body, nil
+	}
+
+	var text strings.Builder
+	var sections []indexer.Section
+	for {
+		i := strings.Index(body, sectionOpen)
+		if i < 0 {
+			break
+		}
+		j := strings.Index(body[i:], sectionClose)
+		if j < 0 {
+			break
+		}
+		text.WriteString(body[:i])
+		n, err := strconv.Atoi(body[i+len(sectionOpen) : i+j])
+		body = body[i+j+len(sectionClose):]
+		if text.Len() == 0 || strings.HasSuffix(text.String(), "\n") {
+			// the marker kept normalization from trimming the heading's line
+			body = strings.TrimLeft(body, " \t")
+		}
+		if err == nil && n >= 0 && n < len(ids) {
+			sections = append(sections, indexer.Section{ID: ids[n], Start: text.Len()})
+		}
+	}
+	text.WriteString(body)
+	return text.String(), sections
+}
+
+// deepLinks appends to the link of every result whose best match is in a
+// section of its page the fragment jumping to that section
+func deepLinks(results []Result) {
+	for i, result := range results {
+		if result.Section == "" {
+			continue
+		}
+		link := result.Link()
+		if j := strings.Index(link, "#"); j >= 0 {
+			link = link[:j]
+		}
+		results[i].URL = link + "#" + (&url.URL{Fragment: result.Section}).EscapedFragment()
+	}
+}
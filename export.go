@@ -0,0 +1,236 @@
+package search
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+const (
+	// exportFormat identifies the archives of the export endpoint
+	exportFormat = "caddy-search-index"
+	// exportVersion is the version of the archive format written by Export
+	// and the only one Import reads. It changes whenever an older server
+	// could not import the archive faithfully.
+	exportVersion = 1
+
+	// archiveMaxSize bounds the compressed archive an import reads, and
+	// archiveMaxData the data it decompresses to
+	archiveMaxSize = 1 << 30
+	archiveMaxData = 16 << 30
+	// archiveMaxDocument bounds each document of an archive, which holds
+	// at most a crawled page's body and what was extracted from it
+	archiveMaxDocument = 2 * maxCrawlBodySize
+)
+
+// exportHeader is the first line of an index archive
+type exportHeader struct {
+	Format   string    `json:"format"`
+	Version  int       `json:"version"`
+	Exported time.Time `json:"exported"`
+}
+
+// exportDocument is an indexed document as written to an index archive
+type exportDocument struct {
+	Path        string            `json:"path"`
+	Title       string            `json:"title,omitempty"`
+	Body        string            `json:"body"`
+	Image       string            `json:"image,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Comments    string            `json:"comments,omitempty"`
+	Excerpt     string            `json:"excerpt,omitempty"`
+	Sections    []indexer.Section `json:"sections,omitempty"`
+	// Translations are the paths of the page in other languages
+	Translations map[string]string `json:"translations,omitempty"`
+	Language     string            `json:"language,omitempty"`
+	Fields       map[string]string `json:"fields,omitempty"`
+	Priority     float64           `json:"priority"`
+	Modified     *time.Time        `json:"modified,omitempty"`
+}
+
+// IndexArchive exports the index to authorized clients as a portable archive
+// on GET and rebuilds it from such an archive on POST. An archive is
+// gzip-compressed JSON: a header naming the format and its version, then one
+// document per line.
+func (s *Search) IndexArchive(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !s.authorized(r) {
+		return http.StatusUnauthorized, nil
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return s.exportIndex(w)
+	case http.MethodPost:
+		if r.ContentLength > archiveMaxSize {
+			return http.StatusRequestEntityTooLarge, nil
+		}
+		return s.importIndex(w, http.MaxBytesReader(w, r.Body, archiveMaxSize))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		return http.StatusMethodNotAllowed, nil
+	}
+}
+
+// exportIndex writes every document of the index to the response
+func (s *Search) exportIndex(w http.ResponseWriter) (int, error) {
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="search-index.ndjson.gz"`)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	zw := gzip.NewWriter(w)
+	if err := writeIndexArchive(zw, s.Indexer, time.Now()); err != nil {
+		// the response has started; the truncated archive fails to import
+		return http.StatusOK, err
+	}
+	return http.StatusOK, zw.Close()
+}
+
+// writeIndexArchive writes the archive header and every document of the index
+func writeIndexArchive(w io.Writer, index indexer.Handler, now time.Time) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(exportHeader{Format: exportFormat, Version: exportVersion, Exported: now.UTC()}); err != nil {
+		return err
+	}
+
+	return index.Walk(func(record indexer.Record) error {
+		doc := exportDocument{
+			Path:         record.Path(),
+			Title:        record.Title(),
+			Body:         string(record.Body()),
+			Image:        record.Image(),
+			Description:  record.Description(),
+			Comments:     record.Comments(),
+			Excerpt:      record.Excerpt(),
+			Sections:     record.Sections(),
+			Translations: record.Translations(),
+			Language:     record.Language(),
+			Fields:       record.Fields(),
+			Priority:     record.Priority(),
+		}
+		if modified := record.Modified(); !modified.IsZero() {
+			doc.Modified = &modified
+		}
+		return enc.Encode(doc)
+	})
+}
+
+// importIndex indexes the documents of an archive and reports their number.
+// Documents replace those of the same path; the others are kept.
+func (s *Search) importIndex(w http.ResponseWriter, body io.Reader) (int, error) {
+	imported, err := s.readIndexArchive(body)
+
+	report := map[string]interface{}{"imported": imported}
+	status := http.StatusAccepted
+	if err != nil {
+		report["error"] = err.Error()
+		status = http.StatusBadRequest
+		if err == errArchiveTooLarge || err == errArchiveDocumentTooLarge {
+			status = http.StatusRequestEntityTooLarge
+		}
+	}
+
+	jresp, jerr := json.Marshal(report)
+	if jerr != nil {
+		return http.StatusInternalServerError, jerr
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jresp)
+	return status, nil
+}
+
+var (
+	// errNotAnArchive is returned when importing data that is not an index
+	// archive
+	errNotAnArchive = errors.New("not a search index archive")
+	// errArchiveTooLarge and errArchiveDocumentTooLarge are returned when
+	// importing an archive past archiveMaxData or one of its documents past
+	// archiveMaxDocument
+	errArchiveTooLarge         = errors.New("archive too large")
+	errArchiveDocumentTooLarge = errors.New("archive document too large")
+)
+
+// readIndexArchive validates the archive's header and indexes its documents
+// as they are read. It returns the number of documents indexed, which are
+// kept when a later one is malformed.
+func (s *Search) readIndexArchive(body io.Reader) (int, error) {
+	zr, err := gzip.NewReader(bufio.NewReader(body))
+	if err != nil {
+		return 0, errNotAnArchive
+	}
+	limit := int64(2*archiveMaxDocument + documentSlack)
+	in := &documentReader{r: &archiveReader{r: zr, left: archiveMaxData}, max: limit, left: limit}
+	dec := json.NewDecoder(in)
+
+	var header exportHeader
+	if err := dec.Decode(&header); err != nil || header.Format != exportFormat {
+		return 0, errNotAnArchive
+	}
+	if header.Version != exportVersion {
+		return 0, fmt.Errorf("unsupported archive version %d (this server reads version %d)", header.Version, exportVersion)
+	}
+
+	imported := 0
+	for {
+		var doc exportDocument
+		in.next()
+		if err := dec.Decode(&doc); err == io.EOF {
+			return imported, nil
+		} else if err != nil {
+			if err = in.cause(err); err == errDocumentTooLarge {
+				return imported, errArchiveDocumentTooLarge
+			} else if err == errArchiveTooLarge {
+				return imported, err
+			}
+			return imported, fmt.Errorf("document %d: %v", imported+1, err)
+		}
+		if doc.Path == "" || doc.Body == "" {
+			return imported, fmt.Errorf("document %d: missing path or body", imported+1)
+		}
+
+		record := s.Indexer.Record(doc.Path)
+		record.SetTitle(doc.Title)
+		record.Write([]byte(doc.Body))
+		record.SetImage(doc.Image)
+		record.SetDescription(doc.Description)
+		record.SetComments(doc.Comments)
+		record.SetExcerpt(doc.Excerpt)
+		record.SetSections(doc.Sections)
+		record.SetTranslations(doc.Translations)
+		record.SetLanguage(doc.Language)
+		record.SetFields(doc.Fields)
+		record.SetPriority(doc.Priority)
+		if doc.Modified != nil {
+			record.SetModified(*doc.Modified)
+		}
+		s.Indexer.Pipe(record)
+		imported++
+	}
+}
+
+// archiveReader fails with errArchiveTooLarge once it has read its allowance
+// of decompressed data, where io.LimitReader would end the archive silently
+type archiveReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (a *archiveReader) Read(p []byte) (int, error) {
+	if a.left <= 0 {
+		return 0, errArchiveTooLarge
+	}
+	if int64(len(p)) > a.left {
+		p = p[:a.left]
+	}
+	n, err := a.r.Read(p)
+	a.left -= int64(n)
+	return n, err
+}
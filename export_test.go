@@ -0,0 +1,101 @@
+package search_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIndexArchive(t *testing.T) {
+	Convey("Given a search middleware with an indexed page and the export endpoint", t, func() {
+		config := func() *search.Config {
+			return &search.Config{ExportEndpoint: "/search/export", Token: "secret"}
+		}
+		source, cleanup := newTestSearch(config())
+		defer cleanup()
+		indexFixture(source, "fields/plugin.html")
+
+		archive := func(s *search.Search, method string, body []byte) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/search/export", bytes.NewReader(body))
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			return w
+		}
+
+		gzipped := func(text string) []byte {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write([]byte(text))
+			zw.Close()
+			return buf.Bytes()
+		}
+
+		Convey("Should reject requests without a valid token", func() {
+			req := httptest.NewRequest("GET", "/search/export", nil)
+			status, _ := source.ServeHTTP(httptest.NewRecorder(), req)
+			So(status, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("Should restore an exported index on another instance", func() {
+			export := archive(source, "GET", nil)
+			So(export.Code, ShouldEqual, http.StatusOK)
+			So(export.Header().Get("Content-Type"), ShouldEqual, "application/gzip")
+
+			target, cleanup := newTestSearch(config())
+			defer cleanup()
+
+			w := archive(target, "POST", export.Body.Bytes())
+			So(w.Code, ShouldEqual, http.StatusAccepted)
+			So(w.Body.String(), ShouldEqual, `{"imported":1}`)
+
+			for i := 0; i < 100 && target.Indexer.DocCount() == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			expected := searchJSON(source, "product:cli")
+			results := searchJSON(target, "product:cli")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, expected[0].Path)
+			So(results[0].Title, ShouldEqual, expected[0].Title)
+			So(results[0].Fields, ShouldResemble, expected[0].Fields)
+		})
+
+		Convey("Should reject data that is not an archive", func() {
+			w := archive(source, "POST", []byte("not gzip"))
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+			So(w.Body.String(), ShouldEqual, `{"error":"not a search index archive","imported":0}`)
+
+			w = archive(source, "POST", gzipped(`{"format":"something-else","version":1}`))
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("Should reject archives of another version", func() {
+			w := archive(source, "POST", gzipped(`{"format":"caddy-search-index","version":2}`+"\n"+`{"path":"/a","body":"text"}`))
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+			So(w.Body.String(), ShouldContainSubstring, "unsupported archive version 2 (this server reads version 1)")
+			So(strings.Contains(w.Body.String(), `"imported":0`), ShouldBeTrue)
+		})
+
+		Convey("Should reject archives too large to import", func() {
+			req := httptest.NewRequest("POST", "/search/export", bytes.NewReader(gzipped("")))
+			req.Header.Set("Authorization", "Bearer secret")
+			req.ContentLength = 2 << 30
+			status, _ := source.ServeHTTP(httptest.NewRecorder(), req)
+			So(status, ShouldEqual, http.StatusRequestEntityTooLarge)
+		})
+
+		Convey("Should stop at a document too large to import", func() {
+			w := archive(source, "POST", gzipped(`{"format":"caddy-search-index","version":1}`+"\n"+
+				`{"path":"/a","body":"text"}`+"\n"+`{"path":"/b","body":"`+strings.Repeat("a", 48<<20)+`"}`))
+			So(w.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(w.Body.String(), ShouldEqual, `{"error":"archive document too large","imported":1}`)
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"mime"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// Extractor pulls the text out of a document format the pipeline cannot
+// read as text or HTML, such as an office document. The title is empty when
+// the document does not declare one.
+type Extractor interface {
+	Extract(body []byte) (title, text string, err error)
+}
+
+var (
+	extractorsMutex     sync.RWMutex
+	extractors          = make(map[string]Extractor)
+	extractorExtensions = make(map[string]string)
+)
+
+// RegisterExtractor makes the pipeline index documents of a media type, and
+// files with one of the extensions (e.g. ".docx") served without one, with
+// the text the extractor pulls out of them. Registering a media type twice
+// replaces the previous extractor.
+func RegisterExtractor(mediaType string, extensions []string, extractor Extractor) {
+	extractorsMutex.Lock()
+	defer extractorsMutex.Unlock()
+	extractors[mediaType] = extractor
+	for _, ext := range extensions {
+		extractorExtensions[strings.ToLower(ext)] = mediaType
+	}
+}
+
+// extractorFor returns the extractor of the record's format, chosen by its
+// content type or, failing that, by its file extension
+func extractorFor(record indexer.Record) (Extractor, bool) {
+	extractorsMutex.RLock()
+	defer extractorsMutex.RUnlock()
+
+	mediaType, _, _ := mime.ParseMediaType(record.ContentType())
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType = extractorExtensions[strings.ToLower(path.Ext(record.Path()))]
+	}
+	extractor, ok := extractors[mediaType]
+	return extractor, ok
+}
+
+// extractText replaces the record's body with the text of the document it
+// holds, which is then indexed as plain text. It reports whether the
+// document could be read.
+func extractText(record indexer.Record, extractor Extractor) bool {
+	title, text, err := extractor.Extract(record.Body())
+	if err != nil {
+		return false
+	}
+
+	if record.Title() == "" {
+		record.SetTitle(title)
+	}
+	record.SetBody([]byte(text))
+	record.SetContentType("text/plain; charset=utf-8")
+	return true
+}
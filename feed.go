@@ -0,0 +1,225 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxFeedSize bounds how much of a feed is read, the size the sitemap
+// protocol allows a sitemap
+const maxFeedSize = 50 << 20
+
+// feedEntry is a page listed by a feed, with the time it changed when the
+// feed provides one. XML feeds also carry the entry's title and its HTML
+// description, sitemaps the page's priority.
+type feedEntry struct {
+	URL         string `json:"url"`
+	Updated     string `json:"updated"`
+	Title       string `json:"-"`
+	Description string `json:"-"`
+	Priority    string `json:"-"`
+}
+
+// xmlFeed covers RSS and Atom documents as well as sitemaps
+type xmlFeed struct {
+	Items []struct {
+		Link        string `xml:"link"`
+		PubDate     string `xml:"pubDate"`
+		Title       string `xml:"title"`
+		Description string `xml:"description"`
+		Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	} `xml:"channel>item"`
+	Entries []struct {
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Updated string `xml:"updated"`
+		Title   string `xml:"title"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+	} `xml:"entry"`
+	URLs []struct {
+		Loc      string `xml:"loc"`
+		LastMod  string `xml:"lastmod"`
+		Priority string `xml:"priority"`
+	} `xml:"url"`
+}
+
+// parseChangeFeed extracts the entries of an RSS or Atom feed, of a sitemap,
+// or of a JSON array listing URLs either as strings or as `{"url", "updated"}`
+// objects
+func parseChangeFeed(body []byte) ([]feedEntry, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, errors.New("empty feed")
+	}
+
+	if body[0] == '[' {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, err
+		}
+
+		entries := make([]feedEntry, 0, len(raw))
+		for _, item := range raw {
+			var entry feedEntry
+			if err := json.Unmarshal(item, &entry.URL); err != nil {
+				if err := json.Unmarshal(item, &entry); err != nil {
+					return nil, err
+				}
+			}
+			if entry.URL != "" {
+				entries = append(entries, entry)
+			}
+		}
+		return entries, nil
+	}
+
+	var feed xmlFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, err
+	}
+
+	entries := make([]feedEntry, 0, len(feed.Items)+len(feed.Entries)+len(feed.URLs))
+	for _, item := range feed.Items {
+		if item.Link != "" {
+			description := item.Content
+			if description == "" {
+				description = item.Description
+			}
+			entries = append(entries, feedEntry{
+				URL:         strings.TrimSpace(item.Link),
+				Updated:     item.PubDate,
+				Title:       item.Title,
+				Description: description,
+			})
+		}
+	}
+	for _, entry := range feed.Entries {
+		for _, link := range entry.Links {
+			if link.Href != "" && (link.Rel == "" || link.Rel == "alternate") {
+				description := entry.Content
+				if description == "" {
+					description = entry.Summary
+				}
+				entries = append(entries, feedEntry{
+					URL:         link.Href,
+					Updated:     entry.Updated,
+					Title:       entry.Title,
+					Description: description,
+				})
+				break
+			}
+		}
+	}
+
+	for _, url := range feed.URLs {
+		if loc := strings.TrimSpace(url.Loc); loc != "" {
+			entries = append(entries, feedEntry{
+				URL:      loc,
+				Updated:  strings.TrimSpace(url.LastMod),
+				Priority: strings.TrimSpace(url.Priority),
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// ChangeFeed polls a feed listing the site's recently changed pages and
+// enqueues only those pages into the crawler
+type ChangeFeed struct {
+	url     string
+	crawler *Crawler
+	client  *http.Client
+}
+
+// NewChangeFeed creates a ChangeFeed for the feed at the given URL, which may
+// be relative to the site root
+func NewChangeFeed(feedURL string, crawler *Crawler) *ChangeFeed {
+	if path, ok := crawler.SitePath(feedURL); ok {
+		feedURL = crawler.config.crawlBase() + path
+	}
+
+	return &ChangeFeed{
+		url:     feedURL,
+		crawler: crawler,
+		client:  crawler.client,
+	}
+}
+
+// Watch polls the feed forever at the given interval. A cycle whose feed
+// cannot be fetched or parsed is skipped.
+func (f *ChangeFeed) Watch(interval time.Duration) {
+	tick := time.NewTicker(interval)
+	for {
+		if err := f.Poll(); err != nil {
+			log.Printf("[search] change feed %s: %v", f.url, err)
+		}
+		<-tick.C
+	}
+}
+
+// Poll fetches the feed once and enqueues the pages that are new to it or
+// changed since the last poll. Entries without a change time are always
+// enqueued.
+func (f *ChangeFeed) Poll() error {
+	f.crawler.StartCycle()
+	// a failed poll also ends the first cycle, with nothing to fetch
+	defer f.crawler.markListed()
+
+	req, err := newCrawlRequest(f.crawler.config, f.url)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxFeedSize {
+		return fmt.Errorf("feed larger than %d bytes", maxFeedSize)
+	}
+
+	entries, err := parseChangeFeed(body)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path, ok := f.crawler.SitePath(entry.URL)
+		if !ok {
+			continue
+		}
+
+		f.crawler.setPriority(path, entry.Priority)
+		// listed pages exist, even those not fetched again
+		f.crawler.pipeline.Confirm(path)
+		if f.crawler.changed(path, entry.Updated) && !f.crawler.Enqueue(path) {
+			f.crawler.forget(path)
+		}
+	}
+	f.crawler.persist()
+
+	return nil
+}
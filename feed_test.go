@@ -0,0 +1,167 @@
+package search_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChangeFeed(t *testing.T) {
+	Convey("Given a site exposing an RSS change feed", t, func() {
+		updated := "Mon, 02 Jan 2006 15:04:05 GMT"
+		feed := ""
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/changes.xml":
+				fmt.Fprint(w, feed)
+			default:
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprintf(w, "<html><head><title>%s</title></head><body>page</body></html>", r.URL.Path)
+			}
+		}))
+		defer server.Close()
+
+		feed = `<?xml version="1.0"?><rss version="2.0"><channel>
+			<item><link>` + server.URL + `/a</link><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+			<item><link>/b</link><pubDate>` + updated + `</pubDate></item>
+			<item><link>https://elsewhere.example.com/c</link></item>
+		</channel></rss>`
+
+		config := &search.Config{SiteURL: server.URL}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+		changes := search.NewChangeFeed("/changes.xml", crawler)
+
+		crawled := func() []string {
+			paths := []string{}
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				paths = append(paths, rec.Path())
+			}
+			sort.Strings(paths)
+			return paths
+		}
+
+		Convey("Should crawl every page of the site listed on the first poll", func() {
+			So(changes.Poll(), ShouldBeNil)
+			So(crawled(), ShouldResemble, []string{"/a", "/b"})
+
+			Convey("Should only crawl pages that changed on the next poll", func() {
+				feed = `<?xml version="1.0"?><rss version="2.0"><channel>
+					<item><link>` + server.URL + `/a</link><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+					<item><link>/b</link><pubDate>Tue, 03 Jan 2006 15:04:05 GMT</pubDate></item>
+				</channel></rss>`
+				So(changes.Poll(), ShouldBeNil)
+				So(crawled(), ShouldResemble, []string{"/b"})
+			})
+		})
+
+		Convey("Should accept a sitemap and record the pages' priorities", func() {
+			feed = `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<url><loc>` + server.URL + `/a</loc><lastmod>2006-01-02</lastmod><priority>0.9</priority></url>
+				<url><loc>` + server.URL + `/b</loc></url>
+			</urlset>`
+			So(changes.Poll(), ShouldBeNil)
+
+			priorities := map[string]float64{}
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				priorities[rec.Path()] = rec.Priority()
+			}
+			So(priorities, ShouldResemble, map[string]float64{"/a": 0.9, "/b": 0.5})
+		})
+
+		Convey("Should accept a JSON list of changed URLs", func() {
+			feed = `["/a", {"url": "/b", "updated": "2006-01-02"}]`
+			So(changes.Poll(), ShouldBeNil)
+			So(crawled(), ShouldResemble, []string{"/a", "/b"})
+		})
+
+		Convey("Should skip the cycle when the feed cannot be parsed", func() {
+			feed = `<rss><channel><item>`
+			So(changes.Poll(), ShouldNotBeNil)
+			So(crawled(), ShouldBeEmpty)
+		})
+
+		Convey("Should skip the cycle when the feed is larger than 50 MB", func() {
+			feed = `<?xml version="1.0"?><rss version="2.0"><channel><item><link>/a</link></item><!--` +
+				strings.Repeat(" ", 50<<20) + `--></channel></rss>`
+			err := changes.Poll()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "feed larger than")
+			So(crawled(), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestCrawlBudget(t *testing.T) {
+	Convey("Given a change feed listing more pages than a cycle may fetch", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/changes.xml":
+				fmt.Fprint(w, `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+					<url><loc>/a</loc><lastmod>2006-01-02</lastmod></url>
+					<url><loc>/b</loc><lastmod>2006-01-02</lastmod></url>
+					<url><loc>/c</loc><lastmod>2006-01-02</lastmod></url>
+				</urlset>`)
+			default:
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprintf(w, "<html><head><title>%s</title></head><body>page</body></html>", r.URL.Path)
+			}
+		}))
+		defer server.Close()
+
+		config := &search.Config{SiteURL: server.URL, MaxCrawlPages: 2}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		crawler := search.NewCrawler(config, capture, pipeline)
+		changes := search.NewChangeFeed("/changes.xml", crawler)
+
+		crawled := func() []string {
+			paths := []string{}
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				paths = append(paths, rec.Path())
+			}
+			sort.Strings(paths)
+			return paths
+		}
+
+		Convey("Should stop fetching once the budget is reached", func() {
+			So(changes.Poll(), ShouldBeNil)
+			first := crawled()
+			So(first, ShouldHaveLength, 2)
+
+			budget := crawler.Stats().Budget
+			So(budget, ShouldNotBeNil)
+			So(budget.Pages, ShouldEqual, 2)
+			So(budget.MaxPages, ShouldEqual, 2)
+			So(budget.Reached, ShouldBeTrue)
+
+			Convey("Should fetch the pages left over on the next cycle", func() {
+				So(changes.Poll(), ShouldBeNil)
+				rest := crawled()
+				So(rest, ShouldHaveLength, 1)
+				So(first, ShouldNotContain, rest[0])
+				So(crawler.Stats().Budget.Reached, ShouldBeFalse)
+			})
+		})
+
+		Convey("Should keep the seeded pages left over for the next cycle", func() {
+			So(crawler.Seed([]string{"/d", "/e", "/f"}), ShouldEqual, 3)
+			So(crawled(), ShouldHaveLength, 2)
+			So(crawler.Stats().Deferred, ShouldEqual, 1)
+
+			crawler.StartCycle()
+			So(crawled(), ShouldHaveLength, 1)
+			So(crawler.Stats().Deferred, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package search
+
+import (
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"golang.org/x/net/html"
+)
+
+// feedTimeFormats are the date formats used by RSS and Atom feeds
+var feedTimeFormats = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"2006-01-02",
+}
+
+// isFeed reports whether the record holds an RSS or Atom feed, preferring its
+// content type and falling back to the file extension
+func isFeed(record indexer.Record) bool {
+	mediaType, _, _ := mime.ParseMediaType(record.ContentType())
+	switch mediaType {
+	case "application/rss+xml", "application/atom+xml":
+		return true
+	case "":
+		return strings.HasSuffix(record.Path(), ".rss") || strings.HasSuffix(record.Path(), ".atom")
+	}
+	return false
+}
+
+// indexFeed indexes every entry of a feed as a document of its own, under the
+// entry's link: a path for links into the site, the absolute URL otherwise.
+// The feed itself is not indexed.
+func (p *Pipeline) indexFeed(record indexer.Record) {
+	record.Ignore()
+
+	entries, err := parseChangeFeed(record.Body())
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		link := resolveURL(record.Path(), entry.URL)
+		if link == "" {
+			continue
+		}
+		if path, ok := p.config.sitePath(link); ok {
+			if !p.ValidatePath(path) {
+				continue
+			}
+			link = p.config.slashPath(path)
+		}
+
+		body := entry.Description
+		if doc, err := html.Parse(strings.NewReader(body)); err == nil {
+			body = string(stripHTML(doc))
+		}
+
+		title := normalizeText(strings.TrimSpace(entry.Title))
+		body = normalizeText(body)
+		if body == "" {
+			body = title
+		}
+		if body == "" {
+			continue
+		}
+
+		rec := p.indexer.Record(link)
+		rec.SetTitle(title)
+		rec.Write([]byte(body))
+		rec.SetModified(parseFeedTime(entry.Updated))
+		rec.SetLanguage(p.language(rec, ""))
+		p.indexer.Pipe(rec)
+	}
+}
+
+// parseFeedTime parses the date of a feed entry, returning the zero time when
+// it is missing or malformed
+func parseFeedTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, format := range feedTimeFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
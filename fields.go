@@ -0,0 +1,101 @@
+package search
+
+import (
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// resultView is a Result restricted to the fields a client asked for with the
+// fields parameter. Fields that were not asked for are nil and omitted.
+type resultView struct {
+	Path            *string             `json:",omitempty"`
+	URL             *string             `json:",omitempty"`
+	Title           *string             `json:",omitempty"`
+	TitleHighlights []indexer.Highlight `json:",omitempty"`
+	Body            *template.HTML      `json:",omitempty"`
+	Highlights      []indexer.Highlight `json:",omitempty"`
+	Image           *string             `json:",omitempty"`
+	Language        *string             `json:",omitempty"`
+	Fields          map[string]string   `json:",omitempty"`
+	Modified        *time.Time          `json:",omitempty"`
+	Indexed         *time.Time          `json:",omitempty"`
+	Hash            *string             `json:",omitempty"`
+	Alternates      []string            `json:",omitempty"`
+	Translations    map[string]string   `json:",omitempty"`
+	MatchedTerms    []string            `json:",omitempty"`
+	Score           *float64            `json:",omitempty"`
+	Debug           *Debug              `json:",omitempty"`
+}
+
+// selectFields restricts the results to the comma-separated list of field
+// names, matched case-insensitively. Unknown names are reported as warnings
+// in each result's debug field.
+func selectFields(results []Result, fields string) []resultView {
+	views := make([]resultView, len(results))
+
+	var warnings []string
+	for i := range results {
+		result := &results[i]
+		view := &views[i]
+
+		for _, field := range strings.Split(fields, ",") {
+			switch strings.ToLower(strings.TrimSpace(field)) {
+			case "path":
+				view.Path = &result.Path
+			case "url":
+				if result.URL != "" {
+					view.URL = &result.URL
+				}
+			case "title":
+				view.Title = &result.Title
+			case "body":
+				view.Body = &result.Body
+			case "image":
+				view.Image = &result.Image
+			case "language":
+				view.Language = &result.Language
+			case "fields":
+				view.Fields = result.Fields
+			case "modified":
+				view.Modified = &result.Modified
+			case "indexed":
+				view.Indexed = &result.Indexed
+			case "hash":
+				view.Hash = &result.Hash
+			case "alternates":
+				view.Alternates = result.Alternates
+			case "translations":
+				view.Translations = result.Translations
+			case "matched_terms":
+				view.MatchedTerms = result.MatchedTerms
+			case "score":
+				view.Score = &result.Score
+			case "debug":
+				view.Debug = result.Debug
+			case "title_highlights":
+				view.TitleHighlights = result.TitleHighlights
+			case "highlights":
+				view.Highlights = result.Highlights
+			case "":
+			default:
+				if i == 0 {
+					warnings = append(warnings, "unknown field `"+strings.TrimSpace(field)+"` ignored")
+				}
+			}
+		}
+
+		if len(warnings) > 0 {
+			debug := Debug{}
+			if view.Debug != nil {
+				debug = *view.Debug
+			}
+			debug.Warnings = warnings
+			view.Debug = &debug
+		}
+	}
+
+	return views
+}
@@ -0,0 +1,54 @@
+package search_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResultFields(t *testing.T) {
+	Convey("Given an indexed page", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "install.html")
+
+		fields := func(query string) []map[string]interface{} {
+			req := httptest.NewRequest("GET", "/search?q=install"+query, nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+
+			var results []map[string]interface{}
+			So(json.Unmarshal(w.Body.Bytes(), &results), ShouldBeNil)
+			So(results, ShouldHaveLength, 1)
+			return results
+		}
+
+		Convey("Should serialize every field by default", func() {
+			result := fields("")[0]
+			So(result, ShouldContainKey, "Path")
+			So(result, ShouldContainKey, "Body")
+			So(result, ShouldContainKey, "Score")
+		})
+
+		Convey("Should only serialize the requested fields", func() {
+			result := fields("&fields=path,TITLE,score")[0]
+			So(result, ShouldHaveLength, 3)
+			So(result["Path"], ShouldEqual, "/install.html")
+			So(result, ShouldContainKey, "Title")
+			So(result, ShouldContainKey, "Score")
+		})
+
+		Convey("Should warn about unknown fields in the debug field", func() {
+			result := fields("&fields=path,rank")[0]
+			So(result, ShouldHaveLength, 2)
+			So(result["Debug"], ShouldResemble, map[string]interface{}{
+				"Warnings": []interface{}{"unknown field `rank` ignored"},
+			})
+		})
+	})
+}
@@ -0,0 +1,151 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// splitFilters separates the custom field terms of a query, as in tag:go,
+// tag:"big data" or tag:(go rust), from its other terms. The values given for
+// a field match any of them, while the terms naming different fields must all
+// match. Field names are lowercase; terms prefixed with + or -, and those
+// naming an indexed field such as Title:, stay in the query. A lowercase name
+// that no page holds a custom field of, or a value starting with / or : as
+// in a URL, is text, and so is its colon.
+func (s *Search) splitFilters(text string) (rest string, filters map[string][]string) {
+	if !strings.Contains(text, ":") {
+		return text, nil
+	}
+
+	words := indexer.QueryWords(text)
+	kept := []string{}
+	for i := 0; i < len(words); i++ {
+		name, value, ok := filterTerm(words[i])
+		if !ok {
+			kept = append(kept, words[i])
+			continue
+		}
+		if strings.HasPrefix(value, "/") || strings.HasPrefix(value, ":") || len(s.Indexer.FieldValues(name)) == 0 {
+			kept = append(kept, name+`\:`+value)
+			continue
+		}
+
+		var values []string
+		switch {
+		case strings.HasPrefix(value, "("):
+			group, end := closeGroup(words, i, len(name)+2, ")")
+			if end < 0 {
+				kept = append(kept, words[i])
+				continue
+			}
+			values, i = strings.Fields(group), end
+		case strings.HasPrefix(value, `"`):
+			phrase, end := closeGroup(words, i, len(name)+2, `"`)
+			if end < 0 {
+				kept = append(kept, words[i])
+				continue
+			}
+			values, i = []string{phrase}, end
+		default:
+			values = []string{value}
+		}
+
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			if filters == nil {
+				filters = make(map[string][]string)
+			}
+			if !containsFold(filters[name], value) {
+				filters[name] = append(filters[name], value)
+			}
+		}
+	}
+
+	return strings.Join(kept, " "), filters
+}
+
+// filterTerm splits a word of the form name:value whose name could be a
+// lowercase custom field name
+func filterTerm(word string) (name, value string, ok bool) {
+	i := strings.Index(word, ":")
+	if i <= 0 || i == len(word)-1 {
+		return "", "", false
+	}
+	for _, r := range word[:i] {
+		if !unicode.IsLower(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return "", "", false
+		}
+	}
+	if !unicode.IsLower([]rune(word)[0]) {
+		return "", "", false
+	}
+	return word[:i], word[i+1:], true
+}
+
+// closeGroup joins the words from words[start][offset:] up to the first one
+// ending with the closing delimiter, both delimiters excluded, and returns
+// the index of that word, or -1 when none closes the group
+func closeGroup(words []string, start, offset int, delim string) (string, int) {
+	parts := []string{words[start][offset:]}
+	for end := start; end < len(words); end++ {
+		if end > start {
+			parts = append(parts, words[end])
+		}
+		last := parts[len(parts)-1]
+		if strings.HasSuffix(last, delim) {
+			parts[len(parts)-1] = strings.TrimSuffix(last, delim)
+			return strings.TrimSpace(strings.Join(parts, " ")), end
+		}
+	}
+	return "", -1
+}
+
+// containsFold reports whether values holds value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatFilters writes filters back as query terms, in the order of their
+// field names, as in `author:jane tag:(go rust)`
+func formatFilters(filters map[string][]string) string {
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	terms := make([]string, len(names))
+	for i, name := range names {
+		values := make([]string, len(filters[name]))
+		for j, value := range filters[name] {
+			if strings.ContainsAny(value, " \t") {
+				value = `"` + value + `"`
+			}
+			values[j] = value
+		}
+		if len(values) == 1 {
+			terms[i] = name + ":" + values[0]
+		} else {
+			terms[i] = name + ":(" + strings.Join(values, " ") + ")"
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// versionFilter returns the version a query is restricted to, if a single one
+func versionFilter(query indexer.Query) string {
+	if versions := query.Filters[versionField]; len(versions) == 1 {
+		return versions[0]
+	}
+	return ""
+}
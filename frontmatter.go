@@ -0,0 +1,48 @@
+package search
+
+import (
+	"bytes"
+	"strings"
+)
+
+// frontMatterDelimiter opens and closes the front matter of a text document
+const frontMatterDelimiter = "---"
+
+// frontMatter splits the YAML front matter, delimited by --- lines, off the
+// start of a text document. It returns the top-level values of the front
+// matter by key and the text that follows it, or ok false when the document
+// has none. Values other than single-line scalars are left out.
+func frontMatter(body []byte) (values map[string]string, text []byte, ok bool) {
+	lines := strings.SplitAfter(string(body), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != frontMatterDelimiter {
+		return nil, body, false
+	}
+
+	values = make(map[string]string)
+	offset := len(lines[0])
+	for _, line := range lines[1:] {
+		offset += len(line)
+		if strings.TrimSpace(line) == frontMatterDelimiter {
+			return values, bytes.TrimLeft(body[offset:], "\r\n"), true
+		}
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if value != "" && !strings.ContainsAny(value[:1], "[{|>") {
+			values[key] = value
+		}
+	}
+
+	// an unclosed block is text
+	return nil, body, false
+}
@@ -0,0 +1,56 @@
+package search
+
+import (
+	"net/http"
+	"strings"
+)
+
+// maxIndexHeaders is the number of response headers index_headers may name
+const maxIndexHeaders = 10
+
+// headerField returns the custom field a response header is stored as, its
+// name in lowercase, as in last-modified. It reports false for names that
+// cannot name a field.
+func headerField(name string) (string, bool) {
+	field := strings.ToLower(name)
+	return field, validFieldName(field)
+}
+
+// headerFields returns the values of the named response headers as custom
+// fields. Repeated headers are joined with commas and long values are cut.
+func headerFields(header http.Header, names []string) map[string]string {
+	var fields map[string]string
+	for _, name := range names {
+		field, ok := headerField(name)
+		if !ok {
+			continue
+		}
+		value := strings.Join(strings.Fields(strings.Join(header.Values(name), ", ")), " ")
+		if value == "" {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		fields[field] = truncate(value, maxFieldValue)
+	}
+	return fields
+}
+
+// mergeFields adds the fields of extra a page does not declare itself, up to
+// maxCustomFields
+func mergeFields(fields, extra map[string]string) map[string]string {
+	for name, value := range extra {
+		if _, ok := fields[name]; ok {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		if len(fields) >= maxCustomFields {
+			break
+		}
+		fields[name] = value
+	}
+	return fields
+}
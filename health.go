@@ -0,0 +1,65 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// Health reports whether the index is ready to serve queries, for load
+// balancers and readiness probes. It answers 503 until the startup scan, and
+// the crawler's first cycle when the site is crawled, have gone through the
+// pipeline or the index holds the configured minimum number of documents,
+// and 200 from then on. While writes to the index keep failing
+// it answers 503 as degraded.
+func (s *Search) Health(w http.ResponseWriter, r *http.Request) (int, error) {
+	ready := s.indexReady()
+	docs := s.Indexer.DocCount()
+	index := s.Indexer.Status()
+
+	status, state := http.StatusOK, "ready"
+	switch {
+	case !ready:
+		status, state = http.StatusServiceUnavailable, "starting"
+	case index.Degraded:
+		status, state = http.StatusServiceUnavailable, "degraded"
+	}
+
+	report := map[string]interface{}{
+		"status":    state,
+		"documents": docs,
+	}
+	if index.Failures > 0 {
+		report["index_errors"] = index.Failures
+		report["last_error"] = index.LastError
+	}
+	if s.queries != nil {
+		report["queries_in_flight"] = s.queries.queriesInFlight()
+	}
+
+	jresp, err := json.Marshal(report)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	w.Write(jresp)
+	return status, nil
+}
+
+// indexReady reports whether the startup scan, and the crawler's first cycle
+// if any, have gone through the pipeline or the index holds the configured
+// minimum number of documents. Once ready the index stays ready.
+func (s *Search) indexReady() bool {
+	if atomic.LoadInt32(&s.ready) == 0 {
+		docs := s.Indexer.DocCount()
+		// the crawler pipes a page before it counts as fetched
+		crawled := s.Crawler == nil || s.Crawler.FirstCycleDone()
+		if crawled && s.Pipeline.Settled() || (s.Config.HealthMinDocs > 0 && docs >= s.Config.HealthMinDocs) {
+			atomic.StoreInt32(&s.ready, 1)
+		}
+	}
+	return atomic.LoadInt32(&s.ready) == 1
+}
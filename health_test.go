@@ -0,0 +1,91 @@
+package search_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHealth(t *testing.T) {
+	Convey("Given a search middleware with the health endpoint enabled", t, func() {
+		health := func(s *search.Search) int {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest("GET", "/search/health", nil))
+			return w.Code
+		}
+
+		Convey("Should be unavailable until the startup scan is indexed", func() {
+			s, cleanup := newTestSearch(&search.Config{HealthEndpoint: "/search/health"})
+			defer cleanup()
+
+			indexFixture(s, "install.html")
+			So(health(s), ShouldEqual, http.StatusServiceUnavailable)
+
+			s.Pipeline.MarkScanned()
+			So(health(s), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("Should be unavailable until the crawler's first cycle is indexed", func() {
+			release := make(chan struct{})
+			site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/changes.json":
+					fmt.Fprint(w, `["/a"]`)
+				default:
+					<-release
+					w.Header().Set("Content-Type", "text/html")
+					fmt.Fprint(w, "<html><head><title>A</title></head><body>A crawled page.</body></html>")
+				}
+			}))
+			defer site.Close()
+
+			config := &search.Config{HealthEndpoint: "/search/health", SiteURL: site.URL}
+			s, cleanup := newTestSearch(config)
+			defer cleanup()
+			s.Crawler = search.NewCrawler(config, s.Indexer, s.Pipeline)
+			s.Pipeline.MarkScanned()
+			So(health(s), ShouldEqual, http.StatusServiceUnavailable)
+
+			So(search.NewChangeFeed("/changes.json", s.Crawler).Poll(), ShouldBeNil)
+			So(health(s), ShouldEqual, http.StatusServiceUnavailable)
+
+			close(release)
+			for i := 0; i < 100 && health(s) != http.StatusOK; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(health(s), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("Should be ready once the minimum document count is reached", func() {
+			s, cleanup := newTestSearch(&search.Config{HealthEndpoint: "/search/health", HealthMinDocs: 2})
+			defer cleanup()
+
+			indexFixture(s, "install.html")
+			So(health(s), ShouldEqual, http.StatusServiceUnavailable)
+
+			indexFixture(s, "typography.html")
+			So(health(s), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("Should be degraded while writes to the index fail", func() {
+			s, cleanup := newTestSearch(&search.Config{HealthEndpoint: "/search/health"})
+			defer cleanup()
+
+			s.Pipeline.MarkScanned()
+			So(health(s), ShouldEqual, http.StatusOK)
+
+			So(s.Indexer.Close(), ShouldBeNil)
+			indexFixture(s, "install.html")
+			for i := 0; i < 100 && !s.Indexer.Status().Degraded; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(health(s), ShouldEqual, http.StatusServiceUnavailable)
+			So(s.Indexer.Status().Failures, ShouldEqual, 1)
+		})
+	})
+}
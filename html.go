@@ -0,0 +1,415 @@
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blockElements are the elements that start a new line of text when stripped
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Body: true, atom.Br: true, atom.Dd: true, atom.Div: true, atom.Dl: true,
+	atom.Dt: true, atom.Figcaption: true, atom.Figure: true, atom.Footer: true,
+	atom.Form: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Header: true, atom.Hr: true, atom.Li: true,
+	atom.Main: true, atom.Nav: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Section: true, atom.Table: true, atom.Td: true, atom.Th: true, atom.Tr: true,
+	atom.Ul: true,
+}
+
+// skippedElements are the elements whose content is never part of the text:
+// code, styles, fallbacks for browsers without scripts and the markup of
+// templates, none of which a visitor reads
+var skippedElements = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+}
+
+// ampBoilerplate are the AMP components that hold configuration, ads and
+// notices rather than the page's content
+var ampBoilerplate = map[string]bool{
+	"amp-ad": true, "amp-analytics": true, "amp-auto-ads": true, "amp-bind-macro": true,
+	"amp-consent": true, "amp-embed": true, "amp-experiment": true, "amp-geo": true,
+	"amp-install-serviceworker": true, "amp-pixel": true, "amp-state": true,
+	"amp-sticky-ad": true, "amp-user-notification": true,
+}
+
+// skippedElement reports whether the content of the element n is never part
+// of the text. Custom elements, such as web components and most AMP ones,
+// are transparent: their text is kept, along with that of the shadow roots
+// they declare in a template, which browsers render.
+func skippedElement(n *html.Node) bool {
+	if n.DataAtom == atom.Template {
+		return !hasAttr(n, "shadowrootmode") && !hasAttr(n, "shadowroot")
+	}
+	if skippedElements[n.DataAtom] || ampBoilerplate[n.Data] {
+		return true
+	}
+	// the placeholder shown while an AMP component loads and the fallback
+	// shown when it cannot
+	if p := n.Parent; p != nil && p.Type == html.ElementNode && strings.HasPrefix(p.Data, "amp-") {
+		return hasAttr(n, "placeholder") || hasAttr(n, "fallback")
+	}
+	return false
+}
+
+// stripHTML extracts the readable text of an HTML document. Inline elements
+// are separated from the surrounding text by a space and block elements by a
+// line break, so adjacent words never merge into a single token.
+func stripHTML(doc *html.Node) []byte {
+	var buf bytes.Buffer
+	writeText(&buf, doc)
+
+	lines := strings.Split(buf.String(), "\n")
+	text := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			text = append(text, line)
+		}
+	}
+
+	return []byte(strings.Join(text, "\n"))
+}
+
+// writeText writes the text content of n to buf, marking element boundaries
+func writeText(buf *bytes.Buffer, n *html.Node) {
+	if n.Type == html.TextNode {
+		buf.WriteString(n.Data)
+		return
+	}
+
+	if n.Type == html.ElementNode && skippedElement(n) {
+		return
+	}
+
+	sep := " "
+	if n.Type == html.ElementNode && blockElements[n.DataAtom] {
+		sep = "\n"
+	}
+
+	buf.WriteString(sep)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(buf, c)
+	}
+	buf.WriteString(sep)
+}
+
+// findElement returns the first element in n's subtree, in document order,
+// for which match returns true
+func findElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, match); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// detachElements removes the elements of n's subtree for which match returns
+// true from the tree and returns them in document order. The subtree of a
+// removed element is not searched further.
+func detachElements(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	found := []*html.Node{}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && match(c) {
+			n.RemoveChild(c)
+			found = append(found, c)
+		} else {
+			found = append(found, detachElements(c, match)...)
+		}
+		c = next
+	}
+	return found
+}
+
+// selector matches elements by tag name, id and classes, as in `main`,
+// `#content` or `div.post.body`
+type selector struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+// parseSelector parses a selector made of an optional tag name followed by
+// any number of #id and .class parts
+func parseSelector(raw string) (*selector, error) {
+	s := raw
+	if s == "" || strings.ContainsAny(s, " \t>+~[]:*,") {
+		return nil, fmt.Errorf("unsupported selector %q", raw)
+	}
+
+	sel := &selector{}
+	i := strings.IndexAny(s, "#.")
+	if i < 0 {
+		i = len(s)
+	}
+	sel.tag, s = strings.ToLower(s[:i]), s[i:]
+
+	for s != "" {
+		kind := s[0]
+		s = s[1:]
+
+		i := strings.IndexAny(s, "#.")
+		if i < 0 {
+			i = len(s)
+		}
+		name := s[:i]
+		s = s[i:]
+
+		switch {
+		case name == "" || kind == '#' && sel.id != "":
+			return nil, fmt.Errorf("unsupported selector %q", raw)
+		case kind == '#':
+			sel.id = name
+		default:
+			sel.classes = append(sel.classes, name)
+		}
+	}
+
+	return sel, nil
+}
+
+// matches reports whether the element n is selected
+func (sel *selector) matches(n *html.Node) bool {
+	if sel.tag != "" && n.Data != sel.tag {
+		return false
+	}
+	if sel.id != "" && attr(n, "id") != sel.id {
+		return false
+	}
+
+	classes := strings.Fields(attr(n, "class"))
+	for _, class := range sel.classes {
+		found := false
+		for _, c := range classes {
+			if c == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// headingText returns the text of the first h1 in n's subtree
+func headingText(n *html.Node) string {
+	h1 := findElement(n, func(n *html.Node) bool {
+		return n.DataAtom == atom.H1
+	})
+	if h1 == nil {
+		return ""
+	}
+	return string(stripHTML(h1))
+}
+
+// attr returns the value of n's attribute with the given name
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasAttr reports whether n has an attribute with the given name, even empty
+func hasAttr(n *html.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasToken reports whether a space-separated attribute value such as `rel`
+// contains token, ignoring case
+func hasToken(value, token string) bool {
+	for _, t := range strings.Fields(value) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlImage returns the page's representative image from its og:image meta
+// tag or, failing that, its image_src link
+func htmlImage(doc *html.Node) string {
+	meta := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Meta && attr(n, "property") == "og:image" && attr(n, "content") != ""
+	})
+	if meta != nil {
+		return attr(meta, "content")
+	}
+
+	link := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Link && hasToken(attr(n, "rel"), "image_src") && attr(n, "href") != ""
+	})
+	if link != nil {
+		return attr(link, "href")
+	}
+
+	return ""
+}
+
+// htmlDescription returns the page's meta description
+func htmlDescription(doc *html.Node) string {
+	meta := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Meta && strings.EqualFold(attr(n, "name"), "description")
+	})
+	if meta == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(attr(meta, "content")), " ")
+}
+
+// htmlLang returns the primary language subtag of the lang attribute of the
+// page's html element, lowercased, as "de" for lang="de-CH"
+func htmlLang(doc *html.Node) string {
+	root := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Html
+	})
+	if root == nil {
+		return ""
+	}
+	lang := strings.TrimSpace(attr(root, "lang"))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return strings.ToLower(lang)
+}
+
+const (
+	// fieldAttrPrefix prefixes the attributes declaring a page's custom fields
+	fieldAttrPrefix = "data-search-"
+	// maxCustomFields is the number of custom fields kept per page
+	maxCustomFields = 20
+	// maxFieldName and maxFieldValue bound, in bytes, the name and value of a
+	// custom field
+	maxFieldName  = 32
+	maxFieldValue = 256
+)
+
+// htmlFields returns the custom fields the page declares with data-search-*
+// attributes, as in data-search-author="Jane Doe". An attribute without a
+// value takes the text of its element. The first declaration of a name wins;
+// invalid names and fields past maxCustomFields are dropped and long values
+// are cut.
+func htmlFields(doc *html.Node) map[string]string {
+	fields := make(map[string]string)
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, a := range n.Attr {
+				name := strings.TrimPrefix(a.Key, fieldAttrPrefix)
+				if name == a.Key || !validFieldName(name) || len(fields) >= maxCustomFields {
+					continue
+				}
+				if _, ok := fields[name]; ok {
+					continue
+				}
+
+				value := strings.Join(strings.Fields(a.Val), " ")
+				if value == "" {
+					value = strings.Join(strings.Fields(string(stripHTML(n))), " ")
+				}
+				if value != "" {
+					fields[name] = truncate(value, maxFieldValue)
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// validFieldName reports whether name, made of lowercase letters, digits,
+// underscores and dashes, can name a custom field
+func validFieldName(name string) bool {
+	if name == "" || len(name) > maxFieldName {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// truncate cuts s to at most n bytes without splitting a rune
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// htmlBase returns the URL the relative references of a page resolve against:
+// the href of its first <base> element, itself resolved against the page's
+// URL, or else the page's URL
+func htmlBase(page string, doc *html.Node) string {
+	base := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Base && strings.TrimSpace(attr(n, "href")) != ""
+	})
+	if base == nil {
+		return page
+	}
+	if resolved := resolveURL(page, attr(base, "href")); resolved != "" {
+		return resolved
+	}
+	return page
+}
+
+// resolveURL resolves a reference found on a page against the page's URL, or
+// against the URL its <base> element sets
+func resolveURL(page, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+
+	base, err := url.Parse(page)
+	if err != nil {
+		return ""
+	}
+
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+
+	return base.ResolveReference(refURL).String()
+}
@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultAnalyzer is the name of the analyzer used when none is configured
+const DefaultAnalyzer = "standard"
+
+// Token is a term produced by an Analyzer. Start and End are the byte offsets
+// of the term in the analyzed text and Position is its 1-based position in
+// the token sequence.
+type Token struct {
+	Term     string
+	Start    int
+	End      int
+	Position int
+}
+
+// Analyzer turns text into the tokens that are indexed and matched. The same
+// analyzer processes documents at index time and queries at search time.
+type Analyzer interface {
+	Analyze(text string) []Token
+}
+
+var (
+	analyzersMutex sync.RWMutex
+	analyzers      = make(map[string]Analyzer)
+)
+
+// RegisterAnalyzer makes an analyzer available by name to the `analyzer`
+// directive. Registering a name twice replaces the previous analyzer.
+func RegisterAnalyzer(name string, analyzer Analyzer) {
+	analyzersMutex.Lock()
+	defer analyzersMutex.Unlock()
+	analyzers[name] = analyzer
+}
+
+// GetAnalyzer returns the analyzer registered under name
+func GetAnalyzer(name string) (Analyzer, bool) {
+	analyzersMutex.RLock()
+	defer analyzersMutex.RUnlock()
+	analyzer, ok := analyzers[name]
+	return analyzer, ok
+}
+
+// Analyzers returns the names of every registered analyzer, sorted
+func Analyzers() []string {
+	analyzersMutex.RLock()
+	defer analyzersMutex.RUnlock()
+
+	names := make([]string, 0, len(analyzers))
+	for name := range analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
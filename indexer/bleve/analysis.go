@@ -0,0 +1,234 @@
+package bleve
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	unicodeTokenizer "github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+const (
+	// identifiersAnalyzer is the standard analyzer plus identifier splitting
+	identifiersAnalyzer = "caddy_identifiers"
+	// identifiersFilter splits camelCase and snake_case tokens
+	identifiersFilter = "split_identifiers"
+	// registeredTokenizer runs an analyzer from the indexer registry
+	registeredTokenizer = "caddy_registered"
+)
+
+func init() {
+	registry.RegisterTokenFilter(identifiersFilter, func(config map[string]interface{}, cache *registry.Cache) (analysis.TokenFilter, error) {
+		return &identifierFilter{}, nil
+	})
+	registry.RegisterAnalyzer(identifiersAnalyzer, identifiersAnalyzerConstructor)
+	registry.RegisterTokenizer(registeredTokenizer, registeredTokenizerConstructor)
+
+	std, err := registry.NewCache().AnalyzerNamed(standard.Name)
+	if err != nil {
+		panic(err)
+	}
+	indexer.RegisterAnalyzer(indexer.DefaultAnalyzer, &bleveAnalyzer{std})
+}
+
+// configureAnalyzer makes the configured analyzer the index's default, which
+// bleve applies both to indexed documents and to query strings
+func configureAnalyzer(indexMap *mapping.IndexMappingImpl, config indexer.Config) error {
+	name := config.Analyzer
+	if name == "" || name == indexer.DefaultAnalyzer {
+		// the standard analyzer runs natively
+		if config.SplitIdentifiers {
+			indexMap.DefaultAnalyzer = identifiersAnalyzer
+		}
+		return nil
+	}
+
+	filters := []string{}
+	if config.SplitIdentifiers {
+		filters = append(filters, identifiersFilter)
+	}
+
+	analyzer := "caddy_" + name
+	if err := addRegisteredAnalyzer(indexMap, analyzer, name, filters); err != nil {
+		return err
+	}
+
+	indexMap.DefaultAnalyzer = analyzer
+	return nil
+}
+
+// addRegisteredAnalyzer defines a bleve analyzer that tokenizes with the
+// analyzer registered under name and then applies the token filters
+func addRegisteredAnalyzer(indexMap *mapping.IndexMappingImpl, analyzer, name string, filters []string) error {
+	if _, ok := indexer.GetAnalyzer(name); !ok {
+		return fmt.Errorf("unknown analyzer %q", name)
+	}
+
+	// the tokenizer is shared by every analyzer running the same one
+	tokenizer := registeredTokenizer + "_" + name
+	if _, ok := indexMap.CustomAnalysis.Tokenizers[tokenizer]; !ok {
+		err := indexMap.AddCustomTokenizer(tokenizer, map[string]interface{}{
+			"type":     registeredTokenizer,
+			"analyzer": name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return indexMap.AddCustomAnalyzer(analyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     tokenizer,
+		"token_filters": filters,
+	})
+}
+
+func registeredTokenizerConstructor(config map[string]interface{}, cache *registry.Cache) (analysis.Tokenizer, error) {
+	name, _ := config["analyzer"].(string)
+	analyzer, ok := indexer.GetAnalyzer(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown analyzer %q", name)
+	}
+	return &analyzerTokenizer{analyzer}, nil
+}
+
+// analyzerTokenizer runs an indexer.Analyzer as a bleve tokenizer
+type analyzerTokenizer struct {
+	analyzer indexer.Analyzer
+}
+
+func (t *analyzerTokenizer) Tokenize(input []byte) analysis.TokenStream {
+	tokens := t.analyzer.Analyze(string(input))
+	stream := make(analysis.TokenStream, 0, len(tokens))
+
+	for i, token := range tokens {
+		position := token.Position
+		if position == 0 {
+			position = i + 1
+		}
+		stream = append(stream, &analysis.Token{
+			Term:     []byte(token.Term),
+			Start:    token.Start,
+			End:      token.End,
+			Position: position,
+			Type:     analysis.AlphaNumeric,
+		})
+	}
+
+	return stream
+}
+
+// bleveAnalyzer exposes a bleve analyzer as an indexer.Analyzer
+type bleveAnalyzer struct {
+	analyzer *analysis.Analyzer
+}
+
+func (a *bleveAnalyzer) Analyze(text string) []indexer.Token {
+	stream := a.analyzer.Analyze([]byte(text))
+	tokens := make([]indexer.Token, len(stream))
+
+	for i, token := range stream {
+		tokens[i] = indexer.Token{
+			Term:     string(token.Term),
+			Start:    token.Start,
+			End:      token.End,
+			Position: token.Position,
+		}
+	}
+
+	return tokens
+}
+
+func identifiersAnalyzerConstructor(config map[string]interface{}, cache *registry.Cache) (*analysis.Analyzer, error) {
+	tokenizer, err := cache.TokenizerNamed(unicodeTokenizer.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []analysis.TokenFilter{}
+	for _, name := range []string{identifiersFilter, lowercase.Name, en.StopName} {
+		filter, err := cache.TokenFilterNamed(name)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	return &analysis.Analyzer{
+		Tokenizer:    tokenizer,
+		TokenFilters: filters,
+	}, nil
+}
+
+// identifierFilter keeps every token and adds the parts of camelCase and
+// snake_case identifiers as extra tokens at the same position, so both
+// `getUserById` and `user` match
+type identifierFilter struct{}
+
+func (f *identifierFilter) Filter(input analysis.TokenStream) analysis.TokenStream {
+	output := make(analysis.TokenStream, 0, len(input))
+
+	for _, token := range input {
+		output = append(output, token)
+
+		parts := splitIdentifier(token.Term)
+		if len(parts) < 2 {
+			continue
+		}
+
+		for _, part := range parts {
+			output = append(output, &analysis.Token{
+				Term:     append([]byte(nil), token.Term[part[0]:part[1]]...),
+				Start:    token.Start + part[0],
+				End:      token.Start + part[1],
+				Position: token.Position,
+				Type:     token.Type,
+			})
+		}
+	}
+
+	return output
+}
+
+// splitIdentifier returns the byte ranges of the words of a camelCase or
+// snake_case identifier
+func splitIdentifier(term []byte) (parts [][2]int) {
+	start := 0
+	var prev rune
+
+	for i := 0; i < len(term); {
+		r, size := utf8.DecodeRune(term[i:])
+
+		if r == '_' {
+			if i > start {
+				parts = append(parts, [2]int{start, i})
+			}
+			start = i + size
+		} else if unicode.IsUpper(r) && i > start {
+			next, _ := utf8.DecodeRune(term[i+size:])
+			// a new word starts at a lower-to-upper transition (getUser) or at
+			// the last capital of an acronym followed by lowercase (HTTPServer)
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && unicode.IsLower(next)) {
+				parts = append(parts, [2]int{start, i})
+				start = i
+			}
+		}
+
+		prev = r
+		i += size
+	}
+
+	if start < len(term) {
+		parts = append(parts, [2]int{start, len(term)})
+	}
+
+	return parts
+}
@@ -0,0 +1,115 @@
+package bleve_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"github.com/pedronasser/caddy-search/indexer/bleve"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newIndexedRecord creates an index with a single document and waits until
+// it is searchable. The returned func removes the index.
+func newIndexedRecord(config indexer.Config, path, body string) (indexer.Handler, func()) {
+	dir, err := ioutil.TempDir("", "caddyIndexTest")
+	So(err, ShouldBeNil)
+
+	indxr, err := bleve.New(dir, config)
+	So(err, ShouldBeNil)
+
+	rec := indxr.Record(path)
+	rec.SetTitle(path)
+	rec.Write([]byte(body))
+	indxr.Pipe(rec)
+
+	for i := 0; i < 100 && !indxr.Record(path).Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return indxr, func() { os.RemoveAll(dir) }
+}
+
+func TestSplitIdentifiers(t *testing.T) {
+	body := "Call getUserById or HTTPServer with a snake_case_name."
+
+	Convey("Given an index with identifier splitting enabled", t, func() {
+		indxr, cleanup := newIndexedRecord(indexer.Config{SplitIdentifiers: true}, "/api", body)
+		defer cleanup()
+
+		Convey("Should match whole identifiers", func() {
+			So(indxr.Search(indexer.Query{Text: "getUserById"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "snake_case_name"}), ShouldHaveLength, 1)
+		})
+
+		Convey("Should match the parts of camelCase and snake_case identifiers", func() {
+			So(indxr.Search(indexer.Query{Text: "user"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "server"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "http"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "case"}), ShouldHaveLength, 1)
+		})
+	})
+
+	Convey("Given an index without identifier splitting", t, func() {
+		indxr, cleanup := newIndexedRecord(indexer.Config{}, "/api", body)
+		defer cleanup()
+
+		Convey("Should only match whole identifiers", func() {
+			So(indxr.Search(indexer.Query{Text: "getUserById"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "user"}), ShouldHaveLength, 0)
+		})
+	})
+}
+
+// whitespaceAnalyzer splits on whitespace only and lowercases every word
+type whitespaceAnalyzer struct{}
+
+func (whitespaceAnalyzer) Analyze(text string) (tokens []indexer.Token) {
+	offset := 0
+	for _, word := range strings.Fields(text) {
+		start := offset + strings.Index(text[offset:], word)
+		offset = start + len(word)
+		tokens = append(tokens, indexer.Token{Term: strings.ToLower(word), Start: start, End: offset})
+	}
+	return
+}
+
+func TestRegisteredAnalyzer(t *testing.T) {
+	Convey("Given the default analyzer", t, func() {
+		analyzer, ok := indexer.GetAnalyzer(indexer.DefaultAnalyzer)
+
+		Convey("Should be registered and usable in isolation", func() {
+			So(ok, ShouldBeTrue)
+			tokens := analyzer.Analyze("The Quick fox")
+			So(tokens, ShouldHaveLength, 2)
+			So(tokens[0].Term, ShouldEqual, "quick")
+			So(tokens[1].Term, ShouldEqual, "fox")
+		})
+	})
+
+	Convey("Given an index using a custom registered analyzer", t, func() {
+		indexer.RegisterAnalyzer("whitespace", whitespaceAnalyzer{})
+		indxr, cleanup := newIndexedRecord(indexer.Config{Analyzer: "whitespace"}, "/mail", "Send an E-Mail today")
+		defer cleanup()
+
+		Convey("Should analyze queries the same way as documents", func() {
+			So(indxr.Search(indexer.Query{Text: "e-mail"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "E-MAIL"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "mail"}), ShouldHaveLength, 0)
+		})
+	})
+
+	Convey("Given an index configured with an unknown analyzer", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		Convey("Should fail to open", func() {
+			_, err := bleve.New(dir, indexer.Config{Analyzer: "missing"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
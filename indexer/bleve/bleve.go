@@ -5,6 +5,9 @@ import (
 	"time"
 
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/pedronasser/caddy-search/indexer"
 	"github.com/pedronasser/go-piper"
 )
 
@@ -21,13 +24,35 @@ var bufPool = sync.Pool{
 }
 
 // New creates a new instance for this indexer
-func New(name string) (*bleveIndexer, error) {
-	blv, err := openIndex(name)
+func New(name string, config indexer.Config) (*bleveIndexer, error) {
+	return newIndexer(name, activePath(name), config)
+}
+
+// newIndexer creates an indexer named name whose index is stored at path,
+// the name itself unless the index was rebuilt
+func newIndexer(name, path string, config indexer.Config) (*bleveIndexer, error) {
+	blv, err := openIndex(name, path, config)
 	if err != nil {
 		return nil, err
 	}
 
-	indxr := &bleveIndexer{}
+	indxr := &bleveIndexer{
+		name:          name,
+		path:          path,
+		config:        config,
+		trigrams:      config.Trigrams,
+		minContains:   config.MinContainsLength,
+		minPrefix:     config.MinPrefixMatch,
+		minTermDF:     config.MinTermDF,
+		rare:          rareTermsOf(name),
+		commentWeight: config.CommentWeight,
+	}
+	if config.IncrementalSections {
+		indxr.sections = newSectionCache()
+	}
+	if indxr.minContains < minTrigramLength {
+		indxr.minContains = minTrigramLength
+	}
 
 	pipe, err := piper.New(
 		piper.P(1, indxr.index),
@@ -38,14 +63,29 @@ func New(name string) (*bleveIndexer, error) {
 	}
 
 	indxr.pipeline = pipe
-	indxr.bleve = blv
+	indxr.active = blv
+	indxr.bleve = bleve.NewIndexAlias(blv)
+	indxr.analyzer = defaultAnalyzer(blv)
+	indxr.languages = languageQueryAnalyzers(blv)
+	if indxr.minTermDF > 1 {
+		if err := indxr.rare.load(blv); err != nil {
+			return nil, err
+		}
+	}
 
-	go consumeOutput(pipe)
+	go indxr.consumeOutput()
 
 	return indxr, nil
 }
 
-func openIndex(name string) (bleve.Index, error) {
+// openIndex opens the index named name stored at path, creating it when it
+// does not exist
+func openIndex(name, path string, config indexer.Config) (bleve.Index, error) {
+	opts, err := parseOptions(config.Options)
+	if err != nil {
+		return nil, err
+	}
+
 	textFieldMapping := bleve.NewTextFieldMapping()
 
 	doc := bleve.NewDocumentMapping()
@@ -55,11 +95,27 @@ func openIndex(name string) (bleve.Index, error) {
 
 	indexMap := bleve.NewIndexMapping()
 	indexMap.AddDocumentMapping("document", doc)
+	indexMap.DefaultDateTimeParser = textDates
 
-	blv, err := bleve.New(name, indexMap)
+	addDocumentFields(indexMap.DefaultMapping)
+	if err := addLanguageMappings(indexMap, config.Segmenters); err != nil {
+		return nil, err
+	}
+
+	if err := configureAnalyzer(indexMap, config); err != nil {
+		return nil, err
+	}
+
+	if config.MinTermDF > 1 {
+		if err := addPrunedBodies(indexMap, name); err != nil {
+			return nil, err
+		}
+	}
+
+	blv, err := bleve.NewUsing(path, indexMap, opts.indexType, opts.kvStore, opts.config())
 
 	if err != nil {
-		blv, err = bleve.Open(name)
+		blv, err = bleve.OpenUsing(path, opts.config())
 		if err != nil {
 			return nil, err
 		}
@@ -68,12 +124,26 @@ func openIndex(name string) (bleve.Index, error) {
 	return blv, nil
 }
 
-func consumeOutput(pipe piper.Handler) {
+// defaultAnalyzer returns the analyzer the index applies to documents without
+// a language mapping
+func defaultAnalyzer(blv bleve.Index) string {
+	if indexMap, ok := blv.Mapping().(*mapping.IndexMappingImpl); ok {
+		return indexMap.DefaultAnalyzer
+	}
+	return standard.Name
+}
+
+// consumeOutput drains the indexing pipeline, releasing every record once
+// the pipeline is done with it
+func (i *bleveIndexer) consumeOutput() {
 	tick := time.NewTicker(1 * time.Second)
-	out := pipe.Output()
+	out := i.pipeline.Output()
 	for {
 		select {
-		case <-out:
+		case in := <-out:
+			if rec, ok := in.(*Record); ok && rec != nil {
+				i.Kill(rec)
+			}
 		case <-tick.C:
 		}
 	}
@@ -0,0 +1,67 @@
+package bleve
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// commentsField is the field of the discussion attached to a page
+const commentsField = "Comments"
+
+// withComments makes the parsed query string also match records whose
+// comments hold its terms. That match is scored weight times its usual
+// score, so discussion text surfaces pages without outranking those whose
+// text matches. Excluded terms still exclude the records whose text holds
+// them.
+func withComments(parsed query.Query, text, analyzer string, weight float64) query.Query {
+	comments, err := bleve.NewQueryStringQuery(text).Parse()
+	if err != nil {
+		return parsed
+	}
+
+	setCustomFields(comments)
+	if !setCommentsField(comments, weight) {
+		// every term names a field; comments hold none of them
+		return parsed
+	}
+	setQueryAnalyzer(comments, analyzer)
+
+	return bleve.NewDisjunctionQuery(parsed, comments)
+}
+
+// setCommentsField points the terms of the parsed query string that name no
+// field at the comments and scales the score of all its terms by weight,
+// leaving excluded terms as they are. It reports whether any term was
+// pointed at the comments.
+func setCommentsField(q query.Query, weight float64) bool {
+	found := false
+	switch q := q.(type) {
+	case *query.BooleanQuery:
+		for _, sub := range []query.Query{q.Must, q.Should} {
+			if sub != nil && setCommentsField(sub, weight) {
+				found = true
+			}
+		}
+	case *query.ConjunctionQuery:
+		for _, sub := range q.Conjuncts {
+			if setCommentsField(sub, weight) {
+				found = true
+			}
+		}
+	case *query.DisjunctionQuery:
+		for _, sub := range q.Disjuncts {
+			if setCommentsField(sub, weight) {
+				found = true
+			}
+		}
+	case query.FieldableQuery:
+		if q.Field() == "" {
+			q.SetField(commentsField)
+			found = true
+		}
+		if boostable, ok := q.(query.BoostableQuery); ok {
+			boostable.SetBoost(boostable.Boost() * weight)
+		}
+	}
+	return found
+}
@@ -0,0 +1,46 @@
+package bleve
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+)
+
+// titleWordsAnalyzer splits a title into its lowercased words, neither
+// stemmed nor stripped of stop words, so completions read as typed
+const titleWordsAnalyzer = "caddy_title_words"
+
+func init() {
+	registry.RegisterAnalyzer(titleWordsAnalyzer, titleWordsAnalyzerConstructor)
+}
+
+func titleWordsAnalyzerConstructor(config map[string]interface{}, cache *registry.Cache) (*analysis.Analyzer, error) {
+	tokenizer, err := cache.TokenizerNamed(unicode.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	lower, err := cache.TokenFilterNamed(lowercase.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &analysis.Analyzer{
+		Tokenizer:    tokenizer,
+		TokenFilters: []analysis.TokenFilter{lower},
+	}, nil
+}
+
+// addTitleWordsField adds the field holding the words of a document's title
+// as written, which completions are read from and queries never match
+func addTitleWordsField(doc *mapping.DocumentMapping) {
+	words := bleve.NewTextFieldMapping()
+	words.Analyzer = titleWordsAnalyzer
+	words.Store = false
+	words.IncludeInAll = false
+	words.IncludeTermVectors = false
+	doc.AddFieldMappingsAt("TitleWords", words)
+}
@@ -0,0 +1,116 @@
+package bleve
+
+import (
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/tokenizer/single"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+const (
+	// fieldAnalyzer indexes a custom field's value as a single lowercased
+	// term, so field:value matches the whole value regardless of case
+	fieldAnalyzer = "caddy_field"
+	// fieldsPrefix prefixes the names of the custom fields in the index
+	fieldsPrefix = "Fields."
+	// textDates is the date parser of the index. It parses nothing, so custom
+	// fields holding dates are indexed and stored as text like all others.
+	textDates = "caddy_text_dates"
+)
+
+// recordFields are the fields of indexRecord. Query terms naming any other
+// field match the record's custom fields.
+var recordFields = map[string]bool{
+	"_all": true, "Path": true, "Title": true, "Body": true, "Image": true,
+	"Description": true, "Comments": true, "Excerpt": true, "Sections": true,
+	"Translations": true, "Language": true, "Scopes": true, "Trigrams": true,
+	"Modified": true, "Indexed": true, "Priority": true, "Hash": true,
+	"Dated": true, "TitleWords": true,
+}
+
+func init() {
+	registry.RegisterAnalyzer(fieldAnalyzer, fieldAnalyzerConstructor)
+	registry.RegisterDateTimeParser(textDates, func(config map[string]interface{}, cache *registry.Cache) (analysis.DateTimeParser, error) {
+		return textDateParser{}, nil
+	})
+}
+
+// textDateParser rejects every value as a date
+type textDateParser struct{}
+
+func (textDateParser) ParseDateTime(string) (time.Time, error) {
+	return time.Time{}, analysis.ErrInvalidDateTime
+}
+
+func fieldAnalyzerConstructor(config map[string]interface{}, cache *registry.Cache) (*analysis.Analyzer, error) {
+	tokenizer, err := cache.TokenizerNamed(single.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	lower, err := cache.TokenFilterNamed(lowercase.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &analysis.Analyzer{
+		Tokenizer:    tokenizer,
+		TokenFilters: []analysis.TokenFilter{lower},
+	}, nil
+}
+
+// addCustomFields maps the Fields of a document, whose names are only known
+// once pages declare them, to the field analyzer. The index must use the
+// textDates parser.
+func addCustomFields(doc *mapping.DocumentMapping) {
+	fields := bleve.NewDocumentMapping()
+	fields.DefaultAnalyzer = fieldAnalyzer
+	doc.AddSubDocumentMapping("Fields", fields)
+}
+
+// setCustomFields points the terms of the parsed query string that name a
+// field the index does not define, as in author:jane, at the custom field of
+// that name
+func setCustomFields(q query.Query) {
+	switch q := q.(type) {
+	case *query.MatchQuery:
+		if customField(q.FieldVal) {
+			q.FieldVal = fieldsPrefix + strings.ToLower(q.FieldVal)
+			q.Analyzer = fieldAnalyzer
+		}
+	case *query.MatchPhraseQuery:
+		if customField(q.FieldVal) {
+			q.FieldVal = fieldsPrefix + strings.ToLower(q.FieldVal)
+			q.Analyzer = fieldAnalyzer
+		}
+	case query.FieldableQuery:
+		if customField(q.Field()) {
+			q.SetField(fieldsPrefix + strings.ToLower(q.Field()))
+		}
+	case *query.BooleanQuery:
+		for _, sub := range []query.Query{q.Must, q.Should, q.MustNot} {
+			if sub != nil {
+				setCustomFields(sub)
+			}
+		}
+	case *query.ConjunctionQuery:
+		for _, sub := range q.Conjuncts {
+			setCustomFields(sub)
+		}
+	case *query.DisjunctionQuery:
+		for _, sub := range q.Disjuncts {
+			setCustomFields(sub)
+		}
+	}
+}
+
+// customField reports whether a query term's field is a custom field
+func customField(field string) bool {
+	return field != "" && !recordFields[field] && !strings.HasPrefix(field, fieldsPrefix)
+}
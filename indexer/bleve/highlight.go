@@ -0,0 +1,109 @@
+package bleve
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// marker locates the words of a record's text matching a query
+type marker struct {
+	// analyzer turns the record's text into the terms it is indexed as
+	analyzer *analysis.Analyzer
+	// words, when set, cuts every mark down to the part of its word the
+	// query's word shares with it
+	words []queryWord
+}
+
+// recordAnalyzer returns the analyzer of a record's text: that of its
+// language, or else the index's default
+func (i *bleveIndexer) recordAnalyzer(rec indexer.Record) *analysis.Analyzer {
+	name := i.analyzer
+	if language, ok := i.languages[rec.Language()]; ok {
+		name = language
+	}
+	return i.bleve.Mapping().AnalyzerNamed(name)
+}
+
+// wordSpans returns the locations of the words of text the analyzer turns
+// into one of the terms of spans, as the index would locate them, so that
+// the term run marks both running and runs. Text that is not indexed, such
+// as a description, is marked like the body this way.
+func (m marker) wordSpans(text string, spans []span) []span {
+	marks := []span{}
+	if len(spans) == 0 || m.analyzer == nil {
+		return marks
+	}
+
+	terms := map[string]bool{}
+	for _, s := range spans {
+		terms[s.term] = true
+	}
+
+	// token filters may change the text they analyze in place
+	for _, token := range m.analyzer.Analyze([]byte(text)) {
+		if term := string(token.Term); terms[term] && token.End <= len(text) {
+			marks = append(marks, span{token.Start, token.End, term})
+		}
+	}
+
+	sort.SliceStable(marks, func(i, j int) bool {
+		return marks[i].start < marks[j].start
+	})
+	pos, kept := 0, marks[:0]
+	for _, s := range marks {
+		if s.start >= pos {
+			kept = append(kept, s)
+			pos = s.end
+		}
+	}
+	return kept
+}
+
+// trim cuts the marks of text down to the part of their word a query's word
+// begins with, as run in running, when the marker has the query's words.
+// The word the mark's term was analyzed from sharing the longest start with
+// it is used; a mark sharing none, such as a fuzzy match, is kept whole.
+func (m marker) trim(text string, marks []span) []span {
+	if len(m.words) == 0 {
+		return marks
+	}
+
+	trimmed := make([]span, len(marks))
+	for i, s := range marks {
+		trimmed[i] = s
+		longest := 0
+		for _, w := range m.words {
+			if w.term != s.term && !strings.HasPrefix(s.term, w.term) {
+				continue
+			}
+			if n := sharedPrefix(text[s.start:s.end], w.word); n > longest {
+				longest = n
+			}
+		}
+		if longest > 0 {
+			trimmed[i].end = s.start + longest
+		}
+	}
+	return trimmed
+}
+
+// sharedPrefix returns the length, in bytes of word, of the start word
+// shares with other, ignoring case
+func sharedPrefix(word, other string) int {
+	n := 0
+	for n < len(word) && other != "" {
+		r, size := utf8.DecodeRuneInString(word[n:])
+		o, osize := utf8.DecodeRuneInString(other)
+		if unicode.ToLower(r) != unicode.ToLower(o) {
+			break
+		}
+		n += size
+		other = other[osize:]
+	}
+	return n
+}
@@ -0,0 +1,199 @@
+package bleve
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/document"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// maxSectionPages is how many pages the tokens of their sections are kept
+// for, the most recently indexed first
+const maxSectionPages = 1000
+
+// sectionKey tells a section's text apart, as analyzed by an analyzer
+type sectionKey struct {
+	analyzer *analysis.Analyzer
+	hash     uint64
+	length   int
+}
+
+// sectionCache keeps the tokens of the sections of recently indexed pages, so
+// indexing a page again only analyzes the sections that changed
+type sectionCache struct {
+	sync.Mutex
+	pages map[string]*list.Element
+	order *list.List
+}
+
+// pageSections are the tokens of the sections of a page, as of its latest
+// analysis
+type pageSections struct {
+	path     string
+	sections map[sectionKey]analysis.TokenStream
+}
+
+func newSectionCache() *sectionCache {
+	return &sectionCache{
+		pages: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// get returns the tokens of the sections of path
+func (c *sectionCache) get(path string) map[sectionKey]analysis.TokenStream {
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.pages[path]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*pageSections).sections
+	}
+	return nil
+}
+
+// put makes sections the tokens of the sections of path, evicting the least
+// recently indexed page when full
+func (c *sectionCache) put(path string, sections map[sectionKey]analysis.TokenStream) {
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.pages[path]; ok {
+		elem.Value.(*pageSections).sections = sections
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= maxSectionPages {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.pages, oldest.Value.(*pageSections).path)
+	}
+	c.pages[path] = c.order.PushFront(&pageSections{path, sections})
+}
+
+// remove forgets the sections of path
+func (c *sectionCache) remove(path string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.pages[path]; ok {
+		c.order.Remove(elem)
+		delete(c.pages, path)
+	}
+}
+
+// reset forgets the sections of every page
+func (c *sectionCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.pages = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// sectionedDocument maps a record to a bleve document whose body is analyzed
+// section by section, or returns nil when the record has no sections
+func (i *bleveIndexer) sectionedDocument(rec *Record, r indexRecord) (*document.Document, error) {
+	sections := rec.Sections()
+	if len(sections) == 0 {
+		return nil, nil
+	}
+
+	doc := document.NewDocument(rec.Path())
+	if err := i.bleve.Mapping().MapDocument(doc, r); err != nil {
+		return nil, err
+	}
+
+	for n, field := range doc.Fields {
+		body, ok := field.(*document.TextField)
+		if !ok || body.Name() != "Body" || body.Analyzer() == nil || !body.Options().IsIndexed() {
+			continue
+		}
+
+		// the body is still stored as text, but indexed by a field that
+		// analyzes each section on its own
+		stored := document.NewTextFieldCustom(body.Name(), body.ArrayPositions(), body.Value(),
+			body.Options()&document.StoreField, body.Analyzer())
+		doc.Fields[n] = stored
+		doc.AddField(&sectionedField{
+			TextField: document.NewTextFieldCustom(body.Name(), body.ArrayPositions(), body.Value(),
+				body.Options()&^document.StoreField, body.Analyzer()),
+			path:   rec.Path(),
+			starts: sectionStarts(sections, len(body.Value())),
+			cache:  i.sections,
+		})
+		return doc, nil
+	}
+
+	return nil, nil
+}
+
+// sectionStarts returns the offsets the sections of a body of length n start
+// at, always starting with the text before the first section
+func sectionStarts(sections []indexer.Section, n int) []int {
+	starts := []int{0}
+	for _, section := range sections {
+		last := starts[len(starts)-1]
+		if section.Start > last && section.Start < n {
+			starts = append(starts, section.Start)
+		}
+	}
+	return starts
+}
+
+// sectionedField is a body field analyzed a section at a time, reusing the
+// tokens of the sections its page held when it was last analyzed
+type sectionedField struct {
+	*document.TextField
+	path   string
+	starts []int
+	cache  *sectionCache
+}
+
+func (f *sectionedField) Analyze() (int, analysis.TokenFrequencies) {
+	value := f.Value()
+	analyzer := f.Analyzer()
+	previous := f.cache.get(f.path)
+	current := make(map[sectionKey]analysis.TokenStream, len(f.starts))
+
+	var tokens analysis.TokenStream
+	position := 0
+	for n, start := range f.starts {
+		end := len(value)
+		if n+1 < len(f.starts) {
+			end = f.starts[n+1]
+		}
+
+		text := value[start:end]
+		h := fnv.New64a()
+		h.Write(text)
+		key := sectionKey{analyzer, h.Sum64(), len(text)}
+
+		section, ok := previous[key]
+		if !ok {
+			// tokens refer to the text they were analyzed from, which is kept
+			// as long as they are
+			section = analyzer.Analyze(append([]byte(nil), text...))
+		}
+		current[key] = section
+
+		last := 0
+		for _, token := range section {
+			shifted := *token
+			shifted.Start += start
+			shifted.End += start
+			shifted.Position += position
+			tokens = append(tokens, &shifted)
+			if token.Position > last {
+				last = token.Position
+			}
+		}
+		position += last
+	}
+
+	f.cache.put(f.path, current)
+	return len(tokens), analysis.TokenFrequency(tokens, f.ArrayPositions(), f.Options().IncludeTermVectors())
+}
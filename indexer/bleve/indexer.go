@@ -2,26 +2,92 @@ package bleve
 
 import (
 	"fmt"
+	"log"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
 	"github.com/pedronasser/caddy-search/indexer"
 	"github.com/pedronasser/go-piper"
 )
 
 type bleveIndexer struct {
 	pipeline piper.Handler
-	bleve    bleve.Index
+	// bleve serves every query and write; it aliases the active index, which
+	// a rebuild swaps for the one it built
+	bleve    bleve.IndexAlias
+	active   bleve.Index
+	analyzer string
+	// name is where the index is stored unless it was rebuilt, path where
+	// the active index is stored; config is what a rebuild creates its index
+	// with
+	name   string
+	path   string
+	config indexer.Config
+	// queued counts the records piped but not yet indexed
+	queued sync.WaitGroup
+	// rebuildMutex serializes rebuilds; staging, while one runs, receives
+	// every write made to the active index
+	rebuildMutex sync.Mutex
+	stagingMutex sync.RWMutex
+	staging      *bleveIndexer
+	// languages maps each language to the analyzer of its queries
+	languages map[string]string
+	// trigrams enables contains: terms no shorter than minContains
+	trigrams    bool
+	minContains int
+	// minPrefix makes query terms that long match by prefix, when set
+	minPrefix int
+	// minTermDF prunes the body terms of fewer documents, when above 1
+	minTermDF int
+	rare      *rareTerms
+	// sections keeps the tokens of the sections of indexed pages, when
+	// they are indexed incrementally
+	sections *sectionCache
+	// commentWeight scales the score of matches in comments, when set
+	commentWeight float64
+	statusMutex   sync.Mutex
+	status        indexer.Status
 }
 
+const (
+	// writeAttempts is how many times a failing write reaches the backend
+	writeAttempts = 3
+	// writeRetryDelay is the pause before the first retry, doubled for each
+	// further one
+	writeRetryDelay = 50 * time.Millisecond
+)
+
 // Bleve's record data struct
 type indexRecord struct {
-	Path     string
-	Title    string
-	Body     string
-	Modified string
-	Indexed  string
+	Path        string
+	Title       string
+	Body        string
+	Image       string
+	Description string
+	Comments    string
+	Excerpt     string
+	Sections    string
+	// Translations holds a line per language the page is translated to,
+	// the language and the path of the translation
+	Translations string
+	Language     string
+	Scopes       []string
+	Trigrams     string
+	Modified     string
+	Indexed      string
+	Priority     string
+	Hash         string
+	Fields       map[string]string
+	// Dated is the modification time in Unix seconds, 0 when unknown,
+	// matched by queries restricted to recent records
+	Dated float64
+	// TitleWords holds the title again, for the completions of its words
+	TitleWords string
 }
 
 // Record method get existent or creates a new Record to be saved/updated in the indexer
@@ -30,10 +96,26 @@ func (i *bleveIndexer) Record(path string) indexer.Record {
 	record.path = path
 	record.fullPath = ""
 	record.title = ""
+	record.ctype = ""
+	record.image = ""
+	record.desc = ""
+	record.comments = ""
+	record.excerpt = ""
+	record.language = ""
+	record.fields = nil
+	record.priority = indexer.DefaultPriority
+	record.score = 0
+	record.marks = nil
+	record.titleMarks = nil
+	record.matched = nil
+	record.sections = nil
+	record.section = ""
+	record.translations = nil
+	record.hash = ""
 	record.document = make(map[string]interface{})
 	record.ignored = false
 	record.loaded = false
-	record.body = bufPool.Get().([]byte)
+	record.body = bufPool.Get().([]byte)[:0]
 	record.indexed = time.Time{}
 	record.modified = time.Time{}
 	record.indexer = i
@@ -45,16 +127,149 @@ func (i *bleveIndexer) Kill(r indexer.Record) {
 	recordPool.Put(r)
 }
 
+// parseQuery parses the query string, analyzing its terms like the documents
+// of the query's language. With the trigram index, it also returns the
+// contains: terms the query matches by their trigrams.
+func (i *bleveIndexer) parseQuery(q indexer.Query) (query.Query, []string, error) {
+	text, contains := q.Text, []string(nil)
+	if q.Literal {
+		text = escapeQueryString(text)
+	} else if i.trigrams {
+		text, contains = splitContains(text)
+		contains = longEnough(contains, i.minContains)
+	}
+
+	conjuncts := []query.Query{}
+	if text == "" && len(contains) == 0 && (len(q.Filters) > 0 || !q.Since.IsZero()) {
+		conjuncts = append(conjuncts, bleve.NewMatchAllQuery())
+	} else if text != "" || len(contains) == 0 {
+		parsed, err := bleve.NewQueryStringQuery(text).Parse()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		setCustomFields(parsed)
+
+		analyzer := i.queryAnalyzer(q)
+		setQueryAnalyzer(parsed, analyzer)
+		if i.minPrefix > 0 {
+			parsed = addPrefixMatches(parsed, i.minPrefix)
+		}
+		if i.commentWeight > 0 && text != "" {
+			parsed = withComments(parsed, text, analyzer, i.commentWeight)
+		}
+		conjuncts = append(conjuncts, parsed)
+	}
+
+	for _, term := range contains {
+		conjuncts = append(conjuncts, containsQuery(term))
+	}
+
+	if len(conjuncts) == 1 {
+		return scoped(conjuncts[0], q), contains, nil
+	}
+	return scoped(bleve.NewConjunctionQuery(conjuncts...), q), contains, nil
+}
+
+// queryAnalyzer returns the analyzer of the query's terms: that of its
+// language, or the index's default
+func (i *bleveIndexer) queryAnalyzer(q indexer.Query) string {
+	if name, ok := i.languages[q.Language]; ok {
+		return name
+	}
+	return i.analyzer
+}
+
+// scoped restricts a query to the paths under the query's scope and outside
+// the directories it excludes, and to the records matching its filters and
+// modified since its Since time
+func scoped(match query.Query, q indexer.Query) query.Query {
+	if q.Scope != "" {
+		scope := bleve.NewTermQuery(q.Scope)
+		scope.SetField("Scopes")
+		match = bleve.NewConjunctionQuery(match, scope)
+	}
+
+	for name, values := range q.Filters {
+		if len(values) == 0 {
+			continue
+		}
+		accepted := make([]query.Query, len(values))
+		for i, value := range values {
+			term := bleve.NewTermQuery(strings.ToLower(value))
+			term.SetField(fieldsPrefix + strings.ToLower(name))
+			accepted[i] = term
+		}
+		match = bleve.NewConjunctionQuery(match, bleve.NewDisjunctionQuery(accepted...))
+	}
+
+	if !q.Since.IsZero() {
+		since, inclusive := float64(q.Since.Unix()), true
+		dated := bleve.NewNumericRangeInclusiveQuery(&since, nil, &inclusive, nil)
+		dated.SetField("Dated")
+		match = bleve.NewConjunctionQuery(match, dated)
+	}
+
+	if len(q.Exclude) > 0 {
+		excluded := make([]query.Query, len(q.Exclude))
+		for i, dir := range q.Exclude {
+			term := bleve.NewTermQuery(dir)
+			term.SetField("Scopes")
+			excluded[i] = term
+		}
+		match = query.NewBooleanQuery([]query.Query{match}, nil, excluded)
+	}
+
+	return match
+}
+
+// scopes returns the directories a path lies under, from the root down:
+// "/docs/api/intro.html" lies under "/", "/docs/" and "/docs/api/". Paths
+// outside the site (absolute URLs) have none.
+func scopes(path string) []string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil
+	}
+
+	dirs := []string{}
+	for i, c := range path {
+		if c == '/' {
+			dirs = append(dirs, path[:i+1])
+		}
+	}
+	return dirs
+}
+
 // Search method lookup for records using a query
-func (i *bleveIndexer) Search(q string) (records []indexer.Record) {
-	query := bleve.NewQueryStringQuery(q)
+func (i *bleveIndexer) Search(q indexer.Query) (records []indexer.Record) {
+	query, contains, err := i.parseQuery(q)
+	if err != nil {
+		return
+	}
+
 	request := bleve.NewSearchRequest(query)
-	request.Highlight = bleve.NewHighlight()
+	if q.Limit > 0 {
+		request.Size = q.Limit
+	}
+	if q.SortField != "" {
+		request.SortByCustom(sortOrder(q))
+	} else if q.PositionDecay > 0 {
+		request.Size *= positionCandidates
+	}
+	request.IncludeLocations = true
 	result, err := i.bleve.Search(request)
 	if err != nil { // an empty query would cause this
 		return
 	}
 
+	var words []queryWord
+	if q.MatchedTerms || q.PartialHighlights {
+		words = i.queryWords(q.Text, i.queryAnalyzer(q))
+	}
+
 	for _, match := range result.Hits {
 		rec := i.Record(match.ID)
 		loaded := rec.Load()
@@ -63,42 +278,309 @@ func (i *bleveIndexer) Search(q string) (records []indexer.Record) {
 			continue
 		}
 
-		if len(match.Fragments["Body"]) > 0 {
-			rec.SetBody([]byte(match.Fragments["Body"][0]))
+		// sharing its trigrams does not make a record contain a term
+		if len(contains) > 0 && !containsAll(rec.Title()+"\n"+string(rec.Body()), contains) {
+			i.Kill(rec)
+			continue
+		}
+
+		rec.SetScore(match.Score)
+		if q.PositionDecay > 0 {
+			rec.SetScore(match.Score * positionBoost(match, q.PositionDecay))
+		}
+
+		// the stored body is plain text; the snippet is escaped HTML unless
+		// the query asks for plain text
+		m := marker{analyzer: i.recordAnalyzer(rec)}
+		if q.PartialHighlights {
+			m.words = words
+		}
+		bodySpans := fieldSpans(match, "Body")
+		body, marks := recordSnippet(rec, bodySpans, q, m)
+		rec.SetBody([]byte(body))
+		rec.SetHighlights(marks)
+		rec.SetTitleHighlights(titleHighlights(rec.Title(), m.trim(rec.Title(), fieldSpans(match, "Title"))))
+		if q.MatchedTerms {
+			rec.SetMatchedTerms(matchedTerms(match, words, i.minPrefix))
+		}
+		if q.DeepLinks {
+			rec.SetSection(matchSection(rec.Sections(), bodySpans))
+		}
+
+		records = append(records, rec)
+	}
+
+	if q.PositionDecay > 0 && q.SortField == "" {
+		records = rankPositions(records, q.Limit)
+	}
+	return
+}
+
+// Recent returns the most recently indexed records under the query's scope,
+// newest first, ignoring its text. It reads no more than q.Limit documents.
+func (i *bleveIndexer) Recent(q indexer.Query) (records []indexer.Record) {
+	request := bleve.NewSearchRequest(scoped(bleve.NewMatchAllQuery(), q))
+	if q.Limit > 0 {
+		request.Size = q.Limit
+	}
+	request.SortBy([]string{"-Indexed", "_id"})
+	result, err := i.bleve.Search(request)
+	if err != nil {
+		return
+	}
+
+	for _, match := range result.Hits {
+		rec := i.Record(match.ID)
+		if !rec.Load() {
+			continue
 		}
 
+		body, _ := recordSnippet(rec, nil, q, marker{})
+		rec.SetBody([]byte(body))
+
 		records = append(records, rec)
 	}
 
 	return
 }
 
+// walkBatch is the number of records Walk reads from the index at a time
+const walkBatch = 100
+
+// Walk calls fn with every record of the index, loaded, in path order. It
+// stops at the first error fn returns and returns it.
+func (i *bleveIndexer) Walk(fn func(indexer.Record) error) error {
+	var after []string
+	for {
+		request := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), walkBatch, 0, false)
+		request.SortBy([]string{"_id"})
+		request.SearchAfter = after
+		result, err := i.bleve.Search(request)
+		if err != nil {
+			return err
+		}
+
+		for _, match := range result.Hits {
+			rec := i.Record(match.ID)
+			if !rec.Load() {
+				continue
+			}
+			err := fn(rec)
+			i.Kill(rec)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(result.Hits) < walkBatch {
+			return nil
+		}
+		after = []string{result.Hits[len(result.Hits)-1].ID}
+	}
+}
+
+// Count returns the number of records matching a query without loading them
+func (i *bleveIndexer) Count(q indexer.Query) uint64 {
+	query, _, err := i.parseQuery(q)
+	if err != nil {
+		return 0
+	}
+
+	result, err := i.bleve.Search(bleve.NewSearchRequestOptions(query, 0, 0, false))
+	if err != nil {
+		return 0
+	}
+
+	return result.Total
+}
+
+// Delete removes the record at path from the index
+func (i *bleveIndexer) Delete(path string) {
+	if err := i.write(func() error { return i.bleve.Delete(path) }); err != nil {
+		log.Printf("[search] deleting %s: %v", path, err)
+	}
+	i.mirror(func(staging *bleveIndexer) error { return staging.bleve.Delete(path) })
+	if i.sections != nil {
+		i.sections.remove(path)
+	}
+}
+
+// write runs a write to the backend, retrying it with backoff, and keeps
+// track of the failures in the index's status
+func (i *bleveIndexer) write(op func() error) error {
+	delay := writeRetryDelay
+	err := op()
+	for attempt := 1; err != nil && attempt < writeAttempts; attempt++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = op()
+	}
+
+	i.statusMutex.Lock()
+	defer i.statusMutex.Unlock()
+	i.status.Degraded = err != nil
+	if err != nil {
+		i.status.Failures++
+		i.status.LastError = err.Error()
+		i.status.LastFailure = time.Now()
+	}
+	return err
+}
+
+// Status reports the failures of the writes to the backend
+func (i *bleveIndexer) Status() indexer.Status {
+	i.statusMutex.Lock()
+	defer i.statusMutex.Unlock()
+	return i.status
+}
+
+// Close closes the backend; later writes fail
+func (i *bleveIndexer) Close() error {
+	i.rebuildMutex.Lock()
+	defer i.rebuildMutex.Unlock()
+	return i.active.Close()
+}
+
+// DocCount returns the number of documents in the index
+func (i *bleveIndexer) DocCount() uint64 {
+	count, err := i.bleve.DocCount()
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// FieldValues returns the distinct values of a custom field in the index,
+// lowercased
+func (i *bleveIndexer) FieldValues(name string) []string {
+	dict, err := i.bleve.FieldDict(fieldsPrefix + strings.ToLower(name))
+	if err != nil {
+		return nil
+	}
+	defer dict.Close()
+
+	values := []string{}
+	for entry, err := dict.Next(); err == nil && entry != nil; entry, err = dict.Next() {
+		if entry.Count > 0 {
+			values = append(values, entry.Term)
+		}
+	}
+	return values
+}
+
+// Completions returns up to limit of the words of the indexed titles that
+// start with prefix, as written rather than stemmed, those found in the most
+// titles first
+func (i *bleveIndexer) Completions(prefix string, limit int) []string {
+	prefix = strings.ToLower(prefix)
+	if prefix == "" || limit <= 0 {
+		return nil
+	}
+
+	dict, err := i.bleve.FieldDictPrefix("TitleWords", []byte(prefix))
+	if err != nil {
+		return nil
+	}
+	defer dict.Close()
+
+	type completion struct {
+		word   string
+		titles uint64
+	}
+	completions := []completion{}
+	for entry, err := dict.Next(); err == nil && entry != nil; entry, err = dict.Next() {
+		if entry.Count > 0 {
+			completions = append(completions, completion{entry.Term, entry.Count})
+		}
+	}
+	sort.SliceStable(completions, func(a, b int) bool {
+		return completions[a].titles > completions[b].titles
+	})
+
+	if len(completions) > limit {
+		completions = completions[:limit]
+	}
+	words := make([]string, len(completions))
+	for j, c := range completions {
+		words[j] = c.word
+	}
+	return words
+}
+
 // Pipe sends the new record to the pipeline
 func (i *bleveIndexer) Pipe(r indexer.Record) {
+	i.queued.Add(1)
 	i.pipeline.Input() <- r
 }
 
 // index is the pipeline step that indexes the document
 func (i *bleveIndexer) index(in interface{}) interface{} {
+	defer i.queued.Done()
+
 	if rec, ok := in.(*Record); ok {
 
 		if rec != nil && len(rec.body) > 0 && !rec.Ignored() {
 			rec.SetIndexed(time.Now())
 			fmt.Println(rec.FullPath())
 
-			r := indexRecord{
-				Path:     rec.Path(),
-				Title:    rec.Title(),
-				Body:     string(rec.body),
-				Modified: strconv.Itoa(int(rec.Modified().Unix())),
-				Indexed:  strconv.Itoa(int(rec.Indexed().Unix())),
-			}
+			r := i.document(rec)
 
-			i.bleve.Index(rec.Path(), r)
+			if err := i.write(func() error { return i.put(rec, r) }); err != nil {
+				log.Printf("[search] indexing %s: %v", rec.Path(), err)
+			}
+			i.mirror(func(staging *bleveIndexer) error { return staging.put(rec, r) })
 		}
-
-		i.Kill(rec)
 	}
 
 	return in
 }
+
+// put writes the document of a record to the index, its body analyzed a
+// section at a time when sections are indexed incrementally and it has any
+func (i *bleveIndexer) put(rec *Record, r indexRecord) error {
+	if i.sections != nil {
+		doc, err := i.sectionedDocument(rec, r)
+		if err != nil {
+			return err
+		}
+		if doc != nil {
+			batch := i.bleve.NewBatch()
+			if err := batch.IndexAdvanced(doc); err != nil {
+				return err
+			}
+			return i.bleve.Batch(batch)
+		}
+		i.sections.remove(rec.Path())
+	}
+	return i.bleve.Index(rec.Path(), r)
+}
+
+// document returns the document the index holds for a record
+func (i *bleveIndexer) document(rec *Record) indexRecord {
+	r := indexRecord{
+		Path:         rec.Path(),
+		Title:        rec.Title(),
+		Body:         string(rec.body),
+		Image:        rec.Image(),
+		Description:  rec.Description(),
+		Comments:     rec.Comments(),
+		Excerpt:      rec.Excerpt(),
+		Sections:     encodeSections(rec.Sections()),
+		Translations: encodeTranslations(rec.Translations()),
+		Language:     rec.Language(),
+		Scopes:       scopes(rec.Path()),
+		Fields:       rec.Fields(),
+		Modified:     strconv.Itoa(int(rec.Modified().Unix())),
+		Indexed:      strconv.Itoa(int(rec.Indexed().Unix())),
+		Priority:     strconv.FormatFloat(rec.Priority(), 'f', -1, 64),
+		Hash:         contentHash(rec.body),
+	}
+	if modified := rec.Modified(); !modified.IsZero() && modified.Unix() > 0 {
+		r.Dated = float64(modified.Unix())
+	}
+	if i.trigrams {
+		r.Trigrams = r.Title + "\n" + r.Body
+	}
+	r.TitleWords = r.Title
+	return r
+}
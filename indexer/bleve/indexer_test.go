@@ -1 +1,389 @@
 package bleve_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"github.com/pedronasser/caddy-search/indexer/bleve"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIndexerFailures(t *testing.T) {
+	Convey("Given an indexer", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		indxr, err := bleve.New(dir, indexer.Config{})
+		So(err, ShouldBeNil)
+
+		pipe := func(path string) {
+			rec := indxr.Record(path)
+			rec.Write([]byte("Install the plugin"))
+			indxr.Pipe(rec)
+		}
+
+		Convey("Should report no failures while writes succeed", func() {
+			pipe("/page")
+			for i := 0; i < 100 && indxr.DocCount() == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(indxr.DocCount(), ShouldEqual, 1)
+			So(indxr.Status(), ShouldResemble, indexer.Status{})
+		})
+
+		Convey("Should report the writes the backend keeps failing", func() {
+			So(indxr.Close(), ShouldBeNil)
+			pipe("/page")
+			for i := 0; i < 100 && indxr.Status().Failures == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			status := indxr.Status()
+			So(status.Failures, ShouldEqual, 1)
+			So(status.Degraded, ShouldBeTrue)
+			So(status.LastError, ShouldNotBeEmpty)
+			So(status.LastFailure, ShouldNotBeZeroValue)
+		})
+	})
+}
+
+func TestIndexerWalk(t *testing.T) {
+	Convey("Given an index with more records than are read at a time", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		indxr, err := bleve.New(dir, indexer.Config{})
+		So(err, ShouldBeNil)
+
+		for i := 0; i < 150; i++ {
+			rec := indxr.Record(fmt.Sprintf("/page%03d", i))
+			rec.Write([]byte("Install the plugin"))
+			indxr.Pipe(rec)
+		}
+		for i := 0; i < 300 && indxr.DocCount() < 150; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		Convey("Should visit every record once, in path order", func() {
+			paths := []string{}
+			err := indxr.Walk(func(rec indexer.Record) error {
+				So(string(rec.Body()), ShouldEqual, "Install the plugin")
+				paths = append(paths, rec.Path())
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(paths, ShouldHaveLength, 150)
+			So(paths[0], ShouldEqual, "/page000")
+			So(paths[149], ShouldEqual, "/page149")
+		})
+
+		Convey("Should stop at the first error", func() {
+			stop := errors.New("stop")
+			visited := 0
+			err := indxr.Walk(func(rec indexer.Record) error {
+				visited++
+				return stop
+			})
+			So(err, ShouldEqual, stop)
+			So(visited, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestIndexerRebuild(t *testing.T) {
+	Convey("Given an index of old pages being rebuilt with new ones", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer func() {
+			rebuilt, _ := filepath.Glob(dir + ".*")
+			for _, path := range append(rebuilt, dir) {
+				os.RemoveAll(path)
+			}
+		}()
+
+		indxr, err := bleve.New(dir, indexer.Config{})
+		So(err, ShouldBeNil)
+
+		pipe := func(index indexer.Handler, path, body string) {
+			rec := index.Record(path)
+			rec.Write([]byte(body))
+			index.Pipe(rec)
+		}
+		count := func() uint64 {
+			return indxr.Count(indexer.Query{Text: "page"})
+		}
+
+		for n := 0; n < 20; n++ {
+			pipe(indxr, fmt.Sprintf("/old/%d", n), "old page")
+		}
+		for i := 0; i < 100 && count() < 20; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(count(), ShouldEqual, 20)
+
+		Convey("Should serve the old index in full until the new one is complete", func() {
+			stop := make(chan struct{})
+			seen := make(chan map[uint64]bool)
+			go func() {
+				counts := map[uint64]bool{}
+				for {
+					select {
+					case <-stop:
+						seen <- counts
+						return
+					default:
+						counts[count()] = true
+					}
+				}
+			}()
+
+			err := indxr.Rebuild(func(staging indexer.Handler) error {
+				for n := 0; n < 30; n++ {
+					pipe(staging, fmt.Sprintf("/new/%d", n), "new page")
+					if n%10 == 0 {
+						time.Sleep(20 * time.Millisecond)
+					}
+				}
+				pipe(indxr, "/pushed", "pushed page")
+				return nil
+			})
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 100 && count() < 31; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			close(stop)
+			counts := <-seen
+
+			So(count(), ShouldEqual, 31)
+			So(indxr.Record("/old/0").Load(), ShouldBeFalse)
+			So(indxr.Record("/pushed").Load(), ShouldBeTrue)
+			for n := range counts {
+				So(n, ShouldBeIn, []uint64{20, 21, 31})
+			}
+
+			Convey("Should open the rebuilt index once restarted", func() {
+				So(indxr.Close(), ShouldBeNil)
+				reopened, err := bleve.New(dir, indexer.Config{})
+				So(err, ShouldBeNil)
+				So(reopened.Count(indexer.Query{Text: "page"}), ShouldEqual, 31)
+				So(reopened.Close(), ShouldBeNil)
+			})
+		})
+
+		Convey("Should keep the old index when the build fails", func() {
+			err := indxr.Rebuild(func(staging indexer.Handler) error {
+				pipe(staging, "/new/0", "new page")
+				return errors.New("scan failed")
+			})
+			So(err, ShouldNotBeNil)
+			So(count(), ShouldEqual, 20)
+
+			rebuilt, _ := filepath.Glob(dir + ".rebuild-*")
+			So(rebuilt, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestIndexerOptions(t *testing.T) {
+	Convey("Given the scorch index type in the engine options", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		config := indexer.Config{Options: map[string]string{"index_type": "scorch"}}
+
+		indxr, err := bleve.New(dir, config)
+		So(err, ShouldBeNil)
+		rec := indxr.Record("/page")
+		rec.Write([]byte("Install the plugin"))
+		indxr.Pipe(rec)
+		for i := 0; i < 100 && indxr.DocCount() == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		Convey("Should create a scorch index holding the records", func() {
+			// closed before the directory is removed, so nothing is
+			// persisted into a missing one
+			defer indxr.Close()
+			meta, err := ioutil.ReadFile(filepath.Join(dir, "index_meta.json"))
+			So(err, ShouldBeNil)
+			So(string(meta), ShouldContainSubstring, `"scorch"`)
+			So(indxr.Search(indexer.Query{Text: "plugin"}), ShouldHaveLength, 1)
+		})
+
+		Convey("Should open it again with the same options", func() {
+			So(indxr.Close(), ShouldBeNil)
+			indxr, err := bleve.New(dir, config)
+			So(err, ShouldBeNil)
+			defer indxr.Close()
+			So(indxr.DocCount(), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Given unsafe batches in the engine options", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		config := indexer.Config{Options: map[string]string{"index_type": "scorch", "unsafe_batch": "true"}}
+
+		Convey("Should index without waiting for the records to be persisted", func() {
+			indxr, err := bleve.New(dir, config)
+			So(err, ShouldBeNil)
+			defer indxr.Close()
+			rec := indxr.Record("/page")
+			rec.Write([]byte("Install the plugin"))
+			indxr.Pipe(rec)
+			for i := 0; i < 100 && indxr.DocCount() == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(indxr.Search(indexer.Query{Text: "plugin"}), ShouldHaveLength, 1)
+		})
+	})
+
+	Convey("Given an unknown engine option", t, func() {
+		Convey("Should refuse it, naming the accepted ones", func() {
+			err := bleve.ValidateOptions(map[string]string{"shards": "4"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "unknown option `shards` (available: index_type, snapshots, unsafe_batch)")
+			So(bleve.ValidateOptions(map[string]string{"index_type": "memory"}), ShouldNotBeNil)
+			So(bleve.ValidateOptions(map[string]string{"snapshots": "2"}), ShouldBeNil)
+		})
+	})
+}
+
+func TestIndexerDocFrequency(t *testing.T) {
+	Convey("Given records sharing some of their words", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		indxr, err := bleve.New(dir, indexer.Config{})
+		So(err, ShouldBeNil)
+		defer indxr.Close()
+
+		pages := map[string]string{
+			"/a": "Installing the desk lamp",
+			"/b": "Installing the floor lamp",
+			"/c": "A zebra rug",
+		}
+		for path, body := range pages {
+			rec := indxr.Record(path)
+			rec.SetTitle("Page")
+			rec.Write([]byte(body))
+			indxr.Pipe(rec)
+		}
+		for i := 0; i < 100 && indxr.DocCount() < uint64(len(pages)); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		Convey("Should count the records holding each word as analyzed", func() {
+			So(indxr.DocFrequency("installing", ""), ShouldEqual, 2)
+			So(indxr.DocFrequency("+Zebra", ""), ShouldEqual, 1)
+			So(indxr.DocFrequency("page", ""), ShouldEqual, 3)
+			So(indxr.DocFrequency("nothingmatches", ""), ShouldEqual, 0)
+		})
+
+		Convey("Should count the rarest term of a word analyzed into several", func() {
+			So(indxr.DocFrequency("lamp-nothingmatches", ""), ShouldEqual, 0)
+			So(indxr.DocFrequency("desk-lamp", ""), ShouldEqual, 1)
+		})
+	})
+}
+
+// recordingAnalyzer splits on whitespace and records the texts it analyzed
+type recordingAnalyzer struct {
+	sync.Mutex
+	texts []string
+}
+
+func (a *recordingAnalyzer) Analyze(text string) []indexer.Token {
+	a.Lock()
+	a.texts = append(a.texts, text)
+	a.Unlock()
+	return whitespaceAnalyzer{}.Analyze(text)
+}
+
+// analyzed returns the texts analyzed since the last call
+func (a *recordingAnalyzer) analyzed() []string {
+	a.Lock()
+	defer a.Unlock()
+	texts := a.texts
+	a.texts = nil
+	return texts
+}
+
+func TestIndexerIncrementalSections(t *testing.T) {
+	Convey("Given an index analyzing the sections of pages incrementally", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		analyzer := &recordingAnalyzer{}
+		indexer.RegisterAnalyzer("recording", analyzer)
+		indxr, err := bleve.New(dir, indexer.Config{Analyzer: "recording", IncrementalSections: true})
+		So(err, ShouldBeNil)
+
+		pipe := func(sections ...string) {
+			rec := indxr.Record("/guide")
+			rec.SetTitle("Guide")
+			body, starts := "", []indexer.Section{}
+			for i, text := range sections {
+				if i > 0 {
+					starts = append(starts, indexer.Section{ID: fmt.Sprintf("s%d", i), Start: len(body)})
+				}
+				body += text
+			}
+			rec.Write([]byte(body))
+			rec.SetSections(starts)
+			indxr.Pipe(rec)
+		}
+		found := func(text string) int {
+			return len(indxr.Search(indexer.Query{Text: text, DeepLinks: true}))
+		}
+
+		pipe("Welcome aboard. ", "Install with apt. ", "Configure the proxy.")
+		for i := 0; i < 100 && found("proxy.") == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(analyzer.analyzed(), ShouldContain, "Install with apt. ")
+
+		Convey("Should only analyze the sections changed when indexed again", func() {
+			pipe("Welcome aboard. ", "Install with brew. ", "Configure the proxy.")
+			for i := 0; i < 100 && found("brew.") == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			analyzed := analyzer.analyzed()
+			So(analyzed, ShouldContain, "Install with brew. ")
+			So(analyzed, ShouldNotContain, "Welcome aboard. ")
+			So(analyzed, ShouldNotContain, "Configure the proxy.")
+
+			So(found("apt."), ShouldEqual, 0)
+			So(found("brew."), ShouldEqual, 1)
+			So(found("aboard."), ShouldEqual, 1)
+			So(found(`"configure the"`), ShouldEqual, 1)
+
+			results := indxr.Search(indexer.Query{Text: "proxy.", DeepLinks: true})
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Section(), ShouldEqual, "s2")
+		})
+
+		Convey("Should analyze pages without sections whole", func() {
+			pipe("Welcome aboard, install with apt and configure the proxy.")
+			for i := 0; i < 100 && found("apt") == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(analyzer.analyzed(), ShouldContain, "Welcome aboard, install with apt and configure the proxy.")
+			So(found("proxy."), ShouldEqual, 1)
+		})
+	})
+}
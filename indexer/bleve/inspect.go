@@ -0,0 +1,76 @@
+package bleve
+
+import (
+	"sort"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// Terms returns the terms of a field of the record at path, as its language's
+// analyzer produces them from the stored text, with how often the index
+// holds each for the record and in how many records it is found. A term
+// left out of the index, such as a pruned rare term, has a frequency of 0.
+// Terms are listed most frequent first.
+func (i *bleveIndexer) Terms(path, field string) []indexer.Term {
+	rec := i.Record(path).(*Record)
+	if !rec.Load() {
+		return nil
+	}
+
+	var text string
+	switch field {
+	case "Title":
+		text = rec.title
+	case "Body":
+		text = string(rec.body)
+	default:
+		return nil
+	}
+
+	analyzer := i.recordAnalyzer(rec)
+	if analyzer == nil {
+		return nil
+	}
+
+	idx, _, err := i.bleve.Advanced()
+	if err != nil {
+		return nil
+	}
+	reader, err := idx.Reader()
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+
+	id, err := reader.InternalID(path)
+	if err != nil || id == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	terms := []indexer.Term{}
+	// token filters may change the text they analyze in place
+	for _, token := range analyzer.Analyze([]byte(text)) {
+		term := string(token.Term)
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		tfr, err := reader.TermFieldReader([]byte(term), field, true, false, false)
+		if err != nil {
+			continue
+		}
+		stats := indexer.Term{Text: term, Documents: tfr.Count()}
+		if doc, err := tfr.Advance(id, nil); err == nil && doc != nil && doc.ID.Equals(id) {
+			stats.Frequency = doc.Freq
+		}
+		tfr.Close()
+		terms = append(terms, stats)
+	}
+
+	sort.SliceStable(terms, func(a, b int) bool {
+		return terms[a].Frequency > terms[b].Frequency
+	})
+	return terms
+}
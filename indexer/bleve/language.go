@@ -0,0 +1,160 @@
+package bleve
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/analysis/lang/de"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/lang/es"
+	"github.com/blevesearch/bleve/analysis/lang/fr"
+	"github.com/blevesearch/bleve/analysis/lang/it"
+	"github.com/blevesearch/bleve/analysis/lang/nl"
+	"github.com/blevesearch/bleve/analysis/lang/pt"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// languageAnalyzers maps the language a record is tagged with to the bleve
+// analyzer that removes its stop words and stems its terms. Chinese, Japanese
+// and Korean are written without spaces between words, so their analyzer
+// indexes every pair of adjacent characters instead.
+var languageAnalyzers = map[string]string{
+	"de": de.AnalyzerName,
+	"en": en.AnalyzerName,
+	"es": es.AnalyzerName,
+	"fr": fr.AnalyzerName,
+	"it": it.AnalyzerName,
+	"ja": cjk.AnalyzerName,
+	"ko": cjk.AnalyzerName,
+	"nl": nl.AnalyzerName,
+	"pt": pt.AnalyzerName,
+	"zh": cjk.AnalyzerName,
+}
+
+// BleveType makes bleve index the record with the document mapping of its
+// language. Records in other languages use the default mapping.
+func (r indexRecord) BleveType() string {
+	if _, ok := languageAnalyzers[r.Language]; ok {
+		return r.Language
+	}
+	return ""
+}
+
+// addDocumentFields adds the fields that are stored but not analyzed as text
+func addDocumentFields(doc *mapping.DocumentMapping) {
+	// stored for display only, never matched by queries
+	storedOnly := bleve.NewTextFieldMapping()
+	storedOnly.Index = false
+	storedOnly.IncludeInAll = false
+	doc.AddFieldMappingsAt("Image", storedOnly)
+	doc.AddFieldMappingsAt("Description", storedOnly)
+	doc.AddFieldMappingsAt("Excerpt", storedOnly)
+	doc.AddFieldMappingsAt("Sections", storedOnly)
+	doc.AddFieldMappingsAt("Translations", storedOnly)
+	doc.AddFieldMappingsAt("Priority", storedOnly)
+	doc.AddFieldMappingsAt("Hash", storedOnly)
+
+	// matched with a lower weight than the text, apart from it
+	comments := bleve.NewTextFieldMapping()
+	comments.IncludeInAll = false
+	comments.IncludeTermVectors = false
+	doc.AddFieldMappingsAt("Comments", comments)
+
+	language := bleve.NewTextFieldMapping()
+	language.Analyzer = keyword.Name
+	language.IncludeInAll = false
+	doc.AddFieldMappingsAt("Language", language)
+
+	// matched exactly by scoped queries, never stored
+	scopes := bleve.NewTextFieldMapping()
+	scopes.Analyzer = keyword.Name
+	scopes.Store = false
+	scopes.IncludeInAll = false
+	doc.AddFieldMappingsAt("Scopes", scopes)
+
+	// matched by range only, never stored
+	dated := bleve.NewNumericFieldMapping()
+	dated.Store = false
+	dated.IncludeInAll = false
+	doc.AddFieldMappingsAt("Dated", dated)
+
+	addTrigramField(doc)
+	addTitleWordsField(doc)
+	addCustomFields(doc)
+}
+
+// addLanguageMappings adds a document mapping per supported language whose
+// fields are analyzed with that language's analyzer, or with the registered
+// analyzer segmenters names for it, such as a dictionary-based word segmenter
+func addLanguageMappings(indexMap *mapping.IndexMappingImpl, segmenters map[string]string) error {
+	for language := range segmenters {
+		if _, ok := languageAnalyzers[language]; !ok {
+			return fmt.Errorf("unsupported segmenter language %q", language)
+		}
+	}
+
+	for language, analyzer := range languageAnalyzers {
+		if name, ok := segmenters[language]; ok {
+			analyzer = "caddy_" + language + "_" + name
+			if err := addRegisteredAnalyzer(indexMap, analyzer, name, nil); err != nil {
+				return err
+			}
+		}
+
+		doc := bleve.NewDocumentMapping()
+		doc.DefaultAnalyzer = analyzer
+		addDocumentFields(doc)
+		indexMap.AddDocumentMapping(language, doc)
+	}
+	return nil
+}
+
+// languageQueryAnalyzers returns the analyzer of each language mapping of the
+// index, which queries in that language are analyzed with
+func languageQueryAnalyzers(blv bleve.Index) map[string]string {
+	analyzers := make(map[string]string, len(languageAnalyzers))
+	indexMap, ok := blv.Mapping().(*mapping.IndexMappingImpl)
+	for language, analyzer := range languageAnalyzers {
+		analyzers[language] = analyzer
+		if !ok {
+			continue
+		}
+		if doc, ok := indexMap.TypeMapping[language]; ok && doc.DefaultAnalyzer != "" {
+			analyzers[language] = doc.DefaultAnalyzer
+		}
+	}
+	return analyzers
+}
+
+// setQueryAnalyzer sets the analyzer of every match query in the parsed query
+// string that does not name one. Without it bleve would pick the analyzer of
+// an arbitrary language mapping.
+func setQueryAnalyzer(q query.Query, analyzer string) {
+	switch q := q.(type) {
+	case *query.MatchQuery:
+		if q.Analyzer == "" {
+			q.Analyzer = analyzer
+		}
+	case *query.MatchPhraseQuery:
+		if q.Analyzer == "" {
+			q.Analyzer = analyzer
+		}
+	case *query.BooleanQuery:
+		for _, sub := range []query.Query{q.Must, q.Should, q.MustNot} {
+			if sub != nil {
+				setQueryAnalyzer(sub, analyzer)
+			}
+		}
+	case *query.ConjunctionQuery:
+		for _, sub := range q.Conjuncts {
+			setQueryAnalyzer(sub, analyzer)
+		}
+	case *query.DisjunctionQuery:
+		for _, sub := range q.Disjuncts {
+			setQueryAnalyzer(sub, analyzer)
+		}
+	}
+}
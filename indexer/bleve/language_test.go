@@ -0,0 +1,129 @@
+package bleve_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"github.com/pedronasser/caddy-search/indexer/bleve"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLanguageAnalyzers(t *testing.T) {
+	Convey("Given an index with an English and an untagged document", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		indxr, err := bleve.New(dir, indexer.Config{})
+		So(err, ShouldBeNil)
+
+		for path, language := range map[string]string{"/en": "en", "/plain": ""} {
+			rec := indxr.Record(path)
+			rec.SetTitle(path)
+			rec.SetLanguage(language)
+			rec.Write([]byte("Running servers in containers"))
+			indxr.Pipe(rec)
+		}
+
+		for _, path := range []string{"/en", "/plain"} {
+			for i := 0; i < 100 && !indxr.Record(path).Load(); i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		Convey("Should stem the terms of queries in the document's language", func() {
+			records := indxr.Search(indexer.Query{Text: "runs", Language: "en"})
+			So(records, ShouldHaveLength, 1)
+			So(records[0].Path(), ShouldEqual, "/en")
+			So(records[0].Language(), ShouldEqual, "en")
+		})
+
+		Convey("Should analyze queries without a language with the default analyzer", func() {
+			So(indxr.Search(indexer.Query{Text: "runs"}), ShouldHaveLength, 0)
+
+			records := indxr.Search(indexer.Query{Text: "running"})
+			So(records, ShouldHaveLength, 1)
+			So(records[0].Path(), ShouldEqual, "/plain")
+		})
+	})
+}
+
+// dictionaryAnalyzer segments text into the longest words of its dictionary,
+// like a dictionary-based segmenter for languages written without spaces
+type dictionaryAnalyzer map[string]bool
+
+func (d dictionaryAnalyzer) Analyze(text string) (tokens []indexer.Token) {
+	for start := 0; start < len(text); {
+		end := start + len(string([]rune(text[start:])[0]))
+		for i := len(text); i > end; i-- {
+			if d[text[start:i]] {
+				end = i
+				break
+			}
+		}
+		tokens = append(tokens, indexer.Token{Term: text[start:end], Start: start, End: end})
+		start = end
+	}
+	return
+}
+
+// newLanguageRecord creates an index with a single document in a language
+// and waits until it is searchable. The returned func removes the index.
+func newLanguageRecord(config indexer.Config, language, body string) (indexer.Handler, func()) {
+	dir, err := ioutil.TempDir("", "caddyIndexTest")
+	So(err, ShouldBeNil)
+
+	indxr, err := bleve.New(dir, config)
+	So(err, ShouldBeNil)
+
+	rec := indxr.Record("/" + language)
+	rec.SetLanguage(language)
+	rec.Write([]byte(body))
+	indxr.Pipe(rec)
+
+	for i := 0; i < 100 && !indxr.Record("/"+language).Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return indxr, func() { os.RemoveAll(dir) }
+}
+
+func TestSegmenters(t *testing.T) {
+	Convey("Given a Chinese document and the built-in analyzer", t, func() {
+		indxr, cleanup := newLanguageRecord(indexer.Config{}, "zh", "全文搜索引擎")
+		defer cleanup()
+
+		Convey("Should match words of the text written without spaces", func() {
+			So(indxr.Search(indexer.Query{Text: "搜索", Language: "zh"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "引擎", Language: "zh"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "数据", Language: "zh"}), ShouldHaveLength, 0)
+		})
+	})
+
+	Convey("Given a Japanese document and a registered segmenter", t, func() {
+		indexer.RegisterAnalyzer("dictionary", dictionaryAnalyzer{"東京": true, "大学": true, "東京大学": true})
+		config := indexer.Config{Segmenters: map[string]string{"ja": "dictionary"}}
+		indxr, cleanup := newLanguageRecord(config, "ja", "東京大学で学ぶ")
+		defer cleanup()
+
+		Convey("Should segment documents and queries with the dictionary", func() {
+			So(indxr.Search(indexer.Query{Text: "東京大学", Language: "ja"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "学ぶ", Language: "ja"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "京大", Language: "ja"}), ShouldHaveLength, 0)
+		})
+	})
+
+	Convey("Given a segmenter for a language without a mapping", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		Convey("Should fail to open", func() {
+			_, err := bleve.New(dir, indexer.Config{Segmenters: map[string]string{"th": "standard"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
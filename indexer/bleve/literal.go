@@ -0,0 +1,26 @@
+package bleve
+
+import (
+	"strings"
+	"unicode"
+)
+
+// queryOperators are the characters the query string syntax reads as
+// operators unless escaped with a backslash
+const queryOperators = `+-=&|><!(){}[]^"~*?:\/`
+
+// escapeQueryString escapes every operator of text, so each of its
+// whitespace-separated words is matched as it is written. Whitespace becomes
+// a space, the only character ending a term.
+func escapeQueryString(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			r = ' '
+		} else if strings.ContainsRune(queryOperators, r) {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
@@ -0,0 +1,100 @@
+package bleve
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/index/scorch"
+	"github.com/blevesearch/bleve/index/upsidedown"
+)
+
+// Options the engine accepts in the block of the engine directive, as in
+// "engine bleve { index_type scorch }"
+const (
+	// OptionIndexType is the format of the indexes the engine creates:
+	// upsidedown, the default, or scorch, which is faster to write and
+	// smaller. Existing indexes keep their format.
+	OptionIndexType = "index_type"
+	// OptionUnsafeBatch, set to true, makes scorch indexes write batches
+	// without syncing them to disk, faster but losing the latest writes on
+	// a crash
+	OptionUnsafeBatch = "unsafe_batch"
+	// OptionSnapshots is the number of older snapshots a scorch index keeps
+	// on disk to recover from, 1 by default
+	OptionSnapshots = "snapshots"
+)
+
+// options are the parsed engine options
+type options struct {
+	indexType string
+	kvStore   string
+	kvConfig  map[string]interface{}
+}
+
+// ValidateOptions reports the first engine option that is unknown or whose
+// value is invalid
+func ValidateOptions(raw map[string]string) error {
+	_, err := parseOptions(raw)
+	return err
+}
+
+// parseOptions reads the engine options, leaving bleve's defaults for the
+// options not set
+func parseOptions(raw map[string]string) (options, error) {
+	opts := options{
+		indexType: bleve.Config.DefaultIndexType,
+		kvStore:   bleve.Config.DefaultKVStore,
+		kvConfig:  map[string]interface{}{},
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := raw[key]
+		switch key {
+		case OptionIndexType:
+			switch value {
+			case upsidedown.Name:
+			case scorch.Name:
+				opts.kvStore = scorch.Name
+			default:
+				return opts, fmt.Errorf("unknown %s `%s` (available: %s, %s)", key, value, upsidedown.Name, scorch.Name)
+			}
+			opts.indexType = value
+		case OptionUnsafeBatch:
+			unsafe, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, fmt.Errorf("%s must be true or false, not `%s`", key, value)
+			}
+			opts.kvConfig["unsafe_batch"] = unsafe
+		case OptionSnapshots:
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return opts, fmt.Errorf("%s must be a positive number, not `%s`", key, value)
+			}
+			opts.kvConfig["numSnapshotsToKeep"] = n
+		default:
+			return opts, fmt.Errorf("unknown option `%s` (available: %s)", key,
+				strings.Join([]string{OptionIndexType, OptionSnapshots, OptionUnsafeBatch}, ", "))
+		}
+	}
+
+	return opts, nil
+}
+
+// config returns a copy of the configuration passed to the index when it is
+// created or opened, which bleve adds its own settings to
+func (o options) config() map[string]interface{} {
+	config := make(map[string]interface{}, len(o.kvConfig))
+	for key, value := range o.kvConfig {
+		config[key] = value
+	}
+	return config
+}
@@ -0,0 +1,56 @@
+package bleve
+
+import (
+	"math"
+	"sort"
+
+	"github.com/blevesearch/bleve/search"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// positionCandidates is how many times the requested number of records is
+// scored when weighing positions, since the weights reorder the index's
+// ranking
+const positionCandidates = 4
+
+// positionBoost returns the score multiplier of a match whose terms occur at
+// the given positions: 1 plus the mean weight of the query's terms, each
+// weighing 1 at the top of the body (or in the title) and half as much every
+// decay words down from its earliest occurrence. A page mentioning the query
+// at its top thus scores up to twice one mentioning it in passing near its end.
+func positionBoost(match *search.DocumentMatch, decay int) float64 {
+	earliest := make(map[string]uint64)
+	for term := range match.Locations["Title"] {
+		earliest[term] = 0
+	}
+	for term, locations := range match.Locations["Body"] {
+		for _, location := range locations {
+			// positions count words from 1
+			pos := location.Pos - 1
+			if first, ok := earliest[term]; !ok || pos < first {
+				earliest[term] = pos
+			}
+		}
+	}
+	if len(earliest) == 0 {
+		return 1
+	}
+
+	weight := 0.0
+	for _, pos := range earliest {
+		weight += math.Exp2(-float64(pos) / float64(decay))
+	}
+	return 1 + weight/float64(len(earliest))
+}
+
+// rankPositions orders records by their score, once weighed by positions,
+// keeping no more than limit when set
+func rankPositions(records []indexer.Record, limit int) []indexer.Record {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Score() > records[j].Score()
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records
+}
@@ -0,0 +1,64 @@
+package bleve
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// prefixBoost weighs the prefix matches of a term against its exact matches,
+// so pages containing the term itself rank first
+const prefixBoost = 0.5
+
+// addPrefixMatches makes every single-word term of the parsed query string
+// with at least min characters also match the indexed terms it starts, as
+// if it were followed by `*`. Excluded terms, phrases and terms naming
+// another field keep matching exactly.
+func addPrefixMatches(q query.Query, min int) query.Query {
+	switch q := q.(type) {
+	case *query.MatchQuery:
+		if !prefixable(q, min) {
+			return q
+		}
+		prefix := bleve.NewPrefixQuery(strings.ToLower(q.Match))
+		prefix.SetField(q.FieldVal)
+		prefix.SetBoost(prefixBoost * q.Boost())
+		return bleve.NewDisjunctionQuery(q, prefix)
+	case *query.BooleanQuery:
+		if q.Must != nil {
+			q.Must = addPrefixMatches(q.Must, min)
+		}
+		if q.Should != nil {
+			q.Should = addPrefixMatches(q.Should, min)
+		}
+	case *query.ConjunctionQuery:
+		for i, sub := range q.Conjuncts {
+			q.Conjuncts[i] = addPrefixMatches(sub, min)
+		}
+	case *query.DisjunctionQuery:
+		for i, sub := range q.Disjuncts {
+			q.Disjuncts[i] = addPrefixMatches(sub, min)
+		}
+	}
+	return q
+}
+
+// prefixFields are the fields whose terms are matched by prefix; "" stands
+// for any field
+var prefixFields = map[string]bool{"": true, "_all": true, "Title": true, "Body": true}
+
+// prefixable reports whether a match query is a single word of at least min
+// characters in a text field
+func prefixable(q *query.MatchQuery, min int) bool {
+	if !prefixFields[q.FieldVal] || len([]rune(q.Match)) < min {
+		return false
+	}
+	for _, c := range q.Match {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package bleve_test
+
+import (
+	"testing"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrefixMatches(t *testing.T) {
+	body := "Edit the configuration before restarting the server."
+
+	Convey("Given an index matching terms by prefix", t, func() {
+		indxr, cleanup := newIndexedRecord(indexer.Config{MinPrefixMatch: 4}, "/setup", body)
+		defer cleanup()
+
+		Convey("Should match the indexed terms a query term starts", func() {
+			So(indxr.Search(indexer.Query{Text: "config"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "Restart server"}), ShouldHaveLength, 1)
+			So(indxr.Count(indexer.Query{Text: "+config"}), ShouldEqual, 1)
+		})
+
+		Convey("Should match shorter terms exactly", func() {
+			So(indxr.Search(indexer.Query{Text: "edi"}), ShouldHaveLength, 0)
+			So(indxr.Search(indexer.Query{Text: "edit"}), ShouldHaveLength, 1)
+		})
+
+		Convey("Should match phrases and excluded terms exactly", func() {
+			So(indxr.Search(indexer.Query{Text: `"the config"`}), ShouldHaveLength, 0)
+			So(indxr.Search(indexer.Query{Text: "server -config"}), ShouldHaveLength, 1)
+		})
+	})
+
+	Convey("Given an index without prefix matching", t, func() {
+		indxr, cleanup := newIndexedRecord(indexer.Config{}, "/setup", body)
+		defer cleanup()
+
+		Convey("Should only match whole terms", func() {
+			So(indxr.Search(indexer.Query{Text: "config"}), ShouldHaveLength, 0)
+		})
+	})
+}
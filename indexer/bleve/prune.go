@@ -0,0 +1,253 @@
+package bleve
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+const (
+	// prunedAnalyzer analyzes the Body field with the analyzer of its
+	// document mapping, then drops the index's rare terms
+	prunedAnalyzer = "caddy_pruned"
+	// rareTermsKey stores the rare terms in the index, so they stay pruned
+	// across restarts
+	rareTermsKey = "caddy_rare_terms"
+)
+
+var (
+	rareTermsMutex sync.Mutex
+	rareTermSets   = make(map[string]*rareTerms)
+)
+
+func init() {
+	registry.RegisterAnalyzer(prunedAnalyzer, prunedAnalyzerConstructor)
+}
+
+// rareTerms is the set of body terms left out of an index, as a token filter
+type rareTerms struct {
+	sync.RWMutex
+	terms map[string]bool
+}
+
+// rareTermsOf returns the rare terms of the index stored at name
+func rareTermsOf(name string) *rareTerms {
+	rareTermsMutex.Lock()
+	defer rareTermsMutex.Unlock()
+
+	rare, ok := rareTermSets[name]
+	if !ok {
+		rare = &rareTerms{terms: map[string]bool{}}
+		rareTermSets[name] = rare
+	}
+	return rare
+}
+
+func (r *rareTerms) Filter(input analysis.TokenStream) analysis.TokenStream {
+	r.RLock()
+	defer r.RUnlock()
+	if len(r.terms) == 0 {
+		return input
+	}
+
+	output := input[:0]
+	for _, token := range input {
+		if !r.terms[string(token.Term)] {
+			output = append(output, token)
+		}
+	}
+	return output
+}
+
+// replace makes terms the rare terms and returns those that were rare and
+// no longer are, or the other way round
+func (r *rareTerms) replace(terms map[string]bool) map[string]bool {
+	r.Lock()
+	defer r.Unlock()
+
+	changed := map[string]bool{}
+	for term := range terms {
+		if !r.terms[term] {
+			changed[term] = true
+		}
+	}
+	for term := range r.terms {
+		if !terms[term] {
+			changed[term] = true
+		}
+	}
+	r.terms = terms
+	return changed
+}
+
+// load reads the rare terms stored in the index
+func (r *rareTerms) load(blv bleve.Index) error {
+	data, err := blv.GetInternal([]byte(rareTermsKey))
+	if err != nil || data == nil {
+		return err
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	terms := make(map[string]bool, len(list))
+	for _, term := range list {
+		terms[term] = true
+	}
+	r.replace(terms)
+	return nil
+}
+
+// save stores the rare terms in the index
+func (r *rareTerms) save(blv bleve.Index) error {
+	r.RLock()
+	list := make([]string, 0, len(r.terms))
+	for term := range r.terms {
+		list = append(list, term)
+	}
+	r.RUnlock()
+	sort.Strings(list)
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return blv.SetInternal([]byte(rareTermsKey), data)
+}
+
+func prunedAnalyzerConstructor(config map[string]interface{}, cache *registry.Cache) (*analysis.Analyzer, error) {
+	name, _ := config["analyzer"].(string)
+	index, _ := config["index"].(string)
+	return &analysis.Analyzer{
+		Tokenizer:    &cachedAnalyzerTokenizer{name, cache},
+		TokenFilters: []analysis.TokenFilter{rareTermsOf(index)},
+	}, nil
+}
+
+// cachedAnalyzerTokenizer runs an analyzer of the index as a tokenizer. It is
+// looked up when first used, as the index may define it after the analyzer
+// depending on it.
+type cachedAnalyzerTokenizer struct {
+	name  string
+	cache *registry.Cache
+}
+
+func (t *cachedAnalyzerTokenizer) Tokenize(input []byte) analysis.TokenStream {
+	analyzer, err := t.cache.AnalyzerNamed(t.name)
+	if err != nil {
+		return analysis.TokenStream{}
+	}
+	return analyzer.Analyze(input)
+}
+
+// addPrunedBodies analyzes the Body field of the default and the language
+// document mappings with their analyzer followed by the rare terms of the
+// index stored at name
+func addPrunedBodies(indexMap *mapping.IndexMappingImpl, name string) error {
+	docs := []*mapping.DocumentMapping{indexMap.DefaultMapping}
+	for language := range languageAnalyzers {
+		docs = append(docs, indexMap.TypeMapping[language])
+	}
+
+	for _, doc := range docs {
+		base := doc.DefaultAnalyzer
+		if base == "" {
+			base = indexMap.DefaultAnalyzer
+		}
+
+		analyzer := prunedAnalyzer + "_" + base
+		if _, ok := indexMap.CustomAnalysis.Analyzers[analyzer]; !ok {
+			err := indexMap.AddCustomAnalyzer(analyzer, map[string]interface{}{
+				"type":     prunedAnalyzer,
+				"analyzer": base,
+				"index":    name,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		body := bleve.NewTextFieldMapping()
+		body.Analyzer = analyzer
+		doc.AddFieldMappingsAt("Body", body)
+	}
+	return nil
+}
+
+// Prune leaves the body terms found in fewer than MinTermDF documents out of
+// the index. It counts the documents holding each term in their stored
+// bodies, so terms pruned earlier come back once common enough, and
+// reindexes the records holding a term that became rare or common. Terms
+// stay searchable in titles.
+func (i *bleveIndexer) Prune() error {
+	if i.minTermDF < 2 {
+		return nil
+	}
+
+	df := map[string]int{}
+	err := i.Walk(func(rec indexer.Record) error {
+		for term := range i.bodyTerms(rec.(*Record)) {
+			df[term]++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rare := map[string]bool{}
+	for term, count := range df {
+		if count < i.minTermDF {
+			rare[term] = true
+		}
+	}
+
+	changed := i.rare.replace(rare)
+	if len(changed) == 0 {
+		return nil
+	}
+	if err := i.write(func() error { return i.rare.save(i.bleve) }); err != nil {
+		return err
+	}
+	if i.sections != nil {
+		// the tokens kept were pruned with the former rare terms
+		i.sections.reset()
+	}
+
+	return i.Walk(func(rec indexer.Record) error {
+		for term := range i.bodyTerms(rec.(*Record)) {
+			if changed[term] {
+				r := i.document(rec.(*Record))
+				return i.write(func() error { return i.put(rec.(*Record), r) })
+			}
+		}
+		return nil
+	})
+}
+
+// bodyTerms returns the distinct terms of a record's body, as analyzed before
+// rare terms are pruned
+func (i *bleveIndexer) bodyTerms(rec *Record) map[string]bool {
+	name := i.analyzer
+	if language, ok := i.languages[rec.Language()]; ok {
+		name = language
+	}
+
+	terms := map[string]bool{}
+	analyzer := i.bleve.Mapping().AnalyzerNamed(name)
+	if analyzer == nil {
+		return terms
+	}
+	// token filters may change the text they analyze in place
+	for _, token := range analyzer.Analyze([]byte(string(rec.body))) {
+		terms[string(token.Term)] = true
+	}
+	return terms
+}
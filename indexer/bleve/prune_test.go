@@ -0,0 +1,67 @@
+package bleve_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"github.com/pedronasser/caddy-search/indexer/bleve"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrune(t *testing.T) {
+	Convey("Given an index pruning the body terms of fewer than two documents", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		indxr, err := bleve.New(dir, indexer.Config{MinTermDF: 2})
+		So(err, ShouldBeNil)
+
+		index := func(path, title, body string) {
+			rec := indxr.Record(path)
+			rec.SetTitle(title)
+			rec.Write([]byte(body))
+			indxr.Pipe(rec)
+			for i := 0; i < 100 && len(indxr.Search(indexer.Query{Text: "Path:" + path})) == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		count := func(text string) uint64 {
+			return indxr.Count(indexer.Query{Text: text})
+		}
+
+		index("/install", "Install", "Install the plugin with the xyzzy package manager")
+		index("/configure", "Configure", "Configure the plugin in the Caddyfile")
+		index("/frobnicate", "Frobnicate", "Frobnicate the plugin")
+		So(count("xyzzy"), ShouldEqual, 1)
+		So(indxr.Prune(), ShouldBeNil)
+
+		Convey("Should leave rare body terms out of the index", func() {
+			So(count("xyzzy"), ShouldEqual, 0)
+			So(count("plugin"), ShouldEqual, 3)
+		})
+
+		Convey("Should keep rare terms of titles searchable", func() {
+			So(count("frobnicate"), ShouldEqual, 1)
+		})
+
+		Convey("Should keep the whole body of pruned records", func() {
+			rec := indxr.Record("/install")
+			So(rec.Load(), ShouldBeTrue)
+			So(string(rec.Body()), ShouldEqual, "Install the plugin with the xyzzy package manager")
+		})
+
+		Convey("Should prune the rare terms of records indexed later", func() {
+			index("/upgrade", "Upgrade", "Upgrade the plugin with xyzzy")
+			So(count("xyzzy"), ShouldEqual, 0)
+
+			Convey("Until they are common enough", func() {
+				So(indxr.Prune(), ShouldBeNil)
+				So(count("xyzzy"), ShouldEqual, 2)
+			})
+		})
+	})
+}
@@ -0,0 +1,134 @@
+package bleve
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// rebuildSuffix separates the name of an index from the time a rebuild
+// started in the path of the index it builds
+const rebuildSuffix = ".rebuild-"
+
+// activeFile returns the file naming the rebuilt index stored in place of
+// the index named name
+func activeFile(name string) string {
+	return name + ".active"
+}
+
+// activePath returns where the active index named name is stored: the
+// rebuilt index its active file names, if it exists, or else name itself
+func activePath(name string) string {
+	data, err := ioutil.ReadFile(activeFile(name))
+	if err != nil {
+		return name
+	}
+	path := filepath.Join(filepath.Dir(name), strings.TrimSpace(string(data)))
+	if _, err := os.Stat(path); err != nil {
+		return name
+	}
+	return path
+}
+
+// Rebuild builds a new index with build, which indexes every document into
+// the handler it is given, while queries keep being served by the current
+// index. Once build returns and its documents are indexed the new index
+// atomically replaces the current one, so queries see either index in full
+// and never one half built. Records written to the current index while
+// build runs are written to the new one too. When build fails the new index
+// is dropped and the current one kept.
+func (i *bleveIndexer) Rebuild(build func(indexer.Handler) error) error {
+	i.rebuildMutex.Lock()
+	defer i.rebuildMutex.Unlock()
+
+	i.removeStaleRebuilds()
+
+	path := fmt.Sprintf("%s%s%d", i.name, rebuildSuffix, time.Now().UnixNano())
+	staging, err := newIndexer(i.name, path, i.config)
+	if err != nil {
+		return err
+	}
+
+	i.setStaging(staging)
+	err = build(staging)
+	staging.queued.Wait()
+
+	if err == nil && i.minTermDF > 1 {
+		err = staging.rare.save(staging.active)
+	}
+	if err == nil {
+		err = writeActiveFile(i.name, path)
+	}
+	if err != nil {
+		i.setStaging(nil)
+		staging.active.Close()
+		os.RemoveAll(path)
+		return err
+	}
+
+	// writes made while swapping reach the new index either way
+	old, oldPath := i.active, i.path
+	i.bleve.Swap([]bleve.Index{staging.active}, []bleve.Index{old})
+	i.active, i.path = staging.active, path
+	i.setStaging(nil)
+
+	if err := old.Close(); err != nil {
+		log.Printf("[search] closing the replaced index %s: %v", oldPath, err)
+	}
+	if err := os.RemoveAll(oldPath); err != nil {
+		log.Printf("[search] removing the replaced index %s: %v", oldPath, err)
+	}
+	return nil
+}
+
+// setStaging sets the index a rebuild is building, or none
+func (i *bleveIndexer) setStaging(staging *bleveIndexer) {
+	i.stagingMutex.Lock()
+	defer i.stagingMutex.Unlock()
+	i.staging = staging
+}
+
+// mirror applies a write made to the active index to the index a rebuild is
+// building, if any
+func (i *bleveIndexer) mirror(op func(*bleveIndexer) error) {
+	i.stagingMutex.RLock()
+	defer i.stagingMutex.RUnlock()
+
+	if i.staging == nil {
+		return
+	}
+	if err := i.staging.write(func() error { return op(i.staging) }); err != nil {
+		log.Printf("[search] writing to the rebuilt index: %v", err)
+	}
+}
+
+// writeActiveFile records that the index named name is stored at path, in a
+// file replaced atomically so a crash leaves the previous index active
+func writeActiveFile(name, path string) error {
+	tmp := activeFile(name) + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(filepath.Base(path)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, activeFile(name))
+}
+
+// removeStaleRebuilds removes the indexes left by rebuilds that never
+// completed, such as those interrupted by a crash
+func (i *bleveIndexer) removeStaleRebuilds() {
+	stale, err := filepath.Glob(i.name + rebuildSuffix + "*")
+	if err != nil {
+		return
+	}
+	for _, path := range stale {
+		if path != i.path {
+			os.RemoveAll(path)
+		}
+	}
+}
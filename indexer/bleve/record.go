@@ -1,24 +1,46 @@
 package bleve
 
 import (
+	"fmt"
+	"hash/fnv"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
 )
 
 // Record handles indexer's data
 type Record struct {
-	indexer  *bleveIndexer
-	path     string
-	fullPath string
-	title    string
-	document map[string]interface{}
-	body     []byte
-	loaded   bool
-	modified time.Time
-	mutex    sync.RWMutex
-	ignored  bool
-	indexed  time.Time
+	indexer    *bleveIndexer
+	path       string
+	fullPath   string
+	title      string
+	ctype      string
+	image      string
+	desc       string
+	comments   string
+	excerpt    string
+	language   string
+	fields     map[string]string
+	priority   float64
+	score      float64
+	marks      []indexer.Highlight
+	titleMarks []indexer.Highlight
+	matched    []string
+	sections   []indexer.Section
+	section    string
+	// translations maps languages to the paths of the record's page in them
+	translations map[string]string
+	hash         string
+	document     map[string]interface{}
+	body         []byte
+	loaded       bool
+	modified     time.Time
+	mutex        sync.RWMutex
+	ignored      bool
+	indexed      time.Time
 }
 
 // Path returns Record's path
@@ -37,8 +59,8 @@ func (r *Record) FullPath() string {
 
 // SetFullPath defines a new fullpath for the record
 func (r *Record) SetFullPath(fp string) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	r.fullPath = fp
 }
 
@@ -49,11 +71,233 @@ func (r *Record) Title() string {
 	return r.title
 }
 
-// SetTitle replaces Record's title
+// SetTitle replaces Record's title. Leading and trailing whitespace is
+// trimmed and internal runs of whitespace are collapsed to a single space.
 func (r *Record) SetTitle(title string) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	r.title = title
+	r.title = strings.Join(strings.Fields(title), " ")
+}
+
+// ContentType returns the media type the record's body was served with
+func (r *Record) ContentType() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.ctype
+}
+
+// SetContentType defines the media type of the record's body
+func (r *Record) SetContentType(ctype string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.ctype = ctype
+}
+
+// Image returns the URL of the record's representative image
+func (r *Record) Image() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.image
+}
+
+// SetImage defines the URL of the record's representative image
+func (r *Record) SetImage(image string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.image = image
+}
+
+// Description returns the summary the page gives of itself
+func (r *Record) Description() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.desc
+}
+
+// SetDescription defines the summary the page gives of itself
+func (r *Record) SetDescription(desc string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.desc = desc
+}
+
+// Comments returns the text of the discussion attached to the page
+func (r *Record) Comments() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.comments
+}
+
+// SetComments defines the text of the discussion attached to the page,
+// indexed apart from its body
+func (r *Record) SetComments(comments string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.comments = comments
+}
+
+// Excerpt returns the preview of the page its author wrote, if any
+func (r *Record) Excerpt() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.excerpt
+}
+
+// SetExcerpt defines the preview of the page its author wrote
+func (r *Record) SetExcerpt(excerpt string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.excerpt = excerpt
+}
+
+// Language returns the language the record is indexed in
+func (r *Record) Language() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.language
+}
+
+// SetLanguage defines the language the record is indexed in, which selects
+// the analyzer applied to its fields
+func (r *Record) SetLanguage(language string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.language = language
+}
+
+// Fields returns the custom fields the page declares
+func (r *Record) Fields() map[string]string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.fields
+}
+
+// SetFields defines the custom fields the page declares, indexed to be
+// matched by field:value terms
+func (r *Record) SetFields(fields map[string]string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.fields = fields
+}
+
+// Priority returns the importance of the page relative to the site's other
+// pages, from 0 to 1, as declared by a sitemap
+func (r *Record) Priority() float64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.priority
+}
+
+// SetPriority defines the importance of the page relative to the site's other
+// pages, from 0 to 1
+func (r *Record) SetPriority(priority float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.priority = priority
+}
+
+// Highlights returns the locations of the matching terms in the record's
+// plain text snippet
+func (r *Record) Highlights() []indexer.Highlight {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.marks
+}
+
+// SetHighlights defines the locations of the matching terms in the record's
+// plain text snippet
+func (r *Record) SetHighlights(marks []indexer.Highlight) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.marks = marks
+}
+
+// TitleHighlights returns the locations of the matching terms in the
+// record's title
+func (r *Record) TitleHighlights() []indexer.Highlight {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.titleMarks
+}
+
+// SetTitleHighlights defines the locations of the matching terms in the
+// record's title
+func (r *Record) SetTitleHighlights(marks []indexer.Highlight) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.titleMarks = marks
+}
+
+// MatchedTerms returns the words of the query the record matched, as typed
+func (r *Record) MatchedTerms() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.matched
+}
+
+// SetMatchedTerms defines the words of the query the record matched
+func (r *Record) SetMatchedTerms(terms []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.matched = terms
+}
+
+// Sections returns the sections of the record's body
+func (r *Record) Sections() []indexer.Section {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.sections
+}
+
+// SetSections defines the sections of the record's body
+func (r *Record) SetSections(sections []indexer.Section) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sections = sections
+}
+
+// Translations returns the paths of the record's page in other languages,
+// by language
+func (r *Record) Translations() map[string]string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.translations
+}
+
+// SetTranslations defines the paths of the record's page in other languages
+func (r *Record) SetTranslations(translations map[string]string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.translations = translations
+}
+
+// Section returns the id of the section holding the best match of the query
+// that found the record, if any
+func (r *Record) Section() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.section
+}
+
+// SetSection defines the id of the section holding the record's best match
+func (r *Record) SetSection(id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.section = id
+}
+
+// Score returns the relevance of the record to the query that found it
+func (r *Record) Score() float64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.score
+}
+
+// SetScore defines the relevance of the record to the query that found it
+func (r *Record) SetScore(score float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.score = score
 }
 
 // Modified returns Record's Modified
@@ -99,6 +343,13 @@ func (r *Record) Load() bool {
 		name := field.Name()
 		value := field.Value()
 		result[name] = value
+
+		if strings.HasPrefix(name, fieldsPrefix) {
+			if r.fields == nil {
+				r.fields = make(map[string]string)
+			}
+			r.fields[strings.TrimPrefix(name, fieldsPrefix)] = string(value)
+		}
 	}
 
 	strModified := string(result["Modified"].([]byte))
@@ -119,6 +370,44 @@ func (r *Record) Load() bool {
 
 	r.title = string(result["Title"].([]byte))
 
+	if image, ok := result["Image"].([]byte); ok {
+		r.image = string(image)
+	}
+
+	if desc, ok := result["Description"].([]byte); ok {
+		r.desc = string(desc)
+	}
+
+	if excerpt, ok := result["Excerpt"].([]byte); ok {
+		r.excerpt = string(excerpt)
+	}
+
+	if comments, ok := result["Comments"].([]byte); ok {
+		r.comments = string(comments)
+	}
+
+	if sections, ok := result["Sections"].([]byte); ok {
+		r.sections = decodeSections(string(sections))
+	}
+
+	if translations, ok := result["Translations"].([]byte); ok {
+		r.translations = decodeTranslations(string(translations))
+	}
+
+	if hash, ok := result["Hash"].([]byte); ok {
+		r.hash = string(hash)
+	}
+
+	if language, ok := result["Language"].([]byte); ok {
+		r.language = string(language)
+	}
+
+	if priority, ok := result["Priority"].([]byte); ok {
+		if p, err := strconv.ParseFloat(string(priority), 64); err == nil {
+			r.priority = p
+		}
+	}
+
 	r.loaded = true
 
 	return true
@@ -165,3 +454,19 @@ func (r *Record) SetIndexed(index time.Time) {
 
 	r.indexed = index
 }
+
+// Hash returns the hash of the body the record was indexed with, as loaded
+// from the index, which changes whenever the indexed text does
+func (r *Record) Hash() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.hash
+}
+
+// contentHash returns the 64-bit FNV-1a hash of an indexed body, in hex
+func contentHash(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
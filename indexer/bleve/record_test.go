@@ -1 +1,50 @@
 package bleve_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"github.com/pedronasser/caddy-search/indexer/bleve"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordTitle(t *testing.T) {
+	Convey("Given a new record", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		indxr, err := bleve.New(dir, indexer.Config{})
+		So(err, ShouldBeNil)
+		rec := indxr.Record("/page")
+
+		Convey("Should trim and collapse whitespace in the title", func() {
+			rec.SetTitle("\n\t  Multi-line\n\t\tpage   title \n")
+			So(rec.Title(), ShouldEqual, "Multi-line page title")
+		})
+	})
+}
+
+func TestRecordReuse(t *testing.T) {
+	Convey("Given a record that was written and released", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		indxr, err := bleve.New(dir, indexer.Config{})
+		So(err, ShouldBeNil)
+
+		for i := 0; i < 10; i++ {
+			rec := indxr.Record("/old")
+			rec.Write([]byte("Page not found"))
+			indxr.Kill(rec)
+		}
+
+		Convey("Should start new records with an empty body", func() {
+			rec := indxr.Record("/new")
+			So(rec.Body(), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,77 @@
+package bleve
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// encodeSections writes the sections of a body as stored in the index, a
+// line per section holding its start and its id
+func encodeSections(sections []indexer.Section) string {
+	lines := make([]string, len(sections))
+	for i, section := range sections {
+		lines[i] = strconv.Itoa(section.Start) + " " + section.ID
+	}
+	return strings.Join(lines, "\n")
+}
+
+// decodeSections reads the sections of a body stored in the index
+func decodeSections(stored string) []indexer.Section {
+	var sections []indexer.Section
+	for _, line := range strings.Split(stored, "\n") {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		start, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		sections = append(sections, indexer.Section{ID: fields[1], Start: start})
+	}
+	return sections
+}
+
+// matchSection returns the id of the section holding the best match of a
+// body, or nothing when it precedes every section or the body has no match
+func matchSection(sections []indexer.Section, spans []span) string {
+	best := bestMatch(spans)
+	id := ""
+	for _, section := range sections {
+		if best < 0 || section.Start > best {
+			break
+		}
+		id = section.ID
+	}
+	return id
+}
+
+// encodeTranslations writes the translations of a page as stored in the
+// index, a line per language holding the language and the translation's path
+func encodeTranslations(translations map[string]string) string {
+	lines := make([]string, 0, len(translations))
+	for language, path := range translations {
+		lines = append(lines, language+" "+path)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// decodeTranslations reads the translations of a page stored in the index
+func decodeTranslations(stored string) map[string]string {
+	var translations map[string]string
+	for _, line := range strings.Split(stored, "\n") {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		if translations == nil {
+			translations = make(map[string]string)
+		}
+		translations[fields[0]] = fields[1]
+	}
+	return translations
+}
@@ -0,0 +1,317 @@
+package bleve
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/search"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+const (
+	// snippetSize is the length, in bytes, of a result's excerpt
+	snippetSize = 200
+	// snippetLead is how much text precedes the first matching term of a
+	// best_match excerpt
+	snippetLead = 40
+	// snippetSlack is how far an excerpt's edges move to reach a word boundary
+	snippetSlack = 20
+)
+
+// span is the location of a matching term in a field
+type span struct {
+	start, end int
+	term       string
+}
+
+// fieldSpans returns the locations of the query's terms in a field of a
+// match, in document order
+func fieldSpans(match *search.DocumentMatch, field string) []span {
+	spans := []span{}
+	for term, locations := range match.Locations[field] {
+		for _, location := range locations {
+			spans = append(spans, span{int(location.Start), int(location.End), term})
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	return spans
+}
+
+// recordSnippet builds the excerpt shown for a record: the first excerpt its
+// author wrote among the query's excerpt sources, with the words matching the
+// query marked, or else the snippet of the query's strategy
+func recordSnippet(rec indexer.Record, spans []span, q indexer.Query, m marker) (string, []indexer.Highlight) {
+sources:
+	for _, source := range q.Excerpt {
+		text := ""
+		switch source {
+		case indexer.ExcerptFrontMatter:
+			text = rec.Excerpt()
+		case indexer.ExcerptMeta:
+			text = rec.Description()
+		case indexer.ExcerptGenerated:
+			break sources
+		}
+		if text == "" {
+			continue
+		}
+
+		marks := m.trim(text, m.wordSpans(text, spans))
+		if q.PlainSnippet {
+			return text, highlights(text, marks)
+		}
+		return markHTML(text, marks), nil
+	}
+
+	return snippet(string(rec.Body()), rec.Description(), spans, q.Snippet, q.PlainSnippet, m)
+}
+
+// snippet builds the excerpt shown for a result with the given strategy. By
+// default the text is escaped HTML whose matching terms are wrapped in <mark>
+// elements; in plain text the matching terms are returned as highlights.
+func snippet(body, description string, spans []span, strategy string, plain bool, m marker) (string, []indexer.Highlight) {
+	var text string
+	var marks []span
+
+	switch strategy {
+	case indexer.SnippetMeta:
+		if description != "" {
+			text, marks = description, m.wordSpans(description, spans)
+		} else {
+			text, marks = excerpt(body, spans, bestMatchStart(body, spans))
+		}
+	case indexer.SnippetBestMatch:
+		text, marks = excerpt(body, spans, bestMatchStart(body, spans))
+	default:
+		text, marks = excerpt(body, spans, 0)
+	}
+	marks = m.trim(text, marks)
+
+	if plain {
+		return text, highlights(text, marks)
+	}
+	return markHTML(text, marks), nil
+}
+
+// bestMatchStart returns where the excerpt covering the most distinct query
+// terms begins, preferring the one with the most matches among equals
+func bestMatchStart(body string, spans []span) int {
+	best := bestMatch(spans)
+	if best <= snippetLead {
+		return 0
+	}
+	return best - snippetLead
+}
+
+// bestMatch returns the start of the first match of the passage covering
+// the most distinct query terms, or -1 without matches
+func bestMatch(spans []span) int {
+	best, bestTerms, bestMatches := -1, 0, 0
+
+	for i := range spans {
+		terms := map[string]bool{}
+		matches := 0
+		for _, s := range spans[i:] {
+			if s.end > spans[i].start+snippetSize-snippetLead {
+				break
+			}
+			terms[s.term] = true
+			matches++
+		}
+
+		if len(terms) > bestTerms || len(terms) == bestTerms && matches > bestMatches {
+			best, bestTerms, bestMatches = spans[i].start, len(terms), matches
+		}
+	}
+	return best
+}
+
+// excerpt cuts up to snippetSize bytes of body from around start, moving
+// both edges back to word boundaries, and returns them with the spans they
+// hold, located in the excerpt
+func excerpt(body string, spans []span, start int) (string, []span) {
+	start = wordBoundary(body, start, -1)
+	end := len(body)
+	if start+snippetSize < end {
+		end = wordBoundary(body, start+snippetSize, -1)
+		if end <= start {
+			end = wordBoundary(body, start+snippetSize, 1)
+		}
+	}
+
+	prefix := ""
+	if start > 0 {
+		prefix = "…"
+	}
+	text := prefix + body[start:end]
+	if end < len(body) {
+		text += "…"
+	}
+
+	trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+	offset := len(prefix) - start - (len(text) - len(trimmed))
+
+	marks := []span{}
+	pos := start
+	for _, s := range spans {
+		if s.start < pos || s.end > end {
+			continue
+		}
+		marks = append(marks, span{s.start + offset, s.end + offset, s.term})
+		pos = s.end
+	}
+
+	return strings.TrimRightFunc(trimmed, unicode.IsSpace), marks
+}
+
+// markHTML escapes text and wraps its marked spans in <mark> elements
+func markHTML(text string, marks []span) string {
+	var buf strings.Builder
+
+	pos := 0
+	for _, s := range marks {
+		buf.WriteString(html.EscapeString(text[pos:s.start]))
+		buf.WriteString("<mark>")
+		buf.WriteString(html.EscapeString(text[s.start:s.end]))
+		buf.WriteString("</mark>")
+		pos = s.end
+	}
+	buf.WriteString(html.EscapeString(text[pos:]))
+
+	return buf.String()
+}
+
+// titleHighlights returns the locations of the matching terms in a title,
+// skipping those overlapping an earlier one
+func titleHighlights(title string, spans []span) []indexer.Highlight {
+	marks := []span{}
+	pos := 0
+	for _, s := range spans {
+		if s.start < pos || s.end > len(title) {
+			continue
+		}
+		marks = append(marks, s)
+		pos = s.end
+	}
+	return highlights(title, marks)
+}
+
+// highlights converts the byte offsets of the marked spans of text to rune
+// offsets
+func highlights(text string, marks []span) []indexer.Highlight {
+	result := make([]indexer.Highlight, len(marks))
+	for i, s := range marks {
+		start := utf8.RuneCountInString(text[:s.start])
+		result[i] = indexer.Highlight{
+			Start: start,
+			End:   start + utf8.RuneCountInString(text[s.start:s.end]),
+		}
+	}
+	return result
+}
+
+// wordBoundary moves i, in direction dir, to the nearest space or
+// punctuation mark within snippetSlack bytes, then to the nearest break
+// between two characters of a script written without spaces, or else to the
+// nearest grapheme boundary, so an edge never splits a character, an accented
+// letter or an emoji sequence
+func wordBoundary(body string, i, dir int) int {
+	if i <= 0 {
+		return 0
+	}
+	if i >= len(body) {
+		return len(body)
+	}
+
+	for _, unspacedBreaks := range []bool{false, true} {
+		for j, moved := i, 0; j > 0 && j < len(body) && moved < snippetSlack; j, moved = j+dir, moved+1 {
+			if utf8.RuneStart(body[j]) && isWordBreak(body, j, unspacedBreaks) {
+				return j
+			}
+		}
+	}
+
+	for i > 0 && i < len(body) && !isGraphemeBreak(body, i) {
+		i += dir
+	}
+	return i
+}
+
+// isWordBreak reports whether the rune boundary j of body lies between two
+// words: after a space or a CJK punctuation mark or, with unspacedBreaks,
+// between two characters of the scripts written without spaces
+func isWordBreak(body string, j int, unspacedBreaks bool) bool {
+	before, _ := utf8.DecodeLastRuneInString(body[:j])
+	if unicode.IsSpace(before) || unicode.Is(cjkPunctuation, before) {
+		return true
+	}
+	if !unspacedBreaks {
+		return false
+	}
+	after, _ := utf8.DecodeRuneInString(body[j:])
+	return unspaced(before) && unspaced(after)
+}
+
+// cjkPunctuation holds the ideographic punctuation marks words end with, as
+// in 。、「」
+var cjkPunctuation = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x3001, Hi: 0x3003, Stride: 1},
+		{Lo: 0x3008, Hi: 0x3011, Stride: 1},
+		{Lo: 0xff01, Hi: 0xff0f, Stride: 1},
+		{Lo: 0xff1a, Hi: 0xff1f, Stride: 1},
+	},
+}
+
+// unspaced reports whether r belongs to a script written without spaces
+// between words, whose text may be cut between any two characters
+func unspaced(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// isGraphemeBreak reports whether the byte offset i of body starts a
+// user-perceived character: a rune that neither extends the previous one, as
+// combining marks, variation selectors and emoji modifiers do, nor follows a
+// zero-width joiner or the first half of a flag
+func isGraphemeBreak(body string, i int) bool {
+	if !utf8.RuneStart(body[i]) {
+		return false
+	}
+	before, _ := utf8.DecodeLastRuneInString(body[:i])
+	after, _ := utf8.DecodeRuneInString(body[i:])
+	switch {
+	case before == zeroWidthJoiner,
+		after == zeroWidthJoiner,
+		unicode.In(after, unicode.Mn, unicode.Me, unicode.Mc, unicode.Variation_Selector),
+		after >= 0x1f3fb && after <= 0x1f3ff: // emoji skin tones
+		return false
+	case regionalIndicator(before) && regionalIndicator(after):
+		// flags are pairs of regional indicators
+		indicators := 0
+		for j := i; j > 0; {
+			r, size := utf8.DecodeLastRuneInString(body[:j])
+			if !regionalIndicator(r) {
+				break
+			}
+			indicators++
+			j -= size
+		}
+		return indicators%2 == 0
+	}
+	return true
+}
+
+// zeroWidthJoiner joins emoji into a single one, as in 👩‍💻
+const zeroWidthJoiner = '\u200d'
+
+// regionalIndicator reports whether r is one of the letters flags are made of
+func regionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
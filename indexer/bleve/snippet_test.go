@@ -0,0 +1,162 @@
+package bleve_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"github.com/pedronasser/caddy-search/indexer/bleve"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSnippetStrategies(t *testing.T) {
+	filler := strings.Repeat("lorem ipsum dolor sit amet ", 20)
+	body := "The alpha release notes. " + filler + "Upgrading from alpha to beta keeps <your> data. " + filler
+
+	Convey("Given an indexed document with matches spread over its body", t, func() {
+		indxr, cleanup := newIndexedRecord(indexer.Config{}, "/notes", body)
+		defer cleanup()
+
+		search := func(strategy string) string {
+			records := indxr.Search(indexer.Query{Text: "alpha beta", Snippet: strategy})
+			So(records, ShouldHaveLength, 1)
+			return string(records[0].Body())
+		}
+
+		Convey("Should excerpt the beginning of the body with the leading strategy", func() {
+			snippet := search(indexer.SnippetLeading)
+			So(snippet, ShouldStartWith, "The <mark>alpha</mark> release notes.")
+			So(snippet, ShouldEndWith, "…")
+			So(len(snippet), ShouldBeLessThan, 250)
+		})
+
+		Convey("Should excerpt the passage covering most terms with the best_match strategy", func() {
+			snippet := search(indexer.SnippetBestMatch)
+			So(snippet, ShouldStartWith, "…")
+			So(snippet, ShouldContainSubstring, "Upgrading from <mark>alpha</mark> to <mark>beta</mark> keeps &lt;your&gt; data.")
+		})
+
+		Convey("Should fall back to the best match with the meta strategy when there is no description", func() {
+			So(search(indexer.SnippetMeta), ShouldEqual, search(indexer.SnippetBestMatch))
+		})
+	})
+}
+
+func TestPlainSnippets(t *testing.T) {
+	Convey("Given an indexed document with multibyte text", t, func() {
+		indxr, cleanup := newIndexedRecord(indexer.Config{}, "/café", "Ünïcode café <menu> and café prices")
+		defer cleanup()
+
+		Convey("Should return plain text with the rune offsets of the matching terms", func() {
+			records := indxr.Search(indexer.Query{Text: "café", PlainSnippet: true})
+			So(records, ShouldHaveLength, 1)
+
+			snippet := []rune(string(records[0].Body()))
+			So(string(snippet), ShouldEqual, "Ünïcode café <menu> and café prices")
+			So(records[0].Highlights(), ShouldResemble, []indexer.Highlight{{Start: 8, End: 12}, {Start: 24, End: 28}})
+			for _, mark := range records[0].Highlights() {
+				So(string(snippet[mark.Start:mark.End]), ShouldEqual, "café")
+			}
+		})
+
+		Convey("Should keep inline <mark> elements in HTML snippets", func() {
+			records := indxr.Search(indexer.Query{Text: "café"})
+			So(records, ShouldHaveLength, 1)
+			So(string(records[0].Body()), ShouldEqual, "Ünïcode <mark>café</mark> &lt;menu&gt; and <mark>café</mark> prices")
+			So(records[0].Highlights(), ShouldBeEmpty)
+		})
+
+		Convey("Should locate the matching terms of the title in runes", func() {
+			records := indxr.Search(indexer.Query{Text: "café"})
+			So(records, ShouldHaveLength, 1)
+			So(records[0].Title(), ShouldEqual, "/café")
+			So(records[0].TitleHighlights(), ShouldResemble, []indexer.Highlight{{Start: 1, End: 5}})
+		})
+	})
+}
+
+func TestSnippetBoundaries(t *testing.T) {
+	Convey("Given indexed documents with long multibyte bodies", t, func() {
+		excerpt := func(body string) string {
+			indxr, cleanup := newIndexedRecord(indexer.Config{}, "/page", body)
+			defer cleanup()
+
+			records := indxr.Search(indexer.Query{Text: "release", PlainSnippet: true})
+			So(records, ShouldHaveLength, 1)
+			snippet := string(records[0].Body())
+			So(utf8.ValidString(snippet), ShouldBeTrue)
+			So(snippet, ShouldEndWith, "…")
+			So(len(snippet), ShouldBeLessThanOrEqualTo, 200+len("…"))
+			return strings.TrimSuffix(snippet, "…")
+		}
+
+		Convey("Should cut CJK text after a punctuation mark", func() {
+			text := excerpt("release 東京は日本の首都です。" + strings.Repeat("新しい版では検索が速くなりました。", 20))
+			So(text, ShouldEndWith, "。")
+		})
+
+		Convey("Should never split an emoji sequence", func() {
+			text := excerpt("release notes " + strings.Repeat("👩\u200d💻🇯🇵👍🏽", 30))
+			So(strings.HasSuffix(text, "👩\u200d💻") || strings.HasSuffix(text, "🇯🇵") || strings.HasSuffix(text, "👍🏽"), ShouldBeTrue)
+			So(strings.TrimRight(strings.TrimPrefix(text, "release notes "), "👩\u200d💻🇯🇵👍🏽"), ShouldBeEmpty)
+		})
+
+		Convey("Should never split a letter from its combining accent", func() {
+			text := excerpt("release " + strings.Repeat("e\u0301", 100))
+			So(text, ShouldEndWith, "e\u0301")
+		})
+	})
+}
+
+func TestStemmedHighlights(t *testing.T) {
+	Convey("Given an English document whose words match a query once stemmed", t, func() {
+		dir, err := ioutil.TempDir("", "caddyIndexTest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		indxr, err := bleve.New(dir, indexer.Config{})
+		So(err, ShouldBeNil)
+
+		rec := indxr.Record("/training")
+		rec.SetTitle("Running plans")
+		rec.SetLanguage("en")
+		rec.SetDescription("Tips for runners who run daily.")
+		rec.Write([]byte("She was running daily. He runs, and the run ends."))
+		indxr.Pipe(rec)
+		for i := 0; i < 100 && !indxr.Record("/training").Load(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		search := func(q indexer.Query) indexer.Record {
+			q.Text, q.Language = "run", "en"
+			records := indxr.Search(q)
+			So(records, ShouldHaveLength, 1)
+			return records[0]
+		}
+
+		Convey("Should mark every word the query matched, whole", func() {
+			rec := search(indexer.Query{})
+			So(string(rec.Body()), ShouldEqual,
+				"She was <mark>running</mark> daily. He <mark>runs</mark>, and the <mark>run</mark> ends.")
+			So(rec.TitleHighlights(), ShouldResemble, []indexer.Highlight{{Start: 0, End: 7}})
+		})
+
+		Convey("Should mark the matched words of a description, which is not indexed", func() {
+			rec := search(indexer.Query{Snippet: indexer.SnippetMeta})
+			So(string(rec.Body()), ShouldEqual, "Tips for runners who <mark>run</mark> daily.")
+			rec = search(indexer.Query{Excerpt: []string{indexer.ExcerptMeta}})
+			So(string(rec.Body()), ShouldEqual, "Tips for runners who <mark>run</mark> daily.")
+		})
+
+		Convey("Should mark only the part of the words the query's word shares with them", func() {
+			rec := search(indexer.Query{PartialHighlights: true})
+			So(string(rec.Body()), ShouldEqual,
+				"She was <mark>run</mark>ning daily. He <mark>run</mark>s, and the <mark>run</mark> ends.")
+			So(rec.TitleHighlights(), ShouldResemble, []indexer.Highlight{{Start: 0, End: 3}})
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package bleve
+
+import (
+	"strings"
+
+	"github.com/blevesearch/bleve/numeric"
+	"github.com/blevesearch/bleve/search"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// fieldSort orders the records by the indexer.SortKey of a custom field, as
+// read from its indexed term, which the field analyzer lowercased. Records
+// without a key follow the others in either direction.
+type fieldSort struct {
+	field      string
+	descending bool
+	key        string
+}
+
+// sortOrder returns the order of the records a query asks for: by the key of
+// its sort field, then by score and then by path
+func sortOrder(q indexer.Query) search.SortOrder {
+	return search.SortOrder{
+		&fieldSort{field: fieldsPrefix + strings.ToLower(q.SortField), descending: q.SortDescending},
+		&search.SortScore{Desc: true},
+		&search.SortDocID{},
+	}
+}
+
+func (s *fieldSort) UpdateVisitor(field string, term []byte) {
+	if field != s.field || s.key != "" {
+		return
+	}
+	// dates are written with an upper case T and Z
+	if key, ok := indexer.SortKey(strings.ToUpper(string(term))); ok {
+		s.key = string(numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(key), 0))
+	}
+}
+
+func (s *fieldSort) Value(match *search.DocumentMatch) string {
+	key := s.key
+	s.key = ""
+	if key != "" {
+		return key
+	}
+	if s.descending {
+		return search.LowTerm
+	}
+	return search.HighTerm
+}
+
+func (s *fieldSort) Descending() bool { return s.descending }
+
+func (s *fieldSort) RequiresDocID() bool      { return false }
+func (s *fieldSort) RequiresScoring() bool    { return false }
+func (s *fieldSort) RequiresFields() []string { return []string{s.field} }
+
+func (s *fieldSort) Reverse() { s.descending = !s.descending }
+
+func (s *fieldSort) Copy() search.SearchSort {
+	copied := *s
+	return &copied
+}
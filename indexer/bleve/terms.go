@@ -0,0 +1,130 @@
+package bleve
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve/search"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// queryWord is a word of a query's text with the term it is indexed as
+type queryWord struct {
+	word, term string
+}
+
+// queryWords returns the words of a query's text that can match a record, as
+// typed, each with the term the analyzer turns it into. Excluded terms are
+// left out and field names are skipped.
+func (i *bleveIndexer) queryWords(text, analyzer string) []queryWord {
+	analyze := i.bleve.Mapping().AnalyzerNamed(analyzer)
+	if analyze == nil {
+		return nil
+	}
+
+	words := []queryWord{}
+	for _, field := range strings.Fields(text) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		if j := strings.Index(field, ":"); j >= 0 {
+			field = field[j+1:]
+		}
+
+		for _, word := range strings.FieldsFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			for _, token := range analyze.Analyze([]byte(word)) {
+				words = append(words, queryWord{word, string(token.Term)})
+			}
+		}
+	}
+	return words
+}
+
+// matchedTerms returns the words of the query a match holds in any of its
+// fields, as typed and in query order, so a stemmed match is listed as the
+// word it stems from. With prefix matching, words as long as minPrefix also
+// match the terms they begin.
+func matchedTerms(match *search.DocumentMatch, words []queryWord, minPrefix int) []string {
+	located := map[string]bool{}
+	for _, terms := range match.Locations {
+		for term := range terms {
+			located[term] = true
+		}
+	}
+
+	matched := []string{}
+	seen := map[string]bool{}
+	for _, w := range words {
+		if seen[w.word] || !locatedTerm(located, w.term, minPrefix) {
+			continue
+		}
+		seen[w.word] = true
+		matched = append(matched, w.word)
+	}
+	return matched
+}
+
+// locatedTerm reports whether term, or with prefix matching a term it
+// begins, is among the located terms
+func locatedTerm(located map[string]bool, term string, minPrefix int) bool {
+	if located[term] {
+		return true
+	}
+	if minPrefix <= 0 || len([]rune(term)) < minPrefix {
+		return false
+	}
+	for l := range located {
+		if strings.HasPrefix(l, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// DocFrequency returns in how many records a word of a query is found, as
+// the analyzer of the language turns it into terms: the records holding the
+// rarest of its terms in their title or body. It only reads the term
+// dictionary. A word the analyzer drops, such as a stop word, is found in
+// none.
+func (i *bleveIndexer) DocFrequency(word, language string) uint64 {
+	analyze := i.bleve.Mapping().AnalyzerNamed(i.queryAnalyzer(indexer.Query{Language: language}))
+	if analyze == nil {
+		return 0
+	}
+
+	idx, _, err := i.bleve.Advanced()
+	if err != nil {
+		return 0
+	}
+	reader, err := idx.Reader()
+	if err != nil {
+		return 0
+	}
+	defer reader.Close()
+
+	var frequency uint64
+	found := false
+	for _, part := range strings.FieldsFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		for _, token := range analyze.Analyze([]byte(part)) {
+			var documents uint64
+			for _, field := range []string{"Title", "Body"} {
+				tfr, err := reader.TermFieldReader(token.Term, field, false, false, false)
+				if err != nil {
+					continue
+				}
+				if n := tfr.Count(); n > documents {
+					documents = n
+				}
+				tfr.Close()
+			}
+			if !found || documents < frequency {
+				frequency, found = documents, true
+			}
+		}
+	}
+	return frequency
+}
@@ -0,0 +1,125 @@
+package bleve
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/token/ngram"
+	"github.com/blevesearch/bleve/analysis/tokenizer/whitespace"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+const (
+	// trigramAnalyzer splits whitespace-separated words into the sequences of
+	// three characters they contain
+	trigramAnalyzer = "caddy_trigrams"
+	// containsOperator prefixes the query terms matched anywhere inside words
+	containsOperator = "contains:"
+	// minTrigramLength is the shortest substring trigrams can match
+	minTrigramLength = 3
+)
+
+func init() {
+	registry.RegisterAnalyzer(trigramAnalyzer, trigramAnalyzerConstructor)
+}
+
+func trigramAnalyzerConstructor(config map[string]interface{}, cache *registry.Cache) (*analysis.Analyzer, error) {
+	tokenizer, err := cache.TokenizerNamed(whitespace.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	lower, err := cache.TokenFilterNamed(lowercase.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &analysis.Analyzer{
+		Tokenizer:    tokenizer,
+		TokenFilters: []analysis.TokenFilter{lower, ngram.NewNgramFilter(minTrigramLength, minTrigramLength)},
+	}, nil
+}
+
+// addTrigramField adds the field holding the trigrams of a document's title
+// and body, matched by contains: terms only
+func addTrigramField(doc *mapping.DocumentMapping) {
+	trigrams := bleve.NewTextFieldMapping()
+	trigrams.Analyzer = trigramAnalyzer
+	trigrams.Store = false
+	trigrams.IncludeInAll = false
+	trigrams.IncludeTermVectors = false
+	doc.AddFieldMappingsAt("Trigrams", trigrams)
+}
+
+// splitContains separates the contains: terms of a query string from the
+// rest of it
+func splitContains(text string) (rest string, terms []string) {
+	words := []string{}
+	for _, word := range indexer.QueryWords(text) {
+		if strings.HasPrefix(strings.ToLower(word), containsOperator) {
+			if term := word[len(containsOperator):]; term != "" {
+				terms = append(terms, term)
+			}
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " "), terms
+}
+
+// trigrams returns the distinct three-character sequences of a term
+func trigrams(term string) []string {
+	runes := []rune(strings.ToLower(term))
+	seen := make(map[string]bool)
+	grams := []string{}
+
+	for i := 0; i+minTrigramLength <= len(runes); i++ {
+		gram := string(runes[i : i+minTrigramLength])
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+
+	return grams
+}
+
+// containsQuery matches the documents holding every trigram of a term, a
+// superset of those containing it
+func containsQuery(term string) query.Query {
+	conjuncts := []query.Query{}
+	for _, gram := range trigrams(term) {
+		q := bleve.NewTermQuery(gram)
+		q.SetField("Trigrams")
+		conjuncts = append(conjuncts, q)
+	}
+	return bleve.NewConjunctionQuery(conjuncts...)
+}
+
+// containsAll reports whether text contains every term, ignoring case
+func containsAll(text string, terms []string) bool {
+	text = strings.ToLower(text)
+	for _, term := range terms {
+		if !strings.Contains(text, strings.ToLower(term)) {
+			return false
+		}
+	}
+	return true
+}
+
+// longEnough drops the terms shorter than min characters
+func longEnough(terms []string, min int) []string {
+	kept := terms[:0]
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= min {
+			kept = append(kept, term)
+		}
+	}
+	return kept
+}
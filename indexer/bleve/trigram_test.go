@@ -0,0 +1,43 @@
+package bleve_test
+
+import (
+	"testing"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestContainsQueries(t *testing.T) {
+	body := "Replacement filter PN-48156-X fits every model since 2019."
+
+	Convey("Given an index with the trigram index enabled", t, func() {
+		indxr, cleanup := newIndexedRecord(indexer.Config{Trigrams: true, MinContainsLength: 4}, "/parts", body)
+		defer cleanup()
+
+		Convey("Should match substrings inside words", func() {
+			So(indxr.Search(indexer.Query{Text: "contains:4815"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "contains:n-481"}), ShouldHaveLength, 1)
+			So(indxr.Search(indexer.Query{Text: "filter contains:8156"}), ShouldHaveLength, 1)
+			So(indxr.Count(indexer.Query{Text: "contains:4815"}), ShouldEqual, 1)
+		})
+
+		Convey("Should not match substrings the document lacks", func() {
+			So(indxr.Search(indexer.Query{Text: "contains:4816"}), ShouldHaveLength, 0)
+			So(indxr.Search(indexer.Query{Text: "contains:4815 missing"}), ShouldHaveLength, 0)
+		})
+
+		Convey("Should require the minimum length", func() {
+			So(indxr.Search(indexer.Query{Text: "contains:481"}), ShouldHaveLength, 0)
+		})
+	})
+
+	Convey("Given an index without the trigram index", t, func() {
+		indxr, cleanup := newIndexedRecord(indexer.Config{}, "/parts", body)
+		defer cleanup()
+
+		Convey("Should only match whole terms", func() {
+			So(indxr.Search(indexer.Query{Text: "contains:4815"}), ShouldHaveLength, 0)
+			So(indxr.Search(indexer.Query{Text: "48156"}), ShouldHaveLength, 1)
+		})
+	})
+}
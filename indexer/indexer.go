@@ -8,15 +8,158 @@ import (
 // Handler ...
 type Handler interface {
 	Record(string) Record
-	Search(string) []Record
+	Search(Query) []Record
+	Recent(Query) []Record
+	Count(Query) uint64
+	DocFrequency(word, language string) uint64
 	Pipe(Record)
 	Kill(Record)
+	Delete(string)
+	DocCount() uint64
+	FieldValues(string) []string
+	Completions(prefix string, limit int) []string
+	Terms(path, field string) []Term
+	Walk(func(Record) error) error
+	Prune() error
+	Rebuild(build func(Handler) error) error
+	Status() Status
+	Close() error
 }
 
 // Config ...
 type Config struct {
-	HostName       string
-	IndexDirectory string
+	HostName         string
+	IndexDirectory   string
+	SplitIdentifiers bool
+	Analyzer         string
+	// Trigrams indexes the trigrams of every document for contains: terms
+	// of at least MinContainsLength characters
+	Trigrams          bool
+	MinContainsLength int
+	// MinPrefixMatch, when set, makes query terms of at least that many
+	// characters also match the indexed terms they are a prefix of
+	MinPrefixMatch int
+	// Segmenters maps a language to the registered analyzer that replaces
+	// its built-in one, such as a dictionary-based word segmenter
+	Segmenters map[string]string
+	// MinTermDF, when above 1, leaves the body terms found in fewer documents
+	// out of the index, as found by each Prune. Titles are never pruned.
+	MinTermDF int
+	// CommentWeight, when set, makes queries also match the comments of
+	// records, scored that many times lower than a match of their text
+	CommentWeight float64
+	// IncrementalSections, when set, keeps the tokens of the sections of
+	// indexed pages, so indexing a page again only analyzes those changed
+	IncrementalSections bool
+	// Options are the engine-specific tuning options of the engine
+	// directive's block, which the engine validates
+	Options map[string]string
+}
+
+// Status describes the health of the index's backend. Failures counts the
+// writes that still failed after being retried; the index is Degraded while
+// its latest write failed.
+type Status struct {
+	Failures    uint64
+	Degraded    bool
+	LastError   string
+	LastFailure time.Time
+}
+
+// DefaultPriority is the priority of the pages a sitemap gives none, which
+// leaves their ranking as it is
+const DefaultPriority = 0.5
+
+// Snippet strategies select the excerpt of a record's body returned as the
+// body of a search result
+const (
+	// SnippetLeading excerpts the beginning of the body
+	SnippetLeading = "leading"
+	// SnippetBestMatch excerpts the passage covering the most query terms
+	SnippetBestMatch = "best_match"
+	// SnippetMeta uses the page's meta description, or the best match when it
+	// has none
+	SnippetMeta = "meta"
+)
+
+// Excerpt sources list, in order of preference, where the excerpt returned
+// as the body of a search result comes from
+const (
+	// ExcerptFrontMatter is the excerpt a document's front matter declares
+	ExcerptFrontMatter = "frontmatter"
+	// ExcerptMeta is the page's meta description
+	ExcerptMeta = "meta"
+	// ExcerptGenerated is the snippet of the query's snippet strategy, which
+	// every record has
+	ExcerptGenerated = "generated"
+)
+
+// Query describes a search sent to the indexer. Language selects the analyzer
+// applied to the query's terms; empty means the index's default analyzer.
+// Snippet is the snippet strategy, SnippetLeading by default. Scope, when
+// set, restricts the results to the paths under that directory (e.g. "/docs/")
+// and Exclude drops the paths under any of its directories. Limit is the
+// maximum number of records Search returns, the engine's default when zero.
+// PlainSnippet returns snippets as plain text with their matching terms in
+// the records' Highlights rather than as HTML with <mark> elements. Filters
+// restricts the results to the records whose custom fields each hold one of
+// the values given for them, ignoring case. A query with filters but no text
+// matches every record they let through. Excerpt, when set, lists the
+// excerpt sources tried in order before the snippet strategy's. MatchedTerms
+// asks for the words of the text each record matched. Literal reads every character of Text as part
+// of a term, none as an operator. PartialHighlights marks only the part of
+// each matching word the query's word shares with it, as run in running,
+// rather than the whole word. DeepLinks sets the Section of each record to
+// that holding its best match. PositionDecay, when set, weighs the terms
+// occurring near the top of a record's body more than those further down,
+// their weight halving every PositionDecay words.
+type Query struct {
+	Text              string
+	Language          string
+	Snippet           string
+	Scope             string
+	Exclude           []string
+	Filters           map[string][]string
+	Excerpt           []string
+	Limit             int
+	PlainSnippet      bool
+	MatchedTerms      bool
+	Literal           bool
+	PartialHighlights bool
+	DeepLinks         bool
+	PositionDecay     int
+	// Since, when set, restricts the results to the records modified at
+	// or after it; records without a modification time never match
+	Since time.Time
+	// SortField, when set, orders the records by the SortKey of that custom
+	// field rather than by score, descending with SortDescending. Records
+	// without a key follow; ties keep the order of their score.
+	SortField      string
+	SortDescending bool
+}
+
+// Term is how often a term occurs in a field of a record, as indexed, and in
+// how many records of the index it occurs
+type Term struct {
+	Text      string
+	Frequency uint64
+	Documents uint64
+}
+
+// Highlight is the location of a matching term in a plain text snippet or in
+// a title. Start and End count runes (not bytes) from the start of the text,
+// End excluded, so "…" marking a cut counts as one.
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Section is a part of a record's body that begins at a heading with an id,
+// which links to the record can jump to as their fragment. Start is the byte
+// offset of the section in the body.
+type Section struct {
+	ID    string
+	Start int
 }
 
 // Record ...
@@ -29,10 +172,41 @@ type Record interface {
 	SetTitle(string)
 	Body() []byte
 	SetBody([]byte)
+	ContentType() string
+	SetContentType(string)
+	Image() string
+	SetImage(string)
+	Description() string
+	SetDescription(string)
+	Comments() string
+	SetComments(string)
+	Excerpt() string
+	SetExcerpt(string)
+	Language() string
+	SetLanguage(string)
+	Priority() float64
+	SetPriority(float64)
+	Fields() map[string]string
+	SetFields(map[string]string)
+	Score() float64
+	SetScore(float64)
+	Highlights() []Highlight
+	SetHighlights([]Highlight)
+	TitleHighlights() []Highlight
+	SetTitleHighlights([]Highlight)
+	MatchedTerms() []string
+	SetMatchedTerms([]string)
+	Sections() []Section
+	SetSections([]Section)
+	Section() string
+	SetSection(string)
+	Translations() map[string]string
+	SetTranslations(map[string]string)
 	SetModified(time.Time)
 	Modified() time.Time
 	Load() bool
 	Ignore()
 	Ignored() bool
 	Indexed() time.Time
+	Hash() string
 }
@@ -1,5 +1,13 @@
 package indexer_test
 
+import (
+	"strings"
+	"testing"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
 type TestIndexer struct {
 }
 
@@ -10,3 +18,46 @@ func NewTestIndexer() *TestIndexer {
 func (t *TestIndexer) Pipe() {
 
 }
+
+// upperAnalyzer emits every whitespace-separated word in upper case
+type upperAnalyzer struct{}
+
+func (upperAnalyzer) Analyze(text string) (tokens []indexer.Token) {
+	for i, word := range strings.Fields(text) {
+		tokens = append(tokens, indexer.Token{Term: strings.ToUpper(word), Position: i + 1})
+	}
+	return
+}
+
+func TestAnalyzerRegistry(t *testing.T) {
+	Convey("Given an analyzer registered by name", t, func() {
+		indexer.RegisterAnalyzer("upper", upperAnalyzer{})
+
+		Convey("Should be available by its name", func() {
+			analyzer, ok := indexer.GetAnalyzer("upper")
+			So(ok, ShouldBeTrue)
+			So(analyzer.Analyze("hello world"), ShouldResemble, []indexer.Token{
+				{Term: "HELLO", Position: 1},
+				{Term: "WORLD", Position: 2},
+			})
+			So(indexer.Analyzers(), ShouldContain, "upper")
+		})
+
+		Convey("Should not find unregistered names", func() {
+			_, ok := indexer.GetAnalyzer("missing")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestQueryWords(t *testing.T) {
+	Convey("Given a query with phrases and escaped spaces", t, func() {
+		Convey("Should keep each of them as one term", func() {
+			So(indexer.QueryWords(`install  "C++ guide" AND\ b -x`), ShouldResemble,
+				[]string{"install", `"C++ guide"`, `AND\ b`, "-x"})
+			So(indexer.QueryWords(`tag:"big data" "unclosed phrase`), ShouldResemble,
+				[]string{`tag:"big data"`, `"unclosed phrase`})
+			So(indexer.QueryWords(`say \"hi there`), ShouldResemble, []string{"say", `\"hi`, "there"})
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package indexer
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SortLayouts are the date formats a custom field's value is sorted by
+var SortLayouts = []string{time.RFC3339, "2006-01-02"}
+
+// QueryWords splits the text of a query into its terms at the whitespace
+// outside quoted phrases, so "install guide" stays one term, like a word
+// whose whitespace is escaped with a backslash, as in AND\ b. A quote left
+// open runs to the end of the text.
+func QueryWords(text string) []string {
+	var words []string
+	var word strings.Builder
+	quoted, escaped := false, false
+	for _, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+			continue
+		}
+		word.WriteRune(r)
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// SortKey returns the number a custom field's value is sorted by: the value
+// itself when it is a number, else the Unix time of a date in one of the
+// SortLayouts. Other values have no key.
+func SortKey(value string) (float64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number, true
+	}
+	for _, layout := range SortLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return float64(date.Unix()), true
+		}
+	}
+	return 0, false
+}
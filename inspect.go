@@ -0,0 +1,127 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// inspection is everything the index knows about a document, as returned by
+// the inspect endpoint
+type inspection struct {
+	Path        string                   `json:"path"`
+	Title       string                   `json:"title"`
+	Body        string                   `json:"body"`
+	Description string                   `json:"description,omitempty"`
+	Comments    string                   `json:"comments,omitempty"`
+	Excerpt     string                   `json:"excerpt,omitempty"`
+	Image       string                   `json:"image,omitempty"`
+	Language    string                   `json:"language,omitempty"`
+	Fields      map[string]string        `json:"fields,omitempty"`
+	Priority    float64                  `json:"priority"`
+	Modified    *time.Time               `json:"modified,omitempty"`
+	Indexed     time.Time                `json:"indexed"`
+	Hash        string                   `json:"hash,omitempty"`
+	Terms       map[string][]inspectTerm `json:"terms"`
+	Query       string                   `json:"query,omitempty"`
+	Match       *inspectMatch            `json:"match,omitempty"`
+}
+
+// inspectTerm is a term of an inspected document's field
+type inspectTerm struct {
+	Term      string `json:"term"`
+	Frequency uint64 `json:"frequency"`
+	Documents uint64 `json:"documents"`
+}
+
+// inspectMatch is how an inspected document ranks for a query
+type inspectMatch struct {
+	Matched bool   `json:"matched"`
+	Rank    int    `json:"rank,omitempty"`
+	Debug   *Debug `json:"debug,omitempty"`
+}
+
+// Inspect returns to authorized clients everything the index knows about the
+// document at the path given with path: its stored text and fields, the
+// terms indexed for its title and body and, when a query is given with q,
+// whether it matches and with what score components.
+func (s *Search) Inspect(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !s.authorized(r) {
+		return http.StatusUnauthorized, nil
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	path := r.URL.Query().Get("path")
+	record := s.Indexer.Record(path)
+	if path == "" || !record.Load() {
+		return http.StatusNotFound, nil
+	}
+
+	view := inspection{
+		Path:        record.Path(),
+		Title:       record.Title(),
+		Body:        string(record.Body()),
+		Description: record.Description(),
+		Comments:    record.Comments(),
+		Excerpt:     record.Excerpt(),
+		Image:       record.Image(),
+		Language:    record.Language(),
+		Fields:      record.Fields(),
+		Priority:    record.Priority(),
+		Indexed:     record.Indexed(),
+		Hash:        record.Hash(),
+		Terms:       make(map[string][]inspectTerm),
+	}
+	if modified := record.Modified(); !modified.IsZero() {
+		view.Modified = &modified
+	}
+	for _, field := range []string{"Title", "Body"} {
+		view.Terms[field] = inspectTerms(s.Indexer.Terms(path, field))
+	}
+	if q := r.URL.Query().Get("q"); q != "" {
+		view.Query = q
+		view.Match = s.inspectMatch(path, q)
+	}
+
+	jresp, err := json.Marshal(view)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(jresp)
+	return http.StatusOK, nil
+}
+
+// inspectTerms converts the terms of a field for the inspect endpoint
+func inspectTerms(terms []indexer.Term) []inspectTerm {
+	views := make([]inspectTerm, len(terms))
+	for i, term := range terms {
+		views[i] = inspectTerm{term.Text, term.Frequency, term.Documents}
+	}
+	return views
+}
+
+// inspectMatch runs the query over the whole index, ranked as the search
+// endpoint ranks it, and reports where the document at path comes
+func (s *Search) inspectMatch(path, q string) *inspectMatch {
+	query := s.indexQuery(q, SearchOptions{})
+	query.Limit = int(s.Indexer.DocCount())
+	if query.Text == "" && len(query.Filters) == 0 {
+		return &inspectMatch{}
+	}
+
+	results, _ := s.results(query, true, nil)
+	for i, result := range results {
+		if result.Path == path {
+			return &inspectMatch{Matched: true, Rank: i + 1, Debug: result.Debug}
+		}
+	}
+	return &inspectMatch{}
+}
@@ -0,0 +1,88 @@
+package search_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInspect(t *testing.T) {
+	Convey("Given a search middleware with indexed pages and the inspect endpoint", t, func() {
+		s, cleanup := newTestSearch(&search.Config{InspectEndpoint: "/search/inspect", Token: "secret"})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		type term struct {
+			Term      string
+			Frequency uint64
+			Documents uint64
+		}
+		type view struct {
+			Path  string
+			Title string
+			Body  string
+			Terms map[string][]term
+			Match *struct {
+				Matched bool
+				Rank    int
+				Debug   *search.Debug
+			}
+		}
+
+		inspect := func(params url.Values) (int, view) {
+			req := httptest.NewRequest("GET", "/search/inspect?"+params.Encode(), nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+
+			var v view
+			if status == http.StatusOK {
+				So(json.Unmarshal(w.Body.Bytes(), &v), ShouldBeNil)
+			}
+			return status, v
+		}
+
+		Convey("Should reject requests without a valid token", func() {
+			req := httptest.NewRequest("GET", "/search/inspect?path=/install.html", nil)
+			status, _ := s.ServeHTTP(httptest.NewRecorder(), req)
+			So(status, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("Should return the stored document with its indexed terms", func() {
+			status, v := inspect(url.Values{"path": {"/install.html"}})
+			So(status, ShouldEqual, http.StatusOK)
+			So(v.Path, ShouldEqual, "/install.html")
+			So(v.Title, ShouldEqual, "Install Guide")
+			So(v.Body, ShouldContainSubstring, "Install the plugin")
+			So(v.Match, ShouldBeNil)
+
+			So(v.Terms["Title"], ShouldContain, term{"guide", 1, 2})
+			So(v.Terms["Body"], ShouldNotBeEmpty)
+			So(v.Terms["Body"][0], ShouldResemble, term{"install", 2, 2})
+		})
+
+		Convey("Should report how the document ranks for a query", func() {
+			_, v := inspect(url.Values{"path": {"/install.html"}, "q": {"plugin"}})
+			So(v.Match, ShouldNotBeNil)
+			So(v.Match.Matched, ShouldBeTrue)
+			So(v.Match.Rank, ShouldEqual, 1)
+			So(v.Match.Debug, ShouldNotBeNil)
+			So(v.Match.Debug.FinalScore, ShouldBeGreaterThan, 0)
+
+			_, v = inspect(url.Values{"path": {"/install.html"}, "q": {"unrelated"}})
+			So(v.Match.Matched, ShouldBeFalse)
+		})
+
+		Convey("Should answer 404 for a path that is not indexed", func() {
+			status, _ := inspect(url.Values{"path": {"/missing.html"}})
+			So(status, ShouldEqual, http.StatusNotFound)
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default limits of the instant search mode, changed with instant_limits
+const (
+	defaultInstantSuggestions = 5
+	defaultInstantResults     = 5
+)
+
+// instantResponse is the answer of the instant search mode
+type instantResponse struct {
+	Suggestions []string      `json:"suggestions"`
+	Results     []interface{} `json:"results"`
+}
+
+// SearchInstant answers search-as-you-type requests, made with instant=1, with
+// both the completions of the query's last word and the top results of the
+// query, looked up concurrently. An empty query has neither. Instant searches
+// are not counted in the analytics, since every keystroke makes one.
+func (s *Search) SearchInstant(w http.ResponseWriter, r *http.Request) (int, error) {
+	text := r.URL.Query().Get("q")
+	opts := searchOptions(r)
+	opts.PlainSnippets = s.plainSnippets(r)
+	opts.Limit = s.Config.instantResults()
+
+	var suggestions []string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		suggestions = s.suggestions(text, s.Config.instantSuggestions())
+	}()
+
+	results, err := s.Search(text, opts)
+	wg.Wait()
+	if err != nil && err != ErrEmptyQuery {
+		return http.StatusBadRequest, err
+	}
+
+	resp := instantResponse{Suggestions: suggestions, Results: make([]interface{}, len(results.Results))}
+	if resp.Suggestions == nil {
+		resp.Suggestions = []string{}
+	}
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		for i, view := range selectFields(results.Results, fields) {
+			resp.Results[i] = view
+		}
+	} else {
+		for i, result := range results.Results {
+			resp.Results[i] = result
+		}
+	}
+
+	jresp, err := json.Marshal(resp)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jresp)
+	return http.StatusOK, nil
+}
+
+// suggestions returns up to limit queries completing the last word of text
+// with the words of the indexed titles, as in "install pl" → "install plugin".
+// A query ending with a space or an operator has none; an empty one has the
+// popular recent searches, with recent_searches.
+func (s *Search) suggestions(text string, limit int) []string {
+	text = normalizeText(text)
+	words := strings.Fields(text)
+	if len(words) == 0 && s.RecentQueries != nil {
+		return s.RecentQueries.Top(limit, time.Now())
+	}
+	if len(words) == 0 || strings.TrimRight(text, " \t") != text {
+		return nil
+	}
+	last := words[len(words)-1]
+	if strings.ContainsAny(last, `+-:"()*`) {
+		return nil
+	}
+
+	head := strings.Join(words[:len(words)-1], " ")
+	if head != "" {
+		head += " "
+	}
+	var suggestions []string
+	for _, word := range s.Indexer.Completions(last, limit) {
+		suggestions = append(suggestions, head+word)
+	}
+	return suggestions
+}
+
+// instantSuggestions returns the number of suggestions of an instant search
+func (c *Config) instantSuggestions() int {
+	if c.InstantSuggestions > 0 {
+		return c.InstantSuggestions
+	}
+	return defaultInstantSuggestions
+}
+
+// recentHalfLife returns the half-life of the counts of the recent searches
+func (c *Config) recentHalfLife() time.Duration {
+	if c.RecentSearchesHalfLife > 0 {
+		return c.RecentSearchesHalfLife
+	}
+	return defaultRecentHalfLife
+}
+
+// instantResults returns the number of results of an instant search
+func (c *Config) instantResults() int {
+	if c.InstantResults > 0 {
+		return c.InstantResults
+	}
+	return defaultInstantResults
+}
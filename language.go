@@ -0,0 +1,76 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// minLanguageConfidence is the lowest confidence at which a detected
+	// language is used instead of the configured default
+	minLanguageConfidence = 0.25
+	// minLanguageHits is the number of stop words a text needs before its
+	// language is detected at all
+	minLanguageHits = 3
+	// maxLanguageWords bounds the number of words the detector looks at
+	maxLanguageWords = 1000
+)
+
+// languageStopWords holds the most frequent words of each language the
+// detector recognizes. Short documents are told apart by these alone.
+var languageStopWords = map[string][]string{
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "des", "auf", "für", "im", "dem", "von", "auch", "es", "wird", "sind", "werden", "aus", "bei", "oder", "wie", "ich", "wir", "kann"},
+	"en": {"the", "and", "of", "to", "in", "is", "that", "it", "for", "was", "with", "as", "on", "are", "be", "this", "by", "not", "have", "you", "from", "or", "at", "which", "but", "they", "an", "can", "will", "your"},
+	"es": {"el", "la", "los", "las", "y", "que", "es", "en", "del", "por", "con", "para", "una", "se", "no", "su", "al", "como", "más", "pero", "sus", "está", "son", "este", "puede", "lo", "hay", "muy", "también", "cuando"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "du", "dans", "que", "pour", "qui", "pas", "sur", "au", "ce", "avec", "sont", "il", "elle", "nous", "vous", "mais", "ou", "par", "plus", "cette", "aux", "être"},
+	"it": {"il", "di", "che", "è", "e", "per", "un", "una", "non", "sono", "della", "le", "gli", "con", "si", "da", "nel", "anche", "come", "più", "questo", "ma", "del", "alla", "lo", "dei", "delle", "essere", "ha", "sia"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "op", "te", "zijn", "met", "voor", "niet", "er", "ook", "aan", "die", "worden", "wordt", "door", "bij", "maar", "naar", "om", "dit", "kan", "heeft", "wij", "u", "hun"},
+	"pt": {"o", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "é", "dos", "das", "no", "na", "por", "mais", "se", "são", "ao", "como", "mas", "pelo", "pela", "você", "também"},
+}
+
+// stopWordLanguages maps each stop word to the languages that use it
+var stopWordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for language, words := range languageStopWords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// detectLanguage guesses the language of text by counting the stop words of
+// each known language. The confidence is the margin of the best language over
+// the runner-up relative to its score: 0 when two languages tie and 1 when no
+// other language matched. Texts with too few stop words have no language.
+func detectLanguage(text string) (string, float64) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) > maxLanguageWords {
+		words = words[:maxLanguageWords]
+	}
+
+	scores := make(map[string]int)
+	for _, word := range words {
+		for _, language := range stopWordLanguages[word] {
+			scores[language]++
+		}
+	}
+
+	best, first, second := "", 0, 0
+	for language, score := range scores {
+		switch {
+		case score > first || score == first && language < best:
+			best, first, second = language, score, first
+		case score > second:
+			second = score
+		}
+	}
+
+	if first < minLanguageHits {
+		return "", 0
+	}
+
+	return best, float64(first-second) / float64(first)
+}
@@ -0,0 +1,21 @@
+package search
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// quoteFolder maps typographic quotes to their ASCII counterparts
+var quoteFolder = strings.NewReplacer(
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`,
+	"«", `"`, "»", `"`,
+)
+
+// normalizeText folds typographic variants (full-width forms, ligatures and
+// smart quotes) into their plain equivalents. It is applied to both indexed
+// text and incoming queries so copy-pasted queries match.
+func normalizeText(s string) string {
+	return quoteFolder.Replace(norm.NFKC.String(s))
+}
@@ -0,0 +1,33 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNormalization(t *testing.T) {
+	Convey("Given an index with a page containing a ligature", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "typography.html")
+
+		Convey("Should match the fi ligature with plain letters", func() {
+			So(searchJSON(s, "financial"), ShouldHaveLength, 1)
+		})
+
+		Convey("Should match a query typed with the fi ligature", func() {
+			So(searchJSON(s, "ﬁnancial"), ShouldHaveLength, 1)
+		})
+
+		Convey("Should match a query in full-width Latin", func() {
+			So(searchJSON(s, "ａｒｃｈｉｖｅ"), ShouldHaveLength, 1)
+		})
+
+		Convey("Should treat smart quotes as a phrase", func() {
+			So(searchJSON(s, "“searchable archive”"), ShouldHaveLength, 1)
+			So(searchJSON(s, "“archive searchable”"), ShouldHaveLength, 0)
+		})
+	})
+}
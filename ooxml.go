@@ -0,0 +1,240 @@
+package search
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Media types of the Office Open XML documents indexed by default
+const (
+	docxType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	xlsxType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// maxOOXMLPart bounds the uncompressed size of a part read from an office
+// document, so a small archive cannot expand without limit
+const maxOOXMLPart = 32 << 20
+
+// errOOXMLPart is returned for a document missing its main part
+var errOOXMLPart = errors.New("search: office document without content")
+
+func init() {
+	RegisterExtractor(docxType, []string{".docx"}, docxExtractor{})
+	RegisterExtractor(xlsxType, []string{".xlsx"}, xlsxExtractor{})
+}
+
+// docxExtractor reads the paragraphs of a Word document
+type docxExtractor struct{}
+
+func (docxExtractor) Extract(body []byte) (string, string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return "", "", err
+	}
+
+	part := ooxmlPart(archive, "word/document.xml")
+	if part == nil {
+		return "", "", errOOXMLPart
+	}
+
+	var text strings.Builder
+	err = readXML(part, func(dec *xml.Decoder, start xml.StartElement) error {
+		switch start.Name.Local {
+		case "t":
+			var value string
+			if err := dec.DecodeElement(&value, &start); err != nil {
+				return err
+			}
+			text.WriteString(value)
+		case "tab":
+			text.WriteString("\t")
+		case "br", "p":
+			if text.Len() > 0 {
+				text.WriteString("\n")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return ooxmlTitle(archive), text.String(), nil
+}
+
+// xlsxExtractor reads the cells of every sheet of an Excel workbook, a row
+// per line
+type xlsxExtractor struct{}
+
+func (xlsxExtractor) Extract(body []byte) (string, string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return "", "", err
+	}
+
+	shared, err := sharedStrings(archive)
+	if err != nil {
+		return "", "", err
+	}
+
+	sheets := []*zip.File{}
+	for _, file := range archive.File {
+		if strings.HasPrefix(file.Name, "xl/worksheets/sheet") && strings.HasSuffix(file.Name, ".xml") {
+			sheets = append(sheets, file)
+		}
+	}
+	if len(sheets) == 0 {
+		return "", "", errOOXMLPart
+	}
+	sort.Slice(sheets, func(i, j int) bool {
+		return sheetNumber(sheets[i].Name) < sheetNumber(sheets[j].Name)
+	})
+
+	var text strings.Builder
+	for _, sheet := range sheets {
+		if err := readSheet(sheet, shared, &text); err != nil {
+			return "", "", err
+		}
+	}
+
+	return ooxmlTitle(archive), text.String(), nil
+}
+
+// sharedStrings returns the strings the cells of a workbook refer to by index
+func sharedStrings(archive *zip.Reader) ([]string, error) {
+	part := ooxmlPart(archive, "xl/sharedStrings.xml")
+	if part == nil {
+		return nil, nil
+	}
+
+	strs := []string{}
+	var current *strings.Builder
+	err := readXML(part, func(dec *xml.Decoder, start xml.StartElement) error {
+		switch start.Name.Local {
+		case "si":
+			strs = append(strs, "")
+			current = &strings.Builder{}
+		case "t":
+			var value string
+			if err := dec.DecodeElement(&value, &start); err != nil {
+				return err
+			}
+			if current != nil {
+				current.WriteString(value)
+				strs[len(strs)-1] = current.String()
+			}
+		}
+		return nil
+	})
+	return strs, err
+}
+
+// readSheet writes the values of a sheet's cells to text, separated by tabs
+// within a row and by newlines between rows
+func readSheet(sheet *zip.File, shared []string, text *strings.Builder) error {
+	var cellType string
+	cells := 0
+	return readXML(sheet, func(dec *xml.Decoder, start xml.StartElement) error {
+		switch start.Name.Local {
+		case "row":
+			if text.Len() > 0 {
+				text.WriteString("\n")
+			}
+			cells = 0
+		case "c":
+			cellType = ""
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "t" {
+					cellType = attr.Value
+				}
+			}
+		case "v", "t":
+			var value string
+			if err := dec.DecodeElement(&value, &start); err != nil {
+				return err
+			}
+			if cellType == "s" {
+				i, err := strconv.Atoi(strings.TrimSpace(value))
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil
+				}
+				value = shared[i]
+			}
+			if value == "" {
+				return nil
+			}
+			if cells > 0 {
+				text.WriteString("\t")
+			}
+			text.WriteString(value)
+			cells++
+		}
+		return nil
+	})
+}
+
+// sheetNumber returns the number of a worksheet part, as in
+// xl/worksheets/sheet12.xml
+func sheetNumber(name string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "xl/worksheets/sheet"), ".xml"))
+	return n
+}
+
+// ooxmlTitle returns the title of an office document's core properties
+func ooxmlTitle(archive *zip.Reader) string {
+	part := ooxmlPart(archive, "docProps/core.xml")
+	if part == nil {
+		return ""
+	}
+
+	var title string
+	readXML(part, func(dec *xml.Decoder, start xml.StartElement) error {
+		if start.Name.Local == "title" {
+			return dec.DecodeElement(&title, &start)
+		}
+		return nil
+	})
+	return strings.TrimSpace(title)
+}
+
+// ooxmlPart returns the part of an office document with the given name
+func ooxmlPart(archive *zip.Reader, name string) *zip.File {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return file
+		}
+	}
+	return nil
+}
+
+// readXML calls element with every start element of an XML part, in order,
+// reading no more than maxOOXMLPart bytes
+func readXML(part *zip.File, element func(*xml.Decoder, xml.StartElement) error) error {
+	r, err := part.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	dec := xml.NewDecoder(io.LimitReader(r, maxOOXMLPart))
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if err := element(dec, start); err != nil {
+				return err
+			}
+		}
+	}
+}
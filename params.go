@@ -0,0 +1,56 @@
+package search
+
+import (
+	"net/url"
+	pathpkg "path"
+)
+
+// stripParams removes the query parameters matching the configured
+// crawl_ignore_params patterns from a site path and sorts the others, so the
+// URLs of a faceted page that only differ by those parameters are one page
+func (c *Config) stripParams(raw string) string {
+	if len(c.CrawlIgnoreParams) == 0 {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.RawQuery == "" {
+		return raw
+	}
+
+	query := u.Query()
+	for name := range query {
+		for _, pattern := range c.CrawlIgnoreParams {
+			if ok, _ := pathpkg.Match(pattern, name); ok {
+				query.Del(name)
+				break
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.RequestURI()
+}
+
+// dedupeURLs collapses results whose paths are the same once normalized like
+// the crawler normalizes URLs into the first (highest ranked) of them,
+// listing the other paths as its alternates. It catches the copies of a page
+// indexed before crawl_ignore_params named their parameters, or pushed or
+// served under them.
+func (c *Config) dedupeURLs(results []Result) []Result {
+	deduped := results[:0]
+	seen := make(map[string]int, len(results))
+
+	for _, result := range results {
+		key := c.slashPath(c.stripParams(result.Path))
+		if i, ok := seen[key]; ok {
+			deduped[i].Alternates = append(deduped[i].Alternates, result.Path)
+			continue
+		}
+
+		seen[key] = len(deduped)
+		deduped = append(deduped, result)
+	}
+
+	return deduped
+}
@@ -3,31 +3,52 @@ package search
 import (
 	"bytes"
 	"io"
+	"mime"
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
-	"github.com/microcosm-cc/bluemonday"
 	"github.com/pedronasser/caddy-search/indexer"
 	"github.com/pedronasser/go-piper"
 	"golang.org/x/net/html"
 )
 
-var bm = bluemonday.UGCPolicy()
-
 // NewPipeline creates a new Pipeline instance
 func NewPipeline(config *Config, indxr indexer.Handler) (*Pipeline, error) {
 	ppl := &Pipeline{
-		config:  config,
-		indexer: indxr,
+		config:    config,
+		indexer:   indxr,
+		redirects: make(map[string]string),
+		variants:  make(map[string]bool),
+		crawled:   make(map[string]int),
+		confirmed: newConfirmations(),
+	}
+
+	if config.ContentSelector != "" {
+		sel, err := parseSelector(config.ContentSelector)
+		if err != nil {
+			return nil, err
+		}
+		ppl.content = sel
+	}
+
+	for _, raw := range config.CommentSelectors {
+		sel, err := parseSelector(raw)
+		if err != nil {
+			return nil, err
+		}
+		ppl.comments = append(ppl.comments, sel)
 	}
 
 	pipe, err := piper.New(
-		piper.P(1, ppl.read),
-		piper.P(1, ppl.validate),
-		piper.P(1, ppl.parse),
-		piper.P(1, ppl.index),
+		piper.P(config.workers("read"), ppl.read),
+		piper.P(config.workers("validate"), ppl.validate),
+		piper.P(config.workers("parse"), ppl.parse),
+		piper.P(config.workers("index"), ppl.index),
 	)
 
 	if err != nil {
@@ -42,10 +63,11 @@ func NewPipeline(config *Config, indxr indexer.Handler) (*Pipeline, error) {
 		for {
 			select {
 			case in := <-out:
+				atomic.AddInt64(&ppl.pending, -1)
+				// records handed over to the indexer belong to it; the
+				// ones left here were ignored along the way
 				if record, ok := in.(indexer.Record); ok {
-					if record.Ignored() {
-						ppl.indexer.Kill(record)
-					}
+					ppl.indexer.Kill(record)
 				}
 			case <-tick.C:
 			}
@@ -55,26 +77,96 @@ func NewPipeline(config *Config, indxr indexer.Handler) (*Pipeline, error) {
 	return ppl, nil
 }
 
+// pipelineStages are the stages of the pipeline, in order
+var pipelineStages = []string{"read", "validate", "parse", "index"}
+
+// workers returns the number of concurrent workers of a pipeline stage
+func (c *Config) workers(stage string) int {
+	if n := c.PipelineWorkers[stage]; n > 0 {
+		return n
+	}
+	return 1
+}
+
 // Pipeline is the structure that holds search's pipeline infos and methods
 type Pipeline struct {
+	pending int64 // records piped but not yet out of the pipeline
+	scanned int32 // set once the startup scan has piped every document
 	config  *Config
 	indexer indexer.Handler
 	pipe    piper.Handler
+	content *selector // container the text is extracted from, if any
+	// comments select the containers of the discussion attached to pages
+	comments []*selector
+
+	redirectsMutex sync.RWMutex
+	redirects      map[string]string // moved path -> path it now lives at
+
+	variantsMutex sync.RWMutex
+	variants      map[string]bool // AMP and print variants of other pages
+
+	crawledMutex sync.Mutex
+	crawled      map[string]int // paths piped by the crawler, not yet parsed
+
+	confirmed *confirmations // when pages were last seen, with document_ttl
 }
 
 // Pipe is the step of the pipeline that pipes valid documents to the indexer.
 func (p *Pipeline) Pipe(record indexer.Record) {
+	atomic.AddInt64(&p.pending, 1)
 	p.pipe.Input() <- record
 }
 
+// MarkScanned records that the startup scan has piped every document
+func (p *Pipeline) MarkScanned() {
+	atomic.StoreInt32(&p.scanned, 1)
+}
+
+// Settled reports whether the startup scan is complete and every document
+// piped so far has gone through the pipeline
+func (p *Pipeline) Settled() bool {
+	return atomic.LoadInt32(&p.scanned) == 1 && atomic.LoadInt64(&p.pending) == 0
+}
+
+// Redirect records that the page at from has moved to to. Earlier redirects
+// to from are updated to point at to, so chains resolve in one step.
+func (p *Pipeline) Redirect(from, to string) {
+	p.redirectsMutex.Lock()
+	defer p.redirectsMutex.Unlock()
+
+	for source, target := range p.redirects {
+		if target == from {
+			p.redirects[source] = to
+		}
+	}
+	delete(p.redirects, to)
+	p.redirects[from] = to
+}
+
+// RemoveRedirect forgets the redirect from path, once it serves a page again
+func (p *Pipeline) RemoveRedirect(path string) {
+	p.redirectsMutex.Lock()
+	defer p.redirectsMutex.Unlock()
+	delete(p.redirects, path)
+}
+
+// Redirected returns the path the page at path has moved to, if it has
+func (p *Pipeline) Redirected(path string) (string, bool) {
+	p.redirectsMutex.RLock()
+	defer p.redirectsMutex.RUnlock()
+	to, ok := p.redirects[path]
+	return to, ok
+}
+
 // Piper is a func that returns the piper.Handler
 func (p *Pipeline) Piper() piper.Handler {
 	return p.pipe
 }
 
-// validate is the step of the pipeline that reads the file content
+// read is the step of the pipeline that reads the file content. Records
+// without a full path already carry their body (served or pushed documents).
 func (p *Pipeline) read(in interface{}) interface{} {
-	if record, ok := in.(indexer.Record); ok && !record.Ignored() {
+	if record, ok := in.(indexer.Record); ok && !record.Ignored() && record.FullPath() != "" {
 		in, err := os.Open(record.FullPath())
 		defer in.Close()
 
@@ -94,6 +186,9 @@ func (p *Pipeline) validate(in interface{}) interface{} {
 	if record, ok := in.(indexer.Record); ok && !record.Ignored() {
 		if !p.ValidatePath(record.Path()) {
 			record.Ignore()
+		} else if p.config.crawlOnly(record.Path()) {
+			p.indexer.Delete(record.Path())
+			record.Ignore()
 		}
 	}
 
@@ -105,28 +200,249 @@ var titleTag = []byte("title")
 // parse is the step of the pipeline that tries to parse documents and get
 // important information
 func (p *Pipeline) parse(in interface{}) interface{} {
-	if record, ok := in.(indexer.Record); ok && !record.Ignored() {
-		if strings.HasSuffix(record.Path(), ".txt") || strings.HasSuffix(record.Path(), ".md") {
-			// TODO: We can improve file type detection; this is a very limited subset of indexable file types
+	record, ok := in.(indexer.Record)
+	if !ok {
+		return in
+	}
+	// taken even from ignored records, so the mark never outlives them
+	crawled := p.takeCrawled(record.Path())
+
+	if !record.Ignored() {
+		declared, heading := "", ""
+		var sections []string
+
+		if isFeed(record) {
+			p.indexFeed(record)
+			return in
+		}
+
+		if extractor, ok := extractorFor(record); ok {
+			// office documents and other binary formats are indexed as the
+			// plain text extracted from them
+			if !extractText(record, extractor) {
+				record.Ignore()
+				return in
+			}
+		}
+
+		record.SetBody(decodeBody(record.Body(), record.ContentType()))
+
+		if isPlainText(record) {
 			// text or markdown file
-			record.SetTitle(path.Base(record.Path()))
+			if values, text, ok := frontMatter(record.Body()); ok {
+				record.SetBody(text)
+				if record.Title() == "" {
+					record.SetTitle(values["title"])
+				}
+				record.SetDescription(values["description"])
+				record.SetExcerpt(values["excerpt"])
+			}
+			if record.Title() == "" {
+				record.SetTitle(path.Base(record.Path()))
+			}
 		} else {
 			body := bytes.NewReader(record.Body())
 			title, err := getHTMLContent(body, titleTag)
-			if err == nil {
+			if err == nil || record.Title() != "" {
 				// html file
-				record.SetTitle(title)
-				stripped := bm.SanitizeBytes(record.Body())
-				record.SetBody(stripped)
+				if doc, err := html.Parse(bytes.NewReader(record.Body())); err == nil {
+					if p.config.SkipVariants && p.skipVariants(record, doc) {
+						p.indexer.Delete(record.Path())
+						record.Ignore()
+						return in
+					}
+					if htmlNoindex(doc) {
+						p.indexer.Delete(record.Path())
+						record.Ignore()
+						return in
+					}
+					record.SetComments(p.commentText(doc))
+					content := p.contentElement(doc)
+					heading = headingText(content)
+					if record.Title() == "" {
+						if content != doc && heading != "" {
+							title = heading
+						}
+						record.SetTitle(title)
+						p.trimTitleSuffix(record)
+					}
+					record.SetImage(resolveURL(htmlBase(record.Path(), doc), htmlImage(doc)))
+					record.SetDescription(htmlDescription(doc))
+					record.SetFields(mergeFields(htmlFields(doc), record.Fields()))
+					if p.config.Translations {
+						record.SetTranslations(p.translations(record, doc))
+					}
+					if len(p.config.SkipElements) > 0 {
+						p.skipElements(content)
+					}
+					if p.config.IndexTables {
+						flattenTables(content)
+					}
+					if p.config.DeepLinks || p.config.IncrementalSections {
+						sections = markSections(content)
+					}
+					record.SetBody(stripHTML(content))
+					declared = htmlLang(doc)
+				} else {
+					record.Ignore()
+				}
 			} else {
 				record.Ignore()
 			}
 		}
+
+		record.SetTitle(normalizeText(record.Title()))
+		record.SetBody([]byte(normalizeText(string(record.Body()))))
+		if len(sections) > 0 {
+			body, starts := splitSections(string(record.Body()), sections)
+			record.SetBody([]byte(body))
+			record.SetSections(starts)
+		}
+		record.SetDescription(normalizeText(record.Description()))
+		record.SetComments(normalizeText(record.Comments()))
+		record.SetExcerpt(normalizeText(record.Excerpt()))
+		record.SetLanguage(p.language(record, declared))
+		p.setVersion(record)
+
+		if crawled && p.config.Soft404 && p.isSoft404(record, normalizeText(heading)) {
+			// an error page served with 200 replaces nothing worth keeping
+			p.indexer.Delete(record.Path())
+			record.Ignore()
+		}
+
+		if n := p.config.IndexBodyPrefixWords; n > 0 {
+			// only the start of the body is indexed, and kept for snippets
+			record.SetBody([]byte(leadingWords(string(record.Body()), n)))
+		}
 	}
 
 	return in
 }
 
+// contentElement returns the configured container element of the page, or
+// the whole document when none is configured or the page lacks it
+func (p *Pipeline) contentElement(doc *html.Node) *html.Node {
+	if p.content == nil {
+		return doc
+	}
+	if container := findElement(doc, p.content.matches); container != nil {
+		return container
+	}
+	return doc
+}
+
+// skipElements removes the elements named by skip_elements from n's subtree,
+// leaving their text out of the body
+func (p *Pipeline) skipElements(n *html.Node) {
+	detachElements(n, func(n *html.Node) bool {
+		for _, name := range p.config.SkipElements {
+			if n.Data == name {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// defaultCommentWeight scales the score of the matches in comments unless
+// comment_weight sets it
+const defaultCommentWeight = 0.3
+
+// commentWeight returns the weight of the matches in comments, which are not
+// searched when no comment selector is configured
+func (c *Config) commentWeight() float64 {
+	if len(c.CommentSelectors) == 0 {
+		return 0
+	}
+	return c.CommentWeight
+}
+
+// commentText removes the comment containers from the page, so their text is
+// left out of its body, and returns that text
+func (p *Pipeline) commentText(doc *html.Node) string {
+	if len(p.comments) == 0 {
+		return ""
+	}
+
+	containers := detachElements(doc, func(n *html.Node) bool {
+		for _, sel := range p.comments {
+			if sel.matches(n) {
+				return true
+			}
+		}
+		return false
+	})
+
+	text := make([]string, len(containers))
+	for i, container := range containers {
+		text[i] = string(stripHTML(container))
+	}
+	return strings.Join(text, "\n")
+}
+
+// leadingWords returns text up to the end of its nth whitespace-separated
+// word
+func leadingWords(text string, n int) string {
+	inWord := false
+	for i, r := range text {
+		if !unicode.IsSpace(r) {
+			inWord = true
+			continue
+		}
+		if inWord {
+			if n--; n == 0 {
+				return text[:i]
+			}
+		}
+		inWord = false
+	}
+	return text
+}
+
+// language returns the language the record is indexed in: the one the page
+// declares, if any, then the detected one when detection is enabled and
+// confident, the configured default otherwise
+func (p *Pipeline) language(record indexer.Record, declared string) string {
+	if declared != "" {
+		return declared
+	}
+	if p.config.DetectLanguage {
+		text := record.Title() + "\n" + string(record.Body())
+		if language, confidence := detectLanguage(text); confidence >= minLanguageConfidence {
+			return language
+		}
+	}
+	return p.config.Language
+}
+
+// isPlainText reports whether the record holds text or markdown rather than
+// HTML, preferring its content type and falling back to the file extension
+func isPlainText(record indexer.Record) bool {
+	mediaType, _, _ := mime.ParseMediaType(record.ContentType())
+	switch mediaType {
+	case "text/plain", "text/markdown", "text/x-markdown":
+		return true
+	case "":
+		// TODO: We can improve file type detection; this is a very limited subset of indexable file types
+		return strings.HasSuffix(record.Path(), ".txt") || strings.HasSuffix(record.Path(), ".md")
+	}
+	return false
+}
+
+// trimTitleSuffix removes the configured site-name suffix from the record's
+// title, keeping the original title when nothing else would remain
+func (p *Pipeline) trimTitleSuffix(record indexer.Record) {
+	if p.config.TitleSuffix == "" {
+		return
+	}
+
+	title := record.Title()
+	trimmed := strings.TrimSpace(strings.TrimSuffix(title, p.config.TitleSuffix))
+	if trimmed != "" && trimmed != title {
+		record.SetTitle(trimmed)
+	}
+}
+
 func getHTMLContent(r io.Reader, tag []byte) (result string, err error) {
 	z := html.NewTokenizer(r)
 	result = ""
@@ -157,10 +473,13 @@ func getHTMLContent(r io.Reader, tag []byte) (result string, err error) {
 }
 
 // index is the step of the pipeline that pipes valid documents to the indexer.
+// A record piped to the indexer is no longer the pipeline's to use.
 func (p *Pipeline) index(in interface{}) interface{} {
 	if record, ok := in.(indexer.Record); ok {
 		if !record.Ignored() {
+			p.Confirm(record.Path())
 			p.indexer.Pipe(record)
+			return nil
 		}
 	}
 	return in
@@ -168,6 +487,10 @@ func (p *Pipeline) index(in interface{}) interface{} {
 
 // ValidatePath is the method that checks if the target page can be indexed
 func (p *Pipeline) ValidatePath(path string) bool {
+	if p.IsVariant(path) {
+		return false
+	}
+
 	for _, pa := range p.config.ExcludePaths {
 		if pa.MatchString(path) {
 			return false
@@ -1,18 +1,264 @@
 package search_test
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pedronasser/caddy-search"
+	"github.com/pedronasser/caddy-search/indexer"
 	"github.com/pedronasser/caddy-search/indexer/bleve"
+	. "github.com/smartystreets/goconvey/convey"
 )
 
+// captureIndexer records every document the pipeline hands over for indexing
+type captureIndexer struct {
+	indexer.Handler
+	records chan indexer.Record
+}
+
+func (c *captureIndexer) Pipe(r indexer.Record) {
+	c.records <- r
+}
+
+// newCapturePipeline creates a pipeline whose indexer captures the records
+// it receives. The returned func removes the temporary index.
+func newCapturePipeline(config *search.Config) (*captureIndexer, *search.Pipeline, func()) {
+	dir, err := ioutil.TempDir("", "caddyIndexTest")
+	So(err, ShouldBeNil)
+
+	indxr, err := bleve.New(dir, indexer.Config{})
+	So(err, ShouldBeNil)
+
+	if config.IncludePaths == nil {
+		config.IncludePaths = search.ConvertToRegExp([]string{"^/"})
+	}
+
+	capture := &captureIndexer{indxr, make(chan indexer.Record, 1)}
+	pipeline, err := search.NewPipeline(config, capture)
+	So(err, ShouldBeNil)
+
+	return capture, pipeline, func() { os.RemoveAll(dir) }
+}
+
+// next returns the next record handed to the indexer, or nil if none
+// arrives in time (the record was ignored)
+func (c *captureIndexer) next() indexer.Record {
+	select {
+	case rec := <-c.records:
+		return rec
+	case <-time.After(500 * time.Millisecond):
+		return nil
+	}
+}
+
+// pipeFixture runs a file from testdata through a new pipeline and returns
+// the record that reached the indexer, or nil if it was ignored
+func pipeFixture(config *search.Config, name string) indexer.Record {
+	capture, pipeline, cleanup := newCapturePipeline(config)
+	defer cleanup()
+
+	fullPath, _ := filepath.Abs(filepath.Join("testdata", name))
+	rec := capture.Record("/" + name)
+	rec.SetFullPath(fullPath)
+	pipeline.Pipe(rec)
+
+	return capture.next()
+}
+
+func TestPipelineTitle(t *testing.T) {
+	Convey("Given an HTML page with a multi-line title tag", t, func() {
+		Convey("Should collapse the title's whitespace", func() {
+			rec := pipeFixture(&search.Config{}, "multiline-title.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "Getting Started with Search | My Site")
+		})
+
+		Convey("Should strip the configured site-name suffix", func() {
+			rec := pipeFixture(&search.Config{TitleSuffix: "| My Site"}, "multiline-title.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "Getting Started with Search")
+		})
+	})
+}
+
+func TestPipelineStripHTML(t *testing.T) {
+	Convey("Given an HTML page with tightly-packed inline markup", t, func() {
+		rec := pipeFixture(&search.Config{}, "inline-markup.html")
+		So(rec, ShouldNotBeNil)
+
+		Convey("Should separate inline elements by spaces and blocks by line breaks", func() {
+			So(string(rec.Body()), ShouldEqual, "Search engines index words quickly.\nFirst block\nSecond block\none\ntwo")
+		})
+	})
+
+	Convey("Given an HTML page embedding scripts, data and templates in its body", t, func() {
+		rec := pipeFixture(&search.Config{}, "script-noise.html")
+		So(rec, ShouldNotBeNil)
+
+		Convey("Should index only the text a visitor reads", func() {
+			So(string(rec.Body()), ShouldEqual, "Pricing\nPlans start at ten dollars a month.\nContact sales for volume discounts.")
+		})
+	})
+}
+
+func TestPipelineImage(t *testing.T) {
+	Convey("Given HTML pages declaring a representative image", t, func() {
+		Convey("Should resolve a relative og:image against the page URL", func() {
+			rec := pipeFixture(&search.Config{}, "blog/og-image.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Image(), ShouldEqual, "/images/cover.png")
+		})
+
+		Convey("Should resolve a relative og:image against the page's base href", func() {
+			rec := pipeFixture(&search.Config{}, "variants/base/guide.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Image(), ShouldEqual, "/docs/images/plugins.png")
+		})
+
+		Convey("Should fall back to the image_src link", func() {
+			rec := pipeFixture(&search.Config{}, "image-src.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Image(), ShouldEqual, "https://cdn.example.com/thumb.jpg")
+		})
+
+		Convey("Should keep an image on the site a path, whatever the crawler fetches from", func() {
+			rec := pipeFixture(&search.Config{SiteURL: "http://localhost:2015"}, "blog/og-image.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Image(), ShouldEqual, "/images/cover.png")
+		})
+
+		Convey("Should leave the image empty when the page declares none", func() {
+			rec := pipeFixture(&search.Config{}, "inline-markup.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Image(), ShouldEqual, "")
+		})
+	})
+}
+
+func TestPipelineWorkers(t *testing.T) {
+	Convey("Given a pipeline with concurrent stages", t, func() {
+		config := &search.Config{PipelineWorkers: map[string]int{"read": 2, "parse": 4, "index": 2}}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		fixtures := []string{"install.html", "multiline-title.html", "inline-markup.html", "container.html"}
+		for i := 0; i < 20; i++ {
+			name := fixtures[i%len(fixtures)]
+			fullPath, _ := filepath.Abs(filepath.Join("testdata", name))
+			rec := capture.Record(fmt.Sprintf("/%d/%s", i, name))
+			rec.SetFullPath(fullPath)
+			go pipeline.Pipe(rec)
+		}
+
+		Convey("Should parse every document", func() {
+			paths := map[string]bool{}
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				So(rec.Title(), ShouldNotBeEmpty)
+				paths[rec.Path()] = true
+			}
+			So(paths, ShouldHaveLength, 20)
+		})
+	})
+
+	// run with -race: the records polled here are reused from the ones
+	// released while the pipeline is still busy
+	Convey("Given concurrent stages handing records to the indexer", t, func() {
+		s, cleanup := newTestSearch(&search.Config{PipelineWorkers: map[string]int{"read": 2, "parse": 4, "index": 2}})
+		defer cleanup()
+
+		fixtures := []string{"install.html", "robots/noindex.html", "inline-markup.html", "container.html"}
+		for i := 0; i < 40; i++ {
+			name := fixtures[i%len(fixtures)]
+			fullPath, _ := filepath.Abs(filepath.Join("testdata", name))
+			rec := s.Indexer.Record(fmt.Sprintf("/%d/%s", i, name))
+			rec.SetFullPath(fullPath)
+			s.Pipeline.Pipe(rec)
+		}
+
+		Convey("Should index every page but the ignored ones", func() {
+			for i := 0; i < 40; i++ {
+				name := fixtures[i%len(fixtures)]
+				if name == "robots/noindex.html" {
+					continue
+				}
+				loaded := false
+				for j := 0; j < 100 && !loaded; j++ {
+					loaded = s.Indexer.Record(fmt.Sprintf("/%d/%s", i, name)).Load()
+					time.Sleep(time.Millisecond)
+				}
+				So(loaded, ShouldBeTrue)
+			}
+		})
+	})
+}
+
+// discardIndexer drops the documents handed over for indexing, so that
+// benchmarks measure the pipeline alone
+type discardIndexer struct {
+	indexer.Handler
+}
+
+func (d discardIndexer) Pipe(r indexer.Record) {
+	d.Kill(r)
+}
+
+// benchmarkPipelineWorkers parses b.N large in-memory pages with the given
+// number of parse workers
+func benchmarkPipelineWorkers(b *testing.B, workers int) {
+	dir, err := ioutil.TempDir("", "caddyIndexTest")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	indxr, err := bleve.New(dir, indexer.Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	config := &search.Config{
+		IncludePaths:    search.ConvertToRegExp([]string{"^/"}),
+		PipelineWorkers: map[string]int{"parse": workers},
+	}
+	pipeline, err := search.NewPipeline(config, discardIndexer{indxr})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	page := []byte("<html><head><title>Large page</title></head><body>" +
+		strings.Repeat("<p>Some <b>bold</b> and <a href=\"/x\">linked</a> text in a paragraph.</p>", 2000) +
+		"</body></html>")
+
+	b.SetBytes(int64(len(page)))
+	b.ResetTimer()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			rec := indxr.Record(fmt.Sprintf("/page-%d.html", i))
+			rec.Write(page)
+			pipeline.Pipe(rec)
+		}
+		pipeline.MarkScanned()
+	}()
+
+	for !pipeline.Settled() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func BenchmarkPipelineWorkers1(b *testing.B) { benchmarkPipelineWorkers(b, 1) }
+func BenchmarkPipelineWorkers4(b *testing.B) { benchmarkPipelineWorkers(b, 4) }
+
 func BenchmarkPipeline(b *testing.B) {
 	b.ReportAllocs()
 
 	os.RemoveAll("/tmp/caddyIndexTest")
-	indxr, err := bleve.New("/tmp/caddyIndexTest")
+	indxr, err := bleve.New("/tmp/caddyIndexTest", indexer.Config{})
 
 	if err != nil {
 		b.Fatal(err)
@@ -32,3 +278,476 @@ func BenchmarkPipeline(b *testing.B) {
 		pipeline.Pipe(rec)
 	}
 }
+
+func TestPipelineLanguage(t *testing.T) {
+	Convey("Given language detection is enabled", t, func() {
+		config := func() *search.Config {
+			return &search.Config{DetectLanguage: true, Language: "en"}
+		}
+
+		Convey("Should tag each page with its detected language", func() {
+			rec := pipeFixture(config(), "lang/de.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Language(), ShouldEqual, "de")
+
+			rec = pipeFixture(config(), "lang/en.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Language(), ShouldEqual, "en")
+		})
+
+		Convey("Should fall back to the default language when unsure", func() {
+			rec := pipeFixture(config(), "lang/short.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Language(), ShouldEqual, "en")
+		})
+
+		Convey("Should prefer the language the page declares", func() {
+			rec := pipeFixture(config(), "lang/declared.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Language(), ShouldEqual, "de")
+		})
+	})
+
+	Convey("Given language detection is disabled", t, func() {
+		Convey("Should tag pages with the configured language", func() {
+			rec := pipeFixture(&search.Config{Language: "fr"}, "lang/de.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Language(), ShouldEqual, "fr")
+		})
+
+		Convey("Should still tag pages with the language they declare", func() {
+			rec := pipeFixture(&search.Config{Language: "fr"}, "lang/declared.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Language(), ShouldEqual, "de")
+		})
+	})
+}
+
+func TestPipelineContentSelector(t *testing.T) {
+	Convey("Given a content selector", t, func() {
+		for _, selector := range []string{"#content", "div.post", ".post.body"} {
+			Convey("Should only index the text within "+selector, func() {
+				rec := pipeFixture(&search.Config{ContentSelector: selector}, "container.html")
+				So(rec, ShouldNotBeNil)
+				So(string(rec.Body()), ShouldEqual, "Version 2.0 released\nThe new version adds incremental indexing.")
+				So(rec.Title(), ShouldEqual, "Version 2.0 released")
+			})
+		}
+
+		Convey("Should index the whole page when it has no such element", func() {
+			rec := pipeFixture(&search.Config{ContentSelector: "main"}, "container.html")
+			So(rec, ShouldNotBeNil)
+			So(string(rec.Body()), ShouldContainSubstring, "Copyright My Site")
+			So(rec.Title(), ShouldEqual, "Release notes | My Site")
+		})
+	})
+}
+
+func TestPipelineComments(t *testing.T) {
+	Convey("Given comment selectors", t, func() {
+		config := &search.Config{CommentSelectors: []string{"#comments"}}
+
+		Convey("Should index the comments apart from the body", func() {
+			rec := pipeFixture(config, "comments/post.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Comments(), ShouldEqual, "Does this work when running on Kubernetes?\nYes, roll the deployment.")
+			So(string(rec.Body()), ShouldNotContainSubstring, "Kubernetes")
+		})
+
+		Convey("Should join the text of every matching element", func() {
+			rec := pipeFixture(&search.Config{CommentSelectors: []string{"div.reply"}}, "comments/post.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Comments(), ShouldEqual, "Does this work when running on Kubernetes?\nYes, roll the deployment.")
+		})
+	})
+
+	Convey("Given no comment selector", t, func() {
+		Convey("Should index the comments as part of the body", func() {
+			rec := pipeFixture(&search.Config{}, "comments/post.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Comments(), ShouldBeEmpty)
+			So(string(rec.Body()), ShouldContainSubstring, "Kubernetes")
+		})
+	})
+}
+
+func TestPipelineBodyPrefix(t *testing.T) {
+	Convey("Given a limit on the words of bodies", t, func() {
+		Convey("Should keep only the leading words", func() {
+			rec := pipeFixture(&search.Config{ContentSelector: "#content", IndexBodyPrefixWords: 4}, "container.html")
+			So(rec, ShouldNotBeNil)
+			So(string(rec.Body()), ShouldEqual, "Version 2.0 released\nThe")
+			So(rec.Title(), ShouldEqual, "Version 2.0 released")
+			So(rec.Description(), ShouldEqual, "What changed in version 2.0.")
+		})
+
+		Convey("Should keep shorter bodies whole", func() {
+			rec := pipeFixture(&search.Config{ContentSelector: "#content", IndexBodyPrefixWords: 100}, "container.html")
+			So(rec, ShouldNotBeNil)
+			So(string(rec.Body()), ShouldEqual, "Version 2.0 released\nThe new version adds incremental indexing.")
+		})
+	})
+}
+
+func TestPipelineRobotsMeta(t *testing.T) {
+	Convey("Given pages with robots meta tags", t, func() {
+		Convey("Should skip pages marked noindex,nofollow", func() {
+			So(pipeFixture(&search.Config{}, "robots/noindex.html"), ShouldBeNil)
+		})
+
+		Convey("Should index pages only marked nofollow", func() {
+			rec := pipeFixture(&search.Config{}, "robots/nofollow.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "Links")
+		})
+
+		Convey("Should ignore the directives addressed to another crawler", func() {
+			rec := pipeFixture(&search.Config{}, "robots/otherbot.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "Archive")
+		})
+
+		Convey("Should remove pages that were indexed before", func() {
+			capture, pipeline, cleanup := newCapturePipeline(&search.Config{})
+			defer cleanup()
+
+			indexed := capture.Record("/robots/noindex.html")
+			indexed.Write([]byte("draft"))
+			capture.Handler.Pipe(indexed)
+			for i := 0; i < 100 && !capture.Record("/robots/noindex.html").Load(); i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(capture.Record("/robots/noindex.html").Load(), ShouldBeTrue)
+
+			fullPath, _ := filepath.Abs(filepath.Join("testdata", "robots/noindex.html"))
+			rec := capture.Record("/robots/noindex.html")
+			rec.SetFullPath(fullPath)
+			pipeline.Pipe(rec)
+
+			So(capture.next(), ShouldBeNil)
+			So(capture.Record("/robots/noindex.html").Load(), ShouldBeFalse)
+		})
+	})
+}
+
+func TestPipelineFrontMatter(t *testing.T) {
+	Convey("Given a Markdown file with front matter", t, func() {
+		Convey("Should read its title, description and excerpt out of the body", func() {
+			rec := pipeFixture(&search.Config{}, "frontmatter.md")
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "Indexing Markdown")
+			So(rec.Description(), ShouldEqual, "How Markdown files are indexed.")
+			So(rec.Excerpt(), ShouldEqual, "Front matter gives Markdown files a title and a preview.")
+			So(string(rec.Body()), ShouldStartWith, "# Indexing Markdown")
+			So(string(rec.Body()), ShouldNotContainSubstring, "tags")
+		})
+	})
+}
+
+func TestPipelineSoft404(t *testing.T) {
+	Convey("Given soft 404 detection is enabled", t, func() {
+		config := func(markers ...string) *search.Config {
+			return &search.Config{Soft404: true, Soft404Markers: markers}
+		}
+		crawl := func(config *search.Config, name string, body string) indexer.Record {
+			capture, pipeline, cleanup := newCapturePipeline(config)
+			defer cleanup()
+
+			rec := capture.Record("/" + name)
+			if body == "" {
+				fullPath, _ := filepath.Abs(filepath.Join("testdata", name))
+				rec.SetFullPath(fullPath)
+			} else {
+				rec.Write([]byte(body))
+			}
+			pipeline.PipeCrawled(rec)
+			return capture.next()
+		}
+
+		Convey("Should skip short crawled pages with a not-found heading", func() {
+			So(crawl(config(), "soft-404.html", ""), ShouldBeNil)
+		})
+
+		Convey("Should skip crawled pages containing a configured marker", func() {
+			So(crawl(config(), "removed.html", ""), ShouldNotBeNil)
+			So(crawl(config("this article was removed"), "removed.html", ""), ShouldBeNil)
+		})
+
+		Convey("Should index short pages mentioning a not-found phrase in their text", func() {
+			So(crawl(config(), "status.html", "<html><head><title>Status codes</title></head>"+
+				"<body><h1>Status codes</h1><p>A 404 means the page was not found.</p></body></html>"), ShouldNotBeNil)
+		})
+
+		Convey("Should index regular pages", func() {
+			So(crawl(config("this article was removed"), "install.html", ""), ShouldNotBeNil)
+		})
+
+		Convey("Should only check pages fetched by the crawler", func() {
+			So(pipeFixture(config(), "soft-404.html"), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given soft 404 detection is disabled", t, func() {
+		Convey("Should index error pages served successfully", func() {
+			So(pipeFixture(&search.Config{}, "soft-404.html"), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPipelineCharsets(t *testing.T) {
+	Convey("Given pages in legacy encodings", t, func() {
+		pipeBody := func(contentType string, body []byte) indexer.Record {
+			capture, pipeline, cleanup := newCapturePipeline(&search.Config{})
+			defer cleanup()
+
+			rec := capture.Record("/page.html")
+			rec.SetContentType(contentType)
+			rec.Write(body)
+			pipeline.Pipe(rec)
+			return capture.next()
+		}
+
+		Convey("Should transcode the charset declared in a meta tag", func() {
+			rec := pipeFixture(&search.Config{}, "latin1.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "Café crème")
+			So(string(rec.Body()), ShouldContainSubstring, "s'il vous plaît")
+		})
+
+		Convey("Should transcode the charset of the Content-Type", func() {
+			rec := pipeBody("text/html; charset=Shift_JIS",
+				[]byte("<html><head><title>\x93\xfa\x96\x7b\x8c\xea</title></head><body>text</body></html>"))
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "日本語")
+		})
+
+		Convey("Should strip a byte order mark", func() {
+			rec := pipeFixture(&search.Config{}, "bom.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "Byte order mark")
+			So(string(rec.Body()), ShouldStartWith, "Naïve")
+		})
+
+		Convey("Should keep undeclared UTF-8 past the sniffed prefix", func() {
+			rec := pipeBody("text/html", []byte("<html><head><title>Page</title></head><body>"+
+				strings.Repeat("plain text ", 200)+"naïve café</body></html>"))
+			So(rec, ShouldNotBeNil)
+			So(string(rec.Body()), ShouldEndWith, "naïve café")
+		})
+
+		Convey("Should read unknown charsets as UTF-8", func() {
+			rec := pipeBody("text/plain; charset=x-unknown", []byte("caf\xe9 ok"))
+			So(rec, ShouldNotBeNil)
+			So(string(rec.Body()), ShouldEqual, "caf\uFFFD ok")
+		})
+	})
+}
+
+func TestPipelineFeeds(t *testing.T) {
+	Convey("Given an RSS feed", t, func() {
+		capture, pipeline, cleanup := newCapturePipeline(&search.Config{})
+		defer cleanup()
+
+		fullPath, _ := filepath.Abs(filepath.Join("testdata", "feeds", "planet.rss"))
+		rec := capture.Record("/feeds/planet.rss")
+		rec.SetFullPath(fullPath)
+		pipeline.Pipe(rec)
+
+		Convey("Should index each item under its link", func() {
+			first := capture.next()
+			So(first, ShouldNotBeNil)
+			So(first.Path(), ShouldEqual, "https://blog.example.org/2016/roadmap")
+			So(first.Title(), ShouldEqual, "Release & roadmap")
+			So(string(first.Body()), ShouldEqual, "What comes next for the project.")
+			So(first.Modified().Equal(time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)), ShouldBeTrue)
+
+			second := capture.next()
+			So(second, ShouldNotBeNil)
+			So(second.Path(), ShouldEqual, "/news/local.html")
+
+			So(capture.next(), ShouldBeNil)
+		})
+	})
+
+	Convey("Given an Atom feed", t, func() {
+		capture, pipeline, cleanup := newCapturePipeline(&search.Config{})
+		defer cleanup()
+
+		fullPath, _ := filepath.Abs(filepath.Join("testdata", "feeds", "posts.atom"))
+		rec := capture.Record("/feeds/posts.atom")
+		rec.SetFullPath(fullPath)
+		pipeline.Pipe(rec)
+
+		Convey("Should resolve entry links against the feed", func() {
+			entry := capture.next()
+			So(entry, ShouldNotBeNil)
+			So(entry.Path(), ShouldEqual, "/feeds/entries/first.html")
+			So(entry.Title(), ShouldEqual, "Atom entry")
+			So(string(entry.Body()), ShouldEqual, "Summary of the first entry.")
+		})
+	})
+}
+
+func TestPipelineFields(t *testing.T) {
+	Convey("Given a page declaring custom fields", t, func() {
+		rec := pipeFixture(&search.Config{}, "fields/plugin.html")
+		So(rec, ShouldNotBeNil)
+
+		Convey("Should collect the data-search attributes", func() {
+			So(rec.Fields(), ShouldResemble, map[string]string{"product": "CLI", "author": "Jane Doe"})
+		})
+	})
+
+	Convey("Given a page declaring too many custom fields", t, func() {
+		capture, pipeline, cleanup := newCapturePipeline(&search.Config{})
+		defer cleanup()
+
+		body := "<html><head><title>Fields</title></head><body"
+		for i := 0; i < 30; i++ {
+			body += fmt.Sprintf(` data-search-f%d="%s"`, i, strings.Repeat("x", 300))
+		}
+		body += ">text</body></html>"
+
+		rec := capture.Record("/page.html")
+		rec.SetContentType("text/html")
+		rec.Write([]byte(body))
+		pipeline.Pipe(rec)
+		rec = capture.next()
+		So(rec, ShouldNotBeNil)
+
+		Convey("Should cap their number and size", func() {
+			So(len(rec.Fields()), ShouldEqual, 20)
+			So(len(rec.Fields()["f0"]), ShouldEqual, 256)
+		})
+	})
+}
+
+func TestPipelineTables(t *testing.T) {
+	Convey("Given a page with a multi-column table", t, func() {
+		Convey("Should index every row as a line of cells prefixed with their column", func() {
+			rec := pipeFixture(&search.Config{IndexTables: true}, "tables/specs.html")
+			So(rec, ShouldNotBeNil)
+			So(string(rec.Body()), ShouldEqual, "Power supply specifications\n"+
+				"Output ratings\n"+
+				"Model; Voltage; Current; Connectors\n"+
+				"PS-100; Voltage: 12 V; Current: 2 A; Connectors: USB-C; Connectors: barrel\n"+
+				"PS-200; Voltage: 24 V; Current: 5 A; Connectors: terminal\n"+
+				"Both models ship with a wall mount.")
+		})
+
+		Convey("Should index every cell as a line of its own unless enabled", func() {
+			rec := pipeFixture(&search.Config{}, "tables/specs.html")
+			So(rec, ShouldNotBeNil)
+			So(string(rec.Body()), ShouldContainSubstring, "Current\nConnectors\nPS-100\n12 V\n")
+		})
+	})
+}
+
+func TestPipelineSections(t *testing.T) {
+	Convey("Given a page with headings carrying ids", t, func() {
+		Convey("Should record where every section with an id starts in the body", func() {
+			rec := pipeFixture(&search.Config{DeepLinks: true}, "sections/guide.html")
+			So(rec, ShouldNotBeNil)
+			body := string(rec.Body())
+			So(body, ShouldNotContainSubstring, "\uE000")
+			So(rec.Sections(), ShouldHaveLength, 2)
+			So(rec.Sections()[0].ID, ShouldEqual, "linux")
+			So(body[rec.Sections()[0].Start:], ShouldStartWith, "Linux\n")
+			So(rec.Sections()[1].ID, ShouldEqual, "windows")
+			So(body[rec.Sections()[1].Start:], ShouldStartWith, "Windows\n")
+		})
+
+		Convey("Should record no sections unless enabled", func() {
+			rec := pipeFixture(&search.Config{}, "sections/guide.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Sections(), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestPipelineTranslations(t *testing.T) {
+	Convey("Given a page linking to its translations with hreflang", t, func() {
+		Convey("Should record the paths of its translations on the site", func() {
+			rec := pipeFixture(&search.Config{Translations: true}, "translations/guide.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Translations(), ShouldResemble, map[string]string{
+				"de": "/translations/de/guide.html",
+				"fr": "/translations/fr/guide.html",
+			})
+		})
+
+		Convey("Should record none unless enabled", func() {
+			rec := pipeFixture(&search.Config{}, "translations/guide.html")
+			So(rec, ShouldNotBeNil)
+			So(rec.Translations(), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestPipelineCustomElements(t *testing.T) {
+	Convey("Given an AMP page built from custom elements", t, func() {
+		Convey("Should index the text of custom elements and their shadow roots without the AMP boilerplate", func() {
+			rec := pipeFixture(&search.Config{}, "amp/components.html")
+			So(rec, ShouldNotBeNil)
+			So(string(rec.Body()), ShouldEqual, "Ridgeline trail runner\n"+
+				"Grippy lugs for muddy descents.\n"+
+				"Waterproof mesh upper.\n"+
+				"Accept all cookies?\n"+
+				"Rated four stars by hikers.")
+		})
+
+		Convey("Should leave out the elements named by skip_elements", func() {
+			rec := pipeFixture(&search.Config{SkipElements: []string{"cookie-banner"}}, "amp/components.html")
+			So(rec, ShouldNotBeNil)
+			So(string(rec.Body()), ShouldNotContainSubstring, "cookies")
+			So(string(rec.Body()), ShouldContainSubstring, "Rated four stars by hikers.")
+		})
+	})
+}
+
+func TestPipelineOfficeDocuments(t *testing.T) {
+	Convey("Given office documents", t, func() {
+		Convey("Should index the paragraphs of a Word document under its title", func() {
+			rec := pipeFixture(&search.Config{}, "office/policy.docx")
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "Travel Policy")
+			So(string(rec.Body()), ShouldContainSubstring, "Submit receipts within 30 days.")
+			So(string(rec.Body()), ShouldContainSubstring, "Reimbursement\tmonthly")
+		})
+
+		Convey("Should index the cells of every sheet of a workbook", func() {
+			rec := pipeFixture(&search.Config{}, "office/sales.xlsx")
+			So(rec, ShouldNotBeNil)
+			So(rec.Title(), ShouldEqual, "sales.xlsx")
+			So(string(rec.Body()), ShouldEqual, "Region\tRevenue\nNortheast\t1200\nSouthwest\t950\nForecast")
+		})
+
+		Convey("Should skip a document that cannot be read", func() {
+			So(pipeFixture(&search.Config{}, "office/broken.docx"), ShouldBeNil)
+		})
+	})
+}
+
+func TestPipelineSweep(t *testing.T) {
+	Convey("Given indexed pages with a document_ttl", t, func() {
+		s, cleanup := newTestSearch(&search.Config{DocumentTTL: time.Hour})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+		So(searchJSON(s, "install"), ShouldHaveLength, 2)
+
+		Convey("Should keep the documents seen within the ttl", func() {
+			removed, err := s.Pipeline.Sweep(time.Now().Add(30 * time.Minute))
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 0)
+			So(searchJSON(s, "install"), ShouldHaveLength, 2)
+		})
+
+		Convey("Should remove the documents not seen for longer", func() {
+			removed, err := s.Pipeline.Sweep(time.Now().Add(2 * time.Hour))
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 2)
+			So(searchJSON(s, "install"), ShouldBeEmpty)
+		})
+	})
+}
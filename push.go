@@ -0,0 +1,287 @@
+package search
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// pushBatchFactor bounds the size of a bulk push request, as a multiple of
+// push_max_size
+const pushBatchFactor = 100
+
+// errDocumentTooLarge ends a bulk push at a document far larger than
+// push_max_size, before it is read whole
+var errDocumentTooLarge = errors.New("document larger than push_max_size")
+
+// PushDocument is the payload accepted by the push endpoint
+type PushDocument struct {
+	Path        string `json:"path"`
+	Title       string `json:"title"`
+	Body        string `json:"body"`
+	ContentType string `json:"content_type"`
+}
+
+// Push indexes a document sent by an authenticated client, running it
+// through the pipeline without fetching it over HTTP
+func (s *Search) Push(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	if !s.authorized(r) {
+		return http.StatusUnauthorized, nil
+	}
+
+	if r.ContentLength > s.Config.PushMaxSize {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+
+	payload, err := ioutil.ReadAll(io.LimitReader(r.Body, s.Config.PushMaxSize+1))
+	if err != nil {
+		return http.StatusBadRequest, nil
+	}
+	if int64(len(payload)) > s.Config.PushMaxSize {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+
+	var doc PushDocument
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return http.StatusBadRequest, nil
+	}
+
+	docPath, status := s.pushDocument(doc)
+	if status != http.StatusAccepted {
+		return status, nil
+	}
+
+	jresp, err := json.Marshal(map[string]string{"path": docPath})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(jresp)
+	return http.StatusAccepted, nil
+}
+
+// pushDocument pipes a pushed document to the indexer and returns its
+// cleaned path along with the status of the push
+func (s *Search) pushDocument(doc PushDocument) (string, int) {
+	if doc.Body == "" || !strings.HasPrefix(doc.Path, "/") {
+		return "", http.StatusBadRequest
+	}
+
+	docPath := s.Config.slashPath(path.Clean(doc.Path))
+	if !s.Pipeline.ValidatePath(docPath) {
+		return docPath, http.StatusUnprocessableEntity
+	}
+
+	record := s.Indexer.Record(docPath)
+	record.SetTitle(doc.Title)
+	record.SetContentType(doc.ContentType)
+	record.Write([]byte(doc.Body))
+	s.Pipeline.Pipe(record)
+	return docPath, http.StatusAccepted
+}
+
+// PushResult is the outcome of one document of a bulk push. Index is the
+// document's position in the batch and Status the status a single push of
+// it would have returned.
+type PushResult struct {
+	Index  int    `json:"index"`
+	Path   string `json:"path,omitempty"`
+	Status int    `json:"status"`
+}
+
+// PushSummary is the response of the bulk push endpoint
+type PushSummary struct {
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Results  []PushResult `json:"results"`
+}
+
+// PushBulk indexes a batch of documents sent by an authenticated client as a
+// JSON array or as newline-delimited JSON. Documents are decoded and piped
+// one at a time, so a batch is never held in memory and a busy pipeline
+// slows down reading the request. Each document is limited to the push size
+// and reported on separately; a malformed document ends the batch, and so
+// does one too large to be read. The request is limited to pushBatchFactor
+// times the push size.
+func (s *Search) PushBulk(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	if !s.authorized(r) {
+		return http.StatusUnauthorized, nil
+	}
+
+	limit := s.Config.PushMaxSize * pushBatchFactor
+	if r.ContentLength > limit {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+	body := http.MaxBytesReader(w, r.Body, limit)
+
+	summary := PushSummary{Results: []PushResult{}}
+	err := decodeBatch(body, s.Config.PushMaxSize, func(index int, raw json.RawMessage) {
+		result := PushResult{Index: index, Status: http.StatusRequestEntityTooLarge}
+		if int64(len(raw)) <= s.Config.PushMaxSize {
+			var doc PushDocument
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				result.Status = http.StatusBadRequest
+			} else {
+				result.Path, result.Status = s.pushDocument(doc)
+			}
+		}
+
+		if result.Status == http.StatusAccepted {
+			summary.Accepted++
+		} else {
+			summary.Rejected++
+		}
+		summary.Results = append(summary.Results, result)
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == errDocumentTooLarge {
+			status = http.StatusRequestEntityTooLarge
+		}
+		summary.Rejected++
+		summary.Results = append(summary.Results, PushResult{Index: len(summary.Results), Status: status})
+	}
+	if len(summary.Results) == 0 {
+		return http.StatusBadRequest, nil
+	}
+
+	jresp, err := json.Marshal(summary)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(jresp)
+	return http.StatusAccepted, nil
+}
+
+// decodeBatch calls each with every document of a JSON array or of a stream
+// of JSON values, in order, as they are read. A document is not read past
+// about twice max bytes, failing with errDocumentTooLarge.
+func decodeBatch(r io.Reader, max int64, each func(int, json.RawMessage)) error {
+	in := bufio.NewReader(r)
+	first, err := firstByte(in)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	limit := 2*max + documentSlack
+	doc := &documentReader{r: in, max: limit, left: limit}
+	dec := json.NewDecoder(doc)
+	if first == '[' {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		for i := 0; dec.More(); i++ {
+			var raw json.RawMessage
+			doc.next()
+			if err := dec.Decode(&raw); err != nil {
+				return doc.cause(err)
+			}
+			each(i, raw)
+		}
+		doc.next()
+		_, err := dec.Token()
+		return doc.cause(err)
+	}
+
+	for i := 0; ; i++ {
+		var raw json.RawMessage
+		doc.next()
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return doc.cause(err)
+		}
+		each(i, raw)
+	}
+}
+
+// documentSlack is the read-ahead a documentReader allows on top of twice the
+// size limit of a document
+const documentSlack = 4096
+
+// documentReader bounds what a JSON decoder reads for one document. The
+// decoder reads ahead into a buffer that grows to about twice the largest
+// document, so each is allowed twice the size limit and some slack.
+type documentReader struct {
+	r         io.Reader
+	max, left int64
+	exceeded  bool
+}
+
+// next gives the reader its whole allowance for the next document
+func (d *documentReader) next() {
+	d.left = d.max
+}
+
+func (d *documentReader) Read(p []byte) (int, error) {
+	if d.left <= 0 {
+		d.exceeded = true
+		return 0, errDocumentTooLarge
+	}
+	if int64(len(p)) > d.left {
+		p = p[:d.left]
+	}
+	n, err := d.r.Read(p)
+	d.left -= int64(n)
+	return n, err
+}
+
+// cause returns errDocumentTooLarge for a decoding error due to the
+// document's size, which the decoder may report as a syntax error
+func (d *documentReader) cause(err error) error {
+	if d.exceeded {
+		return errDocumentTooLarge
+	}
+	return err
+}
+
+// firstByte returns the first byte of the input that is not white space,
+// leaving it unread
+func firstByte(in *bufio.Reader) (byte, error) {
+	for {
+		b, err := in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(rune(b)) {
+			return b, in.UnreadByte()
+		}
+	}
+}
+
+// authorized reports whether the request carries the configured token as a
+// bearer credential
+func (s *Search) authorized(r *http.Request) bool {
+	if s.Config.Token == "" {
+		return false
+	}
+
+	auth := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return token != auth && subtle.ConstantTimeCompare([]byte(token), []byte(s.Config.Token)) == 1
+}
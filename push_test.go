@@ -0,0 +1,159 @@
+package search_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPush(t *testing.T) {
+	Convey("Given a search middleware with the push endpoint enabled", t, func() {
+		config := &search.Config{
+			Endpoint:     "/search",
+			PushEndpoint: "/search/push",
+			PushMaxSize:  256,
+			Token:        "secret",
+		}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		s := search.NewSearch(config, capture, pipeline)
+
+		push := func(token, body string) (int, string) {
+			req := httptest.NewRequest("POST", "/search/push", strings.NewReader(body))
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			status, _ := s.ServeHTTP(w, req)
+			return status, w.Body.String()
+		}
+
+		Convey("Should reject requests without a valid token", func() {
+			status, _ := push("", `{"path": "/a", "body": "text"}`)
+			So(status, ShouldEqual, http.StatusUnauthorized)
+			status, _ = push("wrong", `{"path": "/a", "body": "text"}`)
+			So(status, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("Should reject documents over the size limit", func() {
+			status, _ := push("secret", `{"path": "/a", "body": "`+strings.Repeat("a", 300)+`"}`)
+			So(status, ShouldEqual, http.StatusRequestEntityTooLarge)
+		})
+
+		Convey("Should reject documents without a path or body", func() {
+			status, _ := push("secret", `{"body": "text"}`)
+			So(status, ShouldEqual, http.StatusBadRequest)
+			status, _ = push("secret", `{"path": "/a"}`)
+			So(status, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("Should pipe a valid document to the indexer", func() {
+			status, body := push("secret", `{"path": "/blog/../hello", "title": "Hello", "body": "Hello world", "content_type": "text/plain"}`)
+			So(status, ShouldEqual, http.StatusAccepted)
+			So(body, ShouldEqual, `{"path":"/hello"}`)
+
+			rec := capture.next()
+			So(rec, ShouldNotBeNil)
+			So(rec.Path(), ShouldEqual, "/hello")
+			So(rec.Title(), ShouldEqual, "Hello")
+			So(string(rec.Body()), ShouldEqual, "Hello world")
+		})
+	})
+}
+
+func TestPushBulk(t *testing.T) {
+	Convey("Given a search middleware with the bulk push endpoint enabled", t, func() {
+		config := &search.Config{
+			Endpoint:         "/search",
+			PushEndpoint:     "/search/push",
+			PushBulkEndpoint: "/search/push/bulk",
+			PushMaxSize:      256,
+			Token:            "secret",
+		}
+		capture, pipeline, cleanup := newCapturePipeline(config)
+		defer cleanup()
+
+		s := search.NewSearch(config, capture, pipeline)
+
+		push := func(token, body string) (int, string) {
+			req := httptest.NewRequest("POST", "/search/push/bulk", strings.NewReader(body))
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			status, _ := s.ServeHTTP(w, req)
+			return status, w.Body.String()
+		}
+
+		piped := func() []string {
+			paths := []string{}
+			for rec := capture.next(); rec != nil; rec = capture.next() {
+				paths = append(paths, rec.Path())
+			}
+			return paths
+		}
+
+		Convey("Should reject requests without a valid token", func() {
+			status, _ := push("wrong", `[{"path": "/a", "body": "text"}]`)
+			So(status, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("Should reject an empty batch", func() {
+			status, _ := push("secret", " \n")
+			So(status, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("Should pipe the documents of a JSON array and report on each", func() {
+			status, body := push("secret", `[
+				{"path": "/a", "body": "first", "content_type": "text/plain"},
+				{"path": "relative", "body": "second"},
+				{"path": "/big", "body": "`+strings.Repeat("a", 300)+`"},
+				{"path": "/b/../c", "body": "third", "content_type": "text/plain"}
+			]`)
+			So(status, ShouldEqual, http.StatusAccepted)
+			So(body, ShouldEqual, `{"accepted":2,"rejected":2,"results":[`+
+				`{"index":0,"path":"/a","status":202},`+
+				`{"index":1,"status":400},`+
+				`{"index":2,"status":413},`+
+				`{"index":3,"path":"/c","status":202}]}`)
+			So(piped(), ShouldResemble, []string{"/a", "/c"})
+		})
+
+		Convey("Should end the batch at a document too large to read", func() {
+			status, body := push("secret", `[
+				{"path": "/a", "body": "first", "content_type": "text/plain"},
+				{"path": "/huge", "body": "`+strings.Repeat("a", 10000)+`"},
+				{"path": "/b", "body": "second", "content_type": "text/plain"}
+			]`)
+			So(status, ShouldEqual, http.StatusAccepted)
+			So(body, ShouldEqual, `{"accepted":1,"rejected":1,"results":[`+
+				`{"index":0,"path":"/a","status":202},`+
+				`{"index":1,"status":413}]}`)
+			So(piped(), ShouldResemble, []string{"/a"})
+		})
+
+		Convey("Should refuse a batch larger than its limit", func() {
+			status, _ := push("secret", strings.Repeat(" ", 256*100+1))
+			So(status, ShouldEqual, http.StatusRequestEntityTooLarge)
+		})
+
+		Convey("Should pipe the documents of a newline-delimited stream", func() {
+			status, body := push("secret", "{\"path\": \"/a\", \"body\": \"first\", \"content_type\": \"text/plain\"}\n{\"path\": \"/b\", \"body\": \"second\", \"content_type\": \"text/plain\"}\n")
+			So(status, ShouldEqual, http.StatusAccepted)
+			So(body, ShouldStartWith, `{"accepted":2,"rejected":0,`)
+			So(piped(), ShouldResemble, []string{"/a", "/b"})
+		})
+
+		Convey("Should keep the documents before a malformed one", func() {
+			status, body := push("secret", "{\"path\": \"/a\", \"body\": \"first\", \"content_type\": \"text/plain\"}\n{\"path\": ")
+			So(status, ShouldEqual, http.StatusAccepted)
+			So(body, ShouldEqual, `{"accepted":1,"rejected":1,"results":[{"index":0,"path":"/a","status":202},{"index":1,"status":400}]}`)
+			So(piped(), ShouldResemble, []string{"/a"})
+		})
+	})
+}
@@ -0,0 +1,74 @@
+package search
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// queryLimiter caps the number of queries run at once. A query waits up to
+// the configured time for another to finish, and is rejected after that.
+type queryLimiter struct {
+	slots    chan struct{}
+	wait     time.Duration
+	inFlight int64
+}
+
+func newQueryLimiter(max int, wait time.Duration) *queryLimiter {
+	return &queryLimiter{
+		slots: make(chan struct{}, max),
+		wait:  wait,
+	}
+}
+
+// acquire takes a slot for a query, waiting for one to free up until the
+// configured time elapses or the request is canceled. It reports whether it
+// got one; the slot must then be released.
+func (l *queryLimiter) acquire(r *http.Request) bool {
+	select {
+	case l.slots <- struct{}{}:
+		atomic.AddInt64(&l.inFlight, 1)
+		return true
+	default:
+	}
+	if l.wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		atomic.AddInt64(&l.inFlight, 1)
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// release frees the slot of a finished query
+func (l *queryLimiter) release() {
+	atomic.AddInt64(&l.inFlight, -1)
+	<-l.slots
+}
+
+// queriesInFlight returns the number of queries running
+func (l *queryLimiter) queriesInFlight() int64 {
+	return atomic.LoadInt64(&l.inFlight)
+}
+
+// admitQuery reports whether a search request may run now, under the
+// max_concurrent_queries cap, setting the Retry-After header when it may not.
+// An admitted request must call the returned function once it is done.
+func (s *Search) admitQuery(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	if s.queries == nil {
+		return func() {}, true
+	}
+	if !s.queries.acquire(r) {
+		w.Header().Set("Retry-After", "1")
+		return nil, false
+	}
+	return s.queries.release, true
+}
@@ -0,0 +1,87 @@
+package search_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search"
+	"github.com/pedronasser/caddy-search/indexer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// blockingIndexer holds every search until it is released
+type blockingIndexer struct {
+	indexer.Handler
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingIndexer) Search(q indexer.Query) []indexer.Record {
+	b.started <- struct{}{}
+	<-b.release
+	return b.Handler.Search(q)
+}
+
+func TestMaxConcurrentQueries(t *testing.T) {
+	Convey("Given a cap of one query at a time and a query in flight", t, func() {
+		s, cleanup := newTestSearch(&search.Config{HealthEndpoint: "/search/health"})
+		defer cleanup()
+		indexFixture(s, "install.html")
+
+		blocking := &blockingIndexer{s.Indexer, make(chan struct{}), make(chan struct{})}
+		config := *s.Config
+		config.MaxConcurrentQueries = 1
+		config.QueryQueueTimeout = 200 * time.Millisecond
+		limited := search.NewSearch(&config, blocking, s.Pipeline)
+
+		first := make(chan int)
+		go func() {
+			w := httptest.NewRecorder()
+			limited.ServeHTTP(w, httptest.NewRequest("GET", "/search?q=install", nil))
+			first <- w.Code
+		}()
+		<-blocking.started
+
+		Convey("Should reject the queries that waited too long with 503", func() {
+			w := httptest.NewRecorder()
+			status, err := limited.ServeHTTP(w, httptest.NewRequest("GET", "/search?q=install", nil))
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 503)
+			So(w.Header().Get("Retry-After"), ShouldEqual, "1")
+
+			close(blocking.release)
+			So(<-first, ShouldEqual, 200)
+		})
+
+		Convey("Should report the queries in flight in the health endpoint", func() {
+			w := httptest.NewRecorder()
+			limited.ServeHTTP(w, httptest.NewRequest("GET", "/search/health", nil))
+			var report map[string]interface{}
+			So(json.Unmarshal(w.Body.Bytes(), &report), ShouldBeNil)
+			So(report["queries_in_flight"], ShouldEqual, 1)
+
+			close(blocking.release)
+			<-first
+		})
+
+		Convey("Should run a waiting query once a slot frees up", func() {
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				blocking.release <- struct{}{}
+			}()
+			second := make(chan int)
+			go func() {
+				w := httptest.NewRecorder()
+				limited.ServeHTTP(w, httptest.NewRequest("GET", "/search?q=install", nil))
+				second <- w.Code
+			}()
+
+			So(<-first, ShouldEqual, 200)
+			<-blocking.started
+			blocking.release <- struct{}{}
+			So(<-second, ShouldEqual, 200)
+		})
+	})
+}
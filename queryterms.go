@@ -0,0 +1,89 @@
+package search
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// ErrTooManyTerms is returned by Search for a query with more terms than
+// max_query_terms allows, when such queries are rejected
+var ErrTooManyTerms = errors.New("search: query has more terms than max_query_terms allows")
+
+// What is done with a query longer than max_query_terms
+const (
+	// QueryTermsTruncate searches for its rarest terms only
+	QueryTermsTruncate = "truncate"
+	// QueryTermsReject answers it with 400 Bad Request
+	QueryTermsReject = "reject"
+)
+
+// rankedTermsFactor bounds the terms of a long query whose document
+// frequency is looked up to rank them, as a multiple of max_query_terms, so
+// that pasting a whole page does not cost a lookup per word. The terms past
+// them are dropped.
+const rankedTermsFactor = 4
+
+// limitTerms cuts the text of a query down to max_query_terms terms, and
+// returns the terms it left out. Repeated terms are left out first, then
+// terms found in no page and then the ones found in the most pages, which
+// tell pages apart the least; required (+) and excluded (-) terms are kept over the
+// others. Queries to reject keep their first terms. The terms kept stay in
+// the order they were written.
+func (s *Search) limitTerms(text, language string, literal bool) (string, []string) {
+	max := s.Config.MaxQueryTerms
+	words := indexer.QueryWords(text)
+	if max <= 0 || len(words) <= max {
+		return text, nil
+	}
+	if s.Config.MaxQueryTermsAction == QueryTermsReject {
+		return strings.Join(words[:max], " "), words[max:]
+	}
+
+	var candidates []int
+	seen := make(map[string]bool)
+	for i, word := range words {
+		if key := strings.ToLower(word); !seen[key] && len(candidates) < max*rankedTermsFactor {
+			seen[key] = true
+			candidates = append(candidates, i)
+		}
+	}
+
+	if len(candidates) > max {
+		frequency := make(map[int]uint64, len(candidates))
+		for _, i := range candidates {
+			frequency[i] = s.Indexer.DocFrequency(words[i], language)
+		}
+		operator := func(i int) bool {
+			return !literal && strings.ContainsAny(words[i][:1], "+-")
+		}
+		sort.SliceStable(candidates, func(a, b int) bool {
+			i, j := candidates[a], candidates[b]
+			if operator(i) != operator(j) {
+				return operator(i)
+			}
+			if (frequency[i] == 0) != (frequency[j] == 0) {
+				return frequency[j] == 0
+			}
+			return frequency[i] < frequency[j]
+		})
+		candidates = candidates[:max]
+		sort.Ints(candidates)
+	}
+
+	kept := make(map[int]bool, len(candidates))
+	for _, i := range candidates {
+		kept[i] = true
+	}
+	var keptWords, dropped []string
+	for i, word := range words {
+		if kept[i] {
+			keptWords = append(keptWords, word)
+		} else {
+			dropped = append(dropped, word)
+		}
+	}
+	return strings.Join(keptWords, " "), dropped
+}
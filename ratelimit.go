@@ -0,0 +1,158 @@
+package search
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBuckets bounds how many clients the rate limiter remembers
+const maxBuckets = 10000
+
+// rateLimiter is a per-client token bucket limiter. It remembers up to
+// maxBuckets clients, forgetting the one seen least recently to make room.
+type rateLimiter struct {
+	rate    float64 // tokens added per second
+	burst   float64 // bucket capacity
+	mutex   sync.Mutex
+	buckets map[string]*list.Element
+	order   *list.List // of *bucket, the most recently seen first
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// allow takes a token from the client's bucket. When the bucket is empty it
+// returns false and how long the client should wait for the next token.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var b *bucket
+	if elem, ok := l.buckets[key]; ok {
+		l.order.MoveToFront(elem)
+		b = elem.Value.(*bucket)
+	} else {
+		if l.order.Len() >= maxBuckets {
+			oldest := l.order.Back()
+			l.order.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*bucket).key)
+		}
+		b = &bucket{key: key, tokens: l.burst, last: now}
+		l.buckets[key] = l.order.PushFront(b)
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// limited reports whether a search request exceeds its client's rate,
+// setting the Retry-After header when it does. Authenticated callers are
+// never limited.
+func (s *Search) limited(w http.ResponseWriter, r *http.Request) bool {
+	if s.limiter == nil || s.authorized(r) {
+		return false
+	}
+
+	ok, wait := s.limiter.allow(s.clientKey(r), time.Now())
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	return !ok
+}
+
+// clientKey identifies the client of a request by the configured header, as
+// forwarded by a trusted proxy, or else by its IP address
+func (s *Search) clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if s.Config.SearchRateKey != "" && s.Config.trustedProxy(host) {
+		if key := r.Header.Get(s.Config.SearchRateKey); key != "" {
+			return key
+		}
+	}
+	return host
+}
+
+// trustedProxy reports whether search_rate_key may be read from requests
+// sent from host, never when no proxies are configured
+func (c *Config) trustedProxy(host string) bool {
+	ip := net.ParseIP(host)
+	for _, proxy := range c.SearchRateProxies {
+		if ip != nil && proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetwork parses an IP address, as a network of its own, or a CIDR
+// network such as `10.0.0.0/8`
+func parseNetwork(raw string) (*net.IPNet, error) {
+	if !strings.Contains(raw, "/") {
+		ip := net.ParseIP(raw)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", raw)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(raw)
+	return network, err
+}
+
+// parseRate parses a request rate such as `10r/s` or `600r/m` into requests
+// per second
+func parseRate(rate string) (float64, error) {
+	parts := strings.SplitN(rate, "r/", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid rate %q", rate)
+	}
+
+	n, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", rate)
+	}
+
+	switch parts[1] {
+	case "s":
+		return n, nil
+	case "m":
+		return n / 60, nil
+	case "h":
+		return n / 3600, nil
+	}
+	return 0, fmt.Errorf("invalid rate unit in %q", rate)
+}
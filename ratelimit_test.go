@@ -0,0 +1,106 @@
+package search_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimit(t *testing.T) {
+	Convey("Given a search endpoint limited to a burst of two requests", t, func() {
+		s, cleanup := newTestSearch(&search.Config{SearchRate: 0.5, SearchBurst: 2, Token: "secret"})
+		defer cleanup()
+
+		query := func(remoteAddr, token string) (int, http.Header) {
+			req := httptest.NewRequest("GET", "/search?q=test", nil)
+			req.RemoteAddr = remoteAddr
+			req.Header.Set("Accept", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			status, _ := s.ServeHTTP(w, req)
+			return status, w.Header()
+		}
+
+		Convey("Should reject the client once its burst is spent", func() {
+			status, _ := query("10.0.0.1:1234", "")
+			So(status, ShouldEqual, http.StatusOK)
+			status, _ = query("10.0.0.1:1235", "")
+			So(status, ShouldEqual, http.StatusOK)
+
+			status, header := query("10.0.0.1:1236", "")
+			So(status, ShouldEqual, http.StatusTooManyRequests)
+			So(header.Get("Retry-After"), ShouldEqual, "2")
+
+			Convey("Should keep serving other clients", func() {
+				status, _ := query("10.0.0.2:1234", "")
+				So(status, ShouldEqual, http.StatusOK)
+			})
+
+			Convey("Should exempt authenticated callers", func() {
+				status, _ := query("10.0.0.1:1237", "secret")
+				So(status, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+
+	Convey("Given a search endpoint limiting clients to a request now and then", t, func() {
+		s, cleanup := newTestSearch(&search.Config{SearchRate: 0.001, SearchBurst: 1})
+		defer cleanup()
+
+		query := func(remoteAddr string) int {
+			req := httptest.NewRequest("GET", "/search?q=", nil)
+			req.RemoteAddr = remoteAddr
+			status, _ := s.ServeHTTP(httptest.NewRecorder(), req)
+			return status
+		}
+
+		Convey("Should remember no more than 10000 clients, forgetting the least recent", func() {
+			So(query("10.0.0.1:1234"), ShouldEqual, http.StatusOK)
+			So(query("10.0.0.1:1234"), ShouldEqual, http.StatusTooManyRequests)
+
+			for i := 0; i < 10000; i++ {
+				if status := query(fmt.Sprintf("10.1.%d.%d:1234", i/256, i%256)); status != http.StatusOK {
+					So(status, ShouldEqual, http.StatusOK)
+				}
+			}
+
+			So(query("10.1.39.15:1234"), ShouldEqual, http.StatusTooManyRequests)
+			So(query("10.0.0.1:1234"), ShouldEqual, http.StatusOK)
+		})
+	})
+
+	Convey("Given a search endpoint limiting clients by a header its proxy sets", t, func() {
+		_, proxy, err := net.ParseCIDR("10.0.0.1/32")
+		So(err, ShouldBeNil)
+		s, cleanup := newTestSearch(&search.Config{SearchRate: 0.5, SearchBurst: 1, SearchRateKey: "X-Client",
+			SearchRateProxies: []*net.IPNet{proxy}})
+		defer cleanup()
+
+		query := func(remoteAddr, client string) int {
+			req := httptest.NewRequest("GET", "/search?q=test", nil)
+			req.RemoteAddr = remoteAddr
+			req.Header.Set("Accept", "application/json")
+			req.Header.Set("X-Client", client)
+			status, _ := s.ServeHTTP(httptest.NewRecorder(), req)
+			return status
+		}
+
+		Convey("Should tell clients apart by the header the proxy forwards", func() {
+			So(query("10.0.0.1:1234", "alice"), ShouldEqual, http.StatusOK)
+			So(query("10.0.0.1:1234", "bob"), ShouldEqual, http.StatusOK)
+			So(query("10.0.0.1:1234", "alice"), ShouldEqual, http.StatusTooManyRequests)
+		})
+
+		Convey("Should ignore the header on requests not sent by the proxy", func() {
+			So(query("10.0.0.9:1234", "alice"), ShouldEqual, http.StatusOK)
+			So(query("10.0.0.9:1234", "bob"), ShouldEqual, http.StatusTooManyRequests)
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// recentQueriesFactor is how many more queries than it suggests a
+	// RecentQueries keeps counting, so new queries can climb the list
+	recentQueriesFactor = 10
+	// minRecentClients is the number of distinct clients that must search a
+	// query before it is suggested, so a query only one visitor searched,
+	// however often, is never shown to others
+	minRecentClients = 2
+	// defaultRecentHalfLife is the half-life of the counts of recent_searches
+	defaultRecentHalfLife = 24 * time.Hour
+)
+
+// RecentQueries counts the queries searched lately that found something, to
+// suggest the most popular ones to an empty search box. Counts decay with
+// every half-life, so the list follows what visitors look for now.
+type RecentQueries struct {
+	mutex  sync.Mutex
+	size   int
+	counts *decayingCounts
+	// clients are hashes of the distinct clients that searched each counted
+	// query since it was last evicted, up to minRecentClients of them
+	clients map[string][]uint64
+}
+
+// NewRecentQueries creates RecentQueries suggesting up to size queries, whose
+// counts halve every halfLife
+func NewRecentQueries(size int, halfLife time.Duration) *RecentQueries {
+	return &RecentQueries{
+		size:    size,
+		counts:  newDecayingCounts(halfLife, size*recentQueriesFactor),
+		clients: make(map[string][]uint64),
+	}
+}
+
+// Record counts a search by client, a key identifying who searched, for text
+// that found the given number of results. Searches finding nothing are not
+// suggested.
+func (q *RecentQueries) Record(text, client string, results int, now time.Time) {
+	terms := analyticsTerms(text)
+	if terms == "" || results == 0 {
+		return
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if evicted, ok := q.counts.add(terms, now); ok {
+		delete(q.clients, evicted.(string))
+	}
+
+	clients := q.clients[terms]
+	if len(clients) >= minRecentClients {
+		return
+	}
+	h := fnv.New64a()
+	h.Write([]byte(client))
+	sum := h.Sum64()
+	for _, seen := range clients {
+		if seen == sum {
+			return
+		}
+	}
+	q.clients[terms] = append(clients, sum)
+}
+
+// Top returns up to limit of the most searched queries, most searched first,
+// leaving out those searched by fewer than minRecentClients clients
+func (q *RecentQueries) Top(limit int, now time.Time) []string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	type scored struct {
+		terms string
+		score float64
+	}
+	var top []scored
+	for terms, clients := range q.clients {
+		if len(clients) >= minRecentClients {
+			top = append(top, scored{terms, q.counts.get(terms, now)})
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].score != top[j].score {
+			return top[i].score > top[j].score
+		}
+		return top[i].terms < top[j].terms
+	})
+
+	if limit > q.size {
+		limit = q.size
+	}
+	var queries []string
+	for i := 0; i < len(top) && i < limit; i++ {
+		queries = append(queries, top[i].terms)
+	}
+	return queries
+}
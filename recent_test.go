@@ -0,0 +1,99 @@
+package search_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecentSearches(t *testing.T) {
+	Convey("Given a search suggesting the recent searches", t, func() {
+		s, cleanup := newTestSearch(&search.Config{RecentSearches: 2})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		searchAs := func(q, client string) {
+			req := httptest.NewRequest("GET", "/search?q="+q, nil)
+			req.Header.Set("Accept", "application/json")
+			req.RemoteAddr = client + ":1234"
+			s.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		for _, q := range []string{"install", "Install", "install", "guide", "guide", "amp", "nowhere", "nowhere"} {
+			searchAs(q, "192.0.2.1")
+		}
+		searchAs("install", "192.0.2.2")
+		searchAs("guide", "192.0.2.2")
+		searchAs("nowhere", "192.0.2.2")
+
+		suggestions := func() []string {
+			req := httptest.NewRequest("GET", "/search?instant=1&q=", nil)
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 200)
+
+			var resp struct {
+				Suggestions []string `json:"suggestions"`
+			}
+			So(json.Unmarshal(w.Body.Bytes(), &resp), ShouldBeNil)
+			return resp.Suggestions
+		}
+
+		Convey("Should suggest the most searched queries to an empty query", func() {
+			So(suggestions(), ShouldResemble, []string{"install", "guide"})
+		})
+
+		Convey("Should not suggest queries searched by a single client", func() {
+			for i := 0; i < 5; i++ {
+				searchAs("amp", "192.0.2.1")
+			}
+			So(suggestions(), ShouldResemble, []string{"install", "guide"})
+		})
+
+		Convey("Should not count instant searches", func() {
+			for i := 0; i < 3; i++ {
+				req := httptest.NewRequest("GET", "/search?instant=1&q=amp", nil)
+				s.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			So(suggestions(), ShouldResemble, []string{"install", "guide"})
+		})
+	})
+
+	Convey("Given searches made a while ago", t, func() {
+		recent := search.NewRecentQueries(5, time.Hour)
+		now := time.Now()
+		for i := 0; i < 4; i++ {
+			recent.Record("install", fmt.Sprint(i), 2, now.Add(-3*time.Hour))
+		}
+		recent.Record("plugins", "a", 1, now)
+		recent.Record("plugins", "b", 1, now)
+		recent.Record("typo", "a", 0, now)
+		recent.Record("typo", "b", 0, now)
+		recent.Record("once", "a", 1, now)
+
+		Convey("Should rank them below the searches made now", func() {
+			So(recent.Top(5, now), ShouldResemble, []string{"plugins", "install"})
+		})
+	})
+
+	Convey("Given more queries than are counted", t, func() {
+		recent := search.NewRecentQueries(1, time.Hour)
+		now := time.Now()
+		for i := 0; i < 10; i++ {
+			recent.Record(fmt.Sprintf("old%d", i), "a", 1, now.Add(-3*time.Hour))
+			recent.Record(fmt.Sprintf("old%d", i), "b", 1, now.Add(-3*time.Hour))
+		}
+		recent.Record("fresh", "a", 1, now)
+		recent.Record("fresh", "b", 1, now)
+
+		Convey("Should evict the least searched to count a new one", func() {
+			So(recent.Top(1, now), ShouldResemble, []string{"fresh"})
+		})
+	})
+}
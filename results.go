@@ -0,0 +1,320 @@
+package search
+
+import (
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// Debug explains how a result was ranked
+type Debug struct {
+	Score           float64  `json:",omitempty"` // relevance computed by the index
+	RecencyBoost    float64  `json:",omitempty"`
+	DepthBoost      float64  `json:",omitempty"`
+	PathBoost       float64  `json:",omitempty"`
+	ClickBoost      float64  `json:",omitempty"`
+	PriorityBoost   float64  `json:",omitempty"`
+	ExpressionBoost float64  `json:",omitempty"` // value of the score expression
+	TitleBoost      float64  `json:",omitempty"` // set when the title equals the query
+	FinalScore      float64  `json:",omitempty"`
+	Warnings        []string `json:",omitempty"`
+}
+
+// defaultExactTitleBoost multiplies the score of the pages whose title is the
+// query, enough to put them ahead of any other match
+const defaultExactTitleBoost = 100
+
+// defaultPositionDecay is the number of words after which a term weighs half
+// as much with position_decay
+const defaultPositionDecay = 200
+
+// PathBoost multiplies the score of the pages under a path prefix
+type PathBoost struct {
+	Prefix string
+	Factor float64
+}
+
+// rank applies the configured score adjustments and the pages' sitemap
+// priorities to the results of a query and orders them by their final score
+func (s *Search) rank(results []Result, query string, now time.Time) {
+	config := s.Config
+	if config.RecencyHalfLife <= 0 && config.DepthBoost <= 0 && len(config.PathBoosts) == 0 && s.Clicks == nil &&
+		config.ScoreExpression == nil && config.ExactTitleBoost <= 0 && !prioritized(results) {
+		return
+	}
+
+	exactQuery := ""
+	if config.ExactTitleBoost > 0 {
+		exactQuery = exactTitleKey(query)
+	}
+
+	for i := range results {
+		result := &results[i]
+
+		if config.RecencyHalfLife > 0 {
+			boost := recencyBoost(now.Sub(result.updated()), config.RecencyHalfLife, config.RecencyWeight)
+			result.Score *= boost
+			if result.Debug != nil {
+				result.Debug.RecencyBoost = boost
+			}
+		}
+
+		if config.DepthBoost > 0 {
+			boost := depthBoost(result.Path, config.DepthBoost)
+			result.Score *= boost
+			if result.Debug != nil {
+				result.Debug.DepthBoost = boost
+			}
+		}
+
+		if boost, ok := pathBoost(result.Path, config.PathBoosts); ok {
+			result.Score *= boost
+			if result.Debug != nil {
+				result.Debug.PathBoost = boost
+			}
+		}
+
+		if s.Clicks != nil {
+			boost := clickBoost(s.Clicks.Clicks(query, result.Path, now), config.ClickWeight)
+			result.Score *= boost
+			if result.Debug != nil {
+				result.Debug.ClickBoost = boost
+			}
+		}
+
+		if boost := priorityBoost(result.priority); boost != 1 {
+			result.Score *= boost
+			if result.Debug != nil {
+				result.Debug.PriorityBoost = boost
+			}
+		}
+
+		if config.ScoreExpression != nil {
+			boost := config.ScoreExpression.boost(s.scoreSignals(result, query, now))
+			result.Score *= boost
+			if result.Debug != nil {
+				result.Debug.ExpressionBoost = boost
+			}
+		}
+
+		if exactQuery != "" && exactTitleKey(result.Title) == exactQuery {
+			result.exactTitle = true
+			result.Score *= config.ExactTitleBoost
+			if result.Debug != nil {
+				result.Debug.TitleBoost = config.ExactTitleBoost
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score || !results[i].exactTitle || !results[j].exactTitle {
+			return results[i].Score > results[j].Score
+		}
+		// pages with the same title and score, such as copies of a page,
+		// list the shortest path first
+		if len(results[i].Path) != len(results[j].Path) {
+			return len(results[i].Path) < len(results[j].Path)
+		}
+		return results[i].Path < results[j].Path
+	})
+}
+
+// exactTitleKey returns the words of a title or plain query, in lowercase and
+// separated by single spaces, to tell a query naming a page by its exact
+// title. Queries with operators or field terms return "".
+func exactTitleKey(text string) string {
+	for _, word := range strings.Fields(text) {
+		if strings.HasPrefix(word, "+") || strings.HasPrefix(word, "-") || strings.Contains(word, ":") {
+			return ""
+		}
+	}
+	return strings.Join(strings.FieldsFunc(strings.ToLower(normalizeText(text)), notWordRune), " ")
+}
+
+// scoreSignals returns the signals the score expression reads for a result
+func (s *Search) scoreSignals(result *Result, query string, now time.Time) *scoreSignals {
+	signals := &scoreSignals{
+		depth:    float64(pathDepth(result.Path)),
+		ageDays:  now.Sub(result.updated()).Hours() / 24,
+		priority: result.priority,
+	}
+	if signals.priority < 0 || signals.priority > 1 {
+		signals.priority = indexer.DefaultPriority
+	}
+	if s.Clicks != nil {
+		signals.clicks = s.Clicks.Clicks(query, result.Path, now)
+	}
+	if len(result.TitleHighlights) > 0 {
+		signals.titleMatch = 1
+	}
+	return signals
+}
+
+// updated returns when the result's page last changed, as far as is known
+func (r *Result) updated() time.Time {
+	if r.Modified.IsZero() {
+		return r.Indexed
+	}
+	return r.Modified
+}
+
+// prioritized reports whether any of the results has a sitemap priority
+// other than the default
+func prioritized(results []Result) bool {
+	for _, result := range results {
+		if priorityBoost(result.priority) != 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// priorityBoost returns the score multiplier of a page with the given sitemap
+// priority: 1 for the default priority of 0.5, from 0.5 for priority 0 up to
+// 1.5 for priority 1
+func priorityBoost(priority float64) float64 {
+	if priority < 0 || priority > 1 {
+		return 1
+	}
+	return 0.5 + priority
+}
+
+// depthBoost returns the score multiplier of a page at the given URL path:
+// 1+weight at the top level, 1+weight/2 one directory down and so on. An
+// index page counts as its directory.
+func depthBoost(page string, weight float64) float64 {
+	return 1 + weight/float64(pathDepth(page))
+}
+
+// pathDepth returns the number of directories in a URL path, at least 1. An
+// index page counts as its directory.
+func pathDepth(page string) int {
+	if i := strings.IndexAny(page, "?#"); i >= 0 {
+		page = page[:i]
+	}
+	page = strings.TrimSuffix(path.Clean("/"+page), "/index.html")
+
+	depth := strings.Count(page, "/")
+	if depth < 1 {
+		depth = 1
+	}
+	return depth
+}
+
+// pathBoost returns the factor of the longest boosted prefix of a page's path
+func pathBoost(page string, boosts []PathBoost) (float64, bool) {
+	factor, longest := 1.0, -1
+	for _, boost := range boosts {
+		if httpserver.Path(page).Matches(boost.Prefix) && len(boost.Prefix) > longest {
+			factor, longest = boost.Factor, len(boost.Prefix)
+		}
+	}
+	return factor, longest >= 0
+}
+
+// recencyBoost returns the score multiplier of a page updated age ago: 1+weight
+// for a page updated just now, decaying towards 1 with every halfLife
+func recencyBoost(age, halfLife time.Duration, weight float64) float64 {
+	if age < 0 {
+		age = 0
+	}
+	return 1 + weight*math.Exp2(-age.Seconds()/halfLife.Seconds())
+}
+
+// resolveRedirects points results at the paths their pages have moved to,
+// with the configured trailing slash, dropping results for a page that is
+// already listed
+func (s *Search) resolveRedirects(results []Result) []Result {
+	resolved := results[:0]
+	seen := make(map[string]bool, len(results))
+
+	for _, result := range results {
+		if to, ok := s.Pipeline.Redirected(result.Path); ok {
+			result.Path = to
+		}
+		result.Path = s.Config.slashPath(result.Path)
+		if seen[result.Path] {
+			continue
+		}
+		seen[result.Path] = true
+		resolved = append(resolved, result)
+	}
+
+	return resolved
+}
+
+// dedupeTitles collapses results sharing a normalized title into the first
+// (highest ranked) of them, listing the other paths as its alternates
+func dedupeTitles(results []Result) []Result {
+	deduped := results[:0]
+	seen := make(map[string]int, len(results))
+
+	for _, result := range results {
+		key := titleKey(result.Title)
+		if key == "" {
+			deduped = append(deduped, result)
+			continue
+		}
+
+		if i, ok := seen[key]; ok {
+			deduped[i].Alternates = append(deduped[i].Alternates, result.Path)
+			continue
+		}
+
+		seen[key] = len(deduped)
+		deduped = append(deduped, result)
+	}
+
+	return deduped
+}
+
+// diversify reorders ranked results so that no more than run consecutive
+// ones share the same section, the longest of prefixes their path starts
+// with. A result that would lengthen such a run waits for the next
+// best-ranked one from elsewhere; once only its section is left, the rest
+// follow in rank order. Results outside every prefix are never held back.
+func diversify(results []Result, prefixes []string, run int) []Result {
+	sections := make([]string, len(results))
+	for i, result := range results {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(result.Path, prefix) && len(prefix) > len(sections[i]) {
+				sections[i] = prefix
+			}
+		}
+	}
+
+	diversified := make([]Result, 0, len(results))
+	placed := make([]bool, len(results))
+	last, length := "", 0
+
+	for len(diversified) < len(results) {
+		next := -1
+		for i := range results {
+			if placed[i] {
+				continue
+			}
+			if next < 0 {
+				next = i
+			}
+			if sections[i] == "" || sections[i] != last || length < run {
+				next = i
+				break
+			}
+		}
+
+		placed[next] = true
+		diversified = append(diversified, results[next])
+		if sections[next] != "" && sections[next] == last {
+			length++
+		} else {
+			last, length = sections[next], 1
+		}
+	}
+
+	return diversified
+}
@@ -0,0 +1,448 @@
+package search_test
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDedupeTitles(t *testing.T) {
+	Convey("Given two pages with the same title under different paths", t, func() {
+		Convey("Should list both when deduplication is off", func() {
+			s, cleanup := newTestSearch(&search.Config{})
+			defer cleanup()
+			indexFixture(s, "install.html")
+			indexFixture(s, "amp/install.html")
+
+			So(searchJSON(s, "install"), ShouldHaveLength, 2)
+		})
+
+		Convey("Should collapse them into the best ranked one when deduplication is on", func() {
+			s, cleanup := newTestSearch(&search.Config{DedupeTitles: true})
+			defer cleanup()
+			indexFixture(s, "install.html")
+			indexFixture(s, "amp/install.html")
+
+			results := searchJSON(s, "install")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/install.html")
+			So(results[0].Alternates, ShouldResemble, []string{"/amp/install.html"})
+		})
+	})
+}
+
+func TestDedupeURLs(t *testing.T) {
+	Convey("Given copies of a page indexed under tracking parameters", t, func() {
+		paths := func(config *search.Config) map[string][]string {
+			s, cleanup := newTestSearch(config)
+			defer cleanup()
+			pages := []string{"/shoes.html?utm_source=mail", "/shoes.html?size=42&utm_source=feed", "/shoes.html?size=42", "/boots.html"}
+			for i, path := range pages {
+				rec := s.Indexer.Record(path)
+				rec.SetTitle("Trail shoes " + strings.Repeat("x", i))
+				rec.Write([]byte("Trail shoes for muddy descents"))
+				s.Indexer.Pipe(rec)
+			}
+			for i := 0; i < 100 && len(searchJSON(s, "muddy")) < len(pages); i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			found := map[string][]string{}
+			for _, result := range searchJSON(s, "muddy") {
+				page := strings.Split(result.Path, "?")[0]
+				found[page] = append(found[page], result.Path)
+				found["alternates"] = append(found["alternates"], result.Alternates...)
+			}
+			return found
+		}
+
+		Convey("Should list every copy by default", func() {
+			found := paths(&search.Config{CrawlIgnoreParams: []string{"utm_*"}})
+			So(found["/shoes.html"], ShouldHaveLength, 3)
+			So(found["alternates"], ShouldBeEmpty)
+		})
+
+		Convey("Should collapse the copies differing only by ignored parameters", func() {
+			found := paths(&search.Config{CrawlIgnoreParams: []string{"utm_*"}, DedupeURLs: true})
+			So(found["/shoes.html"], ShouldHaveLength, 2)
+			So(found["/boots.html"], ShouldHaveLength, 1)
+			So(found["alternates"], ShouldHaveLength, 1)
+		})
+	})
+}
+
+func TestDistinctTitles(t *testing.T) {
+	Convey("Given pages sharing a title in different directories", t, func() {
+		titles := func(config *search.Config) map[string]string {
+			s, cleanup := newTestSearch(config)
+			defer cleanup()
+			indexFixture(s, "install.html")
+			indexFixture(s, "amp/install.html")
+			indexFixture(s, "docs/v2/install.html")
+
+			titles := map[string]string{}
+			for _, result := range searchJSON(s, "install") {
+				titles[result.Path] = strings.Join(strings.Fields(result.Title), " ")
+			}
+			return titles
+		}
+
+		Convey("Should append the directory of each page", func() {
+			So(titles(&search.Config{DistinctTitles: search.DistinctTitleDirectory}), ShouldResemble, map[string]string{
+				"/install.html":         "Install Guide (/)",
+				"/amp/install.html":     "install guide (amp)",
+				"/docs/v2/install.html": "Install Guide (v2)",
+			})
+		})
+
+		Convey("Should append the path of each page", func() {
+			result := titles(&search.Config{DistinctTitles: search.DistinctTitlePath})
+			So(result["/amp/install.html"], ShouldEqual, "install guide (/amp/install.html)")
+		})
+
+		Convey("Should leave the titles alone when disabled", func() {
+			So(titles(&search.Config{})["/install.html"], ShouldEqual, "Install Guide")
+		})
+	})
+}
+
+func TestPriorityBoost(t *testing.T) {
+	Convey("Given a relevant page and a less relevant one", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+
+		index := func(name string, priority float64) {
+			fullPath, _ := filepath.Abs(filepath.Join("testdata", name))
+			rec := s.Indexer.Record("/" + name)
+			rec.SetFullPath(fullPath)
+			rec.SetPriority(priority)
+			s.Pipeline.Pipe(rec)
+			for i := 0; i < 100 && !s.Indexer.Record("/"+name).Load(); i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		Convey("Should let the page a sitemap declares important outrank the other", func() {
+			index("install.html", 0.1)
+			index("amp/install.html", 1)
+
+			results := searchJSONParams(s, url.Values{"q": {"install"}, "debug": {"1"}})
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Path, ShouldEqual, "/amp/install.html")
+			So(results[0].Debug.PriorityBoost, ShouldEqual, 1.5)
+			So(results[1].Debug.PriorityBoost, ShouldEqual, 0.6)
+		})
+
+		Convey("Should leave pages with the default priority as they are", func() {
+			index("install.html", 0.5)
+			index("amp/install.html", 0.5)
+
+			results := searchJSONParams(s, url.Values{"q": {"install"}, "debug": {"1"}})
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Path, ShouldEqual, "/install.html")
+			So(results[0].Debug.PriorityBoost, ShouldEqual, 0)
+			So(results[1].Debug.PriorityBoost, ShouldEqual, 0)
+		})
+	})
+}
+
+func TestRecencyBoost(t *testing.T) {
+	Convey("Given a relevant but stale page and a less relevant recent one", t, func() {
+		index := func(s *search.Search) {
+			indexFixtureModified(s, "install.html", time.Now().AddDate(-1, 0, 0))
+			indexFixtureModified(s, "amp/install.html", time.Now())
+		}
+
+		Convey("Should rank by relevance alone without a recency boost", func() {
+			s, cleanup := newTestSearch(&search.Config{})
+			defer cleanup()
+			index(s)
+
+			results := searchJSON(s, "install")
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Path, ShouldEqual, "/install.html")
+			So(results[0].Debug, ShouldBeNil)
+		})
+
+		Convey("Should let the recent page outrank the stale one with a recency boost", func() {
+			s, cleanup := newTestSearch(&search.Config{RecencyHalfLife: 24 * time.Hour, RecencyWeight: 10})
+			defer cleanup()
+			index(s)
+
+			results := searchJSON(s, "install")
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Path, ShouldEqual, "/amp/install.html")
+		})
+
+		Convey("Should expose the applied boost in debug output", func() {
+			s, cleanup := newTestSearch(&search.Config{RecencyHalfLife: 24 * time.Hour, RecencyWeight: 10})
+			defer cleanup()
+			index(s)
+
+			results := searchJSONParams(s, url.Values{"q": {"install"}, "debug": {"1"}})
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Debug, ShouldNotBeNil)
+			So(results[0].Debug.RecencyBoost, ShouldAlmostEqual, 11, 0.01)
+			So(results[0].Debug.FinalScore, ShouldAlmostEqual, results[0].Debug.Score*results[0].Debug.RecencyBoost)
+			So(results[1].Debug.RecencyBoost, ShouldAlmostEqual, 1, 0.01)
+		})
+	})
+}
+
+func TestSnippetStrategy(t *testing.T) {
+	Convey("Given a page with a meta description", t, func() {
+		Convey("Should show the description with the meta strategy", func() {
+			s, cleanup := newTestSearch(&search.Config{SnippetStrategy: "meta"})
+			defer cleanup()
+			indexFixture(s, "container.html")
+
+			results := searchJSON(s, "incremental")
+			So(results, ShouldHaveLength, 1)
+			So(string(results[0].Body), ShouldEqual, "What changed in version 2.0.")
+		})
+
+		Convey("Should show the page's text with the leading strategy", func() {
+			s, cleanup := newTestSearch(&search.Config{SnippetStrategy: "leading"})
+			defer cleanup()
+			indexFixture(s, "container.html")
+
+			results := searchJSON(s, "incremental")
+			So(results, ShouldHaveLength, 1)
+			So(string(results[0].Body), ShouldContainSubstring, "<mark>incremental</mark>")
+		})
+	})
+}
+
+func TestExcerptSource(t *testing.T) {
+	Convey("Given pages with authored previews", t, func() {
+		s, cleanup := newTestSearch(&search.Config{ExcerptSources: []string{"frontmatter", "meta", "generated"}})
+		defer cleanup()
+		indexFixture(s, "frontmatter.md")
+		indexFixture(s, "container.html")
+		indexFixture(s, "install.html")
+
+		Convey("Should prefer the front matter's excerpt", func() {
+			results := searchJSON(s, "markdown")
+			So(results, ShouldHaveLength, 1)
+			So(string(results[0].Body), ShouldEqual, "Front matter gives <mark>Markdown</mark> files a title and a preview.")
+		})
+
+		Convey("Should fall back to the meta description", func() {
+			results := searchJSON(s, "incremental")
+			So(results, ShouldHaveLength, 1)
+			So(string(results[0].Body), ShouldEqual, "What changed in version 2.0.")
+		})
+
+		Convey("Should generate a snippet for pages without either", func() {
+			results := searchJSON(s, "install")
+			So(results, ShouldNotBeEmpty)
+			So(string(results[0].Body), ShouldContainSubstring, "<mark>")
+		})
+	})
+}
+
+func TestTrailingSlashResults(t *testing.T) {
+	Convey("Given a page indexed with and without a trailing slash", t, func() {
+		s, cleanup := newTestSearch(&search.Config{TrailingSlash: "strip"})
+		defer cleanup()
+		for _, path := range []string{"/guide/", "/guide"} {
+			rec := s.Indexer.Record(path)
+			rec.Write([]byte("Install the guide"))
+			s.Indexer.Pipe(rec)
+			for i := 0; i < 100 && !s.Indexer.Record(path).Load(); i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		Convey("Should list it once, with the configured slash", func() {
+			results := searchJSON(s, "guide")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/guide")
+		})
+	})
+}
+
+func TestPathBoosts(t *testing.T) {
+	Convey("Given a top-level page and a nested copy", t, func() {
+		debugSearch := func(config *search.Config) []search.Result {
+			s, cleanup := newTestSearch(config)
+			defer cleanup()
+			indexFixture(s, "install.html")
+			indexFixture(s, "amp/install.html")
+
+			results := searchJSONParams(s, url.Values{"q": {"install"}, "debug": {"1"}})
+			So(results, ShouldHaveLength, 2)
+			return results
+		}
+
+		Convey("Should boost pages inversely to their depth", func() {
+			results := debugSearch(&search.Config{DepthBoost: 1})
+			So(results[0].Path, ShouldEqual, "/install.html")
+			So(results[0].Debug.DepthBoost, ShouldEqual, 2)
+			So(results[1].Debug.DepthBoost, ShouldEqual, 1.5)
+		})
+
+		Convey("Should boost pages under a configured prefix", func() {
+			results := debugSearch(&search.Config{PathBoosts: []search.PathBoost{
+				{Prefix: "/", Factor: 0.5},
+				{Prefix: "/amp", Factor: 10},
+			}})
+			So(results[0].Path, ShouldEqual, "/amp/install.html")
+			So(results[0].Debug.PathBoost, ShouldEqual, 10)
+			So(results[1].Debug.PathBoost, ShouldEqual, 0.5)
+			So(results[0].Score, ShouldAlmostEqual, results[0].Debug.Score*10)
+		})
+	})
+}
+
+func TestScoreExpression(t *testing.T) {
+	Convey("Given a score expression", t, func() {
+		expr := func(source string) *search.ScoreExpression {
+			e, err := search.ParseScoreExpression(source)
+			So(err, ShouldBeNil)
+			return e
+		}
+
+		Convey("Should multiply the scores by its value for each result", func() {
+			s, cleanup := newTestSearch(&search.Config{ScoreExpression: expr("1 + 4 * (depth - 1)")})
+			defer cleanup()
+			indexFixture(s, "install.html")
+			indexFixture(s, "amp/install.html")
+
+			results := searchJSONParams(s, url.Values{"q": {"install"}, "debug": {"1"}})
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Path, ShouldEqual, "/amp/install.html")
+			So(results[0].Debug.ExpressionBoost, ShouldEqual, 5)
+			So(results[0].Score, ShouldAlmostEqual, results[0].Debug.Score*5)
+			So(results[1].Debug.ExpressionBoost, ShouldEqual, 1)
+		})
+
+		Convey("Should leave the score of results it gives no positive value", func() {
+			s, cleanup := newTestSearch(&search.Config{ScoreExpression: expr("min(-depth, log(0))")})
+			defer cleanup()
+			indexFixture(s, "install.html")
+
+			results := searchJSONParams(s, url.Values{"q": {"install"}, "debug": {"1"}})
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Score, ShouldEqual, results[0].Debug.Score)
+		})
+
+		Convey("Should reject unknown names and malformed formulas", func() {
+			for _, source := range []string{"1 + age", "exec(1)", "max(1)", "(depth", "depth +", "2 ** depth", "1..2"} {
+				_, err := search.ParseScoreExpression(source)
+				So(err, ShouldNotBeNil)
+			}
+			_, err := search.ParseScoreExpression(strings.Repeat("(", 20) + "1" + strings.Repeat(")", 20))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDiversify(t *testing.T) {
+	Convey("Given a section outranking the other pages of the site", t, func() {
+		diversified := func(config *search.Config) []string {
+			config.PathBoosts = []search.PathBoost{{Prefix: "/catalog/", Factor: 10}}
+			s, cleanup := newTestSearch(config)
+			defer cleanup()
+			indexFixture(s, "catalog/lamp.html")
+			indexFixture(s, "catalog/chair.html")
+			indexFixture(s, "catalog/shelf.html")
+			indexFixture(s, "blog/home-office.html")
+
+			paths := []string{}
+			for _, result := range searchJSON(s, "furniture") {
+				paths = append(paths, result.Path)
+			}
+			So(paths, ShouldHaveLength, 4)
+			return paths
+		}
+
+		Convey("Should list the section first without diversification", func() {
+			paths := diversified(&search.Config{})
+			So(paths[3], ShouldEqual, "/blog/home-office.html")
+		})
+
+		Convey("Should interleave other pages after a run of the section", func() {
+			paths := diversified(&search.Config{DiversifyRun: 2, DiversifyPrefixes: []string{"/catalog/"}})
+			So(paths[2], ShouldEqual, "/blog/home-office.html")
+			So(paths[3], ShouldStartWith, "/catalog/")
+		})
+	})
+}
+
+func TestExactTitleBoost(t *testing.T) {
+	Convey("Given pages titled as a query", t, func() {
+		debugSearch := func(config *search.Config, q string) []search.Result {
+			s, cleanup := newTestSearch(config)
+			defer cleanup()
+			indexFixture(s, "install.html")
+			indexFixture(s, "amp/install.html")
+
+			return searchJSONParams(s, url.Values{"q": {q}, "debug": {"1"}})
+		}
+
+		Convey("Should boost the pages whose title is the query", func() {
+			results := debugSearch(&search.Config{ExactTitleBoost: 100}, "  install GUIDE ")
+			So(results, ShouldHaveLength, 2)
+			for _, result := range results {
+				So(result.Debug.TitleBoost, ShouldEqual, 100)
+				So(result.Score, ShouldAlmostEqual, result.Debug.Score*100)
+			}
+		})
+
+		Convey("Should leave other queries alone", func() {
+			for _, q := range []string{"install", "install guide -theme", "Title:install guide"} {
+				for _, result := range debugSearch(&search.Config{ExactTitleBoost: 100}, q) {
+					So(result.Debug.TitleBoost, ShouldEqual, 0)
+				}
+			}
+		})
+	})
+}
+
+func TestPositionDecay(t *testing.T) {
+	Convey("Given pages mentioning the query at their top and at their end", t, func() {
+		filler := strings.Repeat("lorem ipsum dolor sit amet ", 80)
+		pages := map[string]string{
+			"/early.html": "The gateway routes requests. " + filler,
+			"/late.html":  filler + "The gateway routes requests.",
+		}
+		scores := func(config *search.Config) map[string]float64 {
+			s, cleanup := newTestSearch(config)
+			defer cleanup()
+			for path, body := range pages {
+				rec := s.Indexer.Record(path)
+				rec.SetTitle("Page")
+				rec.Write([]byte(body))
+				s.Indexer.Pipe(rec)
+			}
+
+			scores := map[string]float64{}
+			for i := 0; i < 100 && len(scores) < len(pages); i++ {
+				time.Sleep(10 * time.Millisecond)
+				scores = map[string]float64{}
+				for _, result := range searchJSON(s, "gateway") {
+					scores[result.Path] = result.Score
+				}
+			}
+			return scores
+		}
+
+		Convey("Should score them alike by default", func() {
+			found := scores(&search.Config{})
+			So(found, ShouldHaveLength, 2)
+			So(found["/early.html"], ShouldAlmostEqual, found["/late.html"])
+		})
+
+		Convey("Should favour the page mentioning it first with position_decay", func() {
+			found := scores(&search.Config{PositionDecay: 50})
+			So(found, ShouldHaveLength, 2)
+			So(found["/early.html"], ShouldBeGreaterThan, 1.9*found["/late.html"])
+		})
+	})
+}
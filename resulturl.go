@@ -0,0 +1,61 @@
+package search
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// resultURLData is what a result_url template is executed with
+type resultURLData struct {
+	Path     string // the page's path without its query, as in /docs/install.html
+	RawQuery string // the query of the page's path, without the ?
+	Title    string
+	Query    string // the query the page was found for, empty when browsing
+}
+
+// parseResultURL parses a result_url template and checks that it renders a
+// URL for a sample result
+func parseResultURL(text string) (*template.Template, error) {
+	tmpl, err := template.New("result_url").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := resultURLData{Path: "/docs/install.html", RawQuery: "page=2", Title: "Install", Query: "install"}
+	if _, err := renderResultURL(tmpl, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderResultURL executes a result_url template and checks that it
+// rendered a URL
+func renderResultURL(tmpl *template.Template, data resultURLData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	link := strings.TrimSpace(buf.String())
+	if _, err := url.Parse(link); err != nil {
+		return "", err
+	}
+	return link, nil
+}
+
+// resultURLs sets the link of every result with the result_url template, or
+// leaves it to the path of those it fails to render a URL for
+func (s *Search) resultURLs(results []Result, query string) {
+	if s.Config.ResultURL == nil {
+		return
+	}
+	for i := range results {
+		data := resultURLData{Path: results[i].Path, Title: results[i].Title, Query: query}
+		if j := strings.Index(data.Path, "?"); j >= 0 {
+			data.Path, data.RawQuery = data.Path[:j], data.Path[j+1:]
+		}
+		if link, err := renderResultURL(s.Config.ResultURL, data); err == nil && link != "" {
+			results[i].URL = link
+		}
+	}
+}
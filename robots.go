@@ -0,0 +1,98 @@
+package search
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// robotsHeader carries the robots directives of a response
+const robotsHeader = "X-Robots-Tag"
+
+// robotsNoindex reports whether robots directives, as in "noindex, nofollow",
+// forbid indexing a page
+func robotsNoindex(values []string) bool {
+	return robotsDirective(values, "noindex")
+}
+
+// robotsNofollow reports whether robots directives forbid following the
+// links of a page
+func robotsNofollow(values []string) bool {
+	return robotsDirective(values, "nofollow")
+}
+
+// robotsDirective reports whether robots directives hold directive, or
+// "none", which stands for both noindex and nofollow. Each value may address a
+// single crawler by name, as in "otherbot: noindex"; those addressed to
+// another crawler are ignored.
+func robotsDirective(values []string, directive string) bool {
+	for _, value := range values {
+		if i := strings.Index(value, ":"); i >= 0 && !strings.Contains(value[:i], ",") && !robotsValueDirective(value[:i]) {
+			if !strings.EqualFold(strings.TrimSpace(value[:i]), crawlUserAgent) {
+				continue
+			}
+			value = value[i+1:]
+		}
+
+		for _, name := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case directive, "none":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// robotsValueDirective reports whether name is a directive taking a value
+// after a colon, as in "unavailable_after: 2030-01-01", rather than the name
+// of a crawler
+func robotsValueDirective(name string) bool {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "unavailable_after", "max-snippet", "max-image-preview", "max-video-preview":
+		return true
+	}
+	return false
+}
+
+// headerNoindex reports whether a response's X-Robots-Tag headers forbid
+// indexing it
+func headerNoindex(header http.Header) bool {
+	return robotsNoindex(header[robotsHeader])
+}
+
+// headerNofollow reports whether a response's X-Robots-Tag headers forbid
+// following its links
+func headerNofollow(header http.Header) bool {
+	return robotsNofollow(header[robotsHeader])
+}
+
+// htmlNoindex reports whether the page's robots meta tags, and those
+// addressed to this crawler by name, forbid indexing it
+func htmlNoindex(doc *html.Node) bool {
+	return robotsNoindex(htmlRobots(doc))
+}
+
+// htmlNofollow reports whether the page's robots meta tags forbid following
+// its links
+func htmlNofollow(doc *html.Node) bool {
+	return robotsNofollow(htmlRobots(doc))
+}
+
+// htmlRobots returns the content of the page's robots meta tags, and of
+// those addressed to this crawler by name
+func htmlRobots(doc *html.Node) []string {
+	directives := []string{}
+	findElement(doc, func(n *html.Node) bool {
+		if n.DataAtom == atom.Meta {
+			name := strings.TrimSpace(attr(n, "name"))
+			if strings.EqualFold(name, "robots") || strings.EqualFold(name, crawlUserAgent) {
+				directives = append(directives, attr(n, "content"))
+			}
+		}
+		return false
+	})
+	return directives
+}
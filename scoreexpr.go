@@ -0,0 +1,261 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxScoreExprLength bounds the length of a score expression
+	maxScoreExprLength = 256
+	// maxScoreExprDepth bounds the nesting of parentheses and calls in a
+	// score expression
+	maxScoreExprDepth = 16
+)
+
+// scoreSignals are the properties of a result a score expression reads
+type scoreSignals struct {
+	depth      float64 // directories in the result's path
+	ageDays    float64 // days since the page was modified, or indexed
+	priority   float64 // sitemap priority, 0.5 unless the sitemap sets one
+	clicks     float64 // decayed clicks on the result for the query
+	titleMatch float64 // 1 when the query matches the result's title
+}
+
+// scoreVariables are the names a score expression refers to signals by
+var scoreVariables = map[string]func(*scoreSignals) float64{
+	"depth":       func(s *scoreSignals) float64 { return s.depth },
+	"age_days":    func(s *scoreSignals) float64 { return s.ageDays },
+	"priority":    func(s *scoreSignals) float64 { return s.priority },
+	"clicks":      func(s *scoreSignals) float64 { return s.clicks },
+	"title_match": func(s *scoreSignals) float64 { return s.titleMatch },
+}
+
+// scoreFunctions are the functions a score expression may call, by name and
+// number of arguments
+var scoreFunctions = map[string]struct {
+	args int
+	call func(args []float64) float64
+}{
+	"min":  {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":  {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+	"log":  {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"sqrt": {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"pow":  {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+}
+
+// ScoreExpression is an arithmetic formula over the signals of a result,
+// such as `1 + 0.5 * title_match - 0.1 * depth`, whose value multiplies the
+// result's score. It is made of numbers, the signal variables, the + - * /
+// operators, parentheses and the min, max, log, sqrt and pow functions.
+type ScoreExpression struct {
+	source string
+	eval   func(*scoreSignals) float64
+}
+
+// ParseScoreExpression parses a score expression, reporting the first
+// unknown name or syntax error in it
+func ParseScoreExpression(source string) (*ScoreExpression, error) {
+	if len(source) > maxScoreExprLength {
+		return nil, fmt.Errorf("longer than %d characters", maxScoreExprLength)
+	}
+
+	p := &scoreParser{src: source}
+	eval, err := p.expr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:p.pos+1])
+	}
+
+	return &ScoreExpression{source: source, eval: eval}, nil
+}
+
+// String returns the source of the expression
+func (e *ScoreExpression) String() string {
+	return e.source
+}
+
+// boost returns the multiplier of a result with the given signals. Results
+// the expression gives no finite, positive value keep their score.
+func (e *ScoreExpression) boost(signals *scoreSignals) float64 {
+	value := e.eval(signals)
+	if math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 {
+		return 1
+	}
+	return value
+}
+
+// scoreParser parses score expressions by recursive descent, building the
+// function that evaluates each part
+type scoreParser struct {
+	src string
+	pos int
+}
+
+func (p *scoreParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at character %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *scoreParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// next consumes the operator or punctuation c if it comes next
+func (p *scoreParser) next(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expr parses a sum of terms
+func (p *scoreParser) expr(depth int) (func(*scoreSignals) float64, error) {
+	if depth > maxScoreExprDepth {
+		return nil, p.errorf("nested deeper than %d levels", maxScoreExprDepth)
+	}
+
+	left, err := p.term(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.next('+'):
+			right, err := p.term(depth)
+			if err != nil {
+				return nil, err
+			}
+			l := left
+			left = func(s *scoreSignals) float64 { return l(s) + right(s) }
+		case p.next('-'):
+			right, err := p.term(depth)
+			if err != nil {
+				return nil, err
+			}
+			l := left
+			left = func(s *scoreSignals) float64 { return l(s) - right(s) }
+		default:
+			return left, nil
+		}
+	}
+}
+
+// term parses a product of factors
+func (p *scoreParser) term(depth int) (func(*scoreSignals) float64, error) {
+	left, err := p.factor(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.next('*'):
+			right, err := p.factor(depth)
+			if err != nil {
+				return nil, err
+			}
+			l := left
+			left = func(s *scoreSignals) float64 { return l(s) * right(s) }
+		case p.next('/'):
+			right, err := p.factor(depth)
+			if err != nil {
+				return nil, err
+			}
+			l := left
+			left = func(s *scoreSignals) float64 { return l(s) / right(s) }
+		default:
+			return left, nil
+		}
+	}
+}
+
+// factor parses a number, a variable, a call, a parenthesized expression or
+// the negation of a factor
+func (p *scoreParser) factor(depth int) (func(*scoreSignals) float64, error) {
+	if p.next('-') {
+		operand, err := p.factor(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *scoreSignals) float64 { return -operand(s) }, nil
+	}
+
+	if p.next('(') {
+		inner, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.next(')') {
+			return nil, p.errorf("missing )")
+		}
+		return inner, nil
+	}
+
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && scoreWordByte(p.src[p.pos]) {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+
+	switch {
+	case word == "":
+		if p.pos == len(p.src) {
+			return nil, p.errorf("unexpected end")
+		}
+		return nil, p.errorf("unexpected %q", p.src[p.pos:p.pos+1])
+	case word[0] == '.' || word[0] >= '0' && word[0] <= '9':
+		value, err := strconv.ParseFloat(word, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", word)
+		}
+		return func(*scoreSignals) float64 { return value }, nil
+	}
+
+	name := strings.ToLower(word)
+	if variable, ok := scoreVariables[name]; ok {
+		return variable, nil
+	}
+
+	function, ok := scoreFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown name %q", word)
+	}
+	if !p.next('(') {
+		return nil, p.errorf("missing ( after %s", word)
+	}
+	args := make([]func(*scoreSignals) float64, function.args)
+	for i := range args {
+		if i > 0 && !p.next(',') {
+			return nil, fmt.Errorf("%s takes %d arguments", name, function.args)
+		}
+		arg, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+	if !p.next(')') {
+		return nil, fmt.Errorf("%s takes %d arguments", name, function.args)
+	}
+
+	return func(s *scoreSignals) float64 {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			values[i] = arg(s)
+		}
+		return function.call(values)
+	}, nil
+}
+
+// scoreWordByte reports whether c belongs to a number or a name
+func scoreWordByte(c byte) bool {
+	return c == '.' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
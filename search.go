@@ -3,8 +3,14 @@ package search
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"html/template"
+	"io"
+	"log"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -17,22 +23,121 @@ type Search struct {
 	*Config
 	Indexer indexer.Handler
 	*Pipeline
+	Analytics *Analytics
+	Clicks    *ClickCounts
+	// RecentQueries suggests the popular recent searches to an empty
+	// instant search
+	RecentQueries *RecentQueries
+	Crawler       *Crawler
+	limiter       *rateLimiter
+	queries       *queryLimiter
+	ready         int32
+}
+
+// NewSearch creates the middleware for the given configuration, indexer and
+// pipeline
+func NewSearch(config *Config, index indexer.Handler, ppl *Pipeline) *Search {
+	s := &Search{
+		Config:   config,
+		Indexer:  index,
+		Pipeline: ppl,
+	}
+
+	if config.SearchRate > 0 {
+		s.limiter = newRateLimiter(config.SearchRate, config.SearchBurst)
+	}
+
+	if config.MaxConcurrentQueries > 0 {
+		s.queries = newQueryLimiter(config.MaxConcurrentQueries, config.QueryQueueTimeout)
+	}
+
+	if config.AnalyticsEndpoint != "" {
+		s.Analytics = NewAnalytics(nil)
+	}
+
+	if config.ClickHalfLife > 0 {
+		s.Clicks = NewClickCounts(config.ClickHalfLife)
+	}
+
+	if config.RecentSearches > 0 {
+		s.RecentQueries = NewRecentQueries(config.RecentSearches, config.recentHalfLife())
+	}
+
+	return s
 }
 
 // ServerHTTP is the HTTP handler for this middleware
 func (s *Search) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 
+	if s.Config.AdminListen == "" {
+		// with an admin listener, the administrative endpoints are
+		// served there instead
+		if endpoint := s.adminEndpoint(r); endpoint != nil {
+			return endpoint(w, r)
+		}
+	}
+
+	if s.Config.HealthEndpoint != "" && httpserver.Path(r.URL.Path).Matches(s.Config.HealthEndpoint) {
+		return s.Health(w, r)
+	}
+
+	if s.Clicks != nil && httpserver.Path(r.URL.Path).Matches(s.Config.ClickEndpoint) {
+		return s.Click(w, r)
+	}
+
 	if httpserver.Path(r.URL.Path).Matches(s.Config.Endpoint) {
-		if r.Header.Get("Accept") == "application/json" || s.Config.Template == nil {
+		if s.cors(w, r) {
+			return http.StatusNoContent, nil
+		}
+		if s.limited(w, r) {
+			return http.StatusTooManyRequests, nil
+		}
+		done, ok := s.admitQuery(w, r)
+		if !ok {
+			return http.StatusServiceUnavailable, nil
+		}
+		defer done()
+		if scope := searchScope(r); scope != "" {
+			w.Header().Set("X-Search-Scope", scope)
+		}
+		if version := s.resolveVersion(r.URL.Query().Get("version")); version != "" {
+			w.Header().Set("X-Search-Version", version)
+		}
+		if s.Config.QuerySyntax != QuerySyntaxLiteral {
+			if _, excluded := splitExclusions(r.URL.Query().Get("q")); len(excluded) > 0 {
+				w.Header().Set("X-Search-Exclude", strings.Join(exclusions(excluded), ", "))
+			}
+			if _, filters := s.splitFilters(r.URL.Query().Get("q")); len(filters) > 0 {
+				w.Header().Set("X-Search-Filters", formatFilters(filters))
+			}
+		}
+		if instant, _ := strconv.ParseBool(r.URL.Query().Get("instant")); instant {
+			return s.SearchInstant(w, r)
+		}
+		if countOnly, _ := strconv.ParseBool(r.URL.Query().Get("count_only")); countOnly {
+			return s.SearchCount(w, r)
+		}
+		if r.Method == http.MethodHead {
+			return s.SearchHead(w, r)
+		}
+		if s.wantsJSON(r) {
 			return s.SearchJSON(w, r)
 		}
 		return s.SearchHTML(w, r)
 	}
 
-	record := s.Indexer.Record(r.URL.String())
+	if r.Header.Get(crawlHeader) != "" {
+		// the crawler indexes its own responses
+		return s.Next.ServeHTTP(w, r)
+	}
+
+	record := s.Indexer.Record(s.Config.slashPath(r.URL.String()))
 
 	status, err := s.Next.ServeHTTP(&searchResponseWriter{w, record}, r)
 
+	record.SetContentType(w.Header().Get("Content-Type"))
+	record.SetFields(headerFields(w.Header(), s.Config.IndexHeaders))
+
 	modif := w.Header().Get("Last-Modified")
 	if len(modif) > 0 {
 		modTime, err := time.Parse(`Mon, 2 Jan 2006 15:04:05 MST`, modif)
@@ -43,6 +148,9 @@ func (s *Search) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 
 	if status != http.StatusOK {
 		record.Ignore()
+	} else if headerNoindex(w.Header()) {
+		s.Indexer.Delete(record.Path())
+		record.Ignore()
 	}
 
 	go s.Pipeline.Pipe(record)
@@ -52,55 +160,616 @@ func (s *Search) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 
 // Result is the structure for the search result
 type Result struct {
-	Path     string
-	Title    string
-	Body     template.HTML
-	Modified time.Time
-	Indexed  time.Time
+	Path            string
+	URL             string `json:",omitempty"` // link to the page, from result_url and deep_links
+	Section         string `json:",omitempty"` // id of the section of the page holding the best match
+	Title           string
+	TitleHighlights []indexer.Highlight `json:",omitempty"` // matching terms of the Title
+	Body            template.HTML
+	Highlights      []indexer.Highlight `json:",omitempty"` // matching terms of a plain text Body
+	Image           string              `json:",omitempty"`
+	Language        string              `json:",omitempty"`
+	Fields          map[string]string   `json:",omitempty"`
+	Modified        time.Time
+	Indexed         time.Time
+	Hash            string            `json:",omitempty"` // hash of the indexed body
+	Alternates      []string          `json:",omitempty"`
+	Translations    map[string]string `json:",omitempty"` // paths of the page in other languages, by language
+	MatchedTerms    []string          `json:",omitempty"` // query words the page matched, as typed
+	Score           float64           `json:",omitempty"`
+	Debug           *Debug            `json:",omitempty"`
+
+	priority   float64 // sitemap priority of the page
+	exactTitle bool    // whether the title equals the query
+}
+
+// Link returns the link to the page, from result_url and deep_links, or else
+// its path, for templates: <a href="{{.Link}}">
+func (r Result) Link() string {
+	if r.URL != "" {
+		return r.URL
+	}
+	return r.Path
+}
+
+// MarkedTitle returns the escaped title with its matching terms wrapped in
+// <mark> elements, for templates: {{.MarkedTitle}}
+func (r Result) MarkedTitle() template.HTML {
+	runes := []rune(r.Title)
+	var buf strings.Builder
+
+	pos := 0
+	for _, mark := range r.TitleHighlights {
+		if mark.Start < pos || mark.End > len(runes) {
+			continue
+		}
+		buf.WriteString(template.HTMLEscapeString(string(runes[pos:mark.Start])))
+		buf.WriteString("<mark>")
+		buf.WriteString(template.HTMLEscapeString(string(runes[mark.Start:mark.End])))
+		buf.WriteString("</mark>")
+		pos = mark.End
+	}
+	buf.WriteString(template.HTMLEscapeString(string(runes[pos:])))
+
+	return template.HTML(buf.String())
+}
+
+// ErrEmptyQuery is returned by Search for a query without any terms
+var ErrEmptyQuery = errors.New("search: empty query")
+
+// SearchOptions tune a search run with Search
+type SearchOptions struct {
+	// Language analyzes the query's terms in a language other than the
+	// configured one
+	Language string
+	// Scope restricts the results to the pages under a directory, e.g. /docs
+	Scope string
+	// Exclude drops the pages under any of these directories, in addition
+	// to those the query excludes with -path: terms
+	Exclude []string
+	// Limit returns fewer results than the configured max_results
+	Limit int
+	// Debug explains the ranking of each result
+	Debug bool
+	// Sort orders the results by a custom field, as in field:price:desc,
+	// rather than by relevance
+	Sort string
+	// PlainSnippets returns each result's Body as plain text with the rune
+	// offsets of its matching terms in Highlights, rather than as HTML
+	PlainSnippets bool
+	// Version restricts the results to the pages of a version found by
+	// version_pattern, e.g. v2, or of the newest one for "latest"
+	Version string
+	// Since restricts the results to the pages modified within a window,
+	// as a duration back from now (7d, 2w, 36h) or a date (2006-01-02 or
+	// RFC 3339)
+	Since string
+}
+
+// SearchResults are the ranked results of a search
+type SearchResults struct {
+	Query     string
+	Scope     string
+	Excluded  []string // directories the results were kept out of
+	Version   string   // version the results are restricted to
+	Results   []Result
+	Truncated bool   // more documents matched than were returned
+	Message   string // shown instead of results for an empty query
+	// Filters are the values of custom fields the results are restricted
+	// to, read from the query's field terms and its version
+	Filters map[string][]string
+	// Dropped are the terms left out of a query longer than
+	// max_query_terms
+	Dropped []string
+}
+
+// Behaviors of the search endpoint for an empty query, set with
+// empty_query_behavior
+const (
+	// EmptyQueryNone returns no results
+	EmptyQueryNone = "none"
+	// EmptyQueryRecent returns the most recently indexed pages
+	EmptyQueryRecent = "recent"
+	// EmptyQueryMessage returns no results but a configured message
+	EmptyQueryMessage = "message"
+)
+
+// Formats of the snippets of JSON results, set with snippet_format
+const (
+	// SnippetFormatHTML escapes the snippets and marks their matching terms
+	// with <mark> elements
+	SnippetFormatHTML = "html"
+	// SnippetFormatPlain returns the snippets as plain text along with the
+	// locations of their matching terms
+	SnippetFormatPlain = "plain"
+)
+
+// Extents of the marks of matching words, set with highlight_matches
+const (
+	// HighlightWhole marks every matching word whole
+	HighlightWhole = "whole"
+	// HighlightPartial marks the part of a matching word the query's word
+	// shares with it, as run in running
+	HighlightPartial = "partial"
+)
+
+// Syntaxes of queries, set with query_syntax
+const (
+	// QuerySyntaxFull reads +, -, quotes, name:value terms and the other
+	// operators of the query string syntax, unless escaped with a backslash
+	QuerySyntaxFull = "full"
+	// QuerySyntaxLiteral matches every word of a query as it is written
+	QuerySyntaxLiteral = "literal"
+)
+
+// Search runs a query against the index and returns its ranked results, as
+// the search endpoint does, for use by other modules and programs without
+// going through HTTP. It returns ErrEmptyQuery for a query without terms,
+// ErrInvalidSort for a sort order and ErrInvalidSince for a window it cannot
+// parse, and ErrTooManyTerms for a query longer than max_query_terms when
+// those are rejected.
+func (s *Search) Search(text string, opts SearchOptions) (SearchResults, error) {
+	query, dropped := s.limitedQuery(text, opts)
+	order, err := parseSort(opts.Sort)
+	if err == nil {
+		_, err = parseSince(opts.Since, time.Now())
+	}
+	if err == nil && len(dropped) > 0 && s.Config.MaxQueryTermsAction == QueryTermsReject {
+		err = ErrTooManyTerms
+	}
+	if err != nil {
+		return SearchResults{Scope: query.Scope, Excluded: query.Exclude, Version: versionFilter(query), Results: []Result{}}, err
+	}
+	if query.Text == "" && len(query.Filters) == 0 && query.Since.IsZero() {
+		return SearchResults{Scope: query.Scope, Excluded: query.Exclude, Version: versionFilter(query), Results: []Result{}}, ErrEmptyQuery
+	}
+
+	if order != nil {
+		query.SortField, query.SortDescending = order.field, order.descending
+	}
+	results, truncated := s.results(query, opts.Debug, order)
+
+	return SearchResults{
+		Query:     query.Text,
+		Scope:     query.Scope,
+		Excluded:  query.Exclude,
+		Version:   versionFilter(query),
+		Filters:   query.Filters,
+		Results:   results,
+		Truncated: truncated,
+		Dropped:   dropped,
+	}, nil
+}
+
+// indexQuery builds the index query for a search
+func (s *Search) indexQuery(text string, opts SearchOptions) indexer.Query {
+	query, _ := s.limitedQuery(text, opts)
+	return query
+}
+
+// limitedQuery builds the index query for a search and returns the terms
+// of its text left out for max_query_terms
+func (s *Search) limitedQuery(text string, opts SearchOptions) (indexer.Query, []string) {
+	text = normalizeText(text)
+	literal := s.Config.QuerySyntax == QuerySyntaxLiteral
+	var excluded []string
+	var filters map[string][]string
+	if !literal {
+		text, excluded = splitExclusions(text)
+		text, filters = s.splitFilters(text)
+	}
+	query := indexer.Query{
+		Text:              strings.TrimSpace(text),
+		Language:          s.Config.Language,
+		Snippet:           s.Config.SnippetStrategy,
+		Excerpt:           s.Config.ExcerptSources,
+		Scope:             normalizeScope(opts.Scope),
+		Exclude:           exclusions(append(excluded, opts.Exclude...)),
+		Limit:             s.Config.MaxResults,
+		Filters:           filters,
+		PlainSnippet:      opts.PlainSnippets,
+		MatchedTerms:      s.Config.MatchedTerms,
+		Literal:           literal,
+		PartialHighlights: s.Config.HighlightMatches == HighlightPartial,
+		DeepLinks:         s.Config.DeepLinks,
+		PositionDecay:     s.Config.PositionDecay,
+	}
+	if opts.Language != "" {
+		query.Language = strings.ToLower(opts.Language)
+	}
+	if opts.Limit > 0 && (query.Limit == 0 || opts.Limit < query.Limit) {
+		query.Limit = opts.Limit
+	}
+	// an invalid window is reported by Search
+	query.Since, _ = parseSince(opts.Since, time.Now())
+	if version := s.resolveVersion(opts.Version); version != "" {
+		if query.Filters == nil {
+			query.Filters = make(map[string][]string)
+		}
+		query.Filters[versionField] = []string{version}
+	}
+	var dropped []string
+	query.Text, dropped = s.limitTerms(query.Text, query.Language, literal)
+	return query, dropped
+}
+
+// searchOptions reads the search options from the request: lang picks the
+// language the terms are analyzed in, scope (or path_prefix) the directory
+// and version the version the results are restricted to, since the window of
+// modification times, sort the custom field they are ordered by and debug
+// asks for ranking details
+func searchOptions(r *http.Request) SearchOptions {
+	debug, _ := strconv.ParseBool(r.URL.Query().Get("debug"))
+
+	return SearchOptions{
+		Language: r.URL.Query().Get("lang"),
+		Scope:    searchScope(r),
+		Debug:    debug,
+		Sort:     r.URL.Query().Get("sort"),
+		Version:  r.URL.Query().Get("version"),
+		Since:    r.URL.Query().Get("since"),
+	}
+}
+
+// searchScope returns the directory named by the request's scope (or
+// path_prefix) parameter, as normalized by normalizeScope
+func searchScope(r *http.Request) string {
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		scope = r.URL.Query().Get("path_prefix")
+	}
+	return normalizeScope(scope)
+}
+
+// pathExclusion prefixes the query terms that keep a directory out of the
+// results, as in `install -path:/archive/`
+const pathExclusion = "-path:"
+
+// splitExclusions separates the -path: terms of a query from its other terms
+func splitExclusions(text string) (rest string, dirs []string) {
+	if !strings.Contains(strings.ToLower(text), pathExclusion) {
+		return text, nil
+	}
+
+	words := []string{}
+	for _, word := range indexer.QueryWords(text) {
+		if strings.HasPrefix(strings.ToLower(word), pathExclusion) {
+			dirs = append(dirs, word[len(pathExclusion):])
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " "), dirs
+}
+
+// exclusions normalizes the excluded directories like scopes, dropping
+// duplicates and the site root
+func exclusions(dirs []string) []string {
+	var excluded []string
+	seen := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		if dir = normalizeScope(dir); dir != "" && !seen[dir] {
+			seen[dir] = true
+			excluded = append(excluded, dir)
+		}
+	}
+	return excluded
+}
+
+// normalizeScope cleans a scope and adds a trailing slash, so /docs matches
+// /docs/intro.html but not /docs-old/. The site root is no restriction.
+func normalizeScope(scope string) string {
+	if scope == "" {
+		return ""
+	}
+
+	scope = path.Clean("/" + scope)
+	if scope == "/" {
+		return ""
+	}
+	return scope + "/"
+}
+
+// Browse returns what the search endpoint answers to an empty query, as set
+// with empty_query_behavior: the most recently indexed pages (under the
+// scope of the options and outside the directories they exclude), a message
+// or nothing
+func (s *Search) Browse(opts SearchOptions) SearchResults {
+	results := SearchResults{
+		Scope:    normalizeScope(opts.Scope),
+		Excluded: exclusions(opts.Exclude),
+		Version:  s.resolveVersion(opts.Version),
+		Results:  []Result{},
+	}
+
+	switch s.Config.EmptyQueryBehavior {
+	case EmptyQueryRecent:
+		query := s.indexQuery("", opts)
+		if query.Limit == 0 || s.Config.EmptyQueryResults < query.Limit {
+			query.Limit = s.Config.EmptyQueryResults
+		}
+		results.Results = s.resolveRedirects(toResults(s.Indexer.Recent(query), false))
+		s.resultURLs(results.Results, "")
+	case EmptyQueryMessage:
+		results.Message = s.Config.EmptyQueryMessage
+	}
+
+	return results
+}
+
+// httpSearch runs the search the request asks for with the given options, or
+// browses for an empty query. It fails only for an invalid sort order or
+// window.
+func (s *Search) httpSearch(r *http.Request, opts SearchOptions) (SearchResults, error) {
+	results, err := s.Search(r.URL.Query().Get("q"), opts)
+	switch err {
+	case ErrEmptyQuery:
+		opts.Exclude = results.Excluded
+		results, err = s.Browse(opts), nil
+	case nil:
+		s.recordSearch(r, results)
+	}
+	absoluteImages(r, results.Results)
+	return results, err
+}
+
+// probeSearch runs the search the request asks for like httpSearch, without
+// recording it in the analytics or the recent searches, for the requests
+// that only ask about its results
+func (s *Search) probeSearch(r *http.Request, opts SearchOptions) (SearchResults, error) {
+	results, err := s.Search(r.URL.Query().Get("q"), opts)
+	if err == ErrEmptyQuery {
+		opts.Exclude = results.Excluded
+		results, err = s.Browse(opts), nil
+	}
+	absoluteImages(r, results.Results)
+	return results, err
+}
+
+// absoluteImages makes the images of results stored as paths on the site
+// absolute on the host the request was made to, which the index does not
+// know: the site may be served under several names
+func absoluteImages(r *http.Request, results []Result) {
+	if r.Host == "" {
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	for i, result := range results {
+		if strings.HasPrefix(result.Image, "/") && !strings.HasPrefix(result.Image, "//") {
+			results[i].Image = scheme + "://" + r.Host + result.Image
+		}
+	}
+}
+
+// toResults converts the records found in the index to search results
+func toResults(records []indexer.Record, debug bool) []Result {
+	results := make([]Result, len(records))
+
+	for i, record := range records {
+		results[i] = Result{
+			Path:            record.Path(),
+			Title:           record.Title(),
+			Image:           record.Image(),
+			Language:        record.Language(),
+			Fields:          record.Fields(),
+			Modified:        record.Modified(),
+			Indexed:         record.Indexed(),
+			Hash:            record.Hash(),
+			Body:            template.HTML(record.Body()),
+			Highlights:      record.Highlights(),
+			TitleHighlights: record.TitleHighlights(),
+			MatchedTerms:    record.MatchedTerms(),
+			Section:         record.Section(),
+			Translations:    record.Translations(),
+			Score:           record.Score(),
+			priority:        record.Priority(),
+		}
+		if debug {
+			results[i].Debug = &Debug{Score: record.Score()}
+		}
+	}
+
+	return results
+}
+
+// results runs the query against the index and builds the ranked search
+// results. With debug set each result explains its ranking. No more than
+// query.Limit results are returned; truncated reports whether more matched.
+// A sort order, which the index already applied to the query, orders the
+// results again after ranking them.
+func (s *Search) results(query indexer.Query, debug bool, order *sortOrder) (results []Result, truncated bool) {
+	limit := query.Limit
+	if limit > 0 {
+		// one more than the limit tells whether there are more
+		query.Limit++
+	}
+	indexResult := s.Indexer.Search(query)
+
+	results = s.resolveRedirects(toResults(indexResult, debug))
+	s.rank(results, query.Text, time.Now())
+
+	for i := range results {
+		if results[i].Debug != nil {
+			results[i].Debug.FinalScore = results[i].Score
+		}
+	}
+
+	if s.Config.DedupeURLs {
+		results = s.Config.dedupeURLs(results)
+	}
+	if s.Config.DedupeTitles {
+		results = dedupeTitles(results)
+	}
+
+	if order != nil {
+		order.sort(results)
+	} else if s.Config.DiversifyRun > 0 {
+		results = diversify(results, s.Config.DiversifyPrefixes, s.Config.DiversifyRun)
+	}
+
+	if limit > 0 && len(indexResult) > limit {
+		truncated = true
+		if len(results) > limit {
+			results = results[:limit]
+		}
+	}
+
+	if s.Config.Translations {
+		// looked up only for the results returned, one load per translation
+		s.indexedTranslations(results)
+	}
+	if s.Config.DistinctTitles != "" {
+		distinctTitles(results, s.Config.DistinctTitles)
+	}
+	s.resultURLs(results, query.Text)
+	deepLinks(results)
+
+	return results, truncated
 }
 
 // SearchJSON renders the search results in JSON format
 func (s *Search) SearchJSON(w http.ResponseWriter, r *http.Request) (int, error) {
-	q := r.URL.Query().Get("q")
-	indexResult := s.Indexer.Search(q)
+	opts := searchOptions(r)
+	opts.PlainSnippets = s.plainSnippets(r)
+	results, err := s.httpSearch(r, opts)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	setResultHeaders(w, results)
 
-	results := make([]Result, len(indexResult))
+	element := func(i int) interface{} { return results.Results[i] }
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		views := selectFields(results.Results, fields)
+		element = func(i int) interface{} { return views[i] }
+	}
 
-	for i, result := range indexResult {
-		body := result.Body()
-		results[i] = Result{
-			Path:     result.Path(),
-			Title:    result.Title(),
-			Modified: result.Modified(),
-			Indexed:  result.Indexed(),
-			Body:     template.HTML(body),
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSONArray(w, len(results.Results), element); err != nil {
+		// the response has started; the client sees a truncated array
+		return http.StatusOK, err
+	}
+	return http.StatusOK, nil
+}
+
+// setResultHeaders sets the headers describing the results sent ahead of
+// them: their number, whether more documents matched and how many terms of
+// the query were left out
+func setResultHeaders(w http.ResponseWriter, results SearchResults) {
+	if results.Truncated {
+		w.Header().Set("X-Results-Truncated", "true")
+	}
+	if len(results.Dropped) > 0 {
+		w.Header().Set("X-Search-Dropped-Terms", strconv.Itoa(len(results.Dropped)))
+	}
+	w.Header().Set("X-Total-Results", strconv.Itoa(len(results.Results)))
+}
+
+// writeJSONArray writes a JSON array of n elements, encoding each as it is
+// written rather than the whole array up front, so large result sets start
+// reaching the client at once and are never held in memory as JSON
+func writeJSONArray(w io.Writer, n int, element func(i int) interface{}) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(element(i)); err != nil {
+			return err
 		}
 	}
 
-	jresp, err := json.Marshal(results)
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// plainSnippets reports whether the JSON results of the request carry plain
+// text snippets, as its snippet_format parameter or else the configured
+// snippet_format asks
+func (s *Search) plainSnippets(r *http.Request) bool {
+	switch r.URL.Query().Get("snippet_format") {
+	case SnippetFormatPlain:
+		return true
+	case SnippetFormatHTML:
+		return false
+	}
+	return s.Config.SnippetFormat == SnippetFormatPlain
+}
+
+// recordSearch counts the search in the analytics and the recent searches,
+// if they are collected
+func (s *Search) recordSearch(r *http.Request, results SearchResults) {
+	if s.Analytics != nil {
+		s.Analytics.Record(results.Query, results.Scope, len(results.Results), time.Now())
+	}
+	if s.RecentQueries != nil {
+		s.RecentQueries.Record(results.Query, s.clientKey(r), len(results.Results), time.Now())
+	}
+}
+
+// wantsJSON reports whether the search results are rendered in JSON rather
+// than with the HTML template
+func (s *Search) wantsJSON(r *http.Request) bool {
+	return r.Header.Get("Accept") == "application/json" || s.Config.Template == nil
+}
+
+// SearchHead answers HEAD requests with the headers of the search results,
+// including their number in X-Total-Results, found as a GET request finds
+// them but without rendering them
+func (s *Search) SearchHead(w http.ResponseWriter, r *http.Request) (int, error) {
+	results, err := s.probeSearch(r, searchOptions(r))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if s.wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	setResultHeaders(w, results)
+	w.WriteHeader(http.StatusOK)
+	return http.StatusOK, nil
+}
+
+// SearchCount renders the number of results of the query in JSON format,
+// found as the search results are but without rendering them
+func (s *Search) SearchCount(w http.ResponseWriter, r *http.Request) (int, error) {
+	results, err := s.probeSearch(r, searchOptions(r))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	jresp, err := json.Marshal(struct {
+		Total     int      `json:"total"`
+		Truncated bool     `json:"truncated,omitempty"`
+		Scope     string   `json:"scope,omitempty"`
+		Exclude   []string `json:"exclude,omitempty"`
+	}{len(results.Results), results.Truncated, results.Scope, results.Excluded})
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(jresp)
-	return http.StatusOK, err
+	return http.StatusOK, nil
 }
 
 // SearchHTML renders the search results in the HTML template
 func (s *Search) SearchHTML(w http.ResponseWriter, r *http.Request) (int, error) {
-	q := r.URL.Query().Get("q")
-	indexResult := s.Indexer.Search(q)
-
-	results := make([]Result, len(indexResult))
-
-	for i, result := range indexResult {
-		results[i] = Result{
-			Path:     result.Path(),
-			Title:    result.Title(),
-			Modified: result.Modified(),
-			Body:     template.HTML(result.Body()),
-		}
+	results, err := s.httpSearch(r, searchOptions(r))
+	if err != nil {
+		return http.StatusBadRequest, err
 	}
+	setResultHeaders(w, results)
 
 	qresults := QueryResults{
 		Context: httpserver.Context{
@@ -108,14 +777,29 @@ func (s *Search) SearchHTML(w http.ResponseWriter, r *http.Request) (int, error)
 			Req:  r,
 			URL:  r.URL,
 		},
-		Query:   q,
-		Results: results,
+		Query:     results.Query,
+		Scope:     results.Scope,
+		Excluded:  results.Excluded,
+		Version:   results.Version,
+		Results:   results.Results,
+		Truncated: results.Truncated,
+		Message:   results.Message,
+		Dropped:   results.Dropped,
 	}
 
 	var buf bytes.Buffer
-	err := s.Config.Template.Execute(&buf, qresults)
+	err = s.Config.Template.Execute(&buf, qresults)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		if s.Config.TemplateFallbackDisabled || s.Config.Template == fallbackTemplate {
+			return http.StatusInternalServerError, err
+		}
+		// a broken template still lets visitors search
+		log.Printf("[search] rendering results template for query %q (%d results), using the default: %v",
+			qresults.Query, len(qresults.Results), err)
+		buf.Reset()
+		if err := fallbackTemplate.Execute(&buf, qresults); err != nil {
+			return http.StatusInternalServerError, err
+		}
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
@@ -123,10 +807,19 @@ func (s *Search) SearchHTML(w http.ResponseWriter, r *http.Request) (int, error)
 	return http.StatusOK, nil
 }
 
+// fallbackTemplate renders the results when the configured template fails
+var fallbackTemplate = template.Must(resultsTemplate("search-fallback").Parse(defaultTemplate))
+
 type QueryResults struct {
 	httpserver.Context
-	Query   string
-	Results []Result
+	Query     string
+	Scope     string
+	Excluded  []string
+	Version   string
+	Results   []Result
+	Truncated bool
+	Message   string
+	Dropped   []string
 }
 
 type searchResponseWriter struct {
@@ -1,6 +1,1082 @@
 package search_test
 
-import "testing"
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/pedronasser/caddy-search"
+	"github.com/pedronasser/caddy-search/indexer"
+	"github.com/pedronasser/caddy-search/indexer/bleve"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newTestSearch creates a search middleware backed by a temporary bleve
+// index. The returned func removes the index.
+func newTestSearch(config *search.Config) (*search.Search, func()) {
+	dir, err := ioutil.TempDir("", "caddyIndexTest")
+	So(err, ShouldBeNil)
+
+	indxr, err := bleve.New(dir, indexer.Config{
+		SplitIdentifiers: config.SplitIdentifiers,
+		CommentWeight:    config.CommentWeight,
+	})
+	So(err, ShouldBeNil)
+
+	if config.IncludePaths == nil {
+		config.IncludePaths = search.ConvertToRegExp([]string{"^/"})
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "/search"
+	}
+
+	pipeline, err := search.NewPipeline(config, indxr)
+	So(err, ShouldBeNil)
+
+	s := search.NewSearch(config, indxr, pipeline)
+	return s, func() { os.RemoveAll(dir) }
+}
+
+// indexFixture pipes a file from testdata and waits until it is indexed
+func indexFixture(s *search.Search, name string) {
+	indexFixtureModified(s, name, time.Time{})
+}
+
+// indexFixtureModified indexes a file from testdata as last modified at the
+// given time
+func indexFixtureModified(s *search.Search, name string, modified time.Time) {
+	fullPath, _ := filepath.Abs(filepath.Join("testdata", name))
+	rec := s.Indexer.Record("/" + name)
+	rec.SetFullPath(fullPath)
+	rec.SetModified(modified)
+	s.Pipeline.Pipe(rec)
+
+	for i := 0; i < 100; i++ {
+		if s.Indexer.Record("/" + name).Load() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// searchJSON queries the search endpoint and decodes the JSON results
+func searchJSON(s *search.Search, q string) []search.Result {
+	return searchJSONParams(s, url.Values{"q": {q}})
+}
+
+// searchJSONParams queries the search endpoint with the given parameters and
+// decodes the JSON results
+func searchJSONParams(s *search.Search, params url.Values) []search.Result {
+	req := httptest.NewRequest("GET", "/search?"+params.Encode(), nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	_, err := s.ServeHTTP(w, req)
+	So(err, ShouldBeNil)
+
+	var results []search.Result
+	So(json.Unmarshal(w.Body.Bytes(), &results), ShouldBeNil)
+	return results
+}
+
+func TestSearchCount(t *testing.T) {
+	Convey("Given an index with two matching pages", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		count := func(q string) string {
+			req := httptest.NewRequest("GET", "/search?count_only=1&q="+url.QueryEscape(q), nil)
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 200)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			return w.Body.String()
+		}
+
+		Convey("Should only return the number of matches", func() {
+			So(count("install"), ShouldEqual, `{"total":2}`)
+			So(count("nothing-matches-this"), ShouldEqual, `{"total":0}`)
+		})
+	})
+
+	Convey("Given an index with two matching pages and max_results 1", t, func() {
+		s, cleanup := newTestSearch(&search.Config{MaxResults: 1})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		Convey("Should count the results the search returns", func() {
+			req := httptest.NewRequest("GET", "/search?count_only=1&q=install", nil)
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			So(w.Body.String(), ShouldEqual, `{"total":1,"truncated":true}`)
+		})
+	})
+}
+
+func TestSearchInstant(t *testing.T) {
+	Convey("Given an index with two matching pages", t, func() {
+		s, cleanup := newTestSearch(&search.Config{InstantSuggestions: 3, InstantResults: 1})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+		indexFixture(s, "instant/configuring.html")
+
+		instant := func(q string) (suggestions []string, results []search.Result) {
+			req := httptest.NewRequest("GET", "/search?instant=1&q="+url.QueryEscape(q), nil)
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 200)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+			var resp struct {
+				Suggestions []string        `json:"suggestions"`
+				Results     []search.Result `json:"results"`
+			}
+			So(json.Unmarshal(w.Body.Bytes(), &resp), ShouldBeNil)
+			So(resp.Suggestions, ShouldNotBeNil)
+			So(resp.Results, ShouldNotBeNil)
+			return resp.Suggestions, resp.Results
+		}
+
+		Convey("Should complete the last word with the words of the titles", func() {
+			suggestions, _ := instant("ins")
+			So(suggestions, ShouldResemble, []string{"install"})
+
+			suggestions, _ = instant("guide ins")
+			So(suggestions, ShouldResemble, []string{"guide install"})
+		})
+
+		Convey("Should complete with the words of stemmed titles as written", func() {
+			suggestions, _ := instant("conf")
+			So(suggestions, ShouldResemble, []string{"configuring"})
+		})
+
+		Convey("Should return the top results within the configured limit", func() {
+			_, results := instant("install")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Title, ShouldContainSubstring, "nstall")
+		})
+
+		Convey("Should not complete a finished word", func() {
+			suggestions, results := instant("install ")
+			So(suggestions, ShouldBeEmpty)
+			So(results, ShouldHaveLength, 1)
+		})
+
+		Convey("Should return empty lists for an empty query", func() {
+			suggestions, results := instant("")
+			So(suggestions, ShouldBeEmpty)
+			So(results, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSearchJSONTotal(t *testing.T) {
+	Convey("Given an index with two matching pages and max_results 1", t, func() {
+		s, cleanup := newTestSearch(&search.Config{MaxResults: 1})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		Convey("Should send the number of results in a header before them", func() {
+			req := httptest.NewRequest("GET", "/search?q=install", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 200)
+			So(w.Header().Get("X-Total-Results"), ShouldEqual, "1")
+			So(w.Header().Get("X-Results-Truncated"), ShouldEqual, "true")
+
+			var results []search.Result
+			So(json.Unmarshal(w.Body.Bytes(), &results), ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+		})
+
+		Convey("Should stream an empty array when nothing matches", func() {
+			req := httptest.NewRequest("GET", "/search?q=nothing-matches-this", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+
+			So(w.Header().Get("X-Total-Results"), ShouldEqual, "0")
+			So(w.Body.String(), ShouldEqual, "[]")
+		})
+	})
+}
+
+func TestSearchHead(t *testing.T) {
+	Convey("Given an index with two matching pages", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		Convey("Should answer HEAD requests with the number of results and no body", func() {
+			req := httptest.NewRequest("HEAD", "/search?q=install", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 200)
+			So(w.Header().Get("X-Total-Results"), ShouldEqual, "2")
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			So(w.Body.Len(), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given an index with two matching pages and max_results 1", t, func() {
+		s, cleanup := newTestSearch(&search.Config{MaxResults: 1})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		Convey("Should send the headers of the same request with GET", func() {
+			headers := func(method string) http.Header {
+				req := httptest.NewRequest(method, "/search?q=install", nil)
+				req.Header.Set("Accept", "application/json")
+				w := httptest.NewRecorder()
+				_, err := s.ServeHTTP(w, req)
+				So(err, ShouldBeNil)
+				return w.Header()
+			}
+
+			head, get := headers("HEAD"), headers("GET")
+			So(head.Get("X-Total-Results"), ShouldEqual, "1")
+			So(head.Get("X-Total-Results"), ShouldEqual, get.Get("X-Total-Results"))
+			So(head.Get("X-Results-Truncated"), ShouldEqual, get.Get("X-Results-Truncated"))
+		})
+	})
+
+	Convey("Given the default results template and max_results 1", t, func() {
+		c := caddy.NewTestController(`search {
+			max_results 1
+		}`, "")
+		config, err := search.ParseSearchConfig(c, httpserver.GetConfig(c))
+		So(err, ShouldBeNil)
+		s, cleanup := newTestSearch(config)
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		Convey("Should send the headers of the JSON results with the HTML ones", func() {
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, httptest.NewRequest("GET", "/search?q=install", nil))
+			So(err, ShouldBeNil)
+			So(w.Header().Get("Content-Type"), ShouldStartWith, "text/html")
+			So(w.Header().Get("X-Total-Results"), ShouldEqual, "1")
+			So(w.Header().Get("X-Results-Truncated"), ShouldEqual, "true")
+		})
+	})
+}
+
+func TestSearchScope(t *testing.T) {
+	Convey("Given an index with matching pages in two directories", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		Convey("Should only return results under the scope", func() {
+			results := searchJSONParams(s, url.Values{"q": {"install"}, "scope": {"/amp/"}})
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Path, ShouldEqual, "/amp/install.html")
+		})
+
+		Convey("Should accept path_prefix and a scope without trailing slash", func() {
+			results := searchJSONParams(s, url.Values{"q": {"install"}, "path_prefix": {"/amp"}})
+			So(len(results), ShouldEqual, 1)
+			So(searchJSONParams(s, url.Values{"q": {"install"}, "scope": {"/am"}}), ShouldBeEmpty)
+		})
+
+		Convey("Should treat the site root as no scope", func() {
+			So(len(searchJSONParams(s, url.Values{"q": {"install"}, "scope": {"/"}})), ShouldEqual, 2)
+		})
+
+		Convey("Should report the active scope", func() {
+			req := httptest.NewRequest("GET", "/search?q=install&scope=amp&count_only=1", nil)
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			So(w.Header().Get("X-Search-Scope"), ShouldEqual, "/amp/")
+			So(w.Body.String(), ShouldEqual, `{"total":1,"scope":"/amp/"}`)
+		})
+	})
+}
+
+func TestSearchImages(t *testing.T) {
+	Convey("Given an index with a page declaring an image on the site", t, func() {
+		s, cleanup := newTestSearch(&search.Config{
+			SiteURL:            "http://localhost:2015",
+			EmptyQueryBehavior: search.EmptyQueryRecent,
+			EmptyQueryResults:  10,
+		})
+		defer cleanup()
+		indexFixture(s, "blog/og-image.html")
+
+		Convey("Should make the image absolute on the host the request was made to", func() {
+			req := httptest.NewRequest("GET", "https://docs.example.com/search?q=cover", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+
+			var results []search.Result
+			So(json.Unmarshal(w.Body.Bytes(), &results), ShouldBeNil)
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Image, ShouldEqual, "https://docs.example.com/images/cover.png")
+		})
+
+		Convey("Should make the images of browsed results absolute too", func() {
+			results := searchJSONParams(s, url.Values{"q": {""}})
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Image, ShouldEqual, "http://example.com/images/cover.png")
+		})
+	})
+}
+
+func TestSearchFields(t *testing.T) {
+	Convey("Given an index with pages declaring custom fields", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "fields/plugin.html")
+		indexFixture(s, "fields/theme.html")
+
+		Convey("Should filter the results by field value, ignoring case", func() {
+			results := searchJSON(s, "install +product:cli")
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Path, ShouldEqual, "/fields/plugin.html")
+
+			results = searchJSON(s, `install +author:"john roe"`)
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Path, ShouldEqual, "/fields/theme.html")
+		})
+
+		Convey("Should match a field's value as a whole", func() {
+			So(searchJSON(s, "install +author:jane"), ShouldBeEmpty)
+		})
+
+		Convey("Should return the fields with the results", func() {
+			results := searchJSON(s, "+product:server")
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Fields, ShouldResemble, map[string]string{"product": "server", "author": "John Roe"})
+		})
+	})
+}
+
+func TestResultHash(t *testing.T) {
+	Convey("Given an indexed page", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+
+		index := func(body string) {
+			rec := s.Indexer.Record("/notes.txt")
+			rec.Write([]byte(body))
+			s.Indexer.Pipe(rec)
+			for i := 0; i < 100; i++ {
+				if rec := s.Indexer.Record("/notes.txt"); rec.Load() && string(rec.Body()) == body {
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		hash := func() string {
+			results := searchJSONParams(s, url.Values{"q": {"notes"}, "fields": {"path,hash"}})
+			So(results, ShouldHaveLength, 1)
+			return results[0].Hash
+		}
+
+		index("release notes")
+		first := hash()
+
+		Convey("Should return the hash of its indexed text", func() {
+			So(first, ShouldHaveLength, 16)
+		})
+
+		Convey("Should keep the hash while the text is unchanged", func() {
+			index("release notes")
+			So(hash(), ShouldEqual, first)
+		})
+
+		Convey("Should change the hash with the text", func() {
+			index("release notes, updated")
+			So(hash(), ShouldNotEqual, first)
+		})
+	})
+}
+
+func TestSearchFieldFilters(t *testing.T) {
+	Convey("Given an index with pages declaring custom fields", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "fields/plugin.html")
+		indexFixture(s, "fields/theme.html")
+
+		Convey("Should match any of the values given for a field", func() {
+			So(searchJSON(s, "install product:(cli server)"), ShouldHaveLength, 2)
+			So(searchJSON(s, "install product:cli product:server"), ShouldHaveLength, 2)
+		})
+
+		Convey("Should require the terms naming different fields to all match", func() {
+			results := searchJSON(s, `install product:(cli server) author:"john roe"`)
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/fields/theme.html")
+		})
+
+		Convey("Should return every page a query of filters alone lets through", func() {
+			results := searchJSON(s, "product:cli")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/fields/plugin.html")
+		})
+
+		Convey("Should report the filters applied", func() {
+			req := httptest.NewRequest("GET", "/search?count_only=1&q="+url.QueryEscape(`install product:(server cli) author:"John Roe"`), nil)
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			So(w.Header().Get("X-Search-Filters"), ShouldEqual, `author:"John Roe" product:(server cli)`)
+
+			results, err := s.Search("install product:(server cli) product:CLI", search.SearchOptions{})
+			So(err, ShouldBeNil)
+			So(results.Query, ShouldEqual, "install")
+			So(results.Filters, ShouldResemble, map[string][]string{"product": {"server", "cli"}})
+		})
+	})
+}
+
+func TestMatchedTerms(t *testing.T) {
+	Convey("Given an English index listing matched terms", t, func() {
+		s, cleanup := newTestSearch(&search.Config{Language: "en", MatchedTerms: true})
+		defer cleanup()
+		indexFixture(s, "install.html")
+
+		Convey("Should list the query words each result matched, as typed", func() {
+			results := searchJSON(s, "Installing plugin zebra -theme")
+			So(results, ShouldBeEmpty)
+
+			results = searchJSON(s, "Installing plugin zebra")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].MatchedTerms, ShouldResemble, []string{"Installing", "plugin"})
+		})
+	})
+
+	Convey("Given an index not listing matched terms", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "install.html")
+
+		Convey("Should leave them out of the results", func() {
+			results := searchJSON(s, "install")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].MatchedTerms, ShouldBeNil)
+		})
+	})
+}
+
+func TestSearchSort(t *testing.T) {
+	Convey("Given an index with catalog pages declaring prices", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "catalog/lamp.html")
+		indexFixture(s, "catalog/chair.html")
+		indexFixture(s, "catalog/shelf.html")
+
+		paths := func(results []search.Result) []string {
+			paths := []string{}
+			for _, result := range results {
+				paths = append(paths, result.Path)
+			}
+			return paths
+		}
+
+		Convey("Should order the results by a numeric field", func() {
+			results := searchJSONParams(s, url.Values{"q": {"furniture"}, "sort": {"field:price:desc"}})
+			So(paths(results), ShouldResemble, []string{"/catalog/chair.html", "/catalog/lamp.html", "/catalog/shelf.html"})
+
+			results = searchJSONParams(s, url.Values{"q": {"furniture"}, "sort": {"field:price"}})
+			So(paths(results), ShouldResemble, []string{"/catalog/lamp.html", "/catalog/chair.html", "/catalog/shelf.html"})
+		})
+
+		Convey("Should order the results by a date field", func() {
+			results := searchJSONParams(s, url.Values{"q": {"furniture"}, "sort": {"field:released:asc"}})
+			So(paths(results), ShouldResemble, []string{"/catalog/chair.html", "/catalog/lamp.html", "/catalog/shelf.html"})
+		})
+
+		Convey("Should reject an invalid sort order", func() {
+			for _, sort := range []string{"price", "field:price:up", "field:Bad.Name"} {
+				req := httptest.NewRequest("GET", "/search?q=furniture&sort="+url.QueryEscape(sort), nil)
+				req.Header.Set("Accept", "application/json")
+				status, err := s.ServeHTTP(httptest.NewRecorder(), req)
+				So(status, ShouldEqual, http.StatusBadRequest)
+				So(err, ShouldEqual, search.ErrInvalidSort)
+			}
+		})
+	})
+
+	Convey("Given more matching pages than are returned", t, func() {
+		s, cleanup := newTestSearch(&search.Config{MaxResults: 2})
+		defer cleanup()
+
+		for i, price := range []string{"5", "40", "10", "90", "20"} {
+			rec := s.Indexer.Record(fmt.Sprintf("/shop/%d.html", i))
+			rec.SetTitle("Item")
+			// the dearer an item, the less relevant its page
+			rec.Write([]byte(strings.Repeat("table ", 10-i) + strings.Repeat("other words ", 4*i)))
+			rec.SetFields(map[string]string{"price": price})
+			s.Indexer.Pipe(rec)
+		}
+		for i := 0; i < 100 && s.Indexer.DocCount() < 5; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		Convey("Should sort every match, not only the most relevant", func() {
+			results := searchJSONParams(s, url.Values{"q": {"table"}, "sort": {"field:price:desc"}})
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Path, ShouldEqual, "/shop/3.html")
+			So(results[1].Path, ShouldEqual, "/shop/1.html")
+
+			results = searchJSONParams(s, url.Values{"q": {"table"}, "sort": {"field:price"}})
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Path, ShouldEqual, "/shop/0.html")
+			So(results[1].Path, ShouldEqual, "/shop/2.html")
+		})
+	})
+}
+
+func TestSearchSortTies(t *testing.T) {
+	Convey("Given many pages released on the same day", t, func() {
+		s, cleanup := newTestSearch(&search.Config{MaxResults: 20})
+		defer cleanup()
+
+		for i := 0; i < 12; i++ {
+			path := fmt.Sprintf("/news/%02d.html", (i*5)%12)
+			rec := s.Indexer.Record(path)
+			rec.SetTitle("News")
+			rec.Write([]byte(strings.Repeat("release ", 1+i%3) + "notes for the week"))
+			rec.SetFields(map[string]string{"released": "2024-05-01"})
+			s.Indexer.Pipe(rec)
+		}
+		for i := 0; i < 100 && len(searchJSON(s, "release")) < 12; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		Convey("Should order them by score and then by path, the same way every time", func() {
+			params := url.Values{"q": {"release"}, "sort": {"field:released:desc"}, "fields": {"path,score"}}
+			results := searchJSONParams(s, params)
+			So(results, ShouldHaveLength, 12)
+			for i := 1; i < len(results); i++ {
+				prev, cur := results[i-1], results[i]
+				So(prev.Score, ShouldBeGreaterThanOrEqualTo, cur.Score)
+				if prev.Score == cur.Score {
+					So(prev.Path, ShouldBeLessThan, cur.Path)
+				}
+			}
+
+			for i := 0; i < 5; i++ {
+				So(searchJSONParams(s, params), ShouldResemble, results)
+			}
+		})
+	})
+}
+
+func TestResultURL(t *testing.T) {
+	Convey("Given a result_url template", t, func() {
+		tmpl := texttemplate.Must(texttemplate.New("result_url").Parse(
+			`{{if eq .Path "/catalog/chair.html"}}{{.Missing}}{{end}}https://cdn.example.com{{.Path}}?q={{urlquery .Query}}`))
+		s, cleanup := newTestSearch(&search.Config{ResultURL: tmpl})
+		defer cleanup()
+		indexFixture(s, "catalog/lamp.html")
+		indexFixture(s, "catalog/chair.html")
+
+		results := map[string]search.Result{}
+		for _, result := range searchJSON(s, "furniture") {
+			results[result.Path] = result
+		}
+
+		Convey("Should render the link of every result", func() {
+			So(results["/catalog/lamp.html"].URL, ShouldEqual, "https://cdn.example.com/catalog/lamp.html?q=furniture")
+			So(results["/catalog/lamp.html"].Link(), ShouldEqual, results["/catalog/lamp.html"].URL)
+		})
+
+		Convey("Should link results it fails to render to their path", func() {
+			So(results["/catalog/chair.html"].URL, ShouldBeEmpty)
+			So(results["/catalog/chair.html"].Link(), ShouldEqual, "/catalog/chair.html")
+		})
+	})
+}
+
+func TestDeepLinks(t *testing.T) {
+	Convey("Given a page with sections and deep_links", t, func() {
+		s, cleanup := newTestSearch(&search.Config{DeepLinks: true})
+		defer cleanup()
+		indexFixture(s, "sections/guide.html")
+
+		link := func(q string) (string, string) {
+			results := searchJSON(s, q)
+			So(results, ShouldHaveLength, 1)
+			return results[0].Section, results[0].Link()
+		}
+
+		Convey("Should link a result to the section of its best match", func() {
+			section, url := link("tarball")
+			So(section, ShouldEqual, "linux")
+			So(url, ShouldEqual, "/sections/guide.html#linux")
+
+			section, url = link("installer")
+			So(section, ShouldEqual, "windows")
+			So(url, ShouldEqual, "/sections/guide.html#windows")
+		})
+
+		Convey("Should link a result matching before every section to the page", func() {
+			section, url := link("supported")
+			So(section, ShouldBeEmpty)
+			So(url, ShouldEqual, "/sections/guide.html")
+		})
+	})
+}
+
+func TestTranslations(t *testing.T) {
+	Convey("Given pages linking to each other as translations", t, func() {
+		s, cleanup := newTestSearch(&search.Config{Translations: true})
+		defer cleanup()
+		indexFixture(s, "translations/guide.html")
+		indexFixture(s, "translations/de/guide.html")
+
+		results := map[string]search.Result{}
+		for _, result := range searchJSON(s, "trailhead") {
+			results[result.Path] = result
+		}
+		So(results, ShouldHaveLength, 2)
+
+		Convey("Should list the translations that are indexed", func() {
+			So(results["/translations/guide.html"].Translations, ShouldResemble, map[string]string{
+				"de": "/translations/de/guide.html",
+			})
+			So(results["/translations/de/guide.html"].Translations, ShouldResemble, map[string]string{
+				"en": "/translations/guide.html",
+			})
+		})
+	})
+}
+
+func TestSearchOperators(t *testing.T) {
+	Convey("Given pages whose text looks like query operators", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+
+		pages := map[string]string{
+			"/cpp.html":   "C++ templates explained",
+			"/flags.html": "Build with -fno-exceptions to drop exceptions",
+			"/notes.html": "Write tag:go in a query to filter by tag",
+			"/music.html": "A history of rock and roll",
+		}
+		for path, body := range pages {
+			rec := s.Indexer.Record(path)
+			rec.SetTitle("Page")
+			rec.Write([]byte(body))
+			s.Indexer.Pipe(rec)
+		}
+		for i := 0; i < 100 && len(searchJSON(s, "page")) < len(pages); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		find := func(text string) (search.SearchResults, []string) {
+			results, err := s.Search(text, search.SearchOptions{})
+			So(err, ShouldBeNil)
+			paths := []string{}
+			for _, result := range results.Results {
+				paths = append(paths, result.Path)
+			}
+			return results, paths
+		}
+
+		Convey("Should match quoted and escaped operators as text", func() {
+			for _, text := range []string{`C++`, `"C++"`, `C\+\+`} {
+				_, paths := find(text)
+				So(paths, ShouldResemble, []string{"/cpp.html"})
+			}
+			for _, text := range []string{`"-fno-exceptions"`, `\-fno-exceptions`} {
+				_, paths := find(text)
+				So(paths, ShouldResemble, []string{"/flags.html"})
+			}
+			for _, text := range []string{`"tag:go"`, `tag\:go`} {
+				results, paths := find(text)
+				So(paths, ShouldResemble, []string{"/notes.html"})
+				So(results.Filters, ShouldBeEmpty)
+			}
+			results, _ := find(`"-path:/archive/" history`)
+			So(results.Excluded, ShouldBeEmpty)
+		})
+
+		Convey("Should read unquoted operators as operators", func() {
+			_, paths := find("exceptions -fno")
+			So(paths, ShouldBeEmpty)
+		})
+
+		Convey("Should match a name:value term as text unless it names an indexed field", func() {
+			for _, text := range []string{"tag:go", "query://go"} {
+				results, _ := find(text)
+				So(results.Filters, ShouldBeEmpty)
+			}
+			_, paths := find("tag:go")
+			So(paths, ShouldResemble, []string{"/notes.html"})
+		})
+
+		Convey("Should match reserved words as plain words", func() {
+			_, paths := find("rock AND roll")
+			So(paths, ShouldResemble, []string{"/music.html"})
+			_, paths = find(`rock AND\ roll`)
+			So(paths, ShouldResemble, []string{"/music.html"})
+		})
+
+		Convey("Should match every character as text with the literal syntax", func() {
+			s.Config.QuerySyntax = search.QuerySyntaxLiteral
+			for text, path := range map[string]string{
+				"C++": "/cpp.html", "-fno-exceptions": "/flags.html", "tag:go": "/notes.html", "rock AND roll?": "/music.html",
+			} {
+				results, paths := find(text)
+				So(paths, ShouldResemble, []string{path})
+				So(results.Filters, ShouldBeEmpty)
+			}
+		})
+	})
+}
+
+func TestSearchMaxQueryTerms(t *testing.T) {
+	Convey("Given a cap on the terms of queries", t, func() {
+		s, cleanup := newTestSearch(&search.Config{MaxQueryTerms: 2, MaxQueryTermsAction: search.QueryTermsTruncate})
+		defer cleanup()
+
+		pages := map[string]string{
+			"/a.html": "guide to the desk lamp",
+			"/b.html": "guide to the floor lamp",
+			"/c.html": "guide to the zebra rug",
+		}
+		for path, body := range pages {
+			rec := s.Indexer.Record(path)
+			rec.SetTitle("Page")
+			rec.Write([]byte(body))
+			s.Indexer.Pipe(rec)
+		}
+		for i := 0; i < 100 && len(searchJSON(s, "page")) < len(pages); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		text := "guide zebra lamp guide nothingmatches"
+
+		Convey("Should keep the rarest terms of a longer query", func() {
+			results, err := s.Search(text, search.SearchOptions{})
+			So(err, ShouldBeNil)
+			So(results.Query, ShouldEqual, "zebra lamp")
+			So(results.Dropped, ShouldResemble, []string{"guide", "guide", "nothingmatches"})
+			So(results.Results, ShouldHaveLength, 3)
+
+			req := httptest.NewRequest("GET", "/search?q="+url.QueryEscape(text), nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("X-Search-Dropped-Terms"), ShouldEqual, "3")
+		})
+
+		Convey("Should leave shorter queries alone", func() {
+			results, err := s.Search("guide lamp", search.SearchOptions{})
+			So(err, ShouldBeNil)
+			So(results.Query, ShouldEqual, "guide lamp")
+			So(results.Dropped, ShouldBeEmpty)
+		})
+
+		Convey("Should reject a longer query when asked to", func() {
+			s.Config.MaxQueryTermsAction = search.QueryTermsReject
+			_, err := s.Search(text, search.SearchOptions{})
+			So(err, ShouldEqual, search.ErrTooManyTerms)
+
+			for _, method := range []string{"GET", "HEAD"} {
+				req := httptest.NewRequest(method, "/search?q="+url.QueryEscape(text), nil)
+				status, _ := s.ServeHTTP(httptest.NewRecorder(), req)
+				So(status, ShouldEqual, http.StatusBadRequest)
+			}
+
+			req := httptest.NewRequest("GET", "/search?count_only=1&q="+url.QueryEscape(text), nil)
+			status, _ := s.ServeHTTP(httptest.NewRecorder(), req)
+			So(status, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
+
+func TestSearchSince(t *testing.T) {
+	Convey("Given pages modified at different times", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixtureModified(s, "catalog/lamp.html", time.Now().Add(-2*24*time.Hour))
+		indexFixtureModified(s, "catalog/chair.html", time.Now().Add(-30*24*time.Hour))
+		indexFixture(s, "catalog/shelf.html")
+
+		paths := func(params url.Values) []string {
+			paths := []string{}
+			for _, result := range searchJSONParams(s, params) {
+				paths = append(paths, result.Path)
+			}
+			sort.Strings(paths)
+			return paths
+		}
+
+		Convey("Should only return the pages modified within the window", func() {
+			So(paths(url.Values{"q": {"furniture"}, "since": {"7d"}}), ShouldResemble, []string{"/catalog/lamp.html"})
+			So(paths(url.Values{"q": {"furniture"}, "since": {"1000h"}}), ShouldResemble, []string{"/catalog/chair.html", "/catalog/lamp.html"})
+		})
+
+		Convey("Should accept a date as the start of the window", func() {
+			since := time.Now().Add(-10 * 24 * time.Hour).Format("2006-01-02")
+			So(paths(url.Values{"q": {"furniture"}, "since": {since}}), ShouldResemble, []string{"/catalog/lamp.html"})
+		})
+
+		Convey("Should return every recent page for a window alone", func() {
+			So(paths(url.Values{"since": {"2w"}}), ShouldResemble, []string{"/catalog/lamp.html"})
+		})
+
+		Convey("Should reject an invalid window", func() {
+			for _, since := range []string{"soon", "-7d", "0h", "7x", "200000d", "250000d", "9999999999999999999w"} {
+				_, err := s.Search("furniture", search.SearchOptions{Since: since})
+				So(err, ShouldEqual, search.ErrInvalidSince)
+			}
+		})
+	})
+}
+
+func TestSearchExclusions(t *testing.T) {
+	Convey("Given an index with matching pages in two directories", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		Convey("Should drop the results under an excluded directory", func() {
+			results := searchJSON(s, "install -path:/amp")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/install.html")
+		})
+
+		Convey("Should combine exclusions with the scope", func() {
+			results := searchJSONParams(s, url.Values{"q": {"install -path:/amp/"}, "scope": {"/amp/"}})
+			So(results, ShouldBeEmpty)
+		})
+
+		Convey("Should report the applied exclusions", func() {
+			req := httptest.NewRequest("GET", "/search?count_only=1&q="+url.QueryEscape("install -path:amp -path:/amp/"), nil)
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			So(w.Header().Get("X-Search-Exclude"), ShouldEqual, "/amp/")
+			So(w.Body.String(), ShouldEqual, `{"total":1,"exclude":["/amp/"]}`)
+
+			results, err := s.Search("install -path:/amp", search.SearchOptions{Exclude: []string{"/docs"}})
+			So(err, ShouldBeNil)
+			So(results.Query, ShouldEqual, "install")
+			So(results.Excluded, ShouldResemble, []string{"/amp/", "/docs/"})
+		})
+	})
+}
+
+func TestSearchComments(t *testing.T) {
+	Convey("Given pages mentioning a term in their text and in their comments", t, func() {
+		s, cleanup := newTestSearch(&search.Config{CommentSelectors: []string{"#comments"}, CommentWeight: 0.3})
+		defer cleanup()
+		indexFixture(s, "comments/post.html")
+		indexFixture(s, "comments/kubernetes.html")
+
+		Convey("Should find both, ranking the comments' match lower", func() {
+			results := searchJSON(s, "kubernetes")
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Path, ShouldEqual, "/comments/kubernetes.html")
+			So(results[1].Path, ShouldEqual, "/comments/post.html")
+		})
+
+		Convey("Should still exclude pages by their text", func() {
+			results := searchJSON(s, "kubernetes -upgrading")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/comments/kubernetes.html")
+		})
+
+		Convey("Should not match comments by a field's terms", func() {
+			results := searchJSON(s, "title:kubernetes")
+			So(results, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSnippetFormat(t *testing.T) {
+	Convey("Given an index with a matching page", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		indexFixture(s, "install.html")
+
+		Convey("Should mark the matching terms in HTML by default", func() {
+			results := searchJSON(s, "theme")
+			So(results, ShouldHaveLength, 1)
+			So(string(results[0].Body), ShouldContainSubstring, "<mark>theme</mark>")
+			So(results[0].Highlights, ShouldBeEmpty)
+		})
+
+		Convey("Should locate the matching terms of plain text snippets", func() {
+			results := searchJSONParams(s, url.Values{"q": {"theme"}, "snippet_format": {"plain"}})
+			So(results, ShouldHaveLength, 1)
+			So(string(results[0].Body), ShouldEqual, "Install the plugin, then install the theme. Installing takes a minute.")
+			So(results[0].Highlights, ShouldResemble, []indexer.Highlight{{Start: 37, End: 42}})
+
+			req := httptest.NewRequest("GET", "/search?q=theme&snippet_format=plain", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			So(w.Body.String(), ShouldContainSubstring, `"Highlights":[{"start":37,"end":42}]`)
+		})
+
+		Convey("Should default to the configured format", func() {
+			s.Config.SnippetFormat = search.SnippetFormatPlain
+			results := searchJSON(s, "theme")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Highlights, ShouldHaveLength, 1)
+
+			results = searchJSONParams(s, url.Values{"q": {"theme"}, "snippet_format": {"html"}})
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Highlights, ShouldBeEmpty)
+		})
+
+		Convey("Should locate the matching terms of the title in either format", func() {
+			for _, format := range []string{"html", "plain"} {
+				results := searchJSONParams(s, url.Values{"q": {"guide"}, "snippet_format": {format}})
+				So(results, ShouldHaveLength, 1)
+				So(results[0].Title, ShouldEqual, "Install Guide")
+				So(results[0].TitleHighlights, ShouldResemble, []indexer.Highlight{{Start: 8, End: 13}})
+				So(results[0].MarkedTitle(), ShouldEqual, "Install <mark>Guide</mark>")
+			}
+		})
+	})
+}
+
+func TestSearchMaxResults(t *testing.T) {
+	Convey("Given an index with two matching pages", t, func() {
+		s, cleanup := newTestSearch(&search.Config{MaxResults: 1})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		Convey("Should cap the results and report the truncation", func() {
+			req := httptest.NewRequest("GET", "/search?q=install", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+
+			var results []search.Result
+			So(json.Unmarshal(w.Body.Bytes(), &results), ShouldBeNil)
+			So(len(results), ShouldEqual, 1)
+			So(w.Header().Get("X-Results-Truncated"), ShouldEqual, "true")
+		})
+
+		Convey("Should not report truncation when every match is returned", func() {
+			req := httptest.NewRequest("GET", "/search?q=install&scope=/amp/", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+			So(w.Header().Get("X-Results-Truncated"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSearchAPI(t *testing.T) {
+	Convey("Given an index with matching pages in two directories", t, func() {
+		s, cleanup := newTestSearch(&search.Config{MaxResults: 10})
+		defer cleanup()
+		indexFixture(s, "install.html")
+		indexFixture(s, "amp/install.html")
+
+		Convey("Should search without going through HTTP", func() {
+			results, err := s.Search("  install ", search.SearchOptions{})
+			So(err, ShouldBeNil)
+			So(results.Query, ShouldEqual, "install")
+			So(results.Results, ShouldHaveLength, 2)
+			So(results.Truncated, ShouldBeFalse)
+		})
+
+		Convey("Should apply the options", func() {
+			results, err := s.Search("install", search.SearchOptions{Scope: "amp", Debug: true})
+			So(err, ShouldBeNil)
+			So(results.Scope, ShouldEqual, "/amp/")
+			So(results.Results, ShouldHaveLength, 1)
+			So(results.Results[0].Debug, ShouldNotBeNil)
+
+			results, err = s.Search("install", search.SearchOptions{Limit: 1})
+			So(err, ShouldBeNil)
+			So(results.Results, ShouldHaveLength, 1)
+			So(results.Truncated, ShouldBeTrue)
+		})
+
+		Convey("Should report empty queries", func() {
+			_, err := s.Search("   ", search.SearchOptions{})
+			So(err, ShouldEqual, search.ErrEmptyQuery)
+		})
+	})
+}
+
+func TestEmptyQuery(t *testing.T) {
+	Convey("Given an index with two pages", t, func() {
+		newSearch := func(config *search.Config) (*search.Search, func()) {
+			s, cleanup := newTestSearch(config)
+			indexFixture(s, "install.html")
+			indexFixture(s, "amp/install.html")
+			return s, cleanup
+		}
+
+		Convey("Should return nothing by default", func() {
+			s, cleanup := newSearch(&search.Config{})
+			defer cleanup()
+			So(searchJSON(s, ""), ShouldBeEmpty)
+		})
+
+		Convey("Should browse the most recently indexed pages", func() {
+			s, cleanup := newSearch(&search.Config{EmptyQueryBehavior: search.EmptyQueryRecent, EmptyQueryResults: 1})
+			defer cleanup()
+
+			So(searchJSON(s, "  "), ShouldHaveLength, 1)
+
+			results := searchJSONParams(s, url.Values{"scope": {"/amp/"}})
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/amp/install.html")
+			So(string(results[0].Body), ShouldNotBeEmpty)
+		})
+
+		Convey("Should return the configured message", func() {
+			s, cleanup := newSearch(&search.Config{EmptyQueryBehavior: search.EmptyQueryMessage, EmptyQueryMessage: "Type to search"})
+			defer cleanup()
+
+			results := s.Browse(search.SearchOptions{})
+			So(results.Message, ShouldEqual, "Type to search")
+			So(results.Results, ShouldBeEmpty)
+		})
+	})
+}
 
 func BenchmarkSearch(b *testing.B) {
 }
@@ -5,10 +5,18 @@ import (
 	"encoding/hex"
 	"fmt"
 	"html/template"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/mholt/caddy"
@@ -35,8 +43,18 @@ func Setup(c *caddy.Controller) (err error) {
 	}
 
 	index, err := NewIndexer(config.Engine, indexer.Config{
-		HostName:       config.HostName,
-		IndexDirectory: config.IndexDirectory,
+		HostName:            config.HostName,
+		IndexDirectory:      config.IndexDirectory,
+		SplitIdentifiers:    config.SplitIdentifiers,
+		Analyzer:            config.Analyzer,
+		Trigrams:            config.TrigramIndex,
+		MinContainsLength:   config.MinContainsLength,
+		MinPrefixMatch:      config.MinPrefixMatch,
+		Segmenters:          config.Segmenters,
+		MinTermDF:           config.MinTermDF,
+		CommentWeight:       config.commentWeight(),
+		IncrementalSections: config.IncrementalSections,
+		Options:             config.EngineOptions,
 	})
 
 	if err != nil {
@@ -52,7 +70,15 @@ func Setup(c *caddy.Controller) (err error) {
 	expire := time.NewTicker(config.Expire)
 	go func() {
 		var lastScanned indexer.Record
-		lastScanned = ScanToPipe(config.SiteRoot, ppl, index)
+		if config.RebuildOnStart {
+			var err error
+			if lastScanned, err = RebuildIndex(config, index); err != nil {
+				log.Printf("[search] rebuilding the index: %v", err)
+			}
+		} else {
+			lastScanned = ScanToPipe(config.SiteRoot, ppl, index)
+		}
+		ppl.MarkScanned()
 
 		for {
 			select {
@@ -60,14 +86,76 @@ func Setup(c *caddy.Controller) (err error) {
 				if lastScanned != nil && (!lastScanned.Indexed().IsZero() || lastScanned.Ignored()) {
 					lastScanned = ScanToPipe(config.SiteRoot, ppl, index)
 				}
+				if err := index.Prune(); err != nil {
+					log.Printf("[search] pruning rare terms: %v", err)
+				}
 			}
 		}
 	}()
 
-	search := &Search{
-		Config:   config,
-		Indexer:  index,
-		Pipeline: ppl,
+	if config.DocumentTTL > 0 {
+		go ppl.SweepEvery(config.sweepInterval())
+	}
+
+	search := NewSearch(config, index, ppl)
+
+	if config.ChangeFeed != "" && config.CrawlDisabled {
+		log.Printf("[search] crawling is off, not polling %s", config.ChangeFeed)
+	}
+	if len(config.SeedURLs) > 0 && config.CrawlDisabled {
+		log.Printf("[search] crawling is off, not fetching %d seed URLs", len(config.SeedURLs))
+	}
+
+	if (config.ChangeFeed != "" || len(config.SeedURLs) > 0) && !config.CrawlDisabled {
+		crawler := NewCrawler(config, index, ppl)
+		if err := crawler.Resume(crawlStateFile(config)); err != nil {
+			return err
+		}
+		crawler.Seed(config.SeedURLs)
+		if config.ChangeFeed != "" {
+			go NewChangeFeed(config.ChangeFeed, crawler).Watch(config.ChangeFeedInterval)
+		} else {
+			crawler.markListed()
+			if config.budgeted() {
+				go crawler.CycleEvery(config.ChangeFeedInterval)
+			}
+		}
+		search.Crawler = crawler
+	}
+
+	if config.AnalyticsLog != "" {
+		log, err := os.OpenFile(config.AnalyticsLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		search.Analytics = NewAnalytics(log)
+	}
+
+	if len(config.WarmQueries) > 0 {
+		go search.Warm(config.WarmQueries)
+	}
+
+	if config.AdminListen != "" {
+		// Caddy only listens for its sites, so the admin listener is
+		// opened once the instance starts and closed before a reload
+		// opens the next one
+		var closeAdmin func() error
+		c.OnStartup(func() error {
+			ln, err := listenAdmin(config.AdminListen)
+			if err != nil {
+				return fmt.Errorf("[search] admin listener: %v", err)
+			}
+			closeAdmin = search.ServeAdmin(ln)
+			return nil
+		})
+		shutdown := func() error {
+			if closeAdmin == nil {
+				return nil
+			}
+			return closeAdmin()
+		}
+		c.OnRestart(shutdown)
+		c.OnShutdown(shutdown)
 	}
 
 	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
@@ -78,6 +166,29 @@ func Setup(c *caddy.Controller) (err error) {
 	return
 }
 
+// rebuildPollInterval is how often a rebuild checks whether the documents it
+// scanned went through its pipeline
+const rebuildPollInterval = 50 * time.Millisecond
+
+// RebuildIndex indexes the site's files into a new index while the current
+// one keeps serving queries, and swaps it in once every file is indexed. It
+// returns the last file scanned.
+func RebuildIndex(config *Config, index indexer.Handler) (last indexer.Record, err error) {
+	err = index.Rebuild(func(staging indexer.Handler) error {
+		ppl, err := NewPipeline(config, staging)
+		if err != nil {
+			return err
+		}
+		last = ScanToPipe(config.SiteRoot, ppl, staging)
+		ppl.MarkScanned()
+		for !ppl.Settled() {
+			time.Sleep(rebuildPollInterval)
+		}
+		return nil
+	})
+	return last, err
+}
+
 // ScanToPipe ...
 func ScanToPipe(fp string, pipeline *Pipeline, index indexer.Handler) indexer.Record {
 	var last indexer.Record
@@ -121,23 +232,192 @@ func NewIndexer(engine string, config indexer.Config) (index indexer.Handler, er
 	name := filepath.Clean(config.IndexDirectory + string(filepath.Separator) + config.HostName)
 	switch engine {
 	default:
-		index, err = bleve.New(name)
+		index, err = bleve.New(name, config)
 	}
 	return
 }
 
+// validateEngineOptions reports the first option of the engine's block the
+// engine does not accept
+func validateEngineOptions(engine string, options map[string]string) error {
+	switch engine {
+	default:
+		return bleve.ValidateOptions(options)
+	}
+}
+
+// parseEngineOptions reads the key-value lines of the engine's block up to
+// its closing brace, which it consumes even when a line is invalid
+func parseEngineOptions(c *caddy.Controller) (map[string]string, error) {
+	options := make(map[string]string)
+	var err error
+	for c.Next() && c.Val() != "}" {
+		key := c.Val()
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			if err == nil {
+				err = c.Errf("[search]: `engine` option `%s` takes a single value", key)
+			}
+			continue
+		}
+		options[key] = args[0]
+	}
+	return options, err
+}
+
 // Config represents this middleware configuration structure
 type Config struct {
-	HostName       string
-	Engine         string
-	Path           string
-	IncludePaths   []*regexp.Regexp
-	ExcludePaths   []*regexp.Regexp
-	Endpoint       string
-	IndexDirectory string
-	Template       *template.Template
-	Expire         time.Duration
-	SiteRoot       string
+	HostName           string
+	Engine             string
+	Path               string
+	IncludePaths       []*regexp.Regexp
+	ExcludePaths       []*regexp.Regexp
+	Endpoint           string
+	IndexDirectory     string
+	Template           *template.Template
+	Expire             time.Duration
+	SiteRoot           string
+	TitleSuffix        string
+	Token              string
+	PushEndpoint       string
+	PushMaxSize        int64
+	PushBulkEndpoint   string
+	SplitIdentifiers   bool
+	SearchRate         float64
+	SearchBurst        int
+	SearchRateKey      string
+	SiteURL            string
+	ChangeFeed         string
+	ChangeFeedInterval time.Duration
+	DedupeTitles       bool
+	HealthEndpoint     string
+	HealthMinDocs      uint64
+	Analyzer           string
+	Language           string
+	DetectLanguage     bool
+	RecencyHalfLife    time.Duration
+	RecencyWeight      float64
+	ContentSelector    string
+	CommentSelectors   []string
+	CommentWeight      float64
+	AllowedOrigins     []string
+	SnippetStrategy    string
+	SnippetFormat      string
+	DepthBoost         float64
+	PathBoosts         []PathBoost
+	Soft404            bool
+	Soft404Markers     []string
+	PipelineWorkers    map[string]int
+	MaxResults         int
+	CrawlHeaders       http.Header
+	CrawlIgnoreParams  []string
+	TrigramIndex       bool
+	EmptyQueryBehavior string
+	EmptyQueryResults  int
+	EmptyQueryMessage  string
+	MinContainsLength  int
+	AnalyticsEndpoint  string
+	AnalyticsLog       string
+	ClickEndpoint      string
+	ClickHalfLife      time.Duration
+	ClickWeight        float64
+	WarmQueries        []string
+	MinPrefixMatch     int
+	SkipVariants       bool
+	CrawlStateEndpoint string
+	Segmenters         map[string]string
+	CrawlDisabled      bool
+	ExportEndpoint     string
+	MinTermDF          int
+	VersionPattern     *regexp.Regexp
+	SeedURLs           []string
+	// MaxConcurrentQueries caps the queries run at once; the others wait
+	// up to QueryQueueTimeout and are then rejected
+	MaxConcurrentQueries int
+	QueryQueueTimeout    time.Duration
+	// IndexBodyPrefixWords, when set, keeps only that many leading words of
+	// each body, in the index and for snippets
+	IndexBodyPrefixWords int
+	ScoreExpression      *ScoreExpression
+	ExcerptSources       []string
+	TrailingSlash        string
+	MatchedTerms         bool
+	IndexHeaders         []string
+	// DiversifyRun, when set, caps the consecutive results sharing one of
+	// the DiversifyPrefixes
+	DiversifyRun      int
+	DiversifyPrefixes []string
+	CrawlUpstream     string
+	ExactTitleBoost   float64
+	// TemplateFallbackDisabled answers with an error rather than the
+	// default template when the configured one fails to render
+	TemplateFallbackDisabled bool
+	DistinctTitles           string
+	// MaxCrawlPages and MaxCrawlDuration bound each crawl cycle
+	MaxCrawlPages    int
+	MaxCrawlDuration time.Duration
+	// InstantSuggestions and InstantResults limit the answers of the
+	// instant search mode
+	InstantSuggestions int
+	InstantResults     int
+	// CrawlOnlyPaths match the listing pages crawled for their links but
+	// never indexed
+	CrawlOnlyPaths  []*regexp.Regexp
+	InspectEndpoint string
+	// RebuildOnStart indexes the site's files into a new index on start,
+	// swapped in once complete, rather than into the stored one
+	RebuildOnStart bool
+	// ResultURL renders the link of each result from its path
+	ResultURL *texttemplate.Template
+	// IndexTables flattens every table row into a line of cells prefixed
+	// with the header of their column
+	IndexTables bool
+	// QuerySyntax is how the operators of queries are read,
+	// QuerySyntaxFull by default
+	QuerySyntax string
+	// MaxQueryTerms caps the terms of a query; longer ones are cut down
+	// or rejected as MaxQueryTermsAction says
+	MaxQueryTerms       int
+	MaxQueryTermsAction string
+	// AdminListen is the address, or unix: socket, the administrative
+	// endpoints are served on instead of the site's listener
+	AdminListen string
+	// HighlightMatches is how much of a matching word is marked,
+	// HighlightWhole by default
+	HighlightMatches string
+	// DeepLinks links results to the section of their page holding their
+	// best match
+	DeepLinks bool
+	// PositionDecay is the number of words after which a term occurring
+	// further down a page weighs half as much, favouring the pages that
+	// mention the query near their top
+	PositionDecay int
+	// RecentSearches is the number of popular recent searches suggested to
+	// an empty instant search, whose counts halve every
+	// RecentSearchesHalfLife
+	RecentSearches         int
+	RecentSearchesHalfLife time.Duration
+	// SkipElements are the names of the elements, such as custom elements
+	// rendering banners, whose text is left out of the body
+	SkipElements []string
+	// DedupeURLs collapses the results whose paths only differ by the
+	// parameters of crawl_ignore_params
+	DedupeURLs bool
+	// EngineOptions are the engine-specific options of the engine block
+	EngineOptions map[string]string
+	// Translations lists with each result the indexed translations its
+	// page links to with hreflang
+	Translations bool
+	// DocumentTTL, when set, removes the documents not seen by any crawl,
+	// scan or push for that long, looked for every DocumentTTLSweep
+	DocumentTTL      time.Duration
+	DocumentTTLSweep time.Duration
+	// SearchRateProxies are the proxies trusted to set SearchRateKey;
+	// requests from elsewhere are told apart by their address
+	SearchRateProxies []*net.IPNet
+	// IncrementalSections marks the sections of pages even without
+	// DeepLinks, so the index only analyzes those changed
+	IncrementalSections bool
 }
 
 // ParseSearchConfig controller information to create a IndexSearch config
@@ -146,20 +426,32 @@ func ParseSearchConfig(c *caddy.Controller, cnf *httpserver.SiteConfig) (*Config
 	hosthash.Write([]byte(cnf.Host()))
 
 	conf := &Config{
-		HostName:       hex.EncodeToString(hosthash.Sum(nil)),
-		Engine:         `bleve`,
-		IndexDirectory: `/tmp/caddyIndex`,
-		IncludePaths:   []*regexp.Regexp{},
-		ExcludePaths:   []*regexp.Regexp{},
-		Endpoint:       `/search`,
-		SiteRoot:       cnf.Root,
-		Expire:         60 * time.Second,
-		Template:       nil,
+		HostName:           hex.EncodeToString(hosthash.Sum(nil)),
+		Engine:             `bleve`,
+		IndexDirectory:     `/tmp/caddyIndex`,
+		IncludePaths:       []*regexp.Regexp{},
+		ExcludePaths:       []*regexp.Regexp{},
+		Endpoint:           `/search`,
+		SiteRoot:           cnf.Root,
+		SiteURL:            siteURL(cnf),
+		Expire:             60 * time.Second,
+		Template:           nil,
+		PushMaxSize:        1 << 20,
+		ChangeFeedInterval: 5 * time.Minute,
+		RecencyWeight:      1,
+		ClickWeight:        1,
+		CommentWeight:      defaultCommentWeight,
+		SnippetStrategy:    indexer.SnippetLeading,
+		MaxResults:         1000,
+		EmptyQueryBehavior: EmptyQueryNone,
+		EmptyQueryResults:  10,
 	}
 
+	var errs configErrors
+
 	_, err := os.Stat(conf.SiteRoot)
 	if err != nil {
-		return nil, c.Err("[search]: `invalid root directory`")
+		errs = append(errs, c.Err("[search]: `invalid root directory`"))
 	}
 
 	incPaths := []string{}
@@ -177,62 +469,64 @@ func ParseSearchConfig(c *caddy.Controller, cnf *httpserver.SiteConfig) (*Config
 		}
 
 		for c.NextBlock() {
-			switch c.Val() {
-			case "engine":
-				if !c.NextArg() {
-					return nil, c.ArgErr()
-				}
-				conf.Engine = c.Val()
-			case "+path":
-				if !c.NextArg() {
-					return nil, c.ArgErr()
-				}
-				incPaths = append(incPaths, c.Val())
-				incPaths = append(incPaths, c.RemainingArgs()...)
-			case "-path":
-				if !c.NextArg() {
-					return nil, c.ArgErr()
-				}
-				excPaths = append(excPaths, c.Val())
-				excPaths = append(excPaths, c.RemainingArgs()...)
-			case "endpoint":
-				if !c.NextArg() {
-					return nil, c.ArgErr()
-				}
-				conf.Endpoint = c.Val()
-			case "expire":
-				if !c.NextArg() {
-					return nil, c.ArgErr()
-				}
-				exp, err := strconv.Atoi(c.Val())
-				if err != nil {
-					return nil, err
-				}
-				conf.Expire = time.Duration(exp) * time.Second
-			case "datadir":
-				if !c.NextArg() {
-					return nil, c.ArgErr()
-				}
-				conf.IndexDirectory = c.Val()
-			case "template":
-				var err error
-				if c.NextArg() {
-					conf.Template, err = template.ParseFiles(filepath.Join(conf.SiteRoot, c.Val()))
-					if err != nil {
-						fmt.Println(err)
-						return nil, err
-					}
-				}
+			if err := parseProperty(c, conf, &incPaths, &excPaths); err != nil {
+				errs = append(errs, err)
+				c.RemainingArgs()
 			}
 		}
 	}
 
+	if conf.PushEndpoint != "" && conf.Token == "" {
+		errs = append(errs, c.Err("[search]: `push` requires a `token`"))
+	}
+	if conf.PushBulkEndpoint != "" && conf.Token == "" {
+		errs = append(errs, c.Err("[search]: `push_bulk` requires a `token`"))
+	}
+	if conf.ExportEndpoint != "" && conf.Token == "" {
+		errs = append(errs, c.Err("[search]: `export` requires a `token`"))
+	}
+
+	if conf.InspectEndpoint != "" && conf.Token == "" {
+		errs = append(errs, c.Err("[search]: `inspect` requires a `token`"))
+	}
+
+	if conf.AnalyticsEndpoint != "" && conf.Token == "" {
+		errs = append(errs, c.Err("[search]: `analytics` requires a `token`"))
+	}
+	if conf.DedupeURLs && len(conf.CrawlIgnoreParams) == 0 {
+		errs = append(errs, c.Err("[search]: `dedupe_urls` requires `crawl_ignore_params`"))
+	}
+	if conf.AnalyticsLog != "" && conf.AnalyticsEndpoint == "" {
+		errs = append(errs, c.Err("[search]: `analytics_log` requires `analytics`"))
+	}
+
+	if conf.CrawlStateEndpoint != "" && conf.Token == "" {
+		errs = append(errs, c.Err("[search]: `crawl_state` requires a `token`"))
+	}
+	if conf.CrawlStateEndpoint != "" && conf.ChangeFeed == "" && len(conf.SeedURLs) == 0 {
+		errs = append(errs, c.Err("[search]: `crawl_state` requires a `change_feed` or `seed_urls`"))
+	}
+
+	if conf.ClickEndpoint != "" && conf.ClickHalfLife == 0 {
+		errs = append(errs, c.Err("[search]: `click_endpoint` requires `click_boost`"))
+	}
+	if conf.ClickHalfLife > 0 && conf.ClickEndpoint == "" {
+		conf.ClickEndpoint = `/search/click`
+	}
+
 	if len(incPaths) == 0 {
 		incPaths = append(incPaths, "^/")
 	}
 
-	conf.IncludePaths = ConvertToRegExp(incPaths)
-	conf.ExcludePaths = ConvertToRegExp(excPaths)
+	var patternErrs []error
+	conf.IncludePaths, patternErrs = compilePatterns(c, incPaths)
+	errs = append(errs, patternErrs...)
+	conf.ExcludePaths, patternErrs = compilePatterns(c, excPaths)
+	errs = append(errs, patternErrs...)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
 
 	dir := conf.IndexDirectory
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -242,14 +536,864 @@ func ParseSearchConfig(c *caddy.Controller, cnf *httpserver.SiteConfig) (*Config
 	}
 
 	if conf.Template == nil {
+		conf.Template = fallbackTemplate
+	}
+
+	return conf, nil
+}
+
+// parseProperty parses the property of a search block at the controller's
+// current token into conf
+func parseProperty(c *caddy.Controller, conf *Config, incPaths, excPaths *[]string) error {
+	switch c.Val() {
+	case "engine":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.Engine = c.Val()
+		if !c.NextArg() {
+			break
+		}
+		if c.Val() != "{" {
+			return c.ArgErr()
+		}
+		options, err := parseEngineOptions(c)
+		if err != nil {
+			return err
+		}
+		if err := validateEngineOptions(conf.Engine, options); err != nil {
+			return c.Errf("[search]: `engine %s` option: %v", conf.Engine, err)
+		}
+		conf.EngineOptions = options
+	case "+path":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		*incPaths = append(*incPaths, c.Val())
+		*incPaths = append(*incPaths, c.RemainingArgs()...)
+	case "-path":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		*excPaths = append(*excPaths, c.Val())
+		*excPaths = append(*excPaths, c.RemainingArgs()...)
+	case "endpoint":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.Endpoint = c.Val()
+	case "expire":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		exp, err := strconv.Atoi(c.Val())
+		if err != nil || exp <= 0 {
+			return c.Err("[search]: `expire` must be a positive number of seconds")
+		}
+		conf.Expire = time.Duration(exp) * time.Second
+	case "datadir":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.IndexDirectory = c.Val()
+	case "title_suffix":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.TitleSuffix = strings.Join(strings.Fields(c.Val()), " ")
+	case "token":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.Token = c.Val()
+	case "push":
+		conf.PushEndpoint = `/search/push`
+		if c.NextArg() {
+			conf.PushEndpoint = c.Val()
+		}
+	case "push_bulk":
+		conf.PushBulkEndpoint = `/search/push/bulk`
+		if c.NextArg() {
+			conf.PushBulkEndpoint = c.Val()
+		}
+	case "export":
+		conf.ExportEndpoint = `/search/export`
+		if c.NextArg() {
+			conf.ExportEndpoint = c.Val()
+		}
+	case "push_max_size":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		size, err := strconv.ParseInt(c.Val(), 10, 64)
+		if err != nil || size <= 0 {
+			return c.Err("[search]: `push_max_size` must be a positive number of bytes")
+		}
+		conf.PushMaxSize = size
+	case "search_rate":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		rate, err := parseRate(args[0])
+		if err != nil {
+			return c.Err("[search]: `search_rate` " + err.Error())
+		}
+		conf.SearchRate = rate
+		conf.SearchBurst = int(math.Ceil(rate))
+		if len(args) == 2 {
+			burst, err := strconv.Atoi(args[1])
+			if err != nil || burst < 1 {
+				return c.Err("[search]: `search_rate` burst must be a positive number")
+			}
+			conf.SearchBurst = burst
+		}
+	case "max_concurrent_queries":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		max, err := strconv.Atoi(args[0])
+		if err != nil || max < 1 {
+			return c.Err("[search]: `max_concurrent_queries` must be a positive number")
+		}
+		conf.MaxConcurrentQueries = max
+		if len(args) == 2 {
+			wait, err := time.ParseDuration(args[1])
+			if err != nil || wait < 0 {
+				return c.Errf("[search]: invalid `max_concurrent_queries` wait `%s`", args[1])
+			}
+			conf.QueryQueueTimeout = wait
+		}
+	case "search_rate_key":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.SearchRateKey = c.Val()
+		for _, arg := range c.RemainingArgs() {
+			proxy, err := parseNetwork(arg)
+			if err != nil {
+				return c.Errf("[search]: invalid `search_rate_key` proxy `%s`", arg)
+			}
+			conf.SearchRateProxies = append(conf.SearchRateProxies, proxy)
+		}
+		if len(conf.SearchRateProxies) == 0 {
+			// any client could pick its own key and so escape the limit
+			return c.Err("[search]: `search_rate_key` requires the proxies trusted to set it")
+		}
+	case "change_feed":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.ChangeFeed = c.Val()
+		if c.NextArg() {
+			interval, err := strconv.Atoi(c.Val())
+			if err != nil || interval <= 0 {
+				return c.Err("[search]: `change_feed` interval must be a positive number of seconds")
+			}
+			conf.ChangeFeedInterval = time.Duration(interval) * time.Second
+		}
+	case "inspect":
+		conf.InspectEndpoint = `/search/inspect`
+		if c.NextArg() {
+			conf.InspectEndpoint = c.Val()
+		}
+	case "health":
+		conf.HealthEndpoint = `/search/health`
+		if c.NextArg() {
+			conf.HealthEndpoint = c.Val()
+		}
+	case "analytics":
+		conf.AnalyticsEndpoint = `/search/analytics`
+		if c.NextArg() {
+			conf.AnalyticsEndpoint = c.Val()
+		}
+	case "crawl_state":
+		conf.CrawlStateEndpoint = `/search/crawl`
+		if c.NextArg() {
+			conf.CrawlStateEndpoint = c.Val()
+		}
+	case "analytics_log":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.AnalyticsLog = c.Val()
+	case "health_min_docs":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		min, err := strconv.ParseUint(c.Val(), 10, 64)
+		if err != nil {
+			return c.Err("[search]: `health_min_docs` must be a number of documents")
+		}
+		conf.HealthMinDocs = min
+	case "dedupe_urls":
+		conf.DedupeURLs = true
+	case "dedupe_titles":
+		conf.DedupeTitles = true
+	case "distinct_titles":
+		conf.DistinctTitles = DistinctTitleDirectory
+		if c.NextArg() {
+			switch c.Val() {
+			case DistinctTitleDirectory, DistinctTitleBreadcrumb, DistinctTitlePath:
+				conf.DistinctTitles = c.Val()
+			default:
+				return c.Errf("[search]: unknown distinct_titles `%s` (available: %s, %s, %s)", c.Val(),
+					DistinctTitleDirectory, DistinctTitleBreadcrumb, DistinctTitlePath)
+			}
+		}
+	case "result_url":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		tmpl, err := parseResultURL(c.Val())
+		if err != nil {
+			return c.Errf("[search]: invalid `result_url` template: %v", err)
+		}
+		conf.ResultURL = tmpl
+	case "max_query_terms":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		max, err := strconv.Atoi(c.Val())
+		if err != nil || max < 1 {
+			return c.Err("[search]: `max_query_terms` must be a positive number")
+		}
+		conf.MaxQueryTerms = max
+		conf.MaxQueryTermsAction = QueryTermsTruncate
+		if c.NextArg() {
+			switch c.Val() {
+			case QueryTermsTruncate, QueryTermsReject:
+				conf.MaxQueryTermsAction = c.Val()
+			default:
+				return c.Errf("[search]: unknown `max_query_terms` action `%s` (available: %s, %s)", c.Val(),
+					QueryTermsTruncate, QueryTermsReject)
+			}
+		}
+	case "document_ttl":
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		ttl, err := time.ParseDuration(args[0])
+		if err != nil || ttl <= 0 {
+			return c.Err("[search]: `document_ttl` must be a positive duration (e.g. 720h)")
+		}
+		conf.DocumentTTL = ttl
+		if len(args) == 2 {
+			interval, err := time.ParseDuration(args[1])
+			if err != nil || interval <= 0 {
+				return c.Err("[search]: `document_ttl` sweep interval must be a positive duration (e.g. 1h)")
+			}
+			conf.DocumentTTLSweep = interval
+		}
+	case "translations":
+		conf.Translations = true
+	case "deep_links":
+		conf.DeepLinks = true
+	case "incremental_sections":
+		conf.IncrementalSections = true
+	case "highlight_matches":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch c.Val() {
+		case HighlightWhole, HighlightPartial:
+			conf.HighlightMatches = c.Val()
+		default:
+			return c.Errf("[search]: unknown highlight_matches `%s` (available: %s, %s)", c.Val(),
+				HighlightWhole, HighlightPartial)
+		}
+	case "admin_listen":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if _, _, err := parseAdminListen(c.Val()); err != nil {
+			return c.Errf("[search]: invalid `admin_listen` address `%s`: %v", c.Val(), err)
+		}
+		conf.AdminListen = c.Val()
+	case "query_syntax":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch c.Val() {
+		case QuerySyntaxFull, QuerySyntaxLiteral:
+			conf.QuerySyntax = c.Val()
+		default:
+			return c.Errf("[search]: unknown query_syntax `%s` (available: %s, %s)", c.Val(),
+				QuerySyntaxFull, QuerySyntaxLiteral)
+		}
+	case "index_tables":
+		conf.IndexTables = true
+	case "rebuild_on_start":
+		conf.RebuildOnStart = true
+	case "matched_terms":
+		conf.MatchedTerms = true
+	case "analyzer":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if _, ok := indexer.GetAnalyzer(c.Val()); !ok {
+			return c.Errf("[search]: unknown analyzer `%s` (available: %s)", c.Val(), strings.Join(indexer.Analyzers(), ", "))
+		}
+		conf.Analyzer = c.Val()
+	case "language":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.Language = strings.ToLower(c.Val())
+	case "segmenter":
+		args := c.RemainingArgs()
+		if len(args) != 2 {
+			return c.ArgErr()
+		}
+		if _, ok := indexer.GetAnalyzer(args[1]); !ok {
+			return c.Errf("[search]: unknown analyzer `%s` (available: %s)", args[1], strings.Join(indexer.Analyzers(), ", "))
+		}
+		if conf.Segmenters == nil {
+			conf.Segmenters = make(map[string]string)
+		}
+		conf.Segmenters[strings.ToLower(args[0])] = args[1]
+	case "detect_language":
+		conf.DetectLanguage = true
+	case "recency_boost":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		halfLife, err := time.ParseDuration(args[0])
+		if err != nil || halfLife <= 0 {
+			return c.Err("[search]: `recency_boost` half-life must be a positive duration (e.g. 168h)")
+		}
+		conf.RecencyHalfLife = halfLife
+		if len(args) == 2 {
+			weight, err := strconv.ParseFloat(args[1], 64)
+			if err != nil || weight <= 0 {
+				return c.Err("[search]: `recency_boost` weight must be a positive number")
+			}
+			conf.RecencyWeight = weight
+		}
+	case "click_boost":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		halfLife, err := time.ParseDuration(args[0])
+		if err != nil || halfLife <= 0 {
+			return c.Err("[search]: `click_boost` half-life must be a positive duration (e.g. 168h)")
+		}
+		conf.ClickHalfLife = halfLife
+		if len(args) == 2 {
+			weight, err := strconv.ParseFloat(args[1], 64)
+			if err != nil || weight <= 0 {
+				return c.Err("[search]: `click_boost` weight must be a positive number")
+			}
+			conf.ClickWeight = weight
+		}
+	case "click_endpoint":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		conf.ClickEndpoint = c.Val()
+	case "content_selector":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if _, err := parseSelector(c.Val()); err != nil {
+			return c.Err("[search]: `content_selector` " + err.Error() + " (use a tag name, #id or .class)")
+		}
+		conf.ContentSelector = c.Val()
+	case "skip_elements":
+		names := c.RemainingArgs()
+		if len(names) == 0 {
+			return c.ArgErr()
+		}
+		for _, name := range names {
+			if strings.ContainsAny(name, " \t#.[]:*,>+~") {
+				return c.Errf("[search]: `skip_elements` takes element names, not selectors (`%s`)", name)
+			}
+			conf.SkipElements = append(conf.SkipElements, strings.ToLower(name))
+		}
+	case "comment_selector":
+		selectors := c.RemainingArgs()
+		if len(selectors) == 0 {
+			return c.ArgErr()
+		}
+		for _, raw := range selectors {
+			if _, err := parseSelector(raw); err != nil {
+				return c.Err("[search]: `comment_selector` " + err.Error() + " (use a tag name, #id or .class)")
+			}
+		}
+		conf.CommentSelectors = append(conf.CommentSelectors, selectors...)
+	case "index_headers":
+		names := c.RemainingArgs()
+		if len(names) == 0 {
+			return c.ArgErr()
+		}
+		for _, name := range names {
+			if _, ok := headerField(name); !ok {
+				return c.Errf("[search]: `index_headers` cannot store header `%s` (use names of letters, digits and dashes, up to %d characters)", name, maxFieldName)
+			}
+			conf.IndexHeaders = append(conf.IndexHeaders, http.CanonicalHeaderKey(name))
+		}
+		if len(conf.IndexHeaders) > maxIndexHeaders {
+			return c.Errf("[search]: `index_headers` names more than %d headers", maxIndexHeaders)
+		}
+	case "index_body_prefix_words":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(c.Val())
+		if err != nil || n <= 0 {
+			return c.Err("[search]: `index_body_prefix_words` must be a positive number of words")
+		}
+		conf.IndexBodyPrefixWords = n
+	case "diversify":
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return c.Err("[search]: `diversify` must start with a positive number of results")
+		}
+		for _, prefix := range args[1:] {
+			if !strings.HasPrefix(prefix, "/") {
+				return c.Errf("[search]: `diversify` prefix `%s` must start with /", prefix)
+			}
+		}
+		conf.DiversifyRun = n
+		conf.DiversifyPrefixes = append(conf.DiversifyPrefixes, args[1:]...)
+	case "score_expression":
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		expr, err := ParseScoreExpression(strings.Join(args, " "))
+		if err != nil {
+			return c.Errf("[search]: invalid `score_expression`: %v", err)
+		}
+		conf.ScoreExpression = expr
+	case "excerpt_source":
+		sources := c.RemainingArgs()
+		if len(sources) == 0 {
+			return c.ArgErr()
+		}
+		for _, source := range sources {
+			switch source {
+			case indexer.ExcerptFrontMatter, indexer.ExcerptMeta, indexer.ExcerptGenerated:
+			default:
+				return c.Errf("[search]: unknown excerpt_source `%s` (available: %s, %s, %s)", source,
+					indexer.ExcerptFrontMatter, indexer.ExcerptMeta, indexer.ExcerptGenerated)
+			}
+		}
+		conf.ExcerptSources = sources
+	case "trailing_slash":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch c.Val() {
+		case TrailingSlashKeep, TrailingSlashStrip, TrailingSlashAdd:
+			conf.TrailingSlash = c.Val()
+		default:
+			return c.Errf("[search]: unknown trailing_slash `%s` (available: %s, %s, %s)", c.Val(),
+				TrailingSlashKeep, TrailingSlashStrip, TrailingSlashAdd)
+		}
+	case "comment_weight":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		weight, err := strconv.ParseFloat(c.Val(), 64)
+		if err != nil || weight <= 0 {
+			return c.Err("[search]: `comment_weight` must be a positive number")
+		}
+		conf.CommentWeight = weight
+	case "allowed_origins":
+		origins := c.RemainingArgs()
+		if len(origins) == 0 {
+			return c.ArgErr()
+		}
+		for _, origin := range origins {
+			conf.AllowedOrigins = append(conf.AllowedOrigins, strings.TrimSuffix(origin, "/"))
+		}
+	case "crawl":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch c.Val() {
+		case "on":
+			conf.CrawlDisabled = false
+		case "off":
+			conf.CrawlDisabled = true
+		default:
+			return c.Errf("[search]: `crawl` must be `on` or `off`, not `%s`", c.Val())
+		}
+	case "template_fallback":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch c.Val() {
+		case "on":
+			conf.TemplateFallbackDisabled = false
+		case "off":
+			conf.TemplateFallbackDisabled = true
+		default:
+			return c.Errf("[search]: `template_fallback` must be `on` or `off`, not `%s`", c.Val())
+		}
+	case "max_crawl_pages":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(c.Val())
+		if err != nil || n <= 0 {
+			return c.Err("[search]: `max_crawl_pages` must be a positive number of pages")
+		}
+		conf.MaxCrawlPages = n
+	case "max_crawl_duration":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		d, err := time.ParseDuration(c.Val())
+		if err != nil || d <= 0 {
+			return c.Err("[search]: `max_crawl_duration` must be a positive duration (e.g. 30m)")
+		}
+		conf.MaxCrawlDuration = d
+	case "instant_limits":
+		args := c.RemainingArgs()
+		if len(args) != 2 {
+			return c.ArgErr()
+		}
+		suggestions, err := strconv.Atoi(args[0])
+		if err != nil || suggestions <= 0 {
+			return c.Err("[search]: `instant_limits` must be a positive number of suggestions")
+		}
+		results, err := strconv.Atoi(args[1])
+		if err != nil || results <= 0 {
+			return c.Err("[search]: `instant_limits` must be a positive number of results")
+		}
+		conf.InstantSuggestions, conf.InstantResults = suggestions, results
+	case "recent_searches":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		size, err := strconv.Atoi(c.Val())
+		if err != nil || size < 1 {
+			return c.Err("[search]: `recent_searches` must be a positive number of searches")
+		}
+		conf.RecentSearches = size
+		if c.NextArg() {
+			d, err := time.ParseDuration(c.Val())
+			if err != nil || d <= 0 {
+				return c.Err("[search]: `recent_searches` half-life must be a positive duration (e.g. 24h)")
+			}
+			conf.RecentSearchesHalfLife = d
+		}
+	case "crawl_only":
+		patterns := c.RemainingArgs()
+		if len(patterns) == 0 {
+			return c.ArgErr()
+		}
+		for _, pattern := range patterns {
+			rule, err := regexp.Compile(pattern)
+			if err != nil {
+				return c.Errf("[search]: invalid crawl_only pattern `%s`: %v", pattern, err)
+			}
+			conf.CrawlOnlyPaths = append(conf.CrawlOnlyPaths, rule)
+		}
+	case "crawl_header":
+		args := c.RemainingArgs()
+		if len(args) != 2 {
+			return c.ArgErr()
+		}
+		if conf.CrawlHeaders == nil {
+			conf.CrawlHeaders = make(http.Header)
+		}
+		conf.CrawlHeaders.Add(args[0], args[1])
+	case "crawl_upstream":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		u, err := url.Parse(c.Val())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+			return c.Errf("[search]: `crawl_upstream` must be an http or https origin such as http://app:8080, not `%s`", c.Val())
+		}
+		conf.CrawlUpstream = u.Scheme + "://" + u.Host
+	case "crawl_ignore_params":
+		params := c.RemainingArgs()
+		if len(params) == 0 {
+			return c.ArgErr()
+		}
+		for _, param := range params {
+			if _, err := path.Match(param, ""); err != nil {
+				return c.Errf("[search]: invalid crawl_ignore_params pattern `%s`", param)
+			}
+		}
+		conf.CrawlIgnoreParams = append(conf.CrawlIgnoreParams, params...)
+	case "snippet_strategy":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch c.Val() {
+		case indexer.SnippetLeading, indexer.SnippetBestMatch, indexer.SnippetMeta:
+			conf.SnippetStrategy = c.Val()
+		default:
+			return c.Errf("[search]: unknown snippet_strategy `%s` (available: %s, %s, %s)", c.Val(),
+				indexer.SnippetLeading, indexer.SnippetBestMatch, indexer.SnippetMeta)
+		}
+	case "snippet_format":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch c.Val() {
+		case SnippetFormatHTML, SnippetFormatPlain:
+			conf.SnippetFormat = c.Val()
+		default:
+			return c.Errf("[search]: unknown snippet_format `%s` (available: %s, %s)", c.Val(), SnippetFormatHTML, SnippetFormatPlain)
+		}
+	case "depth_boost":
+		conf.DepthBoost = 1
+		if c.NextArg() {
+			weight, err := strconv.ParseFloat(c.Val(), 64)
+			if err != nil || weight <= 0 {
+				return c.Err("[search]: `depth_boost` weight must be a positive number")
+			}
+			conf.DepthBoost = weight
+		}
+	case "position_decay":
+		conf.PositionDecay = defaultPositionDecay
+		if c.NextArg() {
+			words, err := strconv.Atoi(c.Val())
+			if err != nil || words < 1 {
+				return c.Err("[search]: `position_decay` words must be a positive number")
+			}
+			conf.PositionDecay = words
+		}
+	case "exact_title_boost":
+		conf.ExactTitleBoost = defaultExactTitleBoost
+		if c.NextArg() {
+			factor, err := strconv.ParseFloat(c.Val(), 64)
+			if err != nil || factor <= 1 {
+				return c.Err("[search]: `exact_title_boost` factor must be a number greater than 1")
+			}
+			conf.ExactTitleBoost = factor
+		}
+	case "boost":
+		args := c.RemainingArgs()
+		if len(args) != 2 {
+			return c.ArgErr()
+		}
+		factor, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || factor <= 0 {
+			return c.Err("[search]: `boost` factor must be a positive number")
+		}
+		conf.PathBoosts = append(conf.PathBoosts, PathBoost{Prefix: args[0], Factor: factor})
+	case "soft_404_markers":
+		conf.Soft404 = true
+		conf.Soft404Markers = append(conf.Soft404Markers, c.RemainingArgs()...)
+	case "pipeline_workers":
+		args := c.RemainingArgs()
+		stages := pipelineStages
+		switch len(args) {
+		case 1:
+		case 2:
+			stages = []string{args[0]}
+			args = args[1:]
+		default:
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return c.Err("[search]: `pipeline_workers` must be a positive number of workers")
+		}
+		for _, stage := range stages {
+			if !isPipelineStage(stage) {
+				return c.Errf("[search]: unknown pipeline stage `%s` (available: %s)", stage, strings.Join(pipelineStages, ", "))
+			}
+			if conf.PipelineWorkers == nil {
+				conf.PipelineWorkers = make(map[string]int)
+			}
+			conf.PipelineWorkers[stage] = n
+		}
+	case "max_results":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		max, err := strconv.Atoi(c.Val())
+		if err != nil || max < 1 {
+			return c.Err("[search]: `max_results` must be a positive number")
+		}
+		conf.MaxResults = max
+	case "empty_query_behavior":
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		switch args[0] {
+		case EmptyQueryNone:
+			if len(args) != 1 {
+				return c.ArgErr()
+			}
+		case EmptyQueryRecent:
+			if len(args) > 2 {
+				return c.ArgErr()
+			}
+			if len(args) == 2 {
+				n, err := strconv.Atoi(args[1])
+				if err != nil || n < 1 {
+					return c.Err("[search]: `empty_query_behavior recent` count must be a positive number")
+				}
+				conf.EmptyQueryResults = n
+			}
+		case EmptyQueryMessage:
+			if len(args) != 2 {
+				return c.ArgErr()
+			}
+			conf.EmptyQueryMessage = args[1]
+		default:
+			return c.Errf("[search]: unknown empty_query_behavior `%s` (available: %s, %s, %s)", args[0],
+				EmptyQueryNone, EmptyQueryRecent, EmptyQueryMessage)
+		}
+		conf.EmptyQueryBehavior = args[0]
+	case "trigram_index":
+		conf.TrigramIndex = true
+		conf.MinContainsLength = 3
+		if c.NextArg() {
+			min, err := strconv.Atoi(c.Val())
+			if err != nil || min < 3 {
+				return c.Err("[search]: `trigram_index` minimum length must be a number of at least 3")
+			}
+			conf.MinContainsLength = min
+		}
+	case "warm_queries":
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		if args[0] == "file" && len(args) == 2 {
+			queries, err := readListFile(args[1])
+			if err != nil {
+				return c.Errf("[search]: `warm_queries` %v", err)
+			}
+			args = queries
+		}
+		conf.WarmQueries = append(conf.WarmQueries, args...)
+	case "seed_urls":
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		if args[0] == "file" && len(args) == 2 {
+			urls, err := readListFile(args[1])
+			if err != nil {
+				return c.Errf("[search]: `seed_urls` %v", err)
+			}
+			args = urls
+		}
+		conf.SeedURLs = append(conf.SeedURLs, args...)
+	case "min_prefix_match":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		min, err := strconv.Atoi(c.Val())
+		if err != nil || min < 1 {
+			return c.Err("[search]: `min_prefix_match` must be a positive number")
+		}
+		conf.MinPrefixMatch = min
+	case "version_pattern":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		pattern, err := regexp.Compile(c.Val())
+		if err != nil {
+			return c.Errf("[search]: invalid version_pattern `%s`", c.Val())
+		}
+		conf.VersionPattern = pattern
+	case "min_term_df":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		min, err := strconv.Atoi(c.Val())
+		if err != nil || min < 1 {
+			return c.Err("[search]: `min_term_df` must be a positive number")
+		}
+		conf.MinTermDF = min
+	case "skip_variants":
+		conf.SkipVariants = true
+	case "split_identifiers":
+		conf.SplitIdentifiers = true
+	case "template":
 		var err error
-		conf.Template, err = template.New("search-results").Parse(defaultTemplate)
+		if c.NextArg() {
+			file := filepath.Join(conf.SiteRoot, c.Val())
+			conf.Template, err = resultsTemplate(filepath.Base(file)).ParseFiles(file)
+			if err != nil {
+				return c.Errf("[search]: `template` %v", err)
+			}
+		}
+	default:
+		return c.Errf("[search]: unknown property `%s`", c.Val())
+	}
+
+	return nil
+}
+
+// isPipelineStage reports whether name is a stage of the pipeline
+func isPipelineStage(name string) bool {
+	for _, stage := range pipelineStages {
+		if stage == name {
+			return true
+		}
+	}
+	return false
+}
+
+// configErrors collects every problem found in a search configuration so
+// they are all reported at once
+type configErrors []error
+
+func (errs configErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// compilePatterns compiles the path regular expressions of a search block,
+// returning an error for each invalid one
+func compilePatterns(c *caddy.Controller, patterns []string) ([]*regexp.Regexp, []error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	var errs []error
+	for _, pattern := range patterns {
+		rule, err := regexp.Compile(pattern)
 		if err != nil {
-			return nil, err
+			errs = append(errs, c.Errf("[search]: invalid path pattern `%s`: %v", pattern, err))
+			continue
 		}
+		compiled = append(compiled, rule)
 	}
+	return compiled, errs
+}
 
-	return conf, nil
+// siteURL returns the base URL the crawler uses to fetch the site's pages
+func siteURL(cnf *httpserver.SiteConfig) string {
+	scheme := cnf.Addr.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if cnf.Addr.Port == "443" {
+			scheme = "https"
+		}
+	}
+
+	host := cnf.Addr.Host
+	if host == "" || strings.Contains(host, "*") {
+		host = "localhost"
+	}
+	if cnf.Addr.Port != "" {
+		host = net.JoinHostPort(host, cnf.Addr.Port)
+	}
+
+	return scheme + "://" + host
 }
 
 // ConvertToRegExp compile a string regular expression to multiple *regexp.Regexp instances
@@ -319,6 +1463,13 @@ li {
 li {
 	margin-top: 15px;
 }
+
+.result-image {
+	float: right;
+	max-width: 120px;
+	max-height: 90px;
+	margin-left: 10px;
+}
 </style>
 	</head>
 	<body>
@@ -332,13 +1483,21 @@ li {
 		<p>
 			Found <b>{{len .Results}}</b> result{{if ne (len .Results) 1}}s{{end}} for <b>{{.Query}}</b>
 		</p>
+		{{else if .Message}}
+		<p>{{.Message}}</p>
+		{{else if .Results}}
+		<p>Recently updated pages</p>
+		{{end}}
 
+		{{if .Results}}
 		<ol>
 			{{range .Results}}
 			<li>
-				<div class="result-title"><a href="{{.Path}}">{{.Title}}</a></div>
+				{{if .Image}}<img class="result-image" src="{{.Image}}" alt="">{{end}}
+				<div class="result-title"><a href="{{.Link}}">{{.Title}}</a></div>
 				<div class="result-url">{{$.Req.Host}}{{.Path}}</div>
 				{{.Body}}
+				{{if .Alternates}}<div class="result-url">Also at: {{range $i, $alt := .Alternates}}{{if $i}}, {{end}}<a href="{{$alt}}">{{$alt}}</a>{{end}}</div>{{end}}
 			</li>
 			{{end}}
 		</ol>
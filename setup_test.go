@@ -1,6 +1,8 @@
 package search_test
 
 import (
+	"net/http"
+	"regexp"
 	"testing"
 	"time"
 
@@ -90,6 +92,836 @@ var (
 				So(expected.Expire, ShouldEqual, result.Expire)
 			},
 		},
+		{
+			`search {
+				title_suffix "|   My Site"
+			}`,
+			search.Config{
+				TitleSuffix: "| My Site",
+			},
+			"Should `search` support a normalized title suffix",
+			func(expected, result search.Config) {
+				So(expected.TitleSuffix, ShouldEqual, result.TitleSuffix)
+			},
+		},
+		{
+			`search {
+				token secret
+				push
+				push_max_size 4096
+			}`,
+			search.Config{
+				Token:        "secret",
+				PushEndpoint: "/search/push",
+				PushMaxSize:  4096,
+			},
+			"Should `search` support the push endpoint",
+			func(expected, result search.Config) {
+				So(expected.Token, ShouldEqual, result.Token)
+				So(expected.PushEndpoint, ShouldEqual, result.PushEndpoint)
+				So(expected.PushMaxSize, ShouldEqual, result.PushMaxSize)
+			},
+		},
+		{
+			`search {
+				split_identifiers
+			}`,
+			search.Config{
+				SplitIdentifiers: true,
+			},
+			"Should `search` support identifier splitting",
+			func(expected, result search.Config) {
+				So(expected.SplitIdentifiers, ShouldEqual, result.SplitIdentifiers)
+			},
+		},
+		{
+			`search {
+				search_rate 120r/m 5
+				search_rate_key X-Api-Key 10.0.0.1 192.168.0.0/16
+			}`,
+			search.Config{
+				SearchRate:    2,
+				SearchBurst:   5,
+				SearchRateKey: "X-Api-Key",
+			},
+			"Should `search` support rate limiting the search endpoint",
+			func(expected, result search.Config) {
+				So(expected.SearchRate, ShouldEqual, result.SearchRate)
+				So(expected.SearchBurst, ShouldEqual, result.SearchBurst)
+				So(expected.SearchRateKey, ShouldEqual, result.SearchRateKey)
+				So(result.SearchRateProxies, ShouldHaveLength, 2)
+				So(result.SearchRateProxies[0].String(), ShouldEqual, "10.0.0.1/32")
+				So(result.SearchRateProxies[1].String(), ShouldEqual, "192.168.0.0/16")
+			},
+		},
+		{
+			`search {
+				change_feed /changes.json 60
+			}`,
+			search.Config{
+				ChangeFeed:         "/changes.json",
+				ChangeFeedInterval: 60 * time.Second,
+			},
+			"Should `search` support polling a change feed",
+			func(expected, result search.Config) {
+				So(expected.ChangeFeed, ShouldEqual, result.ChangeFeed)
+				So(expected.ChangeFeedInterval, ShouldEqual, result.ChangeFeedInterval)
+			},
+		},
+		{
+			`search {
+				dedupe_titles
+			}`,
+			search.Config{
+				DedupeTitles: true,
+			},
+			"Should `search` support deduplicating results by title",
+			func(expected, result search.Config) {
+				So(expected.DedupeTitles, ShouldEqual, result.DedupeTitles)
+			},
+		},
+		{
+			`search {
+				health /healthz
+				health_min_docs 100
+			}`,
+			search.Config{
+				HealthEndpoint: "/healthz",
+				HealthMinDocs:  100,
+			},
+			"Should `search` support the health endpoint",
+			func(expected, result search.Config) {
+				So(expected.HealthEndpoint, ShouldEqual, result.HealthEndpoint)
+				So(expected.HealthMinDocs, ShouldEqual, result.HealthMinDocs)
+			},
+		},
+		{
+			`search {
+				analyzer standard
+			}`,
+			search.Config{
+				Analyzer: "standard",
+			},
+			"Should `search` support selecting a registered analyzer",
+			func(expected, result search.Config) {
+				So(expected.Analyzer, ShouldEqual, result.Analyzer)
+			},
+		},
+		{
+			`search {
+				language DE
+				detect_language
+			}`,
+			search.Config{
+				Language:       "de",
+				DetectLanguage: true,
+			},
+			"Should `search` support a default language and language detection",
+			func(expected, result search.Config) {
+				So(expected.Language, ShouldEqual, result.Language)
+				So(expected.DetectLanguage, ShouldEqual, result.DetectLanguage)
+			},
+		},
+		{
+			`search {
+				recency_boost 168h 2.5
+			}`,
+			search.Config{
+				RecencyHalfLife: 168 * time.Hour,
+				RecencyWeight:   2.5,
+			},
+			"Should `search` support boosting recently updated pages",
+			func(expected, result search.Config) {
+				So(expected.RecencyHalfLife, ShouldEqual, result.RecencyHalfLife)
+				So(expected.RecencyWeight, ShouldEqual, result.RecencyWeight)
+			},
+		},
+		{
+			`search {
+				content_selector "#content"
+			}`,
+			search.Config{
+				ContentSelector: "#content",
+			},
+			"Should `search` support scoping extraction to a container element",
+			func(expected, result search.Config) {
+				So(expected.ContentSelector, ShouldEqual, result.ContentSelector)
+			},
+		},
+		{
+			`search {
+				allowed_origins https://app.example.com/ https://admin.example.com
+			}`,
+			search.Config{
+				AllowedOrigins: []string{"https://app.example.com", "https://admin.example.com"},
+			},
+			"Should `search` support allowing cross-origin requests",
+			func(expected, result search.Config) {
+				So(expected.AllowedOrigins, ShouldResemble, result.AllowedOrigins)
+			},
+		},
+		{
+			`search {
+				snippet_strategy best_match
+			}`,
+			search.Config{
+				SnippetStrategy: "best_match",
+			},
+			"Should `search` support choosing the snippet strategy",
+			func(expected, result search.Config) {
+				So(expected.SnippetStrategy, ShouldEqual, result.SnippetStrategy)
+			},
+		},
+		{
+			`search {
+				depth_boost 0.5
+				boost /getting-started 2.0
+				boost /archive 0.5
+			}`,
+			search.Config{
+				DepthBoost: 0.5,
+				PathBoosts: []search.PathBoost{
+					{Prefix: "/getting-started", Factor: 2},
+					{Prefix: "/archive", Factor: 0.5},
+				},
+			},
+			"Should `search` support boosting pages by depth and path",
+			func(expected, result search.Config) {
+				So(expected.DepthBoost, ShouldEqual, result.DepthBoost)
+				So(expected.PathBoosts, ShouldResemble, result.PathBoosts)
+			},
+		},
+		{
+			`search {
+				soft_404_markers "Sorry, this article was removed" "Nothing here"
+			}`,
+			search.Config{
+				Soft404:        true,
+				Soft404Markers: []string{"Sorry, this article was removed", "Nothing here"},
+			},
+			"Should `search` support detecting soft 404 pages",
+			func(expected, result search.Config) {
+				So(expected.Soft404, ShouldEqual, result.Soft404)
+				So(expected.Soft404Markers, ShouldResemble, result.Soft404Markers)
+			},
+		},
+		{
+			`search {
+				pipeline_workers 2
+				pipeline_workers parse 8
+			}`,
+			search.Config{
+				PipelineWorkers: map[string]int{"read": 2, "validate": 2, "parse": 8, "index": 2},
+			},
+			"Should `search` support configuring the pipeline's workers",
+			func(expected, result search.Config) {
+				So(expected.PipelineWorkers, ShouldResemble, result.PipelineWorkers)
+			},
+		},
+		{
+			`search {
+				max_results 50
+			}`,
+			search.Config{
+				MaxResults: 50,
+			},
+			"Should `search` support capping the number of results",
+			func(expected, result search.Config) {
+				So(expected.MaxResults, ShouldEqual, result.MaxResults)
+			},
+		},
+		{
+			`search {
+				crawl_header Cookie "session=abc"
+				crawl_header Authorization "Bearer secret"
+			}`,
+			search.Config{
+				CrawlHeaders: http.Header{"Cookie": {"session=abc"}, "Authorization": {"Bearer secret"}},
+			},
+			"Should `search` support headers sent with crawl requests",
+			func(expected, result search.Config) {
+				So(expected.CrawlHeaders, ShouldResemble, result.CrawlHeaders)
+			},
+		},
+		{
+			`search {
+				token secret
+				analytics
+				analytics_log /var/log/search.log
+			}`,
+			search.Config{
+				AnalyticsEndpoint: "/search/analytics",
+				AnalyticsLog:      "/var/log/search.log",
+			},
+			"Should `search` support collecting query analytics",
+			func(expected, result search.Config) {
+				So(expected.AnalyticsEndpoint, ShouldEqual, result.AnalyticsEndpoint)
+				So(expected.AnalyticsLog, ShouldEqual, result.AnalyticsLog)
+			},
+		},
+		{
+			`search {
+				click_boost 168h 2
+			}`,
+			search.Config{
+				ClickEndpoint: "/search/click",
+				ClickHalfLife: 168 * time.Hour,
+				ClickWeight:   2,
+			},
+			"Should `search` support boosting clicked results",
+			func(expected, result search.Config) {
+				So(expected.ClickEndpoint, ShouldEqual, result.ClickEndpoint)
+				So(expected.ClickHalfLife, ShouldEqual, result.ClickHalfLife)
+				So(expected.ClickWeight, ShouldEqual, result.ClickWeight)
+			},
+		},
+		{
+			`search {
+				crawl_ignore_params sort filter
+				crawl_ignore_params utm_*
+			}`,
+			search.Config{
+				CrawlIgnoreParams: []string{"sort", "filter", "utm_*"},
+			},
+			"Should `search` support ignoring crawl query parameters",
+			func(expected, result search.Config) {
+				So(expected.CrawlIgnoreParams, ShouldResemble, result.CrawlIgnoreParams)
+			},
+		},
+		{
+			`search {
+				trigram_index 4
+			}`,
+			search.Config{
+				TrigramIndex:      true,
+				MinContainsLength: 4,
+			},
+			"Should `search` support the trigram index",
+			func(expected, result search.Config) {
+				So(expected.TrigramIndex, ShouldEqual, result.TrigramIndex)
+				So(expected.MinContainsLength, ShouldEqual, result.MinContainsLength)
+			},
+		},
+		{
+			`search {
+				empty_query_behavior recent 25
+			}`,
+			search.Config{
+				EmptyQueryBehavior: search.EmptyQueryRecent,
+				EmptyQueryResults:  25,
+			},
+			"Should `search` support browsing recent pages for empty queries",
+			func(expected, result search.Config) {
+				So(expected.EmptyQueryBehavior, ShouldEqual, result.EmptyQueryBehavior)
+				So(expected.EmptyQueryResults, ShouldEqual, result.EmptyQueryResults)
+			},
+		},
+		{
+			`search {
+				empty_query_behavior message "Type something to search"
+			}`,
+			search.Config{
+				EmptyQueryBehavior: search.EmptyQueryMessage,
+				EmptyQueryMessage:  "Type something to search",
+			},
+			"Should `search` support a message for empty queries",
+			func(expected, result search.Config) {
+				So(expected.EmptyQueryBehavior, ShouldEqual, result.EmptyQueryBehavior)
+				So(expected.EmptyQueryMessage, ShouldEqual, result.EmptyQueryMessage)
+			},
+		},
+		{
+			`search {
+				warm_queries "install plugin" theme
+			}`,
+			search.Config{WarmQueries: []string{"install plugin", "theme"}},
+			"Should `search` support queries to warm up",
+			func(expected, result search.Config) {
+				So(expected.WarmQueries, ShouldResemble, result.WarmQueries)
+			},
+		},
+		{
+			`search {
+				warm_queries file testdata/warm-queries.txt
+			}`,
+			search.Config{WarmQueries: []string{"install plugin", "theme"}},
+			"Should `search` read the queries to warm up from a file",
+			func(expected, result search.Config) {
+				So(expected.WarmQueries, ShouldResemble, result.WarmQueries)
+			},
+		},
+		{
+			`search {
+				min_prefix_match 4
+			}`,
+			search.Config{MinPrefixMatch: 4},
+			"Should `search` support matching terms by prefix",
+			func(expected, result search.Config) {
+				So(expected.MinPrefixMatch, ShouldEqual, result.MinPrefixMatch)
+			},
+		},
+		{
+			`search {
+				skip_variants
+			}`,
+			search.Config{SkipVariants: true},
+			"Should `search` support skipping AMP and print variants",
+			func(expected, result search.Config) {
+				So(expected.SkipVariants, ShouldEqual, result.SkipVariants)
+			},
+		},
+		{
+			`search {
+				token secret
+				change_feed /changes.json
+				crawl_state
+			}`,
+			search.Config{CrawlStateEndpoint: "/search/crawl"},
+			"Should `search` support the crawl state endpoint",
+			func(expected, result search.Config) {
+				So(expected.CrawlStateEndpoint, ShouldEqual, result.CrawlStateEndpoint)
+			},
+		},
+		{
+			`search {
+				language ja
+				segmenter JA standard
+			}`,
+			search.Config{Segmenters: map[string]string{"ja": "standard"}},
+			"Should `search` support replacing a language's analyzer with a registered one",
+			func(expected, result search.Config) {
+				So(expected.Segmenters, ShouldResemble, result.Segmenters)
+			},
+		},
+		{
+			`search {
+				token secret
+				push_bulk
+			}`,
+			search.Config{PushBulkEndpoint: "/search/push/bulk"},
+			"Should `search` support the bulk push endpoint",
+			func(expected, result search.Config) {
+				So(expected.PushBulkEndpoint, ShouldEqual, result.PushBulkEndpoint)
+			},
+		},
+		{
+			`search {
+				snippet_format plain
+			}`,
+			search.Config{SnippetFormat: search.SnippetFormatPlain},
+			"Should `search` support plain text snippets in JSON results",
+			func(expected, result search.Config) {
+				So(expected.SnippetFormat, ShouldEqual, result.SnippetFormat)
+			},
+		},
+		{
+			`search {
+				change_feed /changes.json
+				crawl off
+			}`,
+			search.Config{CrawlDisabled: true, ChangeFeed: "/changes.json"},
+			"Should `search` support turning the crawler off while keeping its settings",
+			func(expected, result search.Config) {
+				So(expected.CrawlDisabled, ShouldEqual, result.CrawlDisabled)
+				So(expected.ChangeFeed, ShouldEqual, result.ChangeFeed)
+			},
+		},
+		{
+			`search {
+				token secret
+				export /admin/search-index
+			}`,
+			search.Config{ExportEndpoint: "/admin/search-index"},
+			"Should `search` support exporting and importing the index",
+			func(expected, result search.Config) {
+				So(expected.ExportEndpoint, ShouldEqual, result.ExportEndpoint)
+			},
+		},
+		{
+			`search {
+				min_term_df 3
+			}`,
+			search.Config{MinTermDF: 3},
+			"Should `search` support pruning rare body terms",
+			func(expected, result search.Config) {
+				So(expected.MinTermDF, ShouldEqual, result.MinTermDF)
+			},
+		},
+		{
+			`search {
+				version_pattern ^/docs/(v\d+)/
+			}`,
+			search.Config{VersionPattern: regexp.MustCompile(`^/docs/(v\d+)/`)},
+			"Should `search` support deriving page versions from their path",
+			func(expected, result search.Config) {
+				So(result.VersionPattern, ShouldNotBeNil)
+				So(expected.VersionPattern.String(), ShouldEqual, result.VersionPattern.String())
+			},
+		},
+		{
+			`search {
+				seed_urls /docs/ /blog/
+				seed_urls https://example.com/api/
+			}`,
+			search.Config{SeedURLs: []string{"/docs/", "/blog/", "https://example.com/api/"}},
+			"Should `search` support seeding the crawl with entry-point URLs",
+			func(expected, result search.Config) {
+				So(expected.SeedURLs, ShouldResemble, result.SeedURLs)
+			},
+		},
+		{
+			`search {
+				max_concurrent_queries 8 250ms
+			}`,
+			search.Config{MaxConcurrentQueries: 8, QueryQueueTimeout: 250 * time.Millisecond},
+			"Should `search` support capping the queries run at once",
+			func(expected, result search.Config) {
+				So(expected.MaxConcurrentQueries, ShouldEqual, result.MaxConcurrentQueries)
+				So(expected.QueryQueueTimeout, ShouldEqual, result.QueryQueueTimeout)
+			},
+		},
+		{
+			`search {
+				comment_selector "#comments" .reply
+				comment_weight 0.1
+			}`,
+			search.Config{CommentSelectors: []string{"#comments", ".reply"}, CommentWeight: 0.1},
+			"Should `search` support indexing comments with a lower weight",
+			func(expected, result search.Config) {
+				So(expected.CommentSelectors, ShouldResemble, result.CommentSelectors)
+				So(expected.CommentWeight, ShouldEqual, result.CommentWeight)
+			},
+		},
+		{
+			`search {
+				index_body_prefix_words 200
+			}`,
+			search.Config{IndexBodyPrefixWords: 200},
+			"Should `search` support indexing only the start of bodies",
+			func(expected, result search.Config) {
+				So(expected.IndexBodyPrefixWords, ShouldEqual, result.IndexBodyPrefixWords)
+			},
+		},
+		{
+			`search {
+				score_expression "1 + 0.5 * title_match" - min(depth, 3) / 10
+			}`,
+			search.Config{},
+			"Should `search` support a score expression",
+			func(expected, result search.Config) {
+				So(result.ScoreExpression, ShouldNotBeNil)
+				So(result.ScoreExpression.String(), ShouldEqual, "1 + 0.5 * title_match - min(depth, 3) / 10")
+			},
+		},
+		{
+			`search {
+				excerpt_source frontmatter meta generated
+			}`,
+			search.Config{ExcerptSources: []string{"frontmatter", "meta", "generated"}},
+			"Should `search` support choosing where excerpts come from",
+			func(expected, result search.Config) {
+				So(expected.ExcerptSources, ShouldResemble, result.ExcerptSources)
+			},
+		},
+		{
+			`search {
+				trailing_slash strip
+			}`,
+			search.Config{TrailingSlash: search.TrailingSlashStrip},
+			"Should `search` support normalizing trailing slashes",
+			func(expected, result search.Config) {
+				So(expected.TrailingSlash, ShouldEqual, result.TrailingSlash)
+			},
+		},
+		{
+			`search {
+				matched_terms
+			}`,
+			search.Config{MatchedTerms: true},
+			"Should `search` support listing the matched terms of results",
+			func(expected, result search.Config) {
+				So(expected.MatchedTerms, ShouldEqual, result.MatchedTerms)
+			},
+		},
+		{
+			`search {
+				index_headers x-product Last-Modified
+			}`,
+			search.Config{IndexHeaders: []string{"X-Product", "Last-Modified"}},
+			"Should `search` support storing response headers as fields",
+			func(expected, result search.Config) {
+				So(result.IndexHeaders, ShouldResemble, expected.IndexHeaders)
+			},
+		},
+		{
+			`search {
+				diversify 3 /blog/ /docs/
+			}`,
+			search.Config{DiversifyRun: 3, DiversifyPrefixes: []string{"/blog/", "/docs/"}},
+			"Should `search` support diversifying the results by section",
+			func(expected, result search.Config) {
+				So(result.DiversifyRun, ShouldEqual, expected.DiversifyRun)
+				So(result.DiversifyPrefixes, ShouldResemble, expected.DiversifyPrefixes)
+			},
+		},
+		{
+			`search {
+				crawl_upstream http://app:8080/
+			}`,
+			search.Config{CrawlUpstream: "http://app:8080"},
+			"Should `search` support crawling the site from an upstream",
+			func(expected, result search.Config) {
+				So(result.CrawlUpstream, ShouldEqual, expected.CrawlUpstream)
+			},
+		},
+		{
+			`search {
+				exact_title_boost
+			}`,
+			search.Config{ExactTitleBoost: 100},
+			"Should `search` support boosting the pages titled as the query",
+			func(expected, result search.Config) {
+				So(result.ExactTitleBoost, ShouldEqual, expected.ExactTitleBoost)
+			},
+		},
+		{
+			`search {
+				template_fallback off
+			}`,
+			search.Config{TemplateFallbackDisabled: true},
+			"Should `search` support failing on template errors",
+			func(expected, result search.Config) {
+				So(result.TemplateFallbackDisabled, ShouldEqual, expected.TemplateFallbackDisabled)
+			},
+		},
+		{
+			`search {
+				distinct_titles breadcrumb
+			}`,
+			search.Config{DistinctTitles: search.DistinctTitleBreadcrumb},
+			"Should `search` support telling apart results with the same title",
+			func(expected, result search.Config) {
+				So(result.DistinctTitles, ShouldEqual, expected.DistinctTitles)
+			},
+		},
+		{
+			`search {
+				max_crawl_pages 500
+				max_crawl_duration 30m
+			}`,
+			search.Config{MaxCrawlPages: 500, MaxCrawlDuration: 30 * time.Minute},
+			"Should `search` support bounding each crawl cycle",
+			func(expected, result search.Config) {
+				So(result.MaxCrawlPages, ShouldEqual, expected.MaxCrawlPages)
+				So(result.MaxCrawlDuration, ShouldEqual, expected.MaxCrawlDuration)
+			},
+		},
+		{
+			`search {
+				instant_limits 8 3
+			}`,
+			search.Config{InstantSuggestions: 8, InstantResults: 3},
+			"Should `search` support limiting instant searches",
+			func(expected, result search.Config) {
+				So(result.InstantSuggestions, ShouldEqual, expected.InstantSuggestions)
+				So(result.InstantResults, ShouldEqual, expected.InstantResults)
+			},
+		},
+		{
+			`search {
+				crawl_only ^/blog/page/ ^/tags/
+			}`,
+			search.Config{CrawlOnlyPaths: search.ConvertToRegExp([]string{"^/blog/page/", "^/tags/"})},
+			"Should `search` support crawl-only listing pages",
+			func(expected, result search.Config) {
+				So(result.CrawlOnlyPaths, ShouldResemble, expected.CrawlOnlyPaths)
+			},
+		},
+		{
+			`search {
+				token secret
+				inspect /_inspect
+			}`,
+			search.Config{InspectEndpoint: "/_inspect"},
+			"Should `search` support the inspect endpoint",
+			func(expected, result search.Config) {
+				So(result.InspectEndpoint, ShouldEqual, expected.InspectEndpoint)
+			},
+		},
+		{
+			`search {
+				rebuild_on_start
+			}`,
+			search.Config{RebuildOnStart: true},
+			"Should `search` support rebuilding the index on start",
+			func(expected, result search.Config) {
+				So(result.RebuildOnStart, ShouldEqual, expected.RebuildOnStart)
+			},
+		},
+		{
+			`search {
+				result_url "https://cdn.example.com{{.Path}}?ref=search"
+			}`,
+			search.Config{},
+			"Should `search` support templating result links",
+			func(expected, result search.Config) {
+				So(result.ResultURL, ShouldNotBeNil)
+			},
+		},
+		{
+			`search {
+				index_tables
+			}`,
+			search.Config{IndexTables: true},
+			"Should `search` support indexing tables row by row",
+			func(expected, result search.Config) {
+				So(result.IndexTables, ShouldEqual, expected.IndexTables)
+			},
+		},
+		{
+			`search {
+				query_syntax literal
+			}`,
+			search.Config{QuerySyntax: search.QuerySyntaxLiteral},
+			"Should `search` support reading queries literally",
+			func(expected, result search.Config) {
+				So(result.QuerySyntax, ShouldEqual, expected.QuerySyntax)
+			},
+		},
+		{
+			`search {
+				max_query_terms 32 reject
+			}`,
+			search.Config{MaxQueryTerms: 32, MaxQueryTermsAction: search.QueryTermsReject},
+			"Should `search` support capping the terms of queries",
+			func(expected, result search.Config) {
+				So(result.MaxQueryTerms, ShouldEqual, expected.MaxQueryTerms)
+				So(result.MaxQueryTermsAction, ShouldEqual, expected.MaxQueryTermsAction)
+			},
+		},
+		{
+			`search {
+				admin_listen unix:/run/caddy/search.sock
+			}`,
+			search.Config{AdminListen: "unix:/run/caddy/search.sock"},
+			"Should `search` support a listener for the administrative endpoints",
+			func(expected, result search.Config) {
+				So(result.AdminListen, ShouldEqual, expected.AdminListen)
+			},
+		},
+		{
+			`search {
+				highlight_matches partial
+			}`,
+			search.Config{HighlightMatches: search.HighlightPartial},
+			"Should `search` support marking the matched part of words",
+			func(expected, result search.Config) {
+				So(result.HighlightMatches, ShouldEqual, expected.HighlightMatches)
+			},
+		},
+		{
+			`search {
+				deep_links
+			}`,
+			search.Config{DeepLinks: true},
+			"Should `search` support linking results to the section they match",
+			func(expected, result search.Config) {
+				So(result.DeepLinks, ShouldEqual, expected.DeepLinks)
+			},
+		},
+		{
+			`search {
+				incremental_sections
+			}`,
+			search.Config{IncrementalSections: true},
+			"Should `search` support analyzing only the changed sections of pages",
+			func(expected, result search.Config) {
+				So(result.IncrementalSections, ShouldEqual, expected.IncrementalSections)
+			},
+		},
+		{
+			`search {
+				position_decay 50
+			}`,
+			search.Config{PositionDecay: 50},
+			"Should `search` support weighing terms by their position",
+			func(expected, result search.Config) {
+				So(result.PositionDecay, ShouldEqual, expected.PositionDecay)
+			},
+		},
+		{
+			`search {
+				recent_searches 8 12h
+			}`,
+			search.Config{RecentSearches: 8, RecentSearchesHalfLife: 12 * time.Hour},
+			"Should `search` support suggesting the recent searches",
+			func(expected, result search.Config) {
+				So(result.RecentSearches, ShouldEqual, expected.RecentSearches)
+				So(result.RecentSearchesHalfLife, ShouldEqual, expected.RecentSearchesHalfLife)
+			},
+		},
+		{
+			`search {
+				skip_elements Cookie-Banner site-footer
+			}`,
+			search.Config{SkipElements: []string{"cookie-banner", "site-footer"}},
+			"Should `search` support leaving elements out of the body",
+			func(expected, result search.Config) {
+				So(result.SkipElements, ShouldResemble, expected.SkipElements)
+			},
+		},
+		{
+			`search {
+				crawl_ignore_params utm_*
+				dedupe_urls
+			}`,
+			search.Config{DedupeURLs: true},
+			"Should `search` support collapsing results differing by ignored parameters",
+			func(expected, result search.Config) {
+				So(result.DedupeURLs, ShouldEqual, expected.DedupeURLs)
+			},
+		},
+		{
+			`search {
+				engine bleve {
+					index_type scorch
+					snapshots 2
+				}
+				expire 30
+			}`,
+			search.Config{
+				Engine:        "bleve",
+				EngineOptions: map[string]string{"index_type": "scorch", "snapshots": "2"},
+				Expire:        30 * time.Second,
+			},
+			"Should `search` support a block of engine options",
+			func(expected, result search.Config) {
+				So(result.Engine, ShouldEqual, expected.Engine)
+				So(result.EngineOptions, ShouldResemble, expected.EngineOptions)
+				So(result.Expire, ShouldEqual, expected.Expire)
+			},
+		},
+		{
+			`search {
+				translations
+			}`,
+			search.Config{Translations: true},
+			"Should `search` support listing the translations of results",
+			func(expected, result search.Config) {
+				So(result.Translations, ShouldEqual, expected.Translations)
+			},
+		},
+		{
+			`search {
+				document_ttl 720h 30m
+			}`,
+			search.Config{DocumentTTL: 720 * time.Hour, DocumentTTLSweep: 30 * time.Minute},
+			"Should `search` support removing the documents not seen for a while",
+			func(expected, result search.Config) {
+				So(result.DocumentTTL, ShouldEqual, expected.DocumentTTL)
+				So(result.DocumentTTLSweep, ShouldEqual, expected.DocumentTTLSweep)
+			},
+		},
 	}
 )
 
@@ -108,3 +940,46 @@ func TestSearchSetup(t *testing.T) {
 		})
 	}
 }
+
+func TestSearchSetupErrors(t *testing.T) {
+	Convey("Given a search block with several mistakes", t, func() {
+		c := caddy.NewTestController(`search {
+			+path [unclosed
+			expire soon
+			snippet_strategy random
+			push
+			search_rate_key X-Api-Key
+			unknown_property
+		}`, "")
+		cnf := httpserver.GetConfig(c)
+		_, err := search.ParseSearchConfig(c, cnf)
+
+		Convey("Should report every error at once", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid path pattern `[unclosed`")
+			So(err.Error(), ShouldContainSubstring, "`expire` must be a positive number of seconds")
+			So(err.Error(), ShouldContainSubstring, "unknown snippet_strategy `random`")
+			So(err.Error(), ShouldContainSubstring, "`push` requires a `token`")
+			So(err.Error(), ShouldContainSubstring, "`search_rate_key` requires the proxies trusted to set it")
+			So(err.Error(), ShouldContainSubstring, "unknown property `unknown_property`")
+		})
+	})
+
+	Convey("Given an engine block with an unknown option", t, func() {
+		c := caddy.NewTestController(`search {
+			engine bleve {
+				shards 4
+			}
+			expire soon
+		}`, "")
+		cnf := httpserver.GetConfig(c)
+		_, err := search.ParseSearchConfig(c, cnf)
+
+		Convey("Should name the engine and still read the rest of the block", func() {
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "`engine bleve` option: unknown option `shards`")
+			So(err.Error(), ShouldContainSubstring, "`expire` must be a positive number of seconds")
+			So(err.Error(), ShouldNotContainSubstring, "unknown property")
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package search
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// ErrInvalidSince is returned by Search for a window it cannot parse
+var ErrInvalidSince = errors.New("search: invalid since")
+
+// sinceUnits are the units of the windows Go durations do not cover
+var sinceUnits = map[byte]time.Duration{
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// parseSince returns the start of a window of modification times: a
+// positive duration back from now, as a Go duration (36h) or a number of
+// days or weeks (7d, 2w), or a date in one of the indexer.SortLayouts. An empty window
+// returns the zero time.
+func parseSince(raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range indexer.SortLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+
+	var window time.Duration
+	if unit, ok := sinceUnits[raw[len(raw)-1]]; ok {
+		n, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		// windows too long to be held by a time.Duration are invalid too
+		if err != nil || n > math.MaxInt64/int64(unit) {
+			return time.Time{}, ErrInvalidSince
+		}
+		window = time.Duration(n) * unit
+	} else {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return time.Time{}, ErrInvalidSince
+		}
+		window = d
+	}
+	if window <= 0 {
+		return time.Time{}, ErrInvalidSince
+	}
+
+	return now.Add(-window), nil
+}
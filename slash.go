@@ -0,0 +1,45 @@
+package search
+
+import (
+	"path"
+	"strings"
+)
+
+// Policies for the trailing slash of indexed and displayed paths, set with
+// trailing_slash
+const (
+	// TrailingSlashKeep leaves paths as they were found
+	TrailingSlashKeep = "keep"
+	// TrailingSlashStrip removes the trailing slash of every path but the
+	// site root
+	TrailingSlashStrip = "strip"
+	// TrailingSlashAdd ends with a slash the paths whose last segment has no
+	// file extension
+	TrailingSlashAdd = "add"
+)
+
+// slashPath applies the trailing_slash policy to a site path, leaving its
+// query and fragment as they are
+func (c *Config) slashPath(raw string) string {
+	if c.TrailingSlash != TrailingSlashStrip && c.TrailingSlash != TrailingSlashAdd {
+		return raw
+	}
+
+	p, rest := raw, ""
+	if i := strings.IndexAny(raw, "?#"); i >= 0 {
+		p, rest = raw[:i], raw[i:]
+	}
+
+	switch c.TrailingSlash {
+	case TrailingSlashStrip:
+		if len(p) > 1 {
+			p = strings.TrimSuffix(p, "/")
+		}
+	case TrailingSlashAdd:
+		if !strings.HasSuffix(p, "/") && path.Ext(p) == "" {
+			p += "/"
+		}
+	}
+
+	return p + rest
+}
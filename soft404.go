@@ -0,0 +1,73 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// soft404MaxBody is the length, in bytes, under which a page whose title or
+// heading contains a not-found phrase is considered a soft 404
+const soft404MaxBody = 512
+
+// soft404Phrases are the phrases the titles and headings of short error pages
+// commonly contain
+var soft404Phrases = []string{
+	"404",
+	"not found",
+	"page does not exist",
+	"page doesn't exist",
+	"no longer available",
+	"could not be found",
+}
+
+// PipeCrawled pipes a record the crawler fetched from the site. Only such
+// records are checked for soft 404s: files and pushed documents never are.
+func (p *Pipeline) PipeCrawled(record indexer.Record) {
+	p.crawledMutex.Lock()
+	p.crawled[record.Path()]++
+	p.crawledMutex.Unlock()
+
+	p.Pipe(record)
+}
+
+// takeCrawled reports whether the record at path was piped by the crawler,
+// forgetting it
+func (p *Pipeline) takeCrawled(path string) bool {
+	p.crawledMutex.Lock()
+	defer p.crawledMutex.Unlock()
+
+	if p.crawled[path] == 0 {
+		return false
+	}
+	if p.crawled[path]--; p.crawled[path] == 0 {
+		delete(p.crawled, path)
+	}
+	return true
+}
+
+// isSoft404 reports whether a page served successfully is actually an error
+// page: either it contains one of the configured markers, or it is very
+// short and its title or heading contains a common not-found phrase
+func (p *Pipeline) isSoft404(record indexer.Record, heading string) bool {
+	body := strings.ToLower(string(record.Body()))
+	title := strings.ToLower(record.Title())
+
+	for _, marker := range p.config.Soft404Markers {
+		marker = strings.ToLower(marker)
+		if strings.Contains(title, marker) || strings.Contains(body, marker) {
+			return true
+		}
+	}
+
+	if len(body) < soft404MaxBody {
+		heading = strings.ToLower(heading)
+		for _, phrase := range soft404Phrases {
+			if strings.Contains(title, phrase) || strings.Contains(heading, phrase) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
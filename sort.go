@@ -0,0 +1,79 @@
+package search
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// ErrInvalidSort is returned by Search for a sort order it cannot apply
+var ErrInvalidSort = errors.New("search: invalid sort")
+
+// sortOrder orders the results by a custom field rather than by relevance.
+// The index finds the results with the top values of the field; sort orders
+// them again once ranking has adjusted their scores, which break ties.
+type sortOrder struct {
+	field      string
+	descending bool
+}
+
+// parseSort parses a sort order of the form field:name[:asc|desc], as in
+// field:price:desc, ascending by default. An empty order or "relevance"
+// keeps the results in relevance order and returns nil.
+func parseSort(raw string) (*sortOrder, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if raw == "" || raw == "relevance" {
+		return nil, nil
+	}
+
+	parts := strings.Split(raw, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "field" || !validFieldName(parts[1]) {
+		return nil, ErrInvalidSort
+	}
+
+	order := &sortOrder{field: parts[1]}
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "asc":
+		case "desc":
+			order.descending = true
+		default:
+			return nil, ErrInvalidSort
+		}
+	}
+	return order, nil
+}
+
+// sort orders the results by their value of the field, as indexer.SortKey
+// reads it. Results missing the field or holding another value follow the
+// sorted ones. Results with the same value, as pages of the same day are,
+// keep the order of their score and then of their path, so that pages of
+// results never shift.
+func (order *sortOrder) sort(results []Result) {
+	keys := make(map[string]float64, len(results))
+	for _, result := range results {
+		if key, ok := indexer.SortKey(result.Fields[order.field]); ok {
+			keys[result.Path] = key
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, aok := keys[results[i].Path]
+		b, bok := keys[results[j].Path]
+		switch {
+		case aok != bok:
+			return aok
+		case !aok || a == b:
+			if results[i].Score != results[j].Score {
+				return results[i].Score > results[j].Score
+			}
+			return results[i].Path < results[j].Path
+		case order.descending:
+			return a > b
+		default:
+			return a < b
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// tableCellSeparator separates the cells of a table row flattened by
+// index_tables
+const tableCellSeparator = "; "
+
+// flattenTables replaces every table of n's subtree with a paragraph per
+// row, the cells of a row separated by semicolons and each data cell
+// prefixed with the header of its column, as in "Voltage: 12 V; Current:
+// 2 A". A cell is then found with the name of its column, which is also
+// weighed once for every cell under it. Nested tables are flattened with
+// the cell holding them.
+func flattenTables(n *html.Node) {
+	tables := detachTables(n)
+	for _, table := range tables {
+		table.parent.InsertBefore(tableText(table.node), table.next)
+	}
+}
+
+// detachedTable is a table removed from the tree, with the position it is
+// put back at
+type detachedTable struct {
+	node   *html.Node
+	parent *html.Node
+	next   *html.Node
+}
+
+// detachTables removes the outermost tables of n's subtree from the tree
+func detachTables(n *html.Node) []detachedTable {
+	var found []detachedTable
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && c.DataAtom == atom.Table {
+			n.RemoveChild(c)
+			found = append(found, detachedTable{node: c, parent: n, next: next})
+		} else {
+			found = append(found, detachTables(c)...)
+		}
+		c = next
+	}
+	return found
+}
+
+// tableText returns a div holding the caption of a table and a paragraph
+// per row
+func tableText(table *html.Node) *html.Node {
+	div := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	paragraph := func(text string) {
+		if text == "" {
+			return
+		}
+		p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+		p.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+		div.AppendChild(p)
+	}
+
+	if caption := findElement(table, func(n *html.Node) bool { return n.DataAtom == atom.Caption }); caption != nil {
+		paragraph(cellText(caption))
+	}
+
+	var headers []string
+	for i, row := range tableRows(table) {
+		cells := rowCells(row)
+		if headers == nil && isHeaderRow(row, cells, i) {
+			headers = columns(cells)
+			paragraph(strings.Join(nonEmpty(headers), tableCellSeparator))
+			continue
+		}
+
+		var text []string
+		col := 0
+		for _, cell := range cells {
+			value := cellText(cell)
+			if value != "" {
+				if cell.DataAtom == atom.Td && col < len(headers) && headers[col] != "" {
+					value = headers[col] + ": " + value
+				}
+				text = append(text, value)
+			}
+			col += colspan(cell)
+		}
+		paragraph(strings.Join(text, tableCellSeparator))
+	}
+	return div
+}
+
+// tableRows returns the rows of a table, in its head, bodies and foot, but
+// not those of the tables nested in its cells
+func tableRows(table *html.Node) []*html.Node {
+	var rows []*html.Node
+	for c := table.FirstChild; c != nil; c = c.NextSibling {
+		switch c.DataAtom {
+		case atom.Tr:
+			rows = append(rows, c)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			for r := c.FirstChild; r != nil; r = r.NextSibling {
+				if r.DataAtom == atom.Tr {
+					rows = append(rows, r)
+				}
+			}
+		}
+	}
+	return rows
+}
+
+// rowCells returns the th and td cells of a row
+func rowCells(row *html.Node) []*html.Node {
+	var cells []*html.Node
+	for c := row.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.DataAtom == atom.Th || c.DataAtom == atom.Td) {
+			cells = append(cells, c)
+		}
+	}
+	return cells
+}
+
+// isHeaderRow reports whether a row names the columns of its table: a row
+// of the table's head, or a first row made of th cells only
+func isHeaderRow(row *html.Node, cells []*html.Node, index int) bool {
+	if len(cells) == 0 {
+		return false
+	}
+	if row.Parent != nil && row.Parent.DataAtom == atom.Thead {
+		return true
+	}
+	if index > 0 {
+		return false
+	}
+	for _, cell := range cells {
+		if cell.DataAtom != atom.Th {
+			return false
+		}
+	}
+	return true
+}
+
+// columns returns the header of every column of a header row, repeating the
+// text of a cell spanning several columns
+func columns(cells []*html.Node) []string {
+	var headers []string
+	for _, cell := range cells {
+		text := cellText(cell)
+		for i := colspan(cell); i > 0; i-- {
+			headers = append(headers, text)
+		}
+	}
+	return headers
+}
+
+// colspan returns the number of columns a cell spans, at least one
+func colspan(cell *html.Node) int {
+	for _, attr := range cell.Attr {
+		if attr.Key == "colspan" {
+			if n, err := strconv.Atoi(strings.TrimSpace(attr.Val)); err == nil && n > 1 {
+				return n
+			}
+		}
+	}
+	return 1
+}
+
+// cellText returns the text of a cell on a single line
+func cellText(cell *html.Node) string {
+	return strings.Join(strings.Fields(string(stripHTML(cell))), " ")
+}
+
+// nonEmpty returns the non-empty strings of values, in order, once for the
+// columns a header spans
+func nonEmpty(values []string) []string {
+	var kept []string
+	for i, value := range values {
+		if value != "" && (i == 0 || values[i-1] != value) {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"html/template"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	templateFuncsMutex sync.RWMutex
+	templateFuncs      = template.FuncMap{
+		"truncate":   truncateText,
+		"formatDate": formatDate,
+		"highlight":  highlightTerms,
+	}
+)
+
+// RegisterTemplateFunc makes a function available to the results template by
+// name. It must be called before the template is parsed, e.g. in a plugin's
+// init, and follows the rules of html/template's FuncMap. Registering a name
+// twice replaces the previous function.
+func RegisterTemplateFunc(name string, fn interface{}) {
+	templateFuncsMutex.Lock()
+	defer templateFuncsMutex.Unlock()
+	templateFuncs[name] = fn
+}
+
+// resultsTemplate returns an empty results template with the registered
+// functions
+func resultsTemplate(name string) *template.Template {
+	templateFuncsMutex.RLock()
+	defer templateFuncsMutex.RUnlock()
+	return template.New(name).Funcs(templateFuncs)
+}
+
+// truncateText cuts text to at most n characters, ending it with "…" when
+// anything was cut, as in {{.Title | truncate 60}}
+func truncateText(n int, text string) string {
+	runes := []rune(text)
+	if n < 0 || len(runes) <= n {
+		return text
+	}
+	return strings.TrimRightFunc(string(runes[:n]), unicode.IsSpace) + "…"
+}
+
+// formatDate formats t with a Go time layout, as in
+// {{.Modified | formatDate "Jan 2, 2006"}}. Unknown dates format as "".
+func formatDate(layout string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// highlightTerms escapes text and wraps the words it shares with the query in
+// <mark> elements, ignoring case, as in {{.Title | highlight $.Query}}.
+// Excluded (-) terms are not marked and field names (title:) are ignored.
+func highlightTerms(query, text string) template.HTML {
+	terms := map[string]bool{}
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		if i := strings.Index(field, ":"); i >= 0 {
+			field = field[i+1:]
+		}
+		for _, word := range strings.FieldsFunc(strings.ToLower(field), notWordRune) {
+			terms[word] = true
+		}
+	}
+
+	var buf strings.Builder
+	pos, start := 0, -1
+	for i, r := range text + " " {
+		switch {
+		case !notWordRune(r) && start < 0:
+			start = i
+		case notWordRune(r) && start >= 0:
+			if terms[strings.ToLower(text[start:i])] {
+				buf.WriteString(template.HTMLEscapeString(text[pos:start]))
+				buf.WriteString("<mark>")
+				buf.WriteString(template.HTMLEscapeString(text[start:i]))
+				buf.WriteString("</mark>")
+				pos = i
+			}
+			start = -1
+		}
+	}
+	buf.WriteString(template.HTMLEscapeString(text[pos:]))
+
+	return template.HTML(buf.String())
+}
+
+// notWordRune reports whether r separates the words of a text
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,78 @@
+package search_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	Convey("Given a results template using the helper functions", t, func() {
+		search.RegisterTemplateFunc("shout", strings.ToUpper)
+
+		c := caddy.NewTestController(`search {
+			template testdata/results.tmpl
+		}`, "")
+		config, err := search.ParseSearchConfig(c, httpserver.GetConfig(c))
+		So(err, ShouldBeNil)
+
+		s, cleanup := newTestSearch(config)
+		defer cleanup()
+		indexFixtureModified(s, "install.html", time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC))
+
+		Convey("Should render the results with them", func() {
+			req := httptest.NewRequest("GET", "/search?q=guide+%26+more", nil)
+			w := httptest.NewRecorder()
+			_, err := s.ServeHTTP(w, req)
+			So(err, ShouldBeNil)
+
+			So(w.Body.String(), ShouldContainSubstring, "<h2>Install <mark>Guide</mark></h2>")
+			So(w.Body.String(), ShouldContainSubstring, "<p>Install… 2024-03-09")
+			So(w.Body.String(), ShouldContainSubstring, `<a href="/search?q=guide&#43;%26&#43;more">GUIDE &amp; MORE</a>`)
+		})
+	})
+}
+
+func TestTemplateFallback(t *testing.T) {
+	Convey("Given a results template failing while rendering", t, func() {
+		render := func(block string) (int, string, error) {
+			c := caddy.NewTestController(block, "")
+			config, err := search.ParseSearchConfig(c, httpserver.GetConfig(c))
+			So(err, ShouldBeNil)
+
+			s, cleanup := newTestSearch(config)
+			defer cleanup()
+			indexFixture(s, "install.html")
+
+			w := httptest.NewRecorder()
+			status, err := s.ServeHTTP(w, httptest.NewRequest("GET", "/search?q=install", nil))
+			return status, w.Body.String(), err
+		}
+
+		Convey("Should render the results with the default template", func() {
+			status, body, err := render(`search {
+				template testdata/broken.tmpl
+			}`)
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, http.StatusOK)
+			So(body, ShouldContainSubstring, "Install Guide")
+			So(body, ShouldNotContainSubstring, "<h1>install</h1>")
+		})
+
+		Convey("Should fail when the fallback is off", func() {
+			status, _, err := render(`search {
+				template testdata/broken.tmpl
+				template_fallback off
+			}`)
+			So(err, ShouldNotBeNil)
+			So(status, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package search
+
+import (
+	"path"
+	"strings"
+)
+
+// Formats of the suffix telling apart results with the same title, set with
+// distinct_titles
+const (
+	// DistinctTitleDirectory appends the page's directory, as in
+	// "Documentation (api)"
+	DistinctTitleDirectory = "directory"
+	// DistinctTitleBreadcrumb appends the page's directories from the root,
+	// as in "Documentation (docs › api)"
+	DistinctTitleBreadcrumb = "breadcrumb"
+	// DistinctTitlePath appends the page's path, as in
+	// "Documentation (/docs/api/intro.html)"
+	DistinctTitlePath = "path"
+)
+
+// breadcrumbSeparator separates the directories of a breadcrumb suffix
+const breadcrumbSeparator = " › "
+
+// distinctTitles appends to the title of every result sharing it with
+// another a suffix derived from its path in the given format. Results whose
+// suffixed titles would still be the same get their path instead.
+func distinctTitles(results []Result, format string) {
+	groups := make(map[string][]int)
+	for i, result := range results {
+		key := titleKey(result.Title)
+		if key != "" {
+			groups[key] = append(groups[key], i)
+		}
+	}
+
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+
+		suffixes := make([]string, len(group))
+		seen := make(map[string]int, len(group))
+		for j, i := range group {
+			suffixes[j] = titleSuffix(results[i].Path, format)
+			seen[suffixes[j]]++
+		}
+		for j, i := range group {
+			suffix := suffixes[j]
+			if seen[suffix] > 1 {
+				suffix = titleSuffix(results[i].Path, DistinctTitlePath)
+			}
+			results[i].Title += " (" + suffix + ")"
+		}
+	}
+}
+
+// titleKey returns the normalized title results are compared by
+func titleKey(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(normalizeText(title)), " "))
+}
+
+// titleSuffix returns the suffix of a page's title in the given format. An
+// index page counts as its directory; pages at the root have the directory /.
+func titleSuffix(page, format string) string {
+	if format == DistinctTitlePath {
+		return page
+	}
+	if i := strings.IndexAny(page, "?#"); i >= 0 {
+		page = page[:i]
+	}
+
+	dir := path.Clean("/" + page)
+	if !strings.HasSuffix(page, "/") {
+		dir = path.Dir(dir)
+	}
+	dirs := strings.Split(strings.Trim(dir, "/"), "/")
+	if dirs[0] == "" {
+		return "/"
+	}
+
+	if format == DistinctTitleBreadcrumb {
+		return strings.Join(dirs, breadcrumbSeparator)
+	}
+	return dirs[len(dirs)-1]
+}
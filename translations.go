@@ -0,0 +1,82 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlTranslations returns the URLs of the translations a page links to with
+// `<link rel="alternate" hreflang="de" href="...">`, by language in
+// lowercase. The x-default alternate names no language and is left out.
+func htmlTranslations(doc *html.Node) map[string]string {
+	var translations map[string]string
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Link && hasToken(attr(n, "rel"), "alternate") {
+			language := strings.ToLower(strings.TrimSpace(attr(n, "hreflang")))
+			if language != "" && language != "x-default" && strings.TrimSpace(attr(n, "href")) != "" {
+				if translations == nil {
+					translations = make(map[string]string)
+				}
+				translations[language] = attr(n, "href")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return translations
+}
+
+// translations returns the site paths of the translations of a page, by
+// language. Translations on other sites and the page itself are left out.
+func (p *Pipeline) translations(record indexer.Record, doc *html.Node) map[string]string {
+	base := htmlBase(record.Path(), doc)
+
+	var paths map[string]string
+	for language, href := range htmlTranslations(doc) {
+		path, ok := p.variantPath(base, href)
+		if !ok || path == record.Path() {
+			continue
+		}
+		if paths == nil {
+			paths = make(map[string]string)
+		}
+		paths[language] = p.config.slashPath(path)
+	}
+	return paths
+}
+
+// indexedTranslations leaves out of the translations of every result those
+// that are not indexed, following the pages that moved
+func (s *Search) indexedTranslations(results []Result) {
+	for i := range results {
+		var indexed map[string]string
+		for language, path := range results[i].Translations {
+			if to, ok := s.Pipeline.Redirected(path); ok {
+				path = s.Config.slashPath(to)
+			}
+			if path == results[i].Path || !s.indexed(path) {
+				continue
+			}
+			if indexed == nil {
+				indexed = make(map[string]string)
+			}
+			indexed[language] = path
+		}
+		results[i].Translations = indexed
+	}
+}
+
+// indexed reports whether the index holds the page at path
+func (s *Search) indexed(path string) bool {
+	record := s.Indexer.Record(path)
+	defer s.Indexer.Kill(record)
+	return record.Load()
+}
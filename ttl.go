@@ -0,0 +1,98 @@
+package search
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+// defaultSweepInterval is how often the documents past the document_ttl are
+// looked for unless set
+const defaultSweepInterval = time.Hour
+
+// confirmations records when each page was last seen to exist: fetched by
+// the crawler, found by the scan of the site's files, served to a visitor,
+// pushed, or listed unchanged by the change feed
+type confirmations struct {
+	mutex   sync.Mutex
+	started time.Time
+	seen    map[string]time.Time
+}
+
+// newConfirmations creates confirmations counting pages as seen when the
+// server started
+func newConfirmations() *confirmations {
+	return &confirmations{started: time.Now(), seen: make(map[string]time.Time)}
+}
+
+// Confirm records that the page at path exists, when documents expire
+func (p *Pipeline) Confirm(path string) {
+	if p.config.DocumentTTL <= 0 {
+		return
+	}
+
+	p.confirmed.mutex.Lock()
+	defer p.confirmed.mutex.Unlock()
+	p.confirmed.seen[path] = time.Now()
+}
+
+// lastSeen returns when a record was last seen to exist: when it was last
+// indexed or confirmed, and at least when the server started, so that no
+// page expires before a crawl had the time to confirm it
+func (p *Pipeline) lastSeen(record indexer.Record) time.Time {
+	p.confirmed.mutex.Lock()
+	defer p.confirmed.mutex.Unlock()
+
+	last := p.confirmed.started
+	if seen, ok := p.confirmed.seen[record.Path()]; ok && seen.After(last) {
+		last = seen
+	}
+	if indexed := record.Indexed(); indexed.After(last) {
+		last = indexed
+	}
+	return last
+}
+
+// Sweep removes from the index the documents not seen for longer than the
+// document_ttl, as of now, and returns their number
+func (p *Pipeline) Sweep(now time.Time) (int, error) {
+	var stale []string
+	err := p.indexer.Walk(func(record indexer.Record) error {
+		if now.Sub(p.lastSeen(record)) > p.config.DocumentTTL {
+			stale = append(stale, record.Path())
+		}
+		return nil
+	})
+
+	for _, path := range stale {
+		p.indexer.Delete(path)
+		p.confirmed.mutex.Lock()
+		delete(p.confirmed.seen, path)
+		p.confirmed.mutex.Unlock()
+	}
+	return len(stale), err
+}
+
+// SweepEvery sweeps the expired documents forever at the given interval
+func (p *Pipeline) SweepEvery(interval time.Duration) {
+	tick := time.NewTicker(interval)
+	for range tick.C {
+		removed, err := p.Sweep(time.Now())
+		if err != nil {
+			log.Printf("[search] sweeping expired documents: %v", err)
+		}
+		if removed > 0 {
+			log.Printf("[search] removed %d documents not seen for %s", removed, p.config.DocumentTTL)
+		}
+	}
+}
+
+// sweepInterval returns how often the expired documents are looked for
+func (c *Config) sweepInterval() time.Duration {
+	if c.DocumentTTLSweep > 0 {
+		return c.DocumentTTLSweep
+	}
+	return defaultSweepInterval
+}
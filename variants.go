@@ -0,0 +1,110 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/pedronasser/caddy-search/indexer"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlVariants returns the URLs of the alternate renderings a page links to:
+// its AMP version (`<link rel="amphtml">`) and its print version (`<link
+// rel="alternate" media="print">`)
+func htmlVariants(doc *html.Node) []string {
+	var variants []string
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Link && attr(n, "href") != "" {
+			rel := attr(n, "rel")
+			if hasToken(rel, "amphtml") || hasToken(rel, "alternate") && hasToken(attr(n, "media"), "print") {
+				variants = append(variants, attr(n, "href"))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return variants
+}
+
+// htmlCanonical returns the URL of the page's rel=canonical link
+func htmlCanonical(doc *html.Node) string {
+	link := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Link && hasToken(attr(n, "rel"), "canonical") && attr(n, "href") != ""
+	})
+	if link == nil {
+		return ""
+	}
+	return attr(link, "href")
+}
+
+// isAMP reports whether the page is an AMP document, marked by an `amp` or
+// `⚡` attribute on its html element
+func isAMP(doc *html.Node) bool {
+	root := findElement(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Html
+	})
+	if root == nil {
+		return false
+	}
+	for _, a := range root.Attr {
+		if a.Key == "amp" || a.Key == "⚡" {
+			return true
+		}
+	}
+	return false
+}
+
+// skipVariants records the variants the page links to, so they are neither
+// crawled nor indexed, and drops any that were indexed already. It reports
+// whether the page is itself the AMP variant of another page.
+func (p *Pipeline) skipVariants(record indexer.Record, doc *html.Node) bool {
+	base := htmlBase(record.Path(), doc)
+	for _, href := range htmlVariants(doc) {
+		if variant, ok := p.variantPath(base, href); ok && variant != record.Path() {
+			p.markVariant(variant)
+			p.indexer.Delete(variant)
+		}
+	}
+
+	if !isAMP(doc) {
+		return false
+	}
+	canonical, ok := p.variantPath(base, htmlCanonical(doc))
+	if !ok || canonical == record.Path() {
+		return false
+	}
+	p.markVariant(record.Path())
+	return true
+}
+
+// variantPath returns the site path of a URL a page links to, given the URL
+// its links resolve against
+func (p *Pipeline) variantPath(base, href string) (string, bool) {
+	if strings.TrimSpace(href) == "" {
+		return "", false
+	}
+	return p.config.sitePath(resolveURL(base, href))
+}
+
+// markVariant records that the page at path is a variant of another page
+func (p *Pipeline) markVariant(path string) {
+	p.variantsMutex.Lock()
+	defer p.variantsMutex.Unlock()
+	p.variants[path] = true
+}
+
+// IsVariant reports whether the page at path is a known variant (AMP or
+// print) of another page, when variants are skipped
+func (p *Pipeline) IsVariant(path string) bool {
+	if !p.config.SkipVariants {
+		return false
+	}
+	p.variantsMutex.RLock()
+	defer p.variantsMutex.RUnlock()
+	return p.variants[path]
+}
@@ -0,0 +1,57 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSkipVariants(t *testing.T) {
+	Convey("Given a site with AMP and print variants of a page", t, func() {
+		Convey("Should not index an AMP page pointing at its canonical", func() {
+			s, cleanup := newTestSearch(&search.Config{SkipVariants: true})
+			defer cleanup()
+
+			indexFixture(s, "variants/amp/guide.html")
+			So(searchJSON(s, "theme"), ShouldBeEmpty)
+			So(s.Pipeline.IsVariant("/variants/amp/guide.html"), ShouldBeTrue)
+		})
+
+		Convey("Should skip the variants a canonical page links to", func() {
+			s, cleanup := newTestSearch(&search.Config{SkipVariants: true})
+			defer cleanup()
+
+			indexFixture(s, "variants/guide-print.html")
+			So(searchJSON(s, "theme"), ShouldHaveLength, 1)
+
+			indexFixture(s, "variants/guide.html")
+			results := searchJSON(s, "theme")
+			So(results, ShouldHaveLength, 1)
+			So(results[0].Path, ShouldEqual, "/variants/guide.html")
+
+			So(s.Pipeline.ValidatePath("/variants/guide-print.html"), ShouldBeFalse)
+			So(s.Pipeline.ValidatePath("/variants/amp/guide.html"), ShouldBeFalse)
+			So(s.Pipeline.ValidatePath("/variants/guide.html"), ShouldBeTrue)
+		})
+
+		Convey("Should resolve the variant links against the page's base href", func() {
+			s, cleanup := newTestSearch(&search.Config{SkipVariants: true})
+			defer cleanup()
+
+			indexFixture(s, "variants/base/guide.html")
+			So(s.Pipeline.IsVariant("/docs/amp/plugins.html"), ShouldBeTrue)
+			So(s.Pipeline.IsVariant("/variants/base/amp/plugins.html"), ShouldBeFalse)
+		})
+
+		Convey("Should index variants unless told to skip them", func() {
+			s, cleanup := newTestSearch(&search.Config{})
+			defer cleanup()
+
+			indexFixture(s, "variants/guide.html")
+			indexFixture(s, "variants/amp/guide.html")
+			So(searchJSON(s, "theme"), ShouldHaveLength, 2)
+			So(s.Pipeline.ValidatePath("/variants/amp/guide.html"), ShouldBeTrue)
+		})
+	})
+}
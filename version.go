@@ -0,0 +1,118 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pedronasser/caddy-search/indexer"
+)
+
+const (
+	// versionField is the custom field holding the version of a page
+	versionField = "version"
+	// latestVersion names the newest version in the version parameter
+	latestVersion = "latest"
+)
+
+// setVersion stores the version label version_pattern finds in the record's
+// path in its version field, unless the page declares one
+func (p *Pipeline) setVersion(record indexer.Record) {
+	if p.config.VersionPattern == nil {
+		return
+	}
+
+	fields := record.Fields()
+	if _, ok := fields[versionField]; ok {
+		return
+	}
+
+	match := p.config.VersionPattern.FindStringSubmatch(record.Path())
+	if match == nil {
+		return
+	}
+	label := match[0]
+	if len(match) > 1 {
+		label = match[1]
+	}
+	if label == "" {
+		return
+	}
+
+	if fields == nil {
+		fields = make(map[string]string)
+	}
+	fields[versionField] = label
+	record.SetFields(fields)
+}
+
+// resolveVersion returns the version a version parameter selects: the
+// newest indexed one for "latest", the label itself otherwise. It returns ""
+// when no version is selected.
+func (s *Search) resolveVersion(label string) string {
+	label = strings.TrimSpace(label)
+	if !strings.EqualFold(label, latestVersion) {
+		return label
+	}
+	return newestVersion(s.Indexer.FieldValues(versionField))
+}
+
+// newestVersion returns the newest of the version labels, comparing the
+// numbers they contain by value so v10 is newer than v9
+func newestVersion(labels []string) string {
+	newest := ""
+	for _, label := range labels {
+		if newest == "" || compareVersions(label, newest) > 0 {
+			newest = label
+		}
+	}
+	return newest
+}
+
+// compareVersions compares two version labels run by run of digits and
+// non-digits, the runs of digits by value, and returns -1, 0 or 1
+func compareVersions(a, b string) int {
+	ra, rb := versionRuns(a), versionRuns(b)
+	for i := 0; i < len(ra) && i < len(rb); i++ {
+		na, errA := strconv.Atoi(ra[i])
+		nb, errB := strconv.Atoi(rb[i])
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && ra[i] != rb[i]:
+			if ra[i] < rb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case len(ra) < len(rb):
+		return -1
+	case len(ra) > len(rb):
+		return 1
+	}
+	return 0
+}
+
+// versionRuns splits a version label into runs of digits and of other
+// characters, as "v1.10" into "v", "1", ".", "10"
+func versionRuns(label string) []string {
+	runs := []string{}
+	start, prevDigit := 0, false
+	for i, r := range label {
+		digit := r >= '0' && r <= '9'
+		if i > 0 && digit != prevDigit {
+			runs = append(runs, label[start:i])
+			start = i
+		}
+		prevDigit = digit
+	}
+	if start < len(label) {
+		runs = append(runs, label[start:])
+	}
+	return runs
+}
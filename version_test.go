@@ -0,0 +1,55 @@
+package search_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVersions(t *testing.T) {
+	Convey("Given versioned docs and a version_pattern", t, func() {
+		s, cleanup := newTestSearch(&search.Config{VersionPattern: regexp.MustCompile(`^/docs/(v\d+)/`)})
+		defer cleanup()
+		indexFixture(s, "docs/v2/install.html")
+		indexFixture(s, "docs/v10/install.html")
+		indexFixture(s, "install.html")
+
+		find := func(version string) []string {
+			paths := []string{}
+			for _, result := range searchJSONParams(s, url.Values{"q": {"install"}, "version": {version}}) {
+				paths = append(paths, result.Path)
+			}
+			return paths
+		}
+
+		Convey("Should tag each page with the version in its path", func() {
+			rec := s.Indexer.Record("/docs/v2/install.html")
+			So(rec.Load(), ShouldBeTrue)
+			So(rec.Fields()["version"], ShouldEqual, "v2")
+		})
+
+		Convey("Should restrict the results to the selected version", func() {
+			So(find("v2"), ShouldResemble, []string{"/docs/v2/install.html"})
+			So(find("V10"), ShouldResemble, []string{"/docs/v10/install.html"})
+			So(find("v3"), ShouldBeEmpty)
+		})
+
+		Convey("Should resolve latest to the newest version", func() {
+			So(find("latest"), ShouldResemble, []string{"/docs/v10/install.html"})
+
+			req := httptest.NewRequest("HEAD", "/search?q=install&version=latest", nil)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			So(w.Header().Get("X-Search-Version"), ShouldEqual, "v10")
+			So(w.Header().Get("X-Total-Results"), ShouldEqual, "1")
+		})
+
+		Convey("Should search every version without one", func() {
+			So(find(""), ShouldHaveLength, 3)
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// warmPollInterval is how often the warmup checks whether the index is ready
+const warmPollInterval = time.Second
+
+// readListFile reads a list such as the queries to warm up from a file, one
+// item per line. Blank lines and lines starting with # are skipped.
+func readListFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	items := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	return items, scanner.Err()
+}
+
+// Warm waits until the index is ready, as the health endpoint reports it, and
+// then runs each query through the query path once so the first searches
+// after a start do not pay for loading the index. The searches are not
+// counted in the analytics. It returns the number of queries run.
+func (s *Search) Warm(queries []string) int {
+	for !s.indexReady() {
+		time.Sleep(warmPollInterval)
+	}
+
+	start, warmed := time.Now(), 0
+	for _, query := range queries {
+		if _, err := s.Search(query, SearchOptions{}); err == nil {
+			warmed++
+		}
+	}
+
+	log.Printf("[search] warmed up %d queries in %v", warmed, time.Since(start))
+	return warmed
+}
@@ -0,0 +1,27 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/pedronasser/caddy-search"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWarm(t *testing.T) {
+	Convey("Given a ready index", t, func() {
+		s, cleanup := newTestSearch(&search.Config{})
+		defer cleanup()
+		s.Analytics = search.NewAnalytics(nil)
+		indexFixture(s, "install.html")
+		s.Pipeline.MarkScanned()
+
+		Convey("Should run the queries that have terms", func() {
+			So(s.Warm([]string{"install", "theme", "  "}), ShouldEqual, 2)
+		})
+
+		Convey("Should not count the warmup in the analytics", func() {
+			s.Warm([]string{"install"})
+			So(s.Analytics.Summary(10).Queries, ShouldEqual, 0)
+		})
+	})
+}